@@ -0,0 +1,153 @@
+package boomer
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// adaptiveInitialRPS is the RPS limit which AdaptiveLoad starts from by default.
+	adaptiveInitialRPS = 10
+	// adaptiveBackoff is what the RPS limit is multiplied by when the p99 exceeds the target by default.
+	adaptiveBackoff = 0.5
+	// adaptiveSaturation is the ratio of the RPS limit which the requests must reach for the limit to be raised,
+	// raising it is pointless if the users can't even reach it.
+	adaptiveSaturation = 0.9
+)
+
+// AdaptiveLoad finds the capacity of the target, the max RPS which keeps the p99 response time under TargetP99,
+// in a single run. The RPS limit is adjusted every report interval by AIMD, it's raised by Step while the p99 is
+// under the target, and multiplied by Backoff once it exceeds the target, so the limit saw-tooths around the capacity.
+// The users must be enough to reach the limit, the limit isn't raised while the requests can't reach it.
+type AdaptiveLoad struct {
+	// TargetP99 is the target of the 99th percentile response time, in milliseconds.
+	TargetP99 int64
+	// InitialRPS is the RPS limit to start from. Defaults to 10.
+	InitialRPS int64
+	// MaxRPS caps the RPS limit, 0 means no cap.
+	MaxRPS int64
+	// Step is how much the RPS limit is raised by every interval. Defaults to InitialRPS.
+	Step int64
+	// Backoff is what the RPS limit is multiplied by when the p99 exceeds the target, between 0 and 1. Defaults to 0.5.
+	Backoff float64
+}
+
+func (a AdaptiveLoad) valid() bool {
+	return a.TargetP99 > 0 && a.InitialRPS >= 0 && a.MaxRPS >= 0 && a.Step >= 0 && a.Backoff >= 0 && a.Backoff < 1 &&
+		(a.MaxRPS == 0 || a.MaxRPS >= a.InitialRPS)
+}
+
+func (a AdaptiveLoad) withDefaults() AdaptiveLoad {
+	if a.InitialRPS == 0 {
+		a.InitialRPS = adaptiveInitialRPS
+		if a.MaxRPS > 0 && a.MaxRPS < a.InitialRPS {
+			a.InitialRPS = a.MaxRPS
+		}
+	}
+	if a.Step == 0 {
+		a.Step = a.InitialRPS
+	}
+	if a.Backoff == 0 {
+		a.Backoff = adaptiveBackoff
+	}
+	return a
+}
+
+// adaptiveLoadOutput adjusts the RPS limit of limiter by the p99 response time of every interval,
+// and keeps the highest RPS whose p99 is under the target as the capacity.
+type adaptiveLoadOutput struct {
+	load     AdaptiveLoad
+	limiter  *StableRateLimiter
+	interval time.Duration
+
+	lock     sync.Mutex
+	limit    int64
+	capacity float64
+}
+
+func newAdaptiveLoadOutput(load AdaptiveLoad, limiter *StableRateLimiter, interval time.Duration) *adaptiveLoadOutput {
+	load = load.withDefaults()
+	return &adaptiveLoadOutput{
+		load:     load,
+		limiter:  limiter,
+		interval: interval,
+		limit:    load.InitialRPS,
+	}
+}
+
+// OnStart starts over from the initial RPS limit, so every test finds the capacity by itself.
+func (o *adaptiveLoadOutput) OnStart() {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	o.limit = o.load.InitialRPS
+	o.capacity = 0
+	o.limiter.SetThreshold(o.limit)
+}
+
+// OnEvent adjusts the RPS limit by the p99 response time of the interval, the warm-up intervals are skipped.
+func (o *adaptiveLoadOutput) OnEvent(data map[string]interface{}) {
+	if warmup, _ := data["warmup"].(bool); warmup {
+		return
+	}
+	total, ok := data["stats_total"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	numRequests := toInt64(total["num_requests"])
+	if numRequests == 0 {
+		return
+	}
+	percentiles, _ := total["response_time_percentiles"].(map[float64]int64)
+	p99, ok := percentiles[0.99]
+	if !ok {
+		p99 = getPercentileResponseTime(numRequests, toInt64Map(total["response_times"]), 0.99)
+	}
+	rps := float64(numRequests) / o.interval.Seconds()
+	o.adjust(p99, rps)
+}
+
+// OnStop logs the capacity found.
+func (o *adaptiveLoadOutput) OnStop() {
+	if capacity := o.getCapacity(); capacity > 0 {
+		logInfo("The capacity is %.2f RPS with the p99 response time under %dms", capacity, o.load.TargetP99)
+	} else {
+		logError("The capacity isn't found, the p99 response time never stays under %dms", o.load.TargetP99)
+	}
+}
+
+// adjust raises or backs off the RPS limit by the p99 response time and the RPS of an interval.
+func (o *adaptiveLoadOutput) adjust(p99 int64, rps float64) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	limit := o.limit
+	if p99 <= o.load.TargetP99 {
+		if rps > o.capacity {
+			o.capacity = rps
+		}
+		if rps >= float64(o.limit)*adaptiveSaturation {
+			limit += o.load.Step
+			if o.load.MaxRPS > 0 && limit > o.load.MaxRPS {
+				limit = o.load.MaxRPS
+			}
+		}
+	} else {
+		limit = int64(float64(o.limit) * o.load.Backoff)
+		if limit < 1 {
+			limit = 1
+		}
+	}
+	if limit == o.limit {
+		return
+	}
+	logInfo("The p99 response time is %dms at %.2f RPS, the RPS limit is adjusted from %d to %d", p99, rps, o.limit, limit)
+	o.limit = limit
+	o.limiter.SetThreshold(limit)
+}
+
+func (o *adaptiveLoadOutput) getCapacity() float64 {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.capacity
+}
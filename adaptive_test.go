@@ -0,0 +1,87 @@
+package boomer
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveLoadValid(t *testing.T) {
+	if !(AdaptiveLoad{TargetP99: 300}).valid() {
+		t.Error("The adaptive load should be valid")
+	}
+	for _, load := range []AdaptiveLoad{
+		{},
+		{TargetP99: 300, Backoff: 1},
+		{TargetP99: 300, InitialRPS: 100, MaxRPS: 50},
+		{TargetP99: 300, Step: -1},
+	} {
+		if load.valid() {
+			t.Error("The adaptive load should be invalid", load)
+		}
+	}
+
+	load := AdaptiveLoad{TargetP99: 300, MaxRPS: 5}.withDefaults()
+	if load.InitialRPS != 5 || load.Step != 5 || load.Backoff != 0.5 {
+		t.Error("The defaults are wrong, got", load)
+	}
+}
+
+func TestAdaptiveLoadAIMD(t *testing.T) {
+	limiter := NewStableRateLimiter(1, time.Second)
+	o := newAdaptiveLoadOutput(AdaptiveLoad{TargetP99: 300, InitialRPS: 100, MaxRPS: 250, Step: 100}, limiter, time.Second)
+	o.OnStart()
+	if atomic.LoadInt64(&limiter.threshold) != 100 {
+		t.Fatal("The limit should start from the initial RPS, got", limiter.threshold)
+	}
+
+	o.adjust(100, 95)
+	o.adjust(100, 198)
+	if o.limit != 250 {
+		t.Error("The limit should be raised by the step and capped by the max RPS, got", o.limit)
+	}
+	o.adjust(100, 100)
+	if o.limit != 250 {
+		t.Error("The limit shouldn't be raised if the requests can't reach it, got", o.limit)
+	}
+	o.adjust(500, 240)
+	if o.limit != 125 || atomic.LoadInt64(&limiter.threshold) != 125 {
+		t.Error("The limit should be backed off, got", o.limit, limiter.threshold)
+	}
+	if o.getCapacity() != 198 {
+		t.Error("The capacity should be the highest RPS under the target, got", o.getCapacity())
+	}
+
+	o.OnStart()
+	if o.limit != 100 || o.getCapacity() != 0 {
+		t.Error("The limit and the capacity should be reset, got", o.limit, o.getCapacity())
+	}
+}
+
+func TestAdaptiveLoadOnEvent(t *testing.T) {
+	limiter := NewStableRateLimiter(1, time.Second)
+	o := newAdaptiveLoadOutput(AdaptiveLoad{TargetP99: 300, InitialRPS: 2}, limiter, time.Second)
+	o.OnStart()
+
+	collector := NewStatsCollector()
+	collector.RecordSuccess("http", "foo", 100, 10)
+	collector.RecordSuccess("http", "foo", 200, 10)
+	o.OnEvent(collector.Report())
+	if o.limit != 4 || o.getCapacity() != 2 {
+		t.Error("The limit should be raised, got", o.limit, o.getCapacity())
+	}
+
+	collector.RecordSuccess("http", "foo", 500, 10)
+	data := collector.Report()
+	data["warmup"] = true
+	o.OnEvent(data)
+	if o.limit != 4 {
+		t.Error("The warm-up intervals should be skipped, got", o.limit)
+	}
+
+	collector.RecordSuccess("http", "foo", 500, 10)
+	o.OnEvent(collector.Report())
+	if o.limit != 2 {
+		t.Error("The limit should be backed off, got", o.limit)
+	}
+}
@@ -1,11 +1,15 @@
 package boomer
 
 import (
+	"context"
+	"crypto/tls"
 	"flag"
-	"log"
+	"fmt"
+	"math"
 	"os"
 	"os/signal"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -27,18 +31,56 @@ const (
 	StandaloneMode
 )
 
+// AggregationMode decides how the requests are grouped into stats entries, both ByName and ByType are supported.
+type AggregationMode int
+
+const (
+	// ByName groups the requests by name and request type, like locust does.
+	ByName AggregationMode = iota
+	// ByType groups the requests by request type only, e.g. "GET", the names are discarded.
+	ByType
+)
+
 // A Boomer is used to run tasks.
 // This type is exposed, so users can create and control a Boomer instance programmatically.
 type Boomer struct {
 	masterHost  string
 	masterPort  int
+	clientID    string
+	security    clientSecurity
+	backend     string
 	mode        Mode
 	rateLimiter RateLimiter
 	slaveRunner *slaveRunner
 
+	tags        []string
+	excludeTags []string
+
 	localRunner *localRunner
 	spawnCount  int
 	spawnRate   float64
+	stages      []loadStage
+	runTime     time.Duration
+	startAt     time.Time
+	runID       string
+	runLabels   map[string]string
+
+	hatchStrategy HatchStrategy
+
+	iterationLimit int64
+	arrivalRate    float64
+	interArrival   InterArrival
+
+	maxWorkers  int
+	maxMemoryMB int
+
+	expectedWorkers int
+
+	statsReportInterval time.Duration
+	statsBatch          int
+	statsCompression    bool
+	drainTimeout        time.Duration
+	warmupDuration      time.Duration
 
 	cpuProfile         string
 	cpuProfileDuration time.Duration
@@ -46,7 +88,55 @@ type Boomer struct {
 	memoryProfile         string
 	memoryProfileDuration time.Duration
 
-	outputs []Output
+	pprofAddr string
+
+	responseTimeSampleSize int
+
+	aggregationMode AggregationMode
+
+	errorExemplars  int
+	errorNormalizer ErrorNormalizer
+
+	randomSeed    int64
+	randomSeedSet bool
+
+	webUIAddr string
+
+	consoleDashboard bool
+
+	controlAddr string
+
+	finalReportPath   string
+	finalReportFormat ReportFormat
+
+	summaryFile string
+
+	checks      Checks
+	checkOutput *checkOutput
+
+	circuitBreakers map[string]CircuitBreaker
+
+	slos       []SLO
+	sloTracker *sloTracker
+
+	adaptiveLoad       AdaptiveLoad
+	adaptiveLoadOutput *adaptiveLoadOutput
+
+	masterMessageInterceptor func(msg *Message) *Message
+	testStartHooks           []func()
+	testStopHooks            []func()
+	messageHandlers          map[string]func(data interface{})
+
+	publisher eventPublisher
+
+	secondaryMasters []secondaryMaster
+
+	outputs          []Output
+	rawSampleOutputs []RawSampleOutput
+	strictOutputs    bool
+
+	// snapshot accumulates the stats for Stats, it's always added to the outputs.
+	snapshot snapshotOutput
 }
 
 // NewBoomer returns a new Boomer.
@@ -67,6 +157,318 @@ func NewStandaloneBoomer(spawnCount int, spawnRate float64) *Boomer {
 	}
 }
 
+// AddStage appends a stage to the load profile in standalone mode. When a stage begins, the users are
+// spawned at spawnRate or stopped at once to reach the number of users, which are kept running for the rest
+// of duration, including the time to spawn. To ramp down gradually, use several stages with fewer users.
+// Boomer quits after the last stage, like Quit is called. If any stage is added, the spawnCount and
+// spawnRate of NewStandaloneBoomer are ignored.
+// It's ignored in distributed mode, and must be called before the test is started.
+func (b *Boomer) AddStage(duration time.Duration, users int, spawnRate float64) {
+	if duration <= 0 || users < 0 || spawnRate <= 0 {
+		logError("Invalid stage, ignored!")
+		return
+	}
+	b.stages = append(b.stages, loadStage{
+		duration:  duration,
+		users:     users,
+		spawnRate: spawnRate,
+	})
+}
+
+// UpdateUserCount changes the number of users of a running test in standalone mode, to ramp up or down
+// without restarting. Missing users are spawned at the current spawn rate, excess users are stopped at once,
+// the contexts passed to their FnWithContext are canceled after the drain timeout.
+// It's ignored in distributed mode, where the number of users is decided by the master.
+func (b *Boomer) UpdateUserCount(n int) {
+	if b.mode != StandaloneMode || b.localRunner == nil {
+		logError("UpdateUserCount is only supported by a running standalone boomer, ignored!")
+		return
+	}
+	if n < 0 {
+		logError("Invalid user count, ignored!")
+		return
+	}
+	b.localRunner.updateUserCount(n)
+}
+
+// SetTags runs only the tasks which have any of tags, see Task.Tags, the tasks without tags aren't run either,
+// like --tags of locust. It must be called before the test is started.
+func (b *Boomer) SetTags(tags ...string) {
+	b.tags = tags
+}
+
+// SetExcludeTags doesn't run the tasks which have any of tags, see Task.Tags, like --exclude-tags of locust.
+// It can be used with SetTags. It must be called before the test is started.
+func (b *Boomer) SetExcludeTags(tags ...string) {
+	b.excludeTags = tags
+}
+
+// SetRunTime stops the test after d, which is counted since the users are spawned for the first time,
+// by the spawn message of the master in distributed mode. The test is stopped like Quit is called,
+// the last interval's stats are reported to the master and the outputs before boomer quits.
+// Defaults to 0, which means unlimited. It must be called before the test is started.
+func (b *Boomer) SetRunTime(d time.Duration) {
+	if d < 0 {
+		logError("Invalid run time, ignored!")
+		return
+	}
+	b.runTime = d
+}
+
+// SetHatchStrategy changes the shape of the ramp-up, SmoothHatch spawns the users evenly at the spawn rate by default,
+// AsapHatch spawns them at once, ExponentialHatch speeds up the spawn rate over time, StepHatch spawns them in steps.
+// Implement HatchStrategy for a custom shape. It applies to the spawn messages of the master and the stages too.
+// It must be called before the test is started.
+func (b *Boomer) SetHatchStrategy(strategy HatchStrategy) {
+	if strategy == nil {
+		logError("Invalid hatch strategy, ignored!")
+		return
+	}
+	b.hatchStrategy = strategy
+}
+
+// SetStartAt delays spawning the users until t, so the workers which boot at different times start at the same instant,
+// and the ramp-up of the cluster isn't staggered. The clocks of the workers must be synchronized, e.g. by NTP.
+// A t in the past has no effect. The run time and the warm-up period are counted since t. In distributed mode,
+// MasterRunner.SetStartDelay coordinates the start time by the spawn messages instead.
+// It must be called before the test is started.
+func (b *Boomer) SetStartAt(t time.Time) {
+	b.startAt = t
+}
+
+// SetRunID sets the ID of the test run, which is reported in every interval to the master and the outputs
+// as "run_id", and IntervalStats.RunID, so the results of many workers and runs can be correlated in external stores.
+// It must be called before the test is started.
+func (b *Boomer) SetRunID(id string) {
+	b.runID = id
+}
+
+// SetRunLabels sets the labels of the test run, like the environment or the build, which are reported in every interval
+// to the master and the outputs as "run_labels", and IntervalStats.RunLabels, like SetRunID. The labels are copied.
+// It must be called before the test is started.
+func (b *Boomer) SetRunLabels(labels map[string]string) {
+	b.runLabels = copyLabels(labels)
+}
+
+// SetIterationLimit stops the test once the task functions are called n times, like Quit is called, the last interval's
+// stats are reported to the master and the outputs before boomer quits. In distributed mode, n is the limit of the cluster,
+// which is split over the workers by the number of workers sent by the master as the "worker_count" message, like
+// DistributedRateLimiter, and rounded up, so the cluster runs at least n iterations. Without the number of workers,
+// each worker runs n iterations. Defaults to 0, which means unlimited. It must be called before the test is started.
+func (b *Boomer) SetIterationLimit(n int64) {
+	if n < 0 {
+		logError("Invalid iteration limit, ignored!")
+		return
+	}
+	b.iterationLimit = n
+}
+
+// SetArrivalRate switches to the open model, the iterations are started at rate per second regardless of how many are
+// in flight, so a slow target isn't hidden by the users waiting for it, like the closed model does. The users are the cap
+// of the iterations in flight, they wait for the arrivals instead of calling the task functions in a loop, and an arrival
+// is dropped with a warning if all of them are busy. In distributed mode, rate is split over the workers by the number of
+// workers sent by the master, like SetIterationLimit. Defaults to 0, which means the closed model.
+// It must be called before the test is started.
+func (b *Boomer) SetArrivalRate(rate float64) {
+	if rate < 0 || math.IsInf(rate, 0) || math.IsNaN(rate) {
+		logError("Invalid arrival rate, ignored!")
+		return
+	}
+	b.arrivalRate = rate
+}
+
+// SetInterArrival sets the distribution of the intervals between the arrivals of SetArrivalRate, FixedInterArrival
+// by default, ExponentialInterArrival makes the arrivals a Poisson process, which is bursty like real traffic.
+// It must be called before the test is started.
+func (b *Boomer) SetInterArrival(interArrival InterArrival) {
+	if interArrival == nil {
+		logError("Invalid inter-arrival distribution, ignored!")
+		return
+	}
+	b.interArrival = interArrival
+}
+
+// SetMaxWorkers caps the users of this process, no more users are spawned once it's reached, whatever the master asks for,
+// so a misconfigured test doesn't exhaust the goroutines of the worker. Defaults to 0, which means unlimited.
+// It must be called before the test is started.
+func (b *Boomer) SetMaxWorkers(n int) {
+	if n < 0 {
+		logError("Invalid max workers, ignored!")
+		return
+	}
+	b.maxWorkers = n
+}
+
+// SetExpectedWorkers holds the spawn messages of the master until the master reports n workers, so an auto-scaled
+// fleet of workers doesn't start the test with a part of its capacity. The master must send the number of workers,
+// like boomer's MasterRunner. Defaults to 0, which spawns at once. It's ignored in standalone mode, and must be called
+// before the test is started.
+func (b *Boomer) SetExpectedWorkers(n int) {
+	if n < 0 {
+		logError("Invalid expected workers, ignored!")
+		return
+	}
+	b.expectedWorkers = n
+}
+
+// SetMaxMemoryMB caps the resident memory of this process in megabytes, no more users are spawned once it's reached,
+// and a warning is logged every report interval once the memory usage is approaching it, so the worker doesn't run out
+// of memory in the middle of a test, which corrupts the results of the cluster silently. The running users aren't stopped.
+// Defaults to 0, which means unlimited. It must be called before the test is started.
+func (b *Boomer) SetMaxMemoryMB(mb int) {
+	if mb < 0 {
+		logError("Invalid max memory, ignored!")
+		return
+	}
+	b.maxMemoryMB = mb
+}
+
+// DroppedArrivals returns the number of the arrivals dropped since the test starts, because all the users are busy,
+// see SetArrivalRate.
+func (b *Boomer) DroppedArrivals() int64 {
+	switch b.mode {
+	case DistributedMode:
+		if b.slaveRunner != nil {
+			return atomic.LoadInt64(&b.slaveRunner.droppedArrivals)
+		}
+	case StandaloneMode:
+		if b.localRunner != nil {
+			return atomic.LoadInt64(&b.localRunner.droppedArrivals)
+		}
+	}
+	return 0
+}
+
+// SetDrainTimeout makes boomer wait up to d for the running task functions to return when the test is stopped
+// or quit, instead of abandoning them mid-request. No new iteration is started once the test is stopped, and the contexts
+// passed to Task.FnWithContext are canceled after d, so the requests in flight are recorded before the stats are
+// reported for the last time. Defaults to 0, which doesn't wait. It must be called before the test is started.
+func (b *Boomer) SetDrainTimeout(d time.Duration) {
+	if d < 0 {
+		logError("Invalid drain timeout, ignored!")
+		return
+	}
+	b.drainTimeout = d
+}
+
+// SetStatsReportInterval sets how often the stats are reported to the master and the outputs, defaults to 3 seconds.
+// A shorter interval gives dashboards a higher resolution, a longer one reduces the load of the master in soak tests.
+// It must be called before the test is started.
+func (b *Boomer) SetStatsReportInterval(d time.Duration) {
+	if d <= 0 {
+		logError("Invalid stats report interval, ignored!")
+		return
+	}
+	b.statsReportInterval = d
+}
+
+// SetStatsBatch merges the stats of n report intervals into one stats message to the master, so the master link carries
+// fewer and smaller messages with hundreds of request names, while the outputs still receive every interval. The charts
+// of the master are updated every n intervals. Defaults to 1, which sends every interval. It's ignored in standalone mode,
+// and must be called before the test is started.
+func (b *Boomer) SetStatsBatch(n int) {
+	if n < 1 {
+		logError("Invalid stats batch, ignored!")
+		return
+	}
+	b.statsBatch = n
+}
+
+// SetStatsCompression compresses the stats messages to the master by zlib. Only boomer's MasterRunner decompresses them,
+// a locust master doesn't, so it must not be enabled with locust. It must be called before the test is started.
+func (b *Boomer) SetStatsCompression(enabled bool) {
+	b.statsCompression = enabled
+}
+
+// SetWarmupDuration excludes the first d of the test from the aggregated stats, like the stats reported to the
+// master, the final report and the lifetime stats of CSVOutput, so cold caches and connection pools don't pollute
+// the percentiles. The requests in the warm-up period are still recorded, the outputs receive them with
+// data["warmup"] true. The warm-up period is counted since the users start spawning, every time the test starts.
+// Defaults to 0, which means no warm-up. It must be called before the test is started.
+func (b *Boomer) SetWarmupDuration(d time.Duration) {
+	if d < 0 {
+		logError("Invalid warm-up duration, ignored!")
+		return
+	}
+	b.warmupDuration = d
+}
+
+func (b *Boomer) getStatsReportInterval() time.Duration {
+	if b.statsReportInterval > 0 {
+		return b.statsReportInterval
+	}
+	return slaveReportInterval
+}
+
+// SetClientBackend chooses the implementation of ZMQ to connect to the master in distributed mode, "gomq" or "goczmq".
+// gomq is pure Go and always available, goczmq requires libzmq and is only available if boomer is built with goczmq,
+// which makes it the default. "tcp" is a plain TCP transport without ZMQ, which only connects to a MasterRunner
+// with the tcp server backend, because locust only speaks ZMQ.
+// It must be called before the test is started.
+func (b *Boomer) SetClientBackend(backend string) {
+	if _, ok := clientBackends[backend]; !ok {
+		logError("Unknown client backend %s, expected one of %v, ignored!", backend, availableClientBackends())
+		return
+	}
+	b.backend = backend
+}
+
+// SetClientID sets the ID which boomer identifies itself with to the master in distributed mode, instead of
+// the random hostname_uuid generated like locust, so the identity of a worker is stable across restarts
+// and meaningful in containers, whose hostnames are random, e.g. the name of the pod.
+// The IDs of the workers connected to the same master must be unique. It must be called before the test is started.
+func (b *Boomer) SetClientID(id string) {
+	if id == "" {
+		logError("Invalid client id, ignored!")
+		return
+	}
+	b.clientID = id
+}
+
+// SetCurveSecurity enables CURVE encryption and authentication of the connection to the master in distributed mode.
+// serverKey is the public key of the master, publicKey and secretKey are the key pair of boomer, all of them are
+// Z85 encoded and 40 characters long, like the keys generated by zmq_curve_keypair.
+// It's only supported if boomer is built with goczmq, and the master must be configured as a CURVE server.
+func (b *Boomer) SetCurveSecurity(serverKey, publicKey, secretKey string) {
+	if len(serverKey) != 40 || len(publicKey) != 40 || len(secretKey) != 40 {
+		logError("Invalid CURVE keys, expected Z85 encoded keys of 40 characters, ignored!")
+		return
+	}
+	b.security = clientSecurity{
+		curveServerKey: serverKey,
+		curvePublicKey: publicKey,
+		curveSecretKey: secretKey,
+	}
+}
+
+// SetPlainSecurity enables PLAIN authentication of the connection to the master in distributed mode.
+// The password is sent in clear text, use CURVE on untrusted networks.
+// It's only supported if boomer is built with goczmq, and the master must be configured as a PLAIN server.
+func (b *Boomer) SetPlainSecurity(username, password string) {
+	if username == "" {
+		logError("Invalid PLAIN username, ignored!")
+		return
+	}
+	b.security = clientSecurity{
+		plainUsername: username,
+		plainPassword: password,
+	}
+}
+
+// SetMasterTLS wraps the connection to the master in TLS, so the channel to the master, including the control
+// of the test, can cross untrusted networks. It's only supported by the tcp client backend, see SetClientBackend,
+// and the master must be a MasterRunner with TLS, see MasterRunner.SetTLS. It replaces CURVE and PLAIN security.
+// It must be called before the test is started.
+func (b *Boomer) SetMasterTLS(config *tls.Config) {
+	if config == nil {
+		logError("Invalid TLS config, ignored!")
+		return
+	}
+	b.security = clientSecurity{
+		tls: config,
+	}
+}
+
 // SetRateLimiter allows user to use their own rate limiter.
 // It must be called before the test is started.
 func (b *Boomer) SetRateLimiter(rateLimiter RateLimiter) {
@@ -81,8 +483,72 @@ func (b *Boomer) SetMode(mode Mode) {
 	case StandaloneMode:
 		b.mode = StandaloneMode
 	default:
-		log.Println("Invalid mode, ignored!")
+		logError("Invalid mode, ignored!")
+	}
+}
+
+// SetResponseTimeSampleSize sets the max number of raw response times kept for each request name
+// in every report interval, using reservoir sampling. When it's greater than 0, the percentiles(50%, 90%, 95%, 99%)
+// reported as "response_time_percentiles" are calculated from the samples, instead of the rounded response times.
+// A larger size gives more accurate percentiles but takes more memory, 1000 samples usually give
+// an error of a few percent on the median and more on the tail, e.g. 99%.
+// The rounded response times reported to the master are not affected.
+// Defaults to 0, which keeps the current behavior, no samples are kept and only the rounded response times
+// are recorded, whose memory grows with the number of distinct values.
+// It must be called before the test is started.
+func (b *Boomer) SetResponseTimeSampleSize(n int) {
+	if n < 0 {
+		logError("Invalid response time sample size, ignored!")
+		return
 	}
+	b.responseTimeSampleSize = n
+}
+
+// SetAggregationMode only accepts boomer.ByName and boomer.ByType.
+// In ByType mode, all the requests sharing a request type are collapsed into one stats entry,
+// which is named after the request type, and so are the errors. It trades granularity for a smaller
+// report when a test has thousands of unique request names. Raw samples still have the original names.
+// Defaults to ByName. It must be called before the test is started.
+func (b *Boomer) SetAggregationMode(mode AggregationMode) {
+	switch mode {
+	case ByName, ByType:
+		b.aggregationMode = mode
+	default:
+		logError("Invalid aggregation mode, ignored!")
+	}
+}
+
+// SetErrorExemplars groups the errors by the normalized error, whose UUIDs, long hex strings and IDs
+// are replaced with placeholders, e.g. "GET /users/123: not found" becomes "GET /users/<n>: not found",
+// so the errors with IDs embedded don't explode the errors reported to the master and the outputs.
+// Up to n raw errors of each normalized error are sampled in each interval, with when they occur,
+// which the outputs receive as "exemplars", or RequestError.Exemplars.
+// Disabled by default. It must be called before the test is started.
+func (b *Boomer) SetErrorExemplars(n int) {
+	if n < 0 {
+		logError("Invalid number of error exemplars, ignored!")
+		return
+	}
+	b.errorExemplars = n
+}
+
+// SetErrorNormalizer groups the errors by what normalizer returns, instead of the raw errors, so the timestamps
+// or the IDs in the errors don't make the errors reported to the master and the outputs grow unbounded.
+// It replaces the normalization of SetErrorExemplars, whose exemplars are still sampled if it's called too.
+// The normalizer is called by the stats goroutine for every failure, it should be fast.
+// It must be called before the test is started.
+func (b *Boomer) SetErrorNormalizer(normalizer ErrorNormalizer) {
+	b.errorNormalizer = normalizer
+}
+
+// SetRandomSeed seeds the random number generator owned by the runner, so a run can be reproduced
+// exactly for debugging. It's used by all the randomness in boomer's internal scheduling, like assigning
+// tasks to the goroutines and the seeds of the users, but not by the task code itself, and the order in which
+// the goroutines run is still up to the Go scheduler. By default, the seed is time-based.
+// It must be called before the test is started. WeighingTaskSet has its own SetRandomSeed.
+func (b *Boomer) SetRandomSeed(seed int64) {
+	b.randomSeed = seed
+	b.randomSeedSet = true
 }
 
 // AddOutput accepts outputs which implements the boomer.Output interface.
@@ -90,6 +556,251 @@ func (b *Boomer) AddOutput(o Output) {
 	b.outputs = append(b.outputs, o)
 }
 
+// OnStatsInterval calls fn with the stats of every report interval, the same data as an Output receives, as typed structs,
+// so an adaptive test can read the live stats without implementing Output. Like the outputs, fn is called in a separated
+// goroutine, but not concurrently, and it must not block. It must be called before the test is started.
+//
+//	globalBoomer.OnStatsInterval(func(stats *boomer.IntervalStats) {
+//		if stats.Total != nil && stats.Total.NumFailures > 0 {
+//			...
+//		}
+//	})
+func (b *Boomer) OnStatsInterval(fn func(stats *IntervalStats)) {
+	if fn == nil {
+		logError("Invalid stats interval callback, ignored!")
+		return
+	}
+	b.AddOutput(statsIntervalOutput(fn))
+}
+
+// SetWebUIAddr starts a web UI on addr, like ":8089", when running in standalone mode.
+// The page shows the current users, RPS, failure rate and percentiles of each request name,
+// the charts since the test starts, and refreshes every report interval. It has the controls to start
+// and stop the test, and to change the number of users. If the spawnCount of NewStandaloneBoomer is 0
+// and there is no stage, the test waits to be started by the web UI. The server is shut down when boomer quits.
+// It's ignored in distributed mode, use the web UI of the master instead.
+// It must be called before the test is started.
+func (b *Boomer) SetWebUIAddr(addr string) {
+	b.webUIAddr = addr
+}
+
+// SetControlAddr serves the control API on addr, like ":8090", for the orchestration tools.
+// GET /healthz responds the state and the number of users, GET /stats responds the stats of the last interval as JSON.
+// GET /scaling responds the number of users, the target number of users and the number of workers reported by
+// the master, for the autoscalers of the workers like KEDA.
+// In standalone mode, POST /start?users=10&spawn_rate=5 starts the test or changes the number of users,
+// and POST /stop stops the users, boomer keeps running until it quits. If the spawnCount of NewStandaloneBoomer is 0
+// and there is no stage, the test waits to be started by the API. In distributed mode, the test is controlled by the master,
+// /start and /stop respond 409. The server is shut down when boomer quits. It must be called before the test is started.
+func (b *Boomer) SetControlAddr(addr string) {
+	b.controlAddr = addr
+}
+
+// SetConsoleDashboard draws a live dashboard in the terminal, which is redrawn every report interval,
+// see ConsoleDashboardOutput. In standalone mode, it takes the place of the default ConsoleOutput.
+// It must be called before the test is started.
+func (b *Boomer) SetConsoleDashboard(enabled bool) {
+	b.consoleDashboard = enabled
+}
+
+// SetFinalReport writes a consolidated report of the whole test to path in the format of ReportJSON, ReportCSV, ReportHTML or ReportText,
+// when the test is stopped gracefully, by Quit, SIGINT or a quit message from the master. The report has the lifetime aggregates
+// of each request name, the total and the errors, the percentiles are calculated from the rounded response times.
+// The file is created when Run is called, see SetStrictOutputs if it fails. It must be called before the test is started.
+func (b *Boomer) SetFinalReport(path string, format ReportFormat) {
+	switch format {
+	case ReportJSON, ReportCSV, ReportHTML, ReportText:
+		b.finalReportPath = path
+		b.finalReportFormat = format
+	default:
+		logError("Invalid report format, ignored!")
+	}
+}
+
+// SetSummaryFile writes the summary of the test to path too, besides printing it. The summary has the lifetime aggregates
+// of each request name in ReportText, including the failure ratio and the percentiles, it's printed when the test is
+// stopped in standalone mode, like locust does on exit. In distributed mode, it's printed only if the file is set.
+// It must be called before the test is started.
+func (b *Boomer) SetSummaryFile(path string) {
+	b.summaryFile = path
+}
+
+// SetChecks checks the aggregates of the whole test against the thresholds when the test is stopped, the failed checks
+// are logged, and ChecksFailed returns true. boomer.Run exits with status 1 if any check fails, so CI can fail the build.
+// In distributed mode, each worker checks the requests made by itself. It must be called before the test is started.
+func (b *Boomer) SetChecks(checks Checks) {
+	if !checks.valid() {
+		logError("Invalid checks, ignored!")
+		return
+	}
+	b.checks = checks
+}
+
+// ChecksFailed returns true if any check set by SetChecks fails when the last test is stopped.
+func (b *Boomer) ChecksFailed() bool {
+	return b.checkOutput != nil && b.checkOutput.hasFailed()
+}
+
+// SetAdaptiveLoad finds the capacity of the target in a single run, the max RPS which keeps the p99 response time
+// under the target, see AdaptiveLoad. The RPS limit is adjusted every report interval, it replaces the rate limiter
+// set by SetRateLimiter. The capacity is logged when the test is stopped, and returned by Capacity. In distributed mode,
+// each worker adjusts its own limit by the requests made by itself. It must be called before the test is started.
+func (b *Boomer) SetAdaptiveLoad(load AdaptiveLoad) {
+	if !load.valid() {
+		logError("Invalid adaptive load, ignored!")
+		return
+	}
+	b.adaptiveLoad = load
+}
+
+// Capacity returns the highest RPS of the report intervals whose p99 response time is under the target
+// of SetAdaptiveLoad, since the test starts. It returns 0 if the adaptive load isn't set or the capacity isn't found.
+func (b *Boomer) Capacity() float64 {
+	if b.adaptiveLoadOutput == nil {
+		return 0
+	}
+	return b.adaptiveLoadOutput.getCapacity()
+}
+
+// AddSLO adds an SLO, which is evaluated against the stats of every report interval, the intervals in the warm-up
+// period are skipped. The "boomer:slo_violation" event is published whenever an interval violates it, and the outputs
+// receive the statuses of the SLOs as data["slos"], or IntervalStats.SLOs. In distributed mode, each worker evaluates
+// the requests made by itself. It must be called before the test is started.
+func (b *Boomer) AddSLO(slo SLO) {
+	if !slo.valid() {
+		logError("Invalid SLO, ignored!")
+		return
+	}
+	b.slos = append(b.slos, slo)
+}
+
+// SLOStatuses returns the pass/fail statuses of the SLOs added by AddSLO since the test starts, in the order they're added.
+func (b *Boomer) SLOStatuses() []SLOStatus {
+	if b.sloTracker == nil {
+		return nil
+	}
+	return b.sloTracker.snapshot()
+}
+
+// SetCircuitBreaker pauses or slows down a task when the failure ratio of the requests named name keeps exceeding
+// the threshold of breaker, and resumes it after the cool-down, see CircuitBreaker. The "boomer:circuit_open" and
+// "boomer:circuit_close" events are published when the breaker is tripped and closed. In distributed mode, each worker
+// judges the requests made by itself. It must be called before the test is started.
+func (b *Boomer) SetCircuitBreaker(name string, breaker CircuitBreaker) {
+	if name == "" || !breaker.valid() {
+		logError("Invalid circuit breaker, ignored!")
+		return
+	}
+	if b.circuitBreakers == nil {
+		b.circuitBreakers = make(map[string]CircuitBreaker)
+	}
+	b.circuitBreakers[name] = breaker
+}
+
+// SetMasterMessageInterceptor sets a hook, which is called right before every message is sent to the master.
+// It can mutate the message, like injecting extra fields in msg.Data or redacting some request names in the stats,
+// or return a new one. If it returns nil, the message is dropped. Dropping messages like "client_ready" or "quit"
+// confuses the master, so be careful.
+// The interceptor is called by different goroutines, it must be safe for concurrent use.
+// It's ignored in standalone mode, and must be called before the test is started.
+func (b *Boomer) SetMasterMessageInterceptor(interceptor func(msg *Message) *Message) {
+	b.masterMessageInterceptor = interceptor
+}
+
+// OnTestStart adds a hook, which is called when the test starts, by a spawn message from the master or
+// in standalone mode, before OnStart of the tasks and spawning any goroutine. A spawn message which rescales
+// a running test doesn't call it again. It must be called before the test is started.
+func (b *Boomer) OnTestStart(hook func()) {
+	b.testStartHooks = append(b.testStartHooks, hook)
+}
+
+// OnTestStop adds a hook, which is called when the test is stopped, by a stop or quit message from the master
+// or Quit, after the goroutines are stopped and OnStop of the tasks is called. It must be called before the test is started.
+func (b *Boomer) OnTestStop(hook func()) {
+	b.testStopHooks = append(b.testStopHooks, hook)
+}
+
+// SetEvents sets the event bus, which the lifecycle events of the Boomer are published to, like "boomer:quit".
+// They are published to the package-level Events by default, give each Boomer its own event bus and hooks,
+// see SetHooks, to run several Boomers independently in one process. It must be called before the test is started.
+func (b *Boomer) SetEvents(events EventBus.Bus) {
+	if events == nil {
+		logError("Invalid event bus, ignored!")
+		return
+	}
+	b.publisher.events = events
+}
+
+// Events returns the event bus of the Boomer, the package-level Events if it's not set by SetEvents.
+func (b *Boomer) Events() EventBus.Bus {
+	return b.publisher.getEvents()
+}
+
+// SetHooks sets the hooks of the lifecycle events of the Boomer, which are DefaultHooks by default, see SetEvents.
+// It must be called before the test is started.
+func (b *Boomer) SetHooks(hooks *Hooks) {
+	if hooks == nil {
+		logError("Invalid hooks, ignored!")
+		return
+	}
+	b.publisher.hooks = hooks
+}
+
+// Hooks returns the hooks of the Boomer, DefaultHooks if they are not set by SetHooks.
+func (b *Boomer) Hooks() *Hooks {
+	return b.publisher.getHooks()
+}
+
+// RegisterMessage registers a handler of the custom messages of messageType from the master, like
+// runner.register_message of locust. The handler receives the data of the message, which is decoded
+// from msgpack, the strings may be []byte and the nested maps are map[interface{}]interface{}.
+// The handler is called in the goroutine which receives the messages from the master, it shouldn't block.
+// It's ignored in standalone mode, and must be called before the test is started.
+func (b *Boomer) RegisterMessage(messageType string, handler func(data interface{})) {
+	if b.messageHandlers == nil {
+		b.messageHandlers = make(map[string]func(data interface{}))
+	}
+	b.messageHandlers[messageType] = handler
+}
+
+// SendCustomMessage sends a custom message of messageType to the master, like runner.send_message of locust.
+// The data can be anything serializable by msgpack, like []byte or a map. It only works in distributed mode,
+// after the test is started.
+func (b *Boomer) SendCustomMessage(messageType string, data interface{}) {
+	if b.mode != DistributedMode || b.slaveRunner == nil {
+		logError("Custom messages can only be sent to the master in distributed mode, ignored!")
+		return
+	}
+	b.slaveRunner.sendMessage(newCustomMessage(messageType, data, b.slaveRunner.nodeID))
+}
+
+// SetStrictOutputs makes boomer exit when Run is called, if any output fails to initialize,
+// instead of dropping the output and running the test without it.
+// See OutputInitializer for how an output reports initialization errors.
+func (b *Boomer) SetStrictOutputs(strict bool) {
+	b.strictOutputs = strict
+}
+
+type secondaryMaster struct {
+	host string
+	port int
+}
+
+// AddSecondaryMaster mirrors the stats to another master or aggregator, like one which builds
+// a dashboard across several shards of workers. Boomer connects to it like to the primary master,
+// but only sends the same stats messages to it, and ignores the messages from it.
+// Mirroring is best-effort, failing to connect or a slow secondary never disrupts the primary master,
+// the stats are dropped instead. It's ignored in standalone mode, and must be called before the test is started.
+func (b *Boomer) AddSecondaryMaster(host string, port int) {
+	b.secondaryMasters = append(b.secondaryMasters, secondaryMaster{host: host, port: port})
+}
+
+// AddRawSampleOutput accepts outputs which implements the boomer.RawSampleOutput interface.
+// Every single request will be sent to them, see RawSampleOutput for the overhead.
+func (b *Boomer) AddRawSampleOutput(o RawSampleOutput) {
+	b.rawSampleOutputs = append(b.rawSampleOutputs, o)
+}
+
 // EnableCPUProfile will start cpu profiling after run.
 func (b *Boomer) EnableCPUProfile(cpuProfile string, duration time.Duration) {
 	b.cpuProfile = cpuProfile
@@ -102,98 +813,490 @@ func (b *Boomer) EnableMemoryProfile(memoryProfile string, duration time.Duratio
 	b.memoryProfileDuration = duration
 }
 
+// SetPprofAddr serves the live profiles of net/http/pprof on addr, like ":6060", after run, see StartPprofServer.
+// Unlike EnableCPUProfile and EnableMemoryProfile, the profiles can be grabbed at any time, for any duration.
+func (b *Boomer) SetPprofAddr(addr string) {
+	b.pprofAddr = addr
+}
+
 // Run accepts a slice of Task and connects to the locust master.
 func (b *Boomer) Run(tasks ...*Task) {
 	if b.cpuProfile != "" {
 		err := StartCPUProfile(b.cpuProfile, b.cpuProfileDuration)
 		if err != nil {
-			log.Printf("Error starting cpu profiling, %v", err)
+			logError("Error starting cpu profiling, %v", err)
 		}
 	}
 	if b.memoryProfile != "" {
 		err := StartMemoryProfile(b.memoryProfile, b.memoryProfileDuration)
 		if err != nil {
-			log.Printf("Error starting memory profiling, %v", err)
+			logError("Error starting memory profiling, %v", err)
+		}
+	}
+	if b.pprofAddr != "" {
+		if _, err := StartPprofServer(b.pprofAddr); err != nil {
+			logError("Error starting the pprof server, %v", err)
 		}
 	}
 
+	if len(b.tags) > 0 || len(b.excludeTags) > 0 {
+		tasks = filterTasks(tasks, b.tags, b.excludeTags)
+		if len(tasks) == 0 {
+			logError("No tasks match the tags, nothing will be run")
+		}
+	}
+
+	outputs := append([]Output{}, b.outputs...)
+	outputs = append(outputs, &b.snapshot)
+	var webUI *webStatusOutput
+	if b.mode == StandaloneMode && b.webUIAddr != "" {
+		webUI = newWebStatusOutput(b.webUIAddr, b.getStatsReportInterval())
+		if b.spawnCount > 0 && b.spawnRate > 0 {
+			webUI.spawnCount, webUI.spawnRate = b.spawnCount, b.spawnRate
+		}
+		outputs = append(outputs, webUI)
+	}
+	var control *controlOutput
+	if b.controlAddr != "" {
+		control = newControlOutput(b.controlAddr, b.State)
+		control.scaling = b.scalingStatus
+		outputs = append(outputs, control)
+	}
+	if b.consoleDashboard {
+		outputs = append(outputs, NewConsoleDashboardOutput())
+	}
+	if b.finalReportPath != "" {
+		outputs = append(outputs, newFinalReportOutput(b.finalReportPath, b.finalReportFormat))
+	}
+	if b.mode == StandaloneMode || b.summaryFile != "" {
+		outputs = append(outputs, newSummaryOutput(b.summaryFile))
+	}
+	if b.checks.enabled() {
+		b.checkOutput = newCheckOutput(b.checks)
+		outputs = append(outputs, b.checkOutput)
+	}
+	var circuitBreakers *circuitBreakerOutput
+	if len(b.circuitBreakers) > 0 {
+		circuitBreakers = newCircuitBreakerOutput(b.circuitBreakers, b.publisher)
+		outputs = append(outputs, circuitBreakers)
+	}
+	rateLimiter := b.rateLimiter
+	b.adaptiveLoadOutput = nil
+	if b.adaptiveLoad.TargetP99 > 0 {
+		if rateLimiter != nil {
+			logError("The rate limiter is replaced by the adaptive load")
+		}
+		limiter := NewStableRateLimiter(b.adaptiveLoad.withDefaults().InitialRPS, time.Second)
+		rateLimiter = limiter
+		b.adaptiveLoadOutput = newAdaptiveLoadOutput(b.adaptiveLoad, limiter, b.getStatsReportInterval())
+		outputs = append(outputs, b.adaptiveLoadOutput)
+	}
+	b.sloTracker = nil
+	if len(b.slos) > 0 {
+		b.sloTracker = newSLOTracker(b.slos, b.publisher)
+	}
+	outputs, rawSampleOutputs, err := b.initOutputs(outputs, b.rawSampleOutputs)
+	if err != nil {
+		logFatal("%v\n", err)
+	}
+
 	switch b.mode {
 	case DistributedMode:
-		b.slaveRunner = newSlaveRunner(b.masterHost, b.masterPort, tasks, b.rateLimiter)
-		for _, o := range b.outputs {
+		b.slaveRunner = newSlaveRunner(b.masterHost, b.masterPort, tasks, rateLimiter)
+		if b.clientID != "" {
+			b.slaveRunner.nodeID = b.clientID
+		}
+		b.slaveRunner.stats.setResponseTimeSampleSize(b.responseTimeSampleSize)
+		b.slaveRunner.stats.setAggregationMode(b.aggregationMode)
+		b.slaveRunner.stats.setErrorExemplars(b.errorExemplars)
+		b.slaveRunner.stats.setErrorNormalizer(b.errorNormalizer)
+		b.slaveRunner.stats.setReportInterval(b.getStatsReportInterval())
+		b.slaveRunner.security = b.security
+		b.slaveRunner.clientBackend = b.backend
+		b.slaveRunner.messageInterceptor = b.masterMessageInterceptor
+		b.slaveRunner.messageHandlers = b.messageHandlers
+		b.slaveRunner.statsBatchSize = b.statsBatch
+		b.slaveRunner.statsCompression = b.statsCompression
+		b.slaveRunner.expectedWorkers = b.expectedWorkers
+		b.slaveRunner.drainTimeout = b.drainTimeout
+		b.slaveRunner.warmupDuration = b.warmupDuration
+		b.slaveRunner.testStartHooks = b.testStartHooks
+		b.slaveRunner.testStopHooks = b.testStopHooks
+		b.slaveRunner.eventPublisher = b.publisher
+		b.slaveRunner.circuitBreakers = circuitBreakers
+		b.slaveRunner.slos = b.sloTracker
+		if b.randomSeedSet {
+			b.slaveRunner.setRandomSeed(b.randomSeed)
+		}
+		b.slaveRunner.setStartAt(b.startAt)
+		b.slaveRunner.hatchStrategy = b.hatchStrategy
+		b.slaveRunner.runID = b.runID
+		b.slaveRunner.runLabels = b.runLabels
+		b.slaveRunner.setRunTime(b.runTime, b.Quit)
+		b.slaveRunner.setIterationLimit(b.iterationLimit, b.Quit)
+		b.slaveRunner.setArrivalRate(b.arrivalRate, b.interArrival)
+		b.slaveRunner.setResourceLimits(b.maxWorkers, uint64(b.maxMemoryMB)<<20)
+		for _, m := range b.secondaryMasters {
+			b.slaveRunner.addMirror(m.host, m.port)
+		}
+		for _, o := range outputs {
 			b.slaveRunner.addOutput(o)
 		}
+		for _, o := range rawSampleOutputs {
+			b.slaveRunner.addRawSampleOutput(o)
+		}
 		b.slaveRunner.run()
 	case StandaloneMode:
-		b.localRunner = newLocalRunner(tasks, b.rateLimiter, b.spawnCount, b.spawnRate)
-		for _, o := range b.outputs {
+		b.localRunner = newLocalRunner(tasks, rateLimiter, b.spawnCount, b.spawnRate)
+		if b.consoleDashboard {
+			// drop the default ConsoleOutput
+			b.localRunner.outputs = nil
+		}
+		b.localRunner.stages = b.stages
+		controllable := false
+		if webUI != nil && webUI.listener != nil {
+			webUI.controller = b.localRunner
+			controllable = true
+		}
+		if control != nil && control.listener != nil {
+			control.controller = b.localRunner
+			controllable = true
+		}
+		// the test is started by the web UI or the control API, if there are no users to spawn
+		b.localRunner.waitForStart = controllable && b.spawnCount == 0 && len(b.stages) == 0
+		b.localRunner.drainTimeout = b.drainTimeout
+		b.localRunner.warmupDuration = b.warmupDuration
+		b.localRunner.testStartHooks = b.testStartHooks
+		b.localRunner.testStopHooks = b.testStopHooks
+		b.localRunner.eventPublisher = b.publisher
+		b.localRunner.circuitBreakers = circuitBreakers
+		b.localRunner.slos = b.sloTracker
+		b.localRunner.setStartAt(b.startAt)
+		b.localRunner.hatchStrategy = b.hatchStrategy
+		b.localRunner.runID = b.runID
+		b.localRunner.runLabels = b.runLabels
+		b.localRunner.setRunTime(b.runTime, b.Quit)
+		b.localRunner.setIterationLimit(b.iterationLimit, b.Quit)
+		b.localRunner.setArrivalRate(b.arrivalRate, b.interArrival)
+		b.localRunner.setResourceLimits(b.maxWorkers, uint64(b.maxMemoryMB)<<20)
+		b.localRunner.stats.setResponseTimeSampleSize(b.responseTimeSampleSize)
+		b.localRunner.stats.setAggregationMode(b.aggregationMode)
+		b.localRunner.stats.setErrorExemplars(b.errorExemplars)
+		b.localRunner.stats.setErrorNormalizer(b.errorNormalizer)
+		b.localRunner.stats.setReportInterval(b.getStatsReportInterval())
+		if b.randomSeedSet {
+			b.localRunner.setRandomSeed(b.randomSeed)
+		}
+		for _, o := range outputs {
 			b.localRunner.addOutput(o)
 		}
+		for _, o := range rawSampleOutputs {
+			b.localRunner.addRawSampleOutput(o)
+		}
 		b.localRunner.run()
 	default:
-		log.Println("Invalid mode, expected boomer.DistributedMode or boomer.StandaloneMode")
+		logError("Invalid mode, expected boomer.DistributedMode or boomer.StandaloneMode")
 	}
 }
 
-// RecordSuccess reports a success.
-func (b *Boomer) RecordSuccess(requestType, name string, responseTime int64, responseLength int64) {
-	if b.localRunner == nil && b.slaveRunner == nil {
-		return
-	}
+func (b *Boomer) getStats() *requestStats {
 	switch b.mode {
 	case DistributedMode:
-		b.slaveRunner.stats.requestSuccessChan <- &requestSuccess{
-			requestType:    requestType,
-			name:           name,
-			responseTime:   responseTime,
-			responseLength: responseLength,
+		if b.slaveRunner != nil {
+			return b.slaveRunner.stats
 		}
 	case StandaloneMode:
-		b.localRunner.stats.requestSuccessChan <- &requestSuccess{
-			requestType:    requestType,
-			name:           name,
-			responseTime:   responseTime,
-			responseLength: responseLength,
+		if b.localRunner != nil {
+			return b.localRunner.stats
 		}
 	}
+	return nil
 }
 
-// RecordFailure reports a failure.
-func (b *Boomer) RecordFailure(requestType, name string, responseTime int64, exception string) {
-	if b.localRunner == nil && b.slaveRunner == nil {
+// initOutputs calls Init of the outputs which implement OutputInitializer, and returns the outputs
+// initialized successfully. The failed ones are dropped with an error logged, or an error is returned
+// if strict outputs are enabled.
+func (b *Boomer) initOutputs(outputs []Output, rawSampleOutputs []RawSampleOutput) ([]Output, []RawSampleOutput, error) {
+	var initialized []Output
+	for _, o := range outputs {
+		if err := initOutput(o); err != nil {
+			if b.strictOutputs {
+				return nil, nil, fmt.Errorf("failed to initialize output %T, %v", o, err)
+			}
+			logError("Failed to initialize output %T, it's dropped and nothing will be recorded by it! %v", o, err)
+			continue
+		}
+		initialized = append(initialized, o)
+	}
+
+	var initializedRawSampleOutputs []RawSampleOutput
+	for _, o := range rawSampleOutputs {
+		if err := initOutput(o); err != nil {
+			if b.strictOutputs {
+				return nil, nil, fmt.Errorf("failed to initialize raw sample output %T, %v", o, err)
+			}
+			logError("Failed to initialize raw sample output %T, it's dropped and nothing will be recorded by it! %v", o, err)
+			continue
+		}
+		initializedRawSampleOutputs = append(initializedRawSampleOutputs, o)
+	}
+	return initialized, initializedRawSampleOutputs, nil
+}
+
+// State returns the state of the runner, one of "ready", "spawning", "running" and "stopped",
+// and the number of running users. It's "ready" and 0 before the test is started.
+// Use Hooks().OnStateChange to be notified of the state transitions.
+func (b *Boomer) State() (state string, users int) {
+	r := b.getRunner()
+	if r == nil || r.getState() == "" {
+		return stateInit, 0
+	}
+	return r.getState(), int(atomic.LoadInt32(&r.numClients))
+}
+
+// AddTask adds task to the tasks of Run, for a long-lived worker which receives the tasks at runtime, e.g. by a custom
+// message from the master. If the test is running, OnStart of task is called, and some of the users are stopped and
+// spawned again, so the users are rebalanced onto the tasks by their weights. The tags of SetTags and SetExcludeTags
+// apply to it too. It must be called after Run.
+func (b *Boomer) AddTask(task *Task) {
+	r := b.getRunner()
+	if r == nil {
+		logError("AddTask must be called after Run, ignored!")
+		return
+	}
+	if task == nil || len(filterTasks([]*Task{task}, b.tags, b.excludeTags)) == 0 {
+		logError("Invalid task or the task doesn't match the tags, ignored!")
 		return
 	}
+	r.addTask(task)
+}
+
+// RemoveTask removes the tasks named name from the tasks of Run. If the test is running, the users running them are
+// stopped and spawned again to run the remaining tasks, and OnStop of them is called. It returns false if there is
+// no such task. It must be called after Run.
+func (b *Boomer) RemoveTask(name string) bool {
+	r := b.getRunner()
+	if r == nil {
+		logError("RemoveTask must be called after Run, ignored!")
+		return false
+	}
+	return r.removeTask(name)
+}
+
+// Stats returns the aggregates of the test so far, the cumulative counts, percentiles and errors of every request name,
+// like the final report. It's updated every report interval, and it can be called from any goroutine at any time,
+// even after the test is stopped. The intervals in the warm-up period are excluded. In distributed mode, it's
+// the stats of this worker only.
+func (b *Boomer) Stats() Snapshot {
+	return b.snapshot.snapshot()
+}
+
+// Pause suspends the iterations of the users without stopping them, the users keep their User.Storage and
+// the connection to the master is kept, the running iterations are finished. It's useful to hold the load
+// while the target is inspected or redeployed, Resume continues the test then. The run time is still counted,
+// and the arrivals of SetArrivalRate are skipped while paused. In distributed mode, MasterRunner.Pause pauses
+// all the workers. Stopping the test resumes it.
+func (b *Boomer) Pause() {
+	r := b.getRunner()
+	if r == nil {
+		logError("Pause must be called after Run, ignored!")
+		return
+	}
+	if r.pause() {
+		logInfo("The users are paused")
+	}
+}
+
+// Resume continues the iterations suspended by Pause.
+func (b *Boomer) Resume() {
+	r := b.getRunner()
+	if r == nil {
+		logError("Resume must be called after Run, ignored!")
+		return
+	}
+	if r.resume() {
+		logInfo("The users are resumed")
+	}
+}
+
+// Paused returns true if the iterations are suspended by Pause.
+func (b *Boomer) Paused() bool {
+	r := b.getRunner()
+	return r != nil && r.isPaused()
+}
+
+// scalingStatus returns the response of /scaling of the control API.
+func (b *Boomer) scalingStatus() *scalingStatus {
+	status := &scalingStatus{ExpectedWorkers: b.expectedWorkers}
+	status.State, status.UserCount = b.State()
+	if r := b.getRunner(); r != nil {
+		status.TargetUserCount = int(atomic.LoadInt32(&r.targetClients))
+		status.WorkerCount = int(atomic.LoadInt32(&r.workerCount))
+	}
+	return status
+}
+
+func (b *Boomer) getRunner() *runner {
 	switch b.mode {
 	case DistributedMode:
-		b.slaveRunner.stats.requestFailureChan <- &requestFailure{
-			requestType:  requestType,
-			name:         name,
-			responseTime: responseTime,
-			error:        exception,
+		if b.slaveRunner != nil {
+			return &b.slaveRunner.runner
 		}
 	case StandaloneMode:
-		b.localRunner.stats.requestFailureChan <- &requestFailure{
-			requestType:  requestType,
-			name:         name,
-			responseTime: responseTime,
-			error:        exception,
+		if b.localRunner != nil {
+			return &b.localRunner.runner
 		}
 	}
+	return nil
 }
 
-// Quit will send a quit message to the master.
+// SetLogger replaces the logger of boomer's internal logs, a nil logger discards all the logs.
+// The logger is shared by all the Boomer instances, like the log level, see SetLogger.
+func (b *Boomer) SetLogger(logger Logger) {
+	SetLogger(logger)
+}
+
+// RecordSuccess reports a success. It doesn't allocate, the record is buffered by value and aggregated by the stats
+// goroutine, so recording millions of requests doesn't put pressure on the GC, which distorts the response times.
+func (b *Boomer) RecordSuccess(requestType, name string, responseTime int64, responseLength int64) {
+	b.RecordSuccessWithLabels(requestType, name, nil, responseTime, responseLength)
+}
+
+// RecordFailure reports a failure. It doesn't allocate, like RecordSuccess.
+func (b *Boomer) RecordFailure(requestType, name string, responseTime int64, exception string) {
+	b.RecordFailureWithLabels(requestType, name, nil, responseTime, exception)
+}
+
+// RecordError reports a failure of err, which is classified into an ErrorCategory, like a timeout or an HTTP 5xx,
+// see ClassifyError. The failure is recorded with err.Error() as the exception, and reported with its category,
+// which the outputs receive as "category" of the errors, RequestError.Category and RawSample.ErrorCategory.
+func (b *Boomer) RecordError(requestType, name string, responseTime int64, err error) {
+	if err == nil {
+		logError("RecordError is called with a nil error, ignored!")
+		return
+	}
+	stats := b.getStats()
+	if stats == nil {
+		return
+	}
+	stats.recentResults.add(true)
+	stats.recordFailure(requestFailure{
+		requestType:  requestType,
+		name:         name,
+		responseTime: responseTime,
+		error:        err.Error(),
+		category:     ClassifyError(err),
+		timestamp:    Now(),
+	})
+}
+
+// DroppedRecords returns the number of the successes and failures dropped since boomer runs, because the stats
+// goroutine can't keep up with them. The tasks aren't blocked by the stats, the dropped records are counted instead,
+// reported as "num_dropped_records" of each interval and logged, so a full buffer means the stats are incomplete.
+func (b *Boomer) DroppedRecords() int64 {
+	stats := b.getStats()
+	if stats == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&stats.droppedRecords)
+}
+
+// RecordSuccessWithLabels is like RecordSuccess, with labels like the region, the status code or the tenant.
+// The stats reported to the master are still aggregated by requestType and name, the outputs receive the stats
+// broken down by labels as data["labeled_stats"], and the raw samples have the labels.
+// The labels are copied, so the map can be reused by the caller, which allocates unlike RecordSuccess.
+func (b *Boomer) RecordSuccessWithLabels(requestType, name string, labels map[string]string, responseTime int64, responseLength int64) {
+	stats := b.getStats()
+	if stats == nil {
+		return
+	}
+	stats.recentResults.add(false)
+	stats.recordSuccess(requestSuccess{
+		requestType:    requestType,
+		name:           name,
+		responseTime:   responseTime,
+		responseLength: responseLength,
+		timestamp:      Now(),
+		labels:         copyLabels(labels),
+	})
+}
+
+// RecordFailureWithLabels is like RecordFailure, with labels like RecordSuccessWithLabels.
+func (b *Boomer) RecordFailureWithLabels(requestType, name string, labels map[string]string, responseTime int64, exception string) {
+	stats := b.getStats()
+	if stats == nil {
+		return
+	}
+	stats.recentResults.add(true)
+	stats.recordFailure(requestFailure{
+		requestType:  requestType,
+		name:         name,
+		responseTime: responseTime,
+		error:        exception,
+		timestamp:    Now(),
+		labels:       copyLabels(labels),
+	})
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	if len(labels) == 0 {
+		return nil
+	}
+	copied := make(map[string]string, len(labels))
+	for k, v := range labels {
+		copied[k] = v
+	}
+	return copied
+}
+
+// RecordSuccessWithRatio is like RecordSuccess, but also returns the failure ratio of all the requests
+// recorded in the last 10 seconds, from 0 to 1. Tasks can use it to back off without subscribing to events.
+// The ratio is calculated cheaply and approximately, it's not affected by the stats reported to the master.
+func (b *Boomer) RecordSuccessWithRatio(requestType, name string, responseTime int64, responseLength int64) float64 {
+	b.RecordSuccess(requestType, name, responseTime, responseLength)
+	return b.failureRatio()
+}
+
+// RecordFailureWithRatio is like RecordFailure, but also returns the failure ratio of all the requests
+// recorded in the last 10 seconds, from 0 to 1.
+func (b *Boomer) RecordFailureWithRatio(requestType, name string, responseTime int64, exception string) float64 {
+	b.RecordFailure(requestType, name, responseTime, exception)
+	return b.failureRatio()
+}
+
+func (b *Boomer) failureRatio() float64 {
+	stats := b.getStats()
+	if stats == nil {
+		return 0
+	}
+	return stats.recentResults.ratio()
+}
+
+// Quit will stop the test and send a quit message to the master.
+// The shutdown is done in a deterministic order. Spawning and running goroutines are stopped first,
+// then the buffered records are flushed and the last interval's data is delivered to the master
+// and all the outputs, followed by OnStop of all the outputs. The quit message is sent and
+// the connection to the master is closed at last.
 func (b *Boomer) Quit() {
-	Events.Publish("boomer:quit")
+	switch b.mode {
+	case DistributedMode:
+		b.slaveRunner.shutdown()
+		b.slaveRunner.publishQuit()
+	case StandaloneMode:
+		b.localRunner.shutdown()
+		b.localRunner.publishQuit()
+	}
+
 	var ticker = time.NewTicker(3 * time.Second)
 
 	switch b.mode {
 	case DistributedMode:
 		// wait for quit message is sent to master
 		select {
-		case <-b.slaveRunner.client.disconnectedChannel():
+		case <-b.slaveRunner.getClient().disconnectedChannel():
 			break
 		case <-ticker.C:
-			log.Println("Timeout waiting for sending quit message to master, boomer will quit any way.")
+			logError("Timeout waiting for sending quit message to master, boomer will quit any way.")
 			break
 		}
 		b.slaveRunner.close()
@@ -211,20 +1314,60 @@ func runTasksForTest(tasks ...*Task) {
 		} else {
 			for _, name := range taskNames {
 				if name == task.Name {
-					log.Println("Running " + task.Name)
-					task.Fn()
+					logInfo("Running %s", task.Name)
+					task.run(context.Background())
 				}
 			}
 		}
 	}
 }
 
+// splitTags splits the comma separated tags of --tags and --exclude-tags.
+func splitTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// parseRunLabels parses the comma separated key=value pairs of --labels.
+func parseRunLabels(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		key := strings.TrimSpace(kv[0])
+		if len(kv) != 2 || key == "" {
+			return nil, fmt.Errorf("invalid label %q of --labels, expected key=value", pair)
+		}
+		labels[key] = strings.TrimSpace(kv[1])
+	}
+	return labels, nil
+}
+
 // Run accepts a slice of Task and connects to a locust master.
-// It's a convenience function to use the defaultBoomer.
+// It's a convenience function to use the defaultBoomer, configured by the options, see RegisterFlags.
 func Run(tasks ...*Task) {
-	if !flag.Parsed() {
+	if boomerFlags == nil {
+		RegisterFlags(flag.CommandLine)
+	}
+	if boomerFlags == flag.CommandLine && !flag.Parsed() {
 		flag.Parse()
 	}
+	// the command line overrides the environment variables, which override the config file
+	if err := applyEnvironment(boomerFlags); err != nil {
+		logFatal("%v\n", err)
+	}
+	if configFile != "" {
+		if err := applyConfigFile(boomerFlags, configFile); err != nil {
+			logFatal("%v\n", err)
+		}
+	}
 
 	if runTasks != "" {
 		runTasksForTest(tasks...)
@@ -233,28 +1376,118 @@ func Run(tasks ...*Task) {
 
 	initLegacyEventHandlers()
 
-	rateLimiter, err := createRateLimiter(maxRPS, requestIncreaseRate)
+	logger, err := ParseLogFormat(logFormat)
+	if err != nil {
+		logFatal("%v\n", err)
+	}
+	SetLogger(logger)
+
+	level, err := ParseLogLevel(logLevelName)
 	if err != nil {
-		log.Fatalf("%v\n", err)
+		logFatal("%v\n", err)
+	}
+	SetLogLevel(level)
+
+	if adaptiveP99 > 0 {
+		defaultBoomer.SetAdaptiveLoad(AdaptiveLoad{TargetP99: adaptiveP99, MaxRPS: maxRPS})
+	} else {
+		var rateLimiter RateLimiter
+		if splitMaxRPS {
+			rateLimiter, err = createDistributedRateLimiter(maxRPS, requestIncreaseRate)
+		} else {
+			rateLimiter, err = createRateLimiter(maxRPS, requestIncreaseRate)
+		}
+		if err != nil {
+			logFatal("%v\n", err)
+		}
+		defaultBoomer.SetRateLimiter(rateLimiter)
 	}
-	defaultBoomer.SetRateLimiter(rateLimiter)
 	defaultBoomer.masterHost = masterHost
 	defaultBoomer.masterPort = masterPort
+	if clientBackend != "" {
+		defaultBoomer.SetClientBackend(clientBackend)
+	}
+	if workerID != "" {
+		defaultBoomer.SetClientID(workerID)
+	}
+	if curveServerKey != "" {
+		defaultBoomer.SetCurveSecurity(curveServerKey, curvePublicKey, curveSecretKey)
+	} else if plainUsername != "" {
+		defaultBoomer.SetPlainSecurity(plainUsername, plainPassword)
+	} else if masterTLS {
+		config, err := newClientTLSConfig(masterTLSCert, masterTLSKey, masterTLSCA)
+		if err != nil {
+			logFatal("%v\n", err)
+		}
+		defaultBoomer.SetMasterTLS(config)
+	}
 	defaultBoomer.EnableMemoryProfile(memoryProfile, memoryProfileDuration)
 	defaultBoomer.EnableCPUProfile(cpuProfile, cpuProfileDuration)
+	defaultBoomer.SetPprofAddr(pprofAddr)
+	defaultBoomer.SetTags(splitTags(tags)...)
+	defaultBoomer.SetExcludeTags(splitTags(excludeTags)...)
+	defaultBoomer.SetRunTime(runTime)
+	if startAt != "" {
+		t, err := time.Parse(time.RFC3339, startAt)
+		if err != nil {
+			logFatal("Invalid --start-at %s, expected a RFC3339 time, like 2006-01-02T15:04:05Z07:00\n", startAt)
+		}
+		defaultBoomer.SetStartAt(t)
+	}
+	defaultBoomer.SetRunID(runID)
+	labels, err := parseRunLabels(runLabels)
+	if err != nil {
+		logFatal("%v\n", err)
+	}
+	defaultBoomer.SetRunLabels(labels)
+	defaultBoomer.SetIterationLimit(iterations)
+	defaultBoomer.SetArrivalRate(arrivalRate)
+	interArrival, err := ParseInterArrival(arrivalDistribution)
+	if err != nil {
+		logFatal("%v\n", err)
+	}
+	defaultBoomer.SetInterArrival(interArrival)
+	hatchStrategy, err := ParseHatchStrategy(hatchStrategyName)
+	if err != nil {
+		logFatal("%v\n", err)
+	}
+	defaultBoomer.SetHatchStrategy(hatchStrategy)
+	defaultBoomer.SetMaxWorkers(maxWorkers)
+	defaultBoomer.SetExpectedWorkers(expectedWorkers)
+	defaultBoomer.SetMaxMemoryMB(maxMemoryMB)
+	defaultBoomer.SetStatsReportInterval(statsReportInterval)
+	defaultBoomer.SetStatsBatch(statsBatch)
+	defaultBoomer.SetStatsCompression(compressStats)
+	defaultBoomer.SetWarmupDuration(warmupDuration)
+	defaultBoomer.SetSummaryFile(summaryFile)
+	defaultBoomer.SetConsoleDashboard(consoleDashboard)
+	defaultBoomer.SetControlAddr(controlAddr)
+	if webUIAddr != "" {
+		// run without a master, the test is started by the web UI
+		defaultBoomer.SetMode(StandaloneMode)
+		defaultBoomer.SetWebUIAddr(webUIAddr)
+	}
+	if reportHTML != "" {
+		defaultBoomer.SetFinalReport(reportHTML, ReportHTML)
+	}
+	defaultBoomer.SetChecks(Checks{
+		FailRatio:       checkFailRatio,
+		AvgResponseTime: checkAvgResponseTime,
+		P95:             checkP95,
+	})
 
 	defaultBoomer.Run(tasks...)
 
 	quitByMe := false
 	quitChan := make(chan bool)
 
-	Events.SubscribeOnce("boomer:quit", func() {
+	defaultBoomer.Events().SubscribeOnce("boomer:quit", func() {
 		if !quitByMe {
 			close(quitChan)
 		}
 	})
 
-	c := make(chan os.Signal)
+	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
 
 	select {
@@ -264,7 +1497,10 @@ func Run(tasks ...*Task) {
 	case <-quitChan:
 	}
 
-	log.Println("shut down")
+	logInfo("shut down")
+	if defaultBoomer.ChecksFailed() {
+		os.Exit(1)
+	}
 }
 
 // RecordSuccess reports a success.
@@ -278,3 +1514,57 @@ func RecordSuccess(requestType, name string, responseTime int64, responseLength
 func RecordFailure(requestType, name string, responseTime int64, exception string) {
 	defaultBoomer.RecordFailure(requestType, name, responseTime, exception)
 }
+
+// RecordError reports a failure of err, which is classified into an ErrorCategory.
+// It's a convenience function to use the defaultBoomer.
+func RecordError(requestType, name string, responseTime int64, err error) {
+	defaultBoomer.RecordError(requestType, name, responseTime, err)
+}
+
+// RecordSuccessWithLabels reports a success with labels.
+// It's a convenience function to use the defaultBoomer.
+func RecordSuccessWithLabels(requestType, name string, labels map[string]string, responseTime int64, responseLength int64) {
+	defaultBoomer.RecordSuccessWithLabels(requestType, name, labels, responseTime, responseLength)
+}
+
+// RecordFailureWithLabels reports a failure with labels.
+// It's a convenience function to use the defaultBoomer.
+func RecordFailureWithLabels(requestType, name string, labels map[string]string, responseTime int64, exception string) {
+	defaultBoomer.RecordFailureWithLabels(requestType, name, labels, responseTime, exception)
+}
+
+// RecordSuccessWithRatio reports a success and returns the failure ratio of the last 10 seconds.
+// It's a convenience function to use the defaultBoomer.
+func RecordSuccessWithRatio(requestType, name string, responseTime int64, responseLength int64) float64 {
+	return defaultBoomer.RecordSuccessWithRatio(requestType, name, responseTime, responseLength)
+}
+
+// RecordFailureWithRatio reports a failure and returns the failure ratio of the last 10 seconds.
+// It's a convenience function to use the defaultBoomer.
+func RecordFailureWithRatio(requestType, name string, responseTime int64, exception string) float64 {
+	return defaultBoomer.RecordFailureWithRatio(requestType, name, responseTime, exception)
+}
+
+// OnTestStart adds a hook, which is called when the test starts.
+// It's a convenience function to use the defaultBoomer.
+func OnTestStart(hook func()) {
+	defaultBoomer.OnTestStart(hook)
+}
+
+// OnTestStop adds a hook, which is called when the test is stopped.
+// It's a convenience function to use the defaultBoomer.
+func OnTestStop(hook func()) {
+	defaultBoomer.OnTestStop(hook)
+}
+
+// RegisterMessage registers a handler of the custom messages of messageType from the master.
+// It's a convenience function to use the defaultBoomer.
+func RegisterMessage(messageType string, handler func(data interface{})) {
+	defaultBoomer.RegisterMessage(messageType, handler)
+}
+
+// SendCustomMessage sends a custom message of messageType to the master.
+// It's a convenience function to use the defaultBoomer.
+func SendCustomMessage(messageType string, data interface{}) {
+	defaultBoomer.SendCustomMessage(messageType, data)
+}
@@ -1,16 +1,24 @@
 package boomer
 
 import (
+	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"log"
 	"math"
 	"math/rand"
+	"net/http"
+	"net/url"
 	"os"
 	"runtime"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/asaskevich/EventBus"
 )
 
 func TestNewBoomer(t *testing.T) {
@@ -84,6 +92,262 @@ func TestAddOutput(t *testing.T) {
 	}
 }
 
+func TestSetResponseTimeSampleSize(t *testing.T) {
+	b := NewStandaloneBoomer(100, 10)
+	b.SetResponseTimeSampleSize(1000)
+	if b.responseTimeSampleSize != 1000 {
+		t.Error("responseTimeSampleSize should be 1000")
+	}
+
+	b.SetResponseTimeSampleSize(-1)
+	if b.responseTimeSampleSize != 1000 {
+		t.Error("Invalid responseTimeSampleSize should be ignored")
+	}
+}
+
+func TestSetStatsReportInterval(t *testing.T) {
+	b := NewStandaloneBoomer(100, 10)
+	if b.getStatsReportInterval() != slaveReportInterval {
+		t.Error("stats report interval should be", slaveReportInterval, "by default")
+	}
+
+	b.SetStatsReportInterval(time.Second)
+	b.SetStatsReportInterval(0)
+	if b.getStatsReportInterval() != time.Second {
+		t.Error("stats report interval should be 1 second, got", b.getStatsReportInterval())
+	}
+}
+
+func TestSetExpectedWorkers(t *testing.T) {
+	b := NewBoomer("localhost", 5557)
+	b.SetExpectedWorkers(5)
+	b.SetExpectedWorkers(-1)
+	if b.expectedWorkers != 5 {
+		t.Error("expectedWorkers should be 5, got", b.expectedWorkers)
+	}
+}
+
+func TestSetStatsBatch(t *testing.T) {
+	b := NewBoomer("localhost", 5557)
+	b.SetStatsBatch(5)
+	b.SetStatsCompression(true)
+	if b.statsBatch != 5 || !b.statsCompression {
+		t.Error("The stats batch and compression should be set")
+	}
+
+	b.SetStatsBatch(0)
+	if b.statsBatch != 5 {
+		t.Error("Invalid stats batch should be ignored")
+	}
+}
+
+func TestSetDrainTimeout(t *testing.T) {
+	b := NewStandaloneBoomer(100, 10)
+	b.SetDrainTimeout(5 * time.Second)
+	b.SetDrainTimeout(-time.Second)
+	if b.drainTimeout != 5*time.Second {
+		t.Error("drainTimeout should be 5 seconds, got", b.drainTimeout)
+	}
+}
+
+func TestSetWarmupDuration(t *testing.T) {
+	b := NewStandaloneBoomer(100, 10)
+	b.SetWarmupDuration(30 * time.Second)
+	b.SetWarmupDuration(-time.Second)
+	if b.warmupDuration != 30*time.Second {
+		t.Error("warmupDuration should be 30 seconds, got", b.warmupDuration)
+	}
+}
+
+func TestSetClientBackend(t *testing.T) {
+	b := NewBoomer("localhost", 5557)
+	b.SetClientBackend("gomq")
+	b.SetClientBackend("udp")
+	if b.backend != "gomq" {
+		t.Error("backend should be gomq, got", b.backend)
+	}
+}
+
+func TestSetClientID(t *testing.T) {
+	b := NewBoomer("localhost", 5557)
+	b.SetClientID("worker-1")
+	b.SetClientID("")
+	if b.clientID != "worker-1" {
+		t.Error("clientID should be worker-1, got", b.clientID)
+	}
+}
+
+func TestSetMasterTLS(t *testing.T) {
+	b := NewBoomer("localhost", 5557)
+	config := &tls.Config{}
+	b.SetMasterTLS(config)
+	b.SetMasterTLS(nil)
+	if b.security.tls != config {
+		t.Error("The TLS config should be set, got", b.security.tls)
+	}
+
+	client := newGomqClient("localhost", 5557, "testing tls", b.security)
+	if err := client.connect(); err == nil {
+		t.Error("gomq client should refuse to connect with TLS")
+	}
+}
+
+func TestSetCurveSecurity(t *testing.T) {
+	serverKey := "rq:rM>}U?@Lns47E1%kR.o@n%FcmmsL/@{H8]yf7"
+	publicKey := "Yne@$w-vo<fVvi]a<NY6T1ed:M$fCG*[IaLV{hID"
+	secretKey := "D:)Q[IlAW!ahhC2ac:9*A}h:p?([4%wOTJ%JR%cs"
+
+	b := NewBoomer("localhost", 5557)
+	b.SetCurveSecurity(serverKey, publicKey, "too short")
+	if b.security.curve() {
+		t.Error("Invalid CURVE keys should be ignored")
+	}
+
+	b.SetCurveSecurity(serverKey, publicKey, secretKey)
+	if !b.security.curve() || b.security.curveSecretKey != secretKey {
+		t.Error("CURVE security should be enabled")
+	}
+
+	b.SetPlainSecurity("", "secret")
+	if !b.security.curve() {
+		t.Error("Invalid PLAIN username should be ignored")
+	}
+	b.SetPlainSecurity("boomer", "secret")
+	if b.security.curve() || !b.security.plain() || b.security.plainPassword != "secret" {
+		t.Error("PLAIN security should replace CURVE security")
+	}
+}
+
+func TestOnTestStartAndStop(t *testing.T) {
+	b := NewStandaloneBoomer(100, 10)
+	b.OnTestStart(func() {})
+	b.OnTestStart(func() {})
+	b.OnTestStop(func() {})
+	if len(b.testStartHooks) != 2 || len(b.testStopHooks) != 1 {
+		t.Error("The hooks should be added, got", len(b.testStartHooks), len(b.testStopHooks))
+	}
+}
+
+func TestSetAggregationMode(t *testing.T) {
+	b := NewStandaloneBoomer(100, 10)
+	if b.aggregationMode != ByName {
+		t.Error("aggregationMode should be ByName by default")
+	}
+
+	b.SetAggregationMode(ByType)
+	if b.aggregationMode != ByType {
+		t.Error("aggregationMode should be ByType")
+	}
+
+	b.SetAggregationMode(AggregationMode(10))
+	if b.aggregationMode != ByType {
+		t.Error("Invalid aggregationMode should be ignored")
+	}
+}
+
+func TestSetErrorExemplars(t *testing.T) {
+	b := NewStandaloneBoomer(100, 10)
+	b.SetErrorExemplars(5)
+	if b.errorExemplars != 5 {
+		t.Error("errorExemplars should be 5, got", b.errorExemplars)
+	}
+
+	b.SetErrorExemplars(-1)
+	if b.errorExemplars != 5 {
+		t.Error("Invalid errorExemplars should be ignored")
+	}
+}
+
+func TestSetErrorNormalizer(t *testing.T) {
+	b := NewStandaloneBoomer(100, 10)
+	b.SetErrorNormalizer(strings.ToLower)
+	if b.errorNormalizer == nil || b.errorNormalizer("Timeout") != "timeout" {
+		t.Error("errorNormalizer should be set")
+	}
+}
+
+func TestSetAdaptiveLoad(t *testing.T) {
+	b := NewStandaloneBoomer(100, 10)
+	b.SetAdaptiveLoad(AdaptiveLoad{TargetP99: 300, MaxRPS: 1000})
+	b.SetAdaptiveLoad(AdaptiveLoad{TargetP99: 300, Backoff: 2})
+	if b.adaptiveLoad.TargetP99 != 300 || b.adaptiveLoad.Backoff != 0 {
+		t.Error("Invalid adaptive load should be ignored, got", b.adaptiveLoad)
+	}
+	if b.Capacity() != 0 {
+		t.Error("The capacity should be 0 before the test is started")
+	}
+}
+
+func TestAddSLO(t *testing.T) {
+	b := NewStandaloneBoomer(100, 10)
+	b.AddSLO(SLO{Name: "foo", Metric: SLOP99, Threshold: 300})
+	b.AddSLO(SLO{Name: "foo", Metric: SLOP99})
+	if len(b.slos) != 1 {
+		t.Error("Invalid SLOs should be ignored, got", b.slos)
+	}
+	if b.SLOStatuses() != nil {
+		t.Error("There should be no statuses before the test is started")
+	}
+}
+
+func TestSetWebUIAddr(t *testing.T) {
+	b := NewStandaloneBoomer(100, 10)
+	b.SetWebUIAddr(":8080")
+	if b.webUIAddr != ":8080" {
+		t.Error("webUIAddr should be :8080")
+	}
+}
+
+func TestSetConsoleDashboard(t *testing.T) {
+	b := NewStandaloneBoomer(100, 10)
+	b.SetConsoleDashboard(true)
+	if !b.consoleDashboard {
+		t.Error("consoleDashboard should be true")
+	}
+}
+
+func TestSetMasterMessageInterceptor(t *testing.T) {
+	b := NewBoomer("0.0.0.0", 1234)
+	b.SetMasterMessageInterceptor(func(msg *Message) *Message {
+		return msg
+	})
+	if b.masterMessageInterceptor == nil {
+		t.Error("masterMessageInterceptor should not be nil")
+	}
+}
+
+type failedOutput struct {
+	HitOutput
+}
+
+func (o *failedOutput) Init() error {
+	return fmt.Errorf("can't bind the port")
+}
+
+func TestInitOutputs(t *testing.T) {
+	b := NewStandaloneBoomer(100, 10)
+	ok := &HitOutput{}
+	failed := &failedOutput{}
+	rawSampleOutput := NewRawSampleFileOutput(os.TempDir() + "/not-exist/samples.csv")
+
+	outputs, rawSampleOutputs, err := b.initOutputs([]Output{ok, failed}, []RawSampleOutput{rawSampleOutput})
+	if err != nil {
+		t.Error("initOutputs should not return an error if strict outputs are disabled, got", err)
+	}
+	if len(outputs) != 1 || outputs[0] != ok {
+		t.Error("The failed output should be dropped")
+	}
+	if len(rawSampleOutputs) != 0 {
+		t.Error("The failed raw sample output should be dropped")
+	}
+
+	b.SetStrictOutputs(true)
+	_, _, err = b.initOutputs([]Output{ok, failed}, nil)
+	if err == nil {
+		t.Error("initOutputs should return an error if strict outputs are enabled")
+	}
+}
+
 func TestEnableCPUProfile(t *testing.T) {
 	b := NewStandaloneBoomer(100, 10)
 	b.EnableCPUProfile("cpu.prof", time.Second)
@@ -110,6 +374,15 @@ func TestEnableMemoryProfile(t *testing.T) {
 	}
 }
 
+func TestSetPprofAddr(t *testing.T) {
+	b := NewStandaloneBoomer(100, 10)
+	b.SetPprofAddr(":6060")
+
+	if b.pprofAddr != ":6060" {
+		t.Error("pprofAddr should be :6060")
+	}
+}
+
 func TestStandaloneRun(t *testing.T) {
 	b := NewStandaloneBoomer(10, 10)
 	b.EnableCPUProfile("cpu.pprof", 2*time.Second)
@@ -146,6 +419,575 @@ func TestStandaloneRun(t *testing.T) {
 	}
 }
 
+func TestSetTags(t *testing.T) {
+	b := NewStandaloneBoomer(3, 100)
+	b.SetTags(splitTags("api, ")...)
+	b.SetExcludeTags(splitTags("slow")...)
+
+	var lock sync.Mutex
+	calls := map[string]int{}
+	createTask := func(name string, tags ...string) *Task {
+		return &Task{
+			Name: name,
+			Tags: tags,
+			Fn: func() {
+				lock.Lock()
+				calls[name]++
+				lock.Unlock()
+				runtime.Goexit()
+			},
+		}
+	}
+	go b.Run(createTask("api", "api"), createTask("slow", "api", "slow"), createTask("untagged"))
+	defer b.Quit()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		lock.Lock()
+		n := calls["api"]
+		lock.Unlock()
+		if n == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("The users should run the tagged task, calls:", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if calls["slow"] != 0 || calls["untagged"] != 0 {
+		t.Error("Only the tasks with the tags but not the excluded tags should be run, got", calls)
+	}
+}
+
+func TestAddTask(t *testing.T) {
+	b := NewStandaloneBoomer(2, 100)
+	b.SetTags("api")
+	b.AddTask(&Task{Name: "early", Fn: func() {}})
+	if b.RemoveTask("early") {
+		t.Error("AddTask and RemoveTask should be ignored before Run")
+	}
+
+	called := make(chan bool, 1)
+	sleep := &Task{Name: "sleep", Tags: []string{"api"}, Fn: func() {}, WaitTime: Constant(time.Minute)}
+	go b.Run(sleep)
+	defer b.Quit()
+	for state, users := b.State(); state != stateRunning || users != 2; state, users = b.State() {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	b.AddTask(&Task{Name: "untagged", Fn: func() {}})
+	b.AddTask(&Task{
+		Name: "added",
+		Tags: []string{"api"},
+		Fn: func() {
+			select {
+			case called <- true:
+			default:
+			}
+			runtime.Goexit()
+		},
+	})
+	select {
+	case <-called:
+	case <-time.After(3 * time.Second):
+		t.Fatal("The added task should be run")
+	}
+	if b.RemoveTask("untagged") {
+		t.Error("The task which doesn't match the tags shouldn't be added")
+	}
+	if !b.RemoveTask("added") {
+		t.Error("The added task should be removed")
+	}
+}
+
+func TestBoomerEventsAndHooks(t *testing.T) {
+	b := NewStandaloneBoomer(10, 10)
+	if b.Events() != Events || b.Hooks() != DefaultHooks {
+		t.Error("The package-level Events and DefaultHooks should be used by default")
+	}
+	b.SetEvents(nil)
+	b.SetHooks(nil)
+	if b.Events() != Events || b.Hooks() != DefaultHooks {
+		t.Error("Invalid event bus and hooks should be ignored")
+	}
+
+	events := EventBus.New()
+	hooks := &Hooks{}
+	b.SetEvents(events)
+	b.SetHooks(hooks)
+	if b.Events() != events || b.Hooks() != hooks {
+		t.Error("The event bus and the hooks should be set")
+	}
+}
+
+func TestMultipleBoomers(t *testing.T) {
+	globalQuits := int32(0)
+	globalReceiver := func() {
+		atomic.AddInt32(&globalQuits, 1)
+	}
+	Events.Subscribe("boomer:quit", globalReceiver)
+	defer Events.Unsubscribe("boomer:quit", globalReceiver)
+
+	boomers := make([]*Boomer, 2)
+	quits := make([]int32, 2)
+	hookQuits := make([]int32, 2)
+	for i := range boomers {
+		i := i
+		b := NewStandaloneBoomer(i+1, 10)
+		b.SetEvents(EventBus.New())
+		b.SetHooks(&Hooks{})
+		b.Events().Subscribe("boomer:quit", func() {
+			atomic.AddInt32(&quits[i], 1)
+		})
+		b.Hooks().OnQuit(func() {
+			atomic.AddInt32(&hookQuits[i], 1)
+		})
+		task := &Task{
+			Name: fmt.Sprintf("task%d", i),
+			Fn: func() {
+				b.RecordSuccess("http", fmt.Sprintf("foo%d", i), 1, 10)
+				time.Sleep(10 * time.Millisecond)
+			},
+		}
+		go b.Run(task)
+		boomers[i] = b
+	}
+
+	for i, b := range boomers {
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			if state, users := b.State(); state == stateRunning && users == i+1 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("Boomer", i, "should run", i+1, "users")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	boomers[0].Quit()
+	if atomic.LoadInt32(&quits[0]) != 1 || atomic.LoadInt32(&hookQuits[0]) != 1 {
+		t.Error("The quit event should be published to the first boomer")
+	}
+	if atomic.LoadInt32(&quits[1]) != 0 || atomic.LoadInt32(&hookQuits[1]) != 0 || atomic.LoadInt32(&globalQuits) != 0 {
+		t.Error("The quit event shouldn't be published to the others")
+	}
+	if state, users := boomers[1].State(); state != stateRunning || users != 2 {
+		t.Error("The second boomer should keep running, got", state, users)
+	}
+
+	boomers[1].Quit()
+	if atomic.LoadInt32(&quits[1]) != 1 || atomic.LoadInt32(&globalQuits) != 0 {
+		t.Error("The quit event should be published to the second boomer only")
+	}
+}
+
+func TestAddStage(t *testing.T) {
+	b := NewStandaloneBoomer(100, 10)
+	b.AddStage(time.Minute, 10, 1)
+	b.AddStage(0, 10, 1)
+	b.AddStage(time.Minute, -1, 1)
+	b.AddStage(time.Minute, 10, 0)
+	b.AddStage(time.Minute, 0, 1)
+
+	if len(b.stages) != 2 {
+		t.Fatal("invalid stages should be ignored, got", len(b.stages))
+	}
+	if b.stages[1].users != 0 {
+		t.Error("the users of the second stage should be 0")
+	}
+}
+
+func TestStandaloneRunStages(t *testing.T) {
+	b := NewStandaloneBoomer(100, 10)
+	b.AddStage(300*time.Millisecond, 2, 1000)
+	b.AddStage(300*time.Millisecond, 5, 1000)
+	b.AddStage(300*time.Millisecond, 1, 1000)
+
+	taskA := &Task{
+		Name: "sleep",
+		Fn: func() {
+			time.Sleep(10 * time.Millisecond)
+		},
+	}
+	done := make(chan bool)
+	go func() {
+		b.Run(taskA)
+		close(done)
+	}()
+
+	time.Sleep(150 * time.Millisecond)
+	if n := atomic.LoadInt32(&b.localRunner.numClients); n != 2 {
+		t.Error("expected 2 users in the first stage, got", n)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if n := atomic.LoadInt32(&b.localRunner.numClients); n != 5 {
+		t.Error("expected 5 users in the second stage, got", n)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if n := atomic.LoadInt32(&b.localRunner.numClients); n != 1 {
+		t.Error("expected 1 user in the third stage, got", n)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("boomer should quit after the last stage")
+	}
+	// Quit after the stages are finished must be safe
+	b.Quit()
+}
+
+func TestUpdateUserCount(t *testing.T) {
+	b := NewStandaloneBoomer(5, 1000)
+
+	canceled := int32(0)
+	taskA := &Task{
+		Name: "wait",
+		FnWithContext: func(ctx context.Context) {
+			<-ctx.Done()
+			atomic.AddInt32(&canceled, 1)
+		},
+	}
+	// ignored before the test is started
+	b.UpdateUserCount(10)
+
+	go b.Run(taskA)
+	defer b.Quit()
+
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt32(&b.localRunner.numClients); n != 5 {
+		t.Fatal("expected 5 users, got", n)
+	}
+
+	b.UpdateUserCount(2)
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt32(&b.localRunner.numClients); n != 2 {
+		t.Error("expected 2 users after ramping down, got", n)
+	}
+	if n := atomic.LoadInt32(&canceled); n != 3 {
+		t.Error("the contexts of 3 excess users should be canceled, got", n)
+	}
+
+	b.UpdateUserCount(-1)
+	b.UpdateUserCount(4)
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt32(&b.localRunner.numClients); n != 4 {
+		t.Error("expected 4 users after ramping up, got", n)
+	}
+}
+
+func TestStandaloneRunWithWebUI(t *testing.T) {
+	b := NewStandaloneBoomer(0, 0)
+	b.SetWebUIAddr("127.0.0.1:0")
+	taskA := &Task{
+		Name: "wait",
+		FnWithContext: func(ctx context.Context) {
+			<-ctx.Done()
+		},
+	}
+	go b.Run(taskA)
+	defer b.Quit()
+
+	time.Sleep(100 * time.Millisecond)
+	if state, users := b.State(); state != stateInit || users != 0 {
+		t.Fatal("The test should wait to be started by the web UI, got", state, users)
+	}
+	var webUI *webStatusOutput
+	for _, o := range b.localRunner.outputs {
+		if w, ok := o.(*webStatusOutput); ok {
+			webUI = w
+		}
+	}
+	if webUI == nil || webUI.controller == nil {
+		t.Fatal("The web UI should control the runner")
+	}
+	addr := "http://" + webUI.listener.Addr().String()
+
+	waitForUsers := func(n int) {
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			if _, users := b.State(); users == n {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("Expected", n, "users")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	post := func(path string, form url.Values) {
+		resp, err := http.PostForm(addr+path, form)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatal("Expected status code 200 after the redirection, got", resp.StatusCode)
+		}
+	}
+
+	post("/start", url.Values{"users": {"3"}, "spawn_rate": {"1000"}})
+	waitForUsers(3)
+	post("/start", url.Values{"users": {"1"}, "spawn_rate": {"1000"}})
+	waitForUsers(1)
+	post("/stop", nil)
+	if state, users := b.State(); state != stateStopped || users != 0 {
+		t.Error("The test should be stopped, got", state, users)
+	}
+	post("/start", url.Values{"users": {"2"}, "spawn_rate": {"1000"}})
+	waitForUsers(2)
+}
+
+func TestUpdateUserCountInDistributedMode(t *testing.T) {
+	b := NewBoomer("localhost", 5557)
+	// must not panic
+	b.UpdateUserCount(10)
+}
+
+func TestState(t *testing.T) {
+	defaultHooks := DefaultHooks
+	DefaultHooks = &Hooks{}
+	defer func() {
+		DefaultHooks = defaultHooks
+	}()
+	states := make(chan string, 10)
+	DefaultHooks.OnStateChange(func(state string) {
+		states <- state
+	})
+
+	b := NewStandaloneBoomer(5, 1000)
+	if state, users := b.State(); state != stateInit || users != 0 {
+		t.Error("expected ready and 0 users before the test is started, got", state, users)
+	}
+
+	taskA := &Task{
+		Name: "sleep",
+		Fn: func() {
+			time.Sleep(10 * time.Millisecond)
+		},
+	}
+	go b.Run(taskA)
+	time.Sleep(100 * time.Millisecond)
+	if state, users := b.State(); state != stateRunning || users != 5 {
+		t.Error("expected running and 5 users, got", state, users)
+	}
+
+	b.Quit()
+	if state, users := b.State(); state != stateStopped || users != 0 {
+		t.Error("expected stopped and 0 users after quit, got", state, users)
+	}
+
+	transitions := make([]string, 0)
+	for len(states) > 0 {
+		transitions = append(transitions, <-states)
+	}
+	if fmt.Sprint(transitions) != fmt.Sprint([]string{stateInit, stateSpawning, stateRunning, stateStopped}) {
+		t.Error("unexpected state transitions", transitions)
+	}
+}
+
+func TestSetRunTime(t *testing.T) {
+	b := NewStandaloneBoomer(100, 10)
+	b.SetRunTime(time.Minute)
+	b.SetRunTime(-time.Second)
+	if b.runTime != time.Minute {
+		t.Error("runTime should be 1 minute, got", b.runTime)
+	}
+}
+
+func TestStandaloneRunTime(t *testing.T) {
+	b := NewStandaloneBoomer(1, 10)
+	b.SetRunTime(300 * time.Millisecond)
+	output := &lastEventOutput{}
+	b.AddOutput(output)
+
+	taskA := &Task{
+		Name: "sleep",
+		Fn: func() {
+			time.Sleep(10 * time.Millisecond)
+		},
+	}
+	done := make(chan bool)
+	go func() {
+		b.Run(taskA)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("boomer should quit after the run time")
+	}
+	if output.eventBeforeStop == nil {
+		t.Error("the last interval should be delivered before OnStop")
+	}
+}
+
+func TestSetIterationLimit(t *testing.T) {
+	b := NewStandaloneBoomer(100, 10)
+	b.SetIterationLimit(1000)
+	b.SetIterationLimit(-1)
+	if b.iterationLimit != 1000 {
+		t.Error("iterationLimit should be 1000, got", b.iterationLimit)
+	}
+}
+
+func TestStandaloneIterationLimit(t *testing.T) {
+	b := NewStandaloneBoomer(5, 100)
+	b.SetIterationLimit(100)
+	output := &lastEventOutput{}
+	b.AddOutput(output)
+
+	count := int64(0)
+	taskA := &Task{
+		Name: "increaseCount",
+		Fn: func() {
+			atomic.AddInt64(&count, 1)
+			time.Sleep(time.Millisecond)
+		},
+	}
+	done := make(chan bool)
+	go func() {
+		b.Run(taskA)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("boomer should quit after the iterations")
+	}
+	if atomic.LoadInt64(&count) != 100 {
+		t.Error("The task should be called 100 times, got", atomic.LoadInt64(&count))
+	}
+	if output.eventBeforeStop == nil {
+		t.Error("the last interval should be delivered before OnStop")
+	}
+}
+
+func TestSetArrivalRate(t *testing.T) {
+	b := NewStandaloneBoomer(100, 10)
+	b.SetArrivalRate(50)
+	b.SetArrivalRate(-1)
+	b.SetArrivalRate(math.Inf(1))
+	if b.arrivalRate != 50 {
+		t.Error("arrivalRate should be 50, got", b.arrivalRate)
+	}
+
+	b.SetInterArrival(ExponentialInterArrival)
+	b.SetInterArrival(nil)
+	if b.interArrival == nil {
+		t.Error("The inter-arrival distribution should be kept")
+	}
+}
+
+func TestSetResourceLimits(t *testing.T) {
+	b := NewStandaloneBoomer(10, 10)
+	b.SetMaxWorkers(100)
+	b.SetMaxMemoryMB(512)
+	if b.maxWorkers != 100 || b.maxMemoryMB != 512 {
+		t.Error("The resource limits should be set")
+	}
+
+	b.SetMaxWorkers(-1)
+	b.SetMaxMemoryMB(-1)
+	if b.maxWorkers != 100 || b.maxMemoryMB != 512 {
+		t.Error("Invalid resource limits should be ignored")
+	}
+}
+
+func TestStandaloneArrivalRate(t *testing.T) {
+	run := func(users int, taskTime time.Duration) (count int64, dropped int64) {
+		b := NewStandaloneBoomer(users, 0)
+		b.SetArrivalRate(100)
+		task := &Task{
+			Name: "sleep",
+			Fn: func() {
+				atomic.AddInt64(&count, 1)
+				time.Sleep(taskTime)
+			},
+		}
+		go b.Run(task)
+		time.Sleep(500 * time.Millisecond)
+		b.Quit()
+		return atomic.LoadInt64(&count), b.DroppedArrivals()
+	}
+
+	// the iterations are paced by the arrivals, not by the users
+	count, _ := run(10, time.Millisecond)
+	if count < 30 || count > 60 {
+		t.Error("Expected about 50 iterations in 500ms at 100/s, got", count)
+	}
+
+	// a slow target doesn't slow down the arrivals, the arrivals are dropped if the user is busy
+	count, dropped := run(1, 50*time.Millisecond)
+	if count > 12 {
+		t.Error("Expected at most 10 iterations of 50ms by a user in 500ms, got", count)
+	}
+	if dropped < 30 {
+		t.Error("Expected the arrivals to be dropped when the user is busy, got", dropped)
+	}
+}
+
+type lastEventOutput struct {
+	lastEvent map[string]interface{}
+	// the last event received before OnStop is called
+	eventBeforeStop map[string]interface{}
+}
+
+func (o *lastEventOutput) OnStart() {}
+
+func (o *lastEventOutput) OnEvent(data map[string]interface{}) {
+	o.lastEvent = data
+}
+
+func (o *lastEventOutput) OnStop() {
+	o.eventBeforeStop = o.lastEvent
+}
+
+func TestQuitDeliversLastInterval(t *testing.T) {
+	b := NewStandaloneBoomer(1, 10)
+	output := &lastEventOutput{}
+	b.AddOutput(output)
+
+	taskA := &Task{
+		Name: "sleep",
+		Fn: func() {
+			time.Sleep(10 * time.Millisecond)
+		},
+	}
+	go b.Run(taskA)
+
+	time.Sleep(500 * time.Millisecond)
+
+	b.RecordSuccess("http", "last", int64(1), int64(10))
+	b.Quit()
+
+	if output.eventBeforeStop == nil {
+		t.Fatal("Output should receive the last interval's data before OnStop")
+	}
+	found := false
+	for _, stat := range output.eventBeforeStop["stats"].([]interface{}) {
+		s := stat.(map[string]interface{})
+		if s["name"].(string) == "last" && s["num_requests"].(int64) == int64(1) {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("The request recorded right before Quit is not found in the last interval's data")
+	}
+	if _, ok := output.eventBeforeStop["current_memory_usage"].(uint64); !ok {
+		t.Error("The memory usage should be reported to the outputs")
+	}
+	if _, ok := output.eventBeforeStop["current_cpu_usage"].(float64); !ok {
+		t.Error("The CPU usage should be reported to the outputs")
+	}
+}
+
 func TestDistributedRun(t *testing.T) {
 	masterHost := "0.0.0.0"
 	rand.Seed(Now())
@@ -267,8 +1109,27 @@ func TestCreateRatelimiter(t *testing.T) {
 	}
 }
 
+func TestCreateDistributedRateLimiter(t *testing.T) {
+	rateLimiter, err := createDistributedRateLimiter(100, "-1")
+	if distributedRateLimiter, ok := rateLimiter.(*DistributedRateLimiter); !ok || err != nil {
+		t.Error("Expected distributedRateLimiter, got", err)
+	} else if distributedRateLimiter.globalThreshold != 100 {
+		t.Error("globalThreshold should be equals to 100, was", distributedRateLimiter.globalThreshold)
+	}
+
+	if _, err := createDistributedRateLimiter(0, "-1"); err == nil {
+		t.Error("Expected error without max RPS")
+	}
+	if _, err := createDistributedRateLimiter(100, "1"); err == nil {
+		t.Error("Expected error with an increase rate")
+	}
+}
+
 func TestRun(t *testing.T) {
-	flag.Parse()
+	RegisterFlags(flag.CommandLine)
+	defer func() {
+		boomerFlags = nil
+	}()
 
 	masterHost = "0.0.0.0"
 	rand.Seed(Now())
@@ -315,7 +1176,11 @@ func TestRecordSuccess(t *testing.T) {
 	defaultBoomer.slaveRunner = newSlaveRunner(masterHost, masterPort, nil, nil)
 	RecordSuccess("http", "foo", int64(1), int64(10))
 
-	requestSuccessMsg := <-defaultBoomer.slaveRunner.stats.requestSuccessChan
+	successes, _ := takeRecords(defaultBoomer.slaveRunner.stats)
+	if len(successes) != 1 {
+		t.Fatal("Expected 1 success, got:", len(successes))
+	}
+	requestSuccessMsg := successes[0]
 	if requestSuccessMsg.requestType != "http" {
 		t.Error("Expected: http, got:", requestSuccessMsg.requestType)
 	}
@@ -325,6 +1190,21 @@ func TestRecordSuccess(t *testing.T) {
 	defaultBoomer = nil
 }
 
+func TestDroppedRecords(t *testing.T) {
+	b := NewBoomer("127.0.0.1", 5557)
+	if b.DroppedRecords() != 0 {
+		t.Error("Nothing should be dropped before boomer runs")
+	}
+	b.slaveRunner = newSlaveRunner("127.0.0.1", 5557, nil, nil)
+	b.slaveRunner.stats.records = newRecordBuffer(1, recordBufferSize)
+	for i := 0; i <= recordBufferSize; i++ {
+		b.RecordSuccess("http", "foo", 1, 10)
+	}
+	if b.DroppedRecords() != 1 {
+		t.Error("The record should be dropped instead of blocking once the buffer is full, got", b.DroppedRecords())
+	}
+}
+
 func TestRecordFailure(t *testing.T) {
 	masterHost := "127.0.0.1"
 	masterPort := 5557
@@ -332,7 +1212,11 @@ func TestRecordFailure(t *testing.T) {
 	defaultBoomer.slaveRunner = newSlaveRunner(masterHost, masterPort, nil, nil)
 	RecordFailure("udp", "bar", int64(2), "udp error")
 
-	requestFailureMsg := <-defaultBoomer.slaveRunner.stats.requestFailureChan
+	_, failures := takeRecords(defaultBoomer.slaveRunner.stats)
+	if len(failures) != 1 {
+		t.Fatal("Expected 1 failure, got:", len(failures))
+	}
+	requestFailureMsg := failures[0]
 	if requestFailureMsg.requestType != "udp" {
 		t.Error("Expected: udp, got:", requestFailureMsg.requestType)
 	}
@@ -344,3 +1228,188 @@ func TestRecordFailure(t *testing.T) {
 	}
 	defaultBoomer = nil
 }
+
+func TestRecordError(t *testing.T) {
+	masterHost := "127.0.0.1"
+	masterPort := 5557
+	defaultBoomer = NewBoomer(masterHost, masterPort)
+	defaultBoomer.slaveRunner = newSlaveRunner(masterHost, masterPort, nil, nil)
+	RecordError("http", "foo", int64(2), &StatusError{Code: 503})
+	RecordError("http", "foo", int64(2), nil)
+
+	_, failures := takeRecords(defaultBoomer.slaveRunner.stats)
+	if len(failures) != 1 {
+		t.Fatal("Expected 1 failure, the nil error should be ignored, got:", len(failures))
+	}
+	if failures[0].error != "HTTP 503" || failures[0].category != ErrorHTTPServer {
+		t.Error("Expected: HTTP 503 of http_5xx, got:", failures[0].error, failures[0].category)
+	}
+	defaultBoomer = nil
+}
+
+func TestRecordWithRatio(t *testing.T) {
+	masterHost := "127.0.0.1"
+	masterPort := 5557
+	defaultBoomer = NewBoomer(masterHost, masterPort)
+	defaultBoomer.slaveRunner = newSlaveRunner(masterHost, masterPort, nil, nil)
+
+	if ratio := RecordSuccessWithRatio("http", "foo", int64(1), int64(10)); ratio != 0 {
+		t.Error("Expected: 0, got:", ratio)
+	}
+	if ratio := RecordFailureWithRatio("http", "foo", int64(1), "error"); ratio != 0.5 {
+		t.Error("Expected: 0.5, got:", ratio)
+	}
+	RecordSuccess("http", "foo", int64(1), int64(10))
+	if ratio := RecordFailureWithRatio("http", "foo", int64(1), "error"); ratio != 0.5 {
+		t.Error("Expected: 0.5, got:", ratio)
+	}
+
+	successes, failures := takeRecords(defaultBoomer.slaveRunner.stats)
+	if len(successes) != 2 {
+		t.Error("Expected 2 successes to be sent to the stats goroutine")
+	}
+	if len(failures) != 2 {
+		t.Error("Expected 2 failures to be sent to the stats goroutine")
+	}
+	defaultBoomer = nil
+}
+
+func TestSetFinalReport(t *testing.T) {
+	b := NewStandaloneBoomer(100, 10)
+	b.SetFinalReport("report.html", ReportHTML)
+	if b.finalReportPath != "report.html" || b.finalReportFormat != ReportHTML {
+		t.Error("The final report should be report.html in HTML")
+	}
+
+	b.SetFinalReport("report.txt", ReportFormat(10))
+	if b.finalReportPath != "report.html" {
+		t.Error("Invalid report format should be ignored")
+	}
+}
+
+func TestSetChecks(t *testing.T) {
+	b := NewStandaloneBoomer(100, 10)
+	b.SetChecks(Checks{FailRatio: 0.01, P95: 100})
+	if b.checks.FailRatio != 0.01 || b.checks.P95 != 100 {
+		t.Error("The checks should be set")
+	}
+
+	b.SetChecks(Checks{FailRatio: -1})
+	if b.checks.FailRatio != 0.01 {
+		t.Error("Invalid checks should be ignored")
+	}
+	if b.ChecksFailed() {
+		t.Error("The checks shouldn't fail before the test is run")
+	}
+}
+
+func TestSetCircuitBreaker(t *testing.T) {
+	b := NewStandaloneBoomer(100, 10)
+	b.SetCircuitBreaker("foo", CircuitBreaker{FailRatio: 0.5, CoolDown: time.Minute})
+	if b.circuitBreakers["foo"].FailRatio != 0.5 {
+		t.Error("The circuit breaker should be set")
+	}
+
+	b.SetCircuitBreaker("bar", CircuitBreaker{FailRatio: 0.5})
+	b.SetCircuitBreaker("", CircuitBreaker{FailRatio: 0.5, CoolDown: time.Minute})
+	if len(b.circuitBreakers) != 1 {
+		t.Error("Invalid circuit breakers should be ignored")
+	}
+}
+
+func TestSetSummaryFile(t *testing.T) {
+	b := NewStandaloneBoomer(100, 10)
+	b.SetSummaryFile("summary.txt")
+	if b.summaryFile != "summary.txt" {
+		t.Error("The summary file should be summary.txt")
+	}
+}
+
+func TestRecordDoesNotAllocate(t *testing.T) {
+	b := NewBoomer("127.0.0.1", 5557)
+	b.slaveRunner = newSlaveRunner("127.0.0.1", 5557, nil, nil)
+	stats := b.slaveRunner.stats
+	// grow the buffers of the shards, they are reused by the next flushes
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 2000; j++ {
+			b.RecordSuccess("http", "foo", 1, 10)
+			b.RecordFailure("http", "foo", 1, "500 error")
+		}
+		stats.flushRecords()
+	}
+
+	timer := b.StartTimer()
+	allocs := testing.AllocsPerRun(500, func() {
+		b.RecordSuccess("http", "foo", 1, 10)
+		b.RecordFailure("http", "foo", 1, "500 error")
+		timer.RecordSuccess("http", "foo", 10)
+	})
+	if allocs != 0 {
+		t.Error("Recording shouldn't allocate, got", allocs)
+	}
+}
+
+func benchmarkRecord(b *testing.B, record func(boomer *Boomer)) {
+	boomer := NewBoomer("127.0.0.1", 5557)
+	boomer.slaveRunner = newSlaveRunner("127.0.0.1", 5557, nil, nil)
+	stats := boomer.slaveRunner.stats
+	stats.setReportInterval(time.Hour)
+	stats.start()
+	defer stats.close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			record(boomer)
+		}
+	})
+}
+
+func BenchmarkRecordSuccess(b *testing.B) {
+	benchmarkRecord(b, func(boomer *Boomer) {
+		boomer.RecordSuccess("http", "foo", 10, 100)
+	})
+}
+
+func BenchmarkRecordFailure(b *testing.B) {
+	benchmarkRecord(b, func(boomer *Boomer) {
+		boomer.RecordFailure("http", "foo", 10, "500 error")
+	})
+}
+
+func BenchmarkRecordSuccessWithLabels(b *testing.B) {
+	labels := map[string]string{"region": "us-east"}
+	benchmarkRecord(b, func(boomer *Boomer) {
+		boomer.RecordSuccessWithLabels("http", "foo", labels, 10, 100)
+	})
+}
+
+func TestParseRunLabels(t *testing.T) {
+	labels, err := parseRunLabels(" env=staging, build=42,,url=http://a?b=c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(labels) != 3 || labels["env"] != "staging" || labels["build"] != "42" || labels["url"] != "http://a?b=c" {
+		t.Error("Unexpected labels", labels)
+	}
+	if labels, err := parseRunLabels(""); err != nil || len(labels) != 0 {
+		t.Error("Empty labels should be parsed, got", labels, err)
+	}
+	for _, s := range []string{"env", "=staging"} {
+		if _, err := parseRunLabels(s); err == nil {
+			t.Error("Invalid labels should be refused", s)
+		}
+	}
+}
+
+func TestSetRunLabels(t *testing.T) {
+	b := NewStandaloneBoomer(10, 10)
+	labels := map[string]string{"env": "staging"}
+	b.SetRunID("nightly")
+	b.SetRunLabels(labels)
+	labels["env"] = "production"
+	if b.runID != "nightly" || b.runLabels["env"] != "staging" {
+		t.Error("The run metadata should be set and the labels copied, got", b.runID, b.runLabels)
+	}
+}
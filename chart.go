@@ -0,0 +1,144 @@
+package boomer
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"time"
+)
+
+const (
+	chartWidth   = 800
+	chartHeight  = 240
+	chartPadding = 50
+)
+
+var chartColors = []string{"#1f77b4", "#d62728", "#2ca02c", "#ff7f0e"}
+
+// timelinePoint is the aggregates of an interval, they are drawn as the charts of the HTML report.
+type timelinePoint struct {
+	Time              int64   `json:"time"`
+	Users             int64   `json:"user_count"`
+	RPS               float64 `json:"rps"`
+	FailuresPerSecond float64 `json:"fail_per_sec"`
+	P50               int64   `json:"response_time_50"`
+	P95               int64   `json:"response_time_95"`
+	P99               int64   `json:"response_time_99"`
+}
+
+// chartSeries is a line of a chart.
+type chartSeries struct {
+	name   string
+	values []float64
+}
+
+var chartTemplate = template.Must(template.New("chart").Parse(`<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}">
+<text x="{{.Padding}}" y="20" font-weight="bold">{{.Title}}</text>
+<line x1="{{.Padding}}" y1="{{.Bottom}}" x2="{{.Right}}" y2="{{.Bottom}}" stroke="#999"/>
+<line x1="{{.Padding}}" y1="{{.Padding}}" x2="{{.Padding}}" y2="{{.Bottom}}" stroke="#999"/>
+<text x="{{.Padding}}" y="{{.Padding}}" dx="-4" text-anchor="end" font-size="12">{{.Max}}</text>
+<text x="{{.Padding}}" y="{{.Bottom}}" dx="-4" text-anchor="end" font-size="12">0</text>
+<text x="{{.Padding}}" y="{{.Bottom}}" dy="16" font-size="12">{{.Start}}</text>
+<text x="{{.Right}}" y="{{.Bottom}}" dy="16" text-anchor="end" font-size="12">{{.End}}</text>
+{{range .Lines}}<polyline fill="none" stroke="{{.Color}}" stroke-width="2" points="{{.Points}}"/>
+<text x="{{.LegendX}}" y="20" fill="{{.Color}}" font-size="12">{{.Name}}</text>
+{{end}}</svg>
+`))
+
+type chartLine struct {
+	Name    string
+	Color   string
+	Points  string
+	LegendX int
+}
+
+type chartView struct {
+	Title                                 string
+	Width, Height, Padding, Right, Bottom int
+	Max                                   string
+	Start, End                            string
+	Lines                                 []chartLine
+}
+
+// renderChart renders a line chart of the series over the timeline as inline SVG,
+// so the report doesn't need any script or network access.
+func renderChart(title string, timeline []*timelinePoint, series ...chartSeries) template.HTML {
+	view := &chartView{
+		Title:   title,
+		Width:   chartWidth,
+		Height:  chartHeight,
+		Padding: chartPadding,
+		Right:   chartWidth - chartPadding,
+		Bottom:  chartHeight - chartPadding,
+	}
+	if len(timeline) > 0 {
+		view.Start = time.Unix(timeline[0].Time, 0).Format("15:04:05")
+		view.End = time.Unix(timeline[len(timeline)-1].Time, 0).Format("15:04:05")
+	}
+
+	max := float64(0)
+	for _, s := range series {
+		for _, v := range s.values {
+			if v > max {
+				max = v
+			}
+		}
+	}
+	view.Max = fmt.Sprintf("%.0f", max)
+	if max == 0 {
+		max = 1
+	}
+
+	plotWidth := float64(view.Right - view.Padding)
+	plotHeight := float64(view.Bottom - view.Padding)
+	for i, s := range series {
+		var points bytes.Buffer
+		for j, v := range s.values {
+			x := float64(view.Padding)
+			if len(s.values) > 1 {
+				x += plotWidth * float64(j) / float64(len(s.values)-1)
+			}
+			y := float64(view.Bottom) - plotHeight*v/max
+			fmt.Fprintf(&points, "%.1f,%.1f ", x, y)
+		}
+		view.Lines = append(view.Lines, chartLine{
+			Name:    s.name,
+			Color:   chartColors[i%len(chartColors)],
+			Points:  points.String(),
+			LegendX: view.Right - 80*(len(series)-i),
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := chartTemplate.Execute(&buf, view); err != nil {
+		logError("Failed to render the chart %s, %v", title, err)
+		return ""
+	}
+	return template.HTML(buf.String())
+}
+
+// timelineCharts renders the charts of RPS, failures, response time percentiles and users over the timeline.
+func timelineCharts(timeline []*timelinePoint) []template.HTML {
+	if len(timeline) == 0 {
+		return nil
+	}
+	rps := chartSeries{name: "RPS"}
+	failures := chartSeries{name: "Failures/s"}
+	p50 := chartSeries{name: "50%"}
+	p95 := chartSeries{name: "95%"}
+	p99 := chartSeries{name: "99%"}
+	users := chartSeries{name: "Users"}
+	for _, point := range timeline {
+		rps.values = append(rps.values, point.RPS)
+		failures.values = append(failures.values, point.FailuresPerSecond)
+		p50.values = append(p50.values, float64(point.P50))
+		p95.values = append(p95.values, float64(point.P95))
+		p99.values = append(p99.values, float64(point.P99))
+		users.values = append(users.values, float64(point.Users))
+	}
+	return []template.HTML{
+		renderChart("Requests per second", timeline, rps, failures),
+		renderChart("Response times (ms)", timeline, p50, p95, p99),
+		renderChart("Users", timeline, users),
+	}
+}
@@ -0,0 +1,87 @@
+package boomer
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Checks are the thresholds of a test, they are checked against the aggregates of the whole test when it's stopped,
+// so a CI pipeline can fail the build if the target regresses. A zero threshold isn't checked.
+type Checks struct {
+	// FailRatio is the max ratio of the failures to the requests, e.g. 0.01 for 1%.
+	FailRatio float64
+	// AvgResponseTime is the max average response time, in milliseconds.
+	AvgResponseTime int64
+	// P95 is the max 95th percentile of the response times, in milliseconds.
+	P95 int64
+}
+
+func (c Checks) valid() bool {
+	return c.FailRatio >= 0 && c.AvgResponseTime >= 0 && c.P95 >= 0
+}
+
+func (c Checks) enabled() bool {
+	return c.FailRatio > 0 || c.AvgResponseTime > 0 || c.P95 > 0
+}
+
+// violations returns the description of every threshold which total exceeds.
+func (c Checks) violations(total *finalReportEntry) []string {
+	var violations []string
+	if c.FailRatio > 0 && total.NumRequests > 0 {
+		if ratio := float64(total.NumFailures) / float64(total.NumRequests); ratio > c.FailRatio {
+			violations = append(violations, fmt.Sprintf("fail ratio %.4f exceeds %.4f", ratio, c.FailRatio))
+		}
+	}
+	if c.AvgResponseTime > 0 && total.AvgResponseTime > float64(c.AvgResponseTime) {
+		violations = append(violations, fmt.Sprintf("average response time %.2fms exceeds %dms", total.AvgResponseTime, c.AvgResponseTime))
+	}
+	if c.P95 > 0 && total.P95 > c.P95 {
+		violations = append(violations, fmt.Sprintf("95th percentile response time %dms exceeds %dms", total.P95, c.P95))
+	}
+	return violations
+}
+
+// checkOutput accumulates the stats of every interval, and checks them against the thresholds when the test is stopped.
+type checkOutput struct {
+	checks Checks
+	stats  *lifetimeStats
+	// failed is set to 1 if any check fails, it's updated atomically.
+	failed int32
+}
+
+func newCheckOutput(checks Checks) *checkOutput {
+	return &checkOutput{
+		checks: checks,
+		stats:  newLifetimeStats(),
+	}
+}
+
+// OnStart starts over the aggregates, so every test is checked by itself.
+func (o *checkOutput) OnStart() {
+	o.stats = newLifetimeStats()
+	atomic.StoreInt32(&o.failed, 0)
+}
+
+// OnEvent adds the interval's stats to the aggregates.
+func (o *checkOutput) OnEvent(data map[string]interface{}) {
+	o.stats.add(data)
+}
+
+// OnStop checks the aggregates, and logs the failed checks.
+func (o *checkOutput) OnStop() {
+	o.stats.summarize(time.Now())
+	violations := o.checks.violations(o.stats.total)
+	for _, violation := range violations {
+		logError("Check failed: %s", violation)
+	}
+	if len(violations) > 0 {
+		atomic.StoreInt32(&o.failed, 1)
+		return
+	}
+	logInfo("All the checks passed")
+}
+
+func (o *checkOutput) hasFailed() bool {
+	return atomic.LoadInt32(&o.failed) == 1
+}
@@ -0,0 +1,75 @@
+package boomer
+
+import (
+	"testing"
+)
+
+func runChecks(checks Checks, record func(collector *StatsCollector)) *checkOutput {
+	o := newCheckOutput(checks)
+	o.OnStart()
+	collector := NewStatsCollector()
+	record(collector)
+	o.OnEvent(collector.Report())
+	o.OnStop()
+	return o
+}
+
+func TestChecksPassed(t *testing.T) {
+	o := runChecks(Checks{FailRatio: 0.5, AvgResponseTime: 100, P95: 100}, func(collector *StatsCollector) {
+		collector.RecordSuccess("http", "foo", 10, 100)
+		collector.RecordFailure("http", "foo", 20, "500 error")
+	})
+	if o.hasFailed() {
+		t.Error("The checks should pass")
+	}
+}
+
+func TestCheckFailRatio(t *testing.T) {
+	o := runChecks(Checks{FailRatio: 0.1}, func(collector *StatsCollector) {
+		collector.RecordSuccess("http", "foo", 10, 100)
+		collector.RecordFailure("http", "foo", 20, "500 error")
+	})
+	if !o.hasFailed() {
+		t.Error("The fail ratio 0.5 should fail the check")
+	}
+
+	o.OnStart()
+	if o.hasFailed() {
+		t.Error("The result of the last test should be cleared")
+	}
+}
+
+func TestCheckResponseTimes(t *testing.T) {
+	record := func(collector *StatsCollector) {
+		for i := 0; i < 100; i++ {
+			collector.RecordSuccess("http", "foo", 10, 100)
+		}
+		for i := 0; i < 10; i++ {
+			collector.RecordSuccess("http", "foo", 1000, 100)
+		}
+	}
+	if o := runChecks(Checks{AvgResponseTime: 50}, record); !o.hasFailed() {
+		t.Error("The average response time 100ms should fail the check")
+	}
+	if o := runChecks(Checks{P95: 500}, record); !o.hasFailed() {
+		t.Error("The 95th percentile 1000ms should fail the check")
+	}
+	if o := runChecks(Checks{AvgResponseTime: 200, P95: 1000}, record); o.hasFailed() {
+		t.Error("The checks should pass")
+	}
+}
+
+func TestChecksViolations(t *testing.T) {
+	total := newFinalReportEntry("", "Total")
+	total.NumRequests = 100
+	total.NumFailures = 2
+	total.AvgResponseTime = 20
+	total.P95 = 50
+	violations := Checks{FailRatio: 0.01, AvgResponseTime: 10, P95: 100}.violations(total)
+	if len(violations) != 2 {
+		t.Error("The fail ratio and the average response time should be violated, got", violations)
+	}
+	if len(Checks{}.violations(total)) != 0 {
+		t.Error("Zero thresholds shouldn't be checked")
+	}
+}
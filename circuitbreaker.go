@@ -0,0 +1,182 @@
+package boomer
+
+import (
+	"sync"
+	"time"
+)
+
+// circuitBreakerWait is how long the workers of a paused task sleep before checking the breaker again.
+const circuitBreakerWait = 100 * time.Millisecond
+
+// CircuitBreaker pauses or slows down a task when the failure ratio of a request name exceeds the threshold for
+// several report intervals in a row, so a dying endpoint isn't hammered for the rest of a long soak test.
+// The breaker is open for CoolDown, then it's closed and the task runs at full speed again, it's tripped again
+// if the endpoint keeps failing.
+type CircuitBreaker struct {
+	// FailRatio is the failure ratio of an interval which trips the breaker if it's exceeded, e.g. 0.5 for 50%.
+	FailRatio float64
+	// Intervals is how many report intervals in a row the failure ratio must exceed FailRatio. Defaults to 1.
+	Intervals int
+	// MinRequests is the minimum number of requests of an interval to be judged, the intervals with fewer
+	// requests are skipped, so a couple of failures don't trip the breaker. Defaults to 1.
+	MinRequests int64
+	// CoolDown is how long the breaker is open.
+	CoolDown time.Duration
+	// Delay slows the task down instead of pausing it while the breaker is open, every call of the task
+	// is delayed by it, so the endpoint still gets a trickle of requests.
+	Delay time.Duration
+	// Task is the name of the task which is paused or slowed down. Defaults to the request name.
+	Task string
+}
+
+func (c CircuitBreaker) valid() bool {
+	return c.FailRatio > 0 && c.FailRatio < 1 && c.Intervals >= 0 && c.MinRequests >= 0 && c.CoolDown > 0 && c.Delay >= 0
+}
+
+func (c CircuitBreaker) task(name string) string {
+	if c.Task != "" {
+		return c.Task
+	}
+	return name
+}
+
+// openCircuit is a tripped breaker, which is closed by timer.
+type openCircuit struct {
+	name  string
+	delay time.Duration
+	timer *time.Timer
+}
+
+// circuitBreakerOutput trips the breakers by the stats of every interval, and tells the workers whether
+// their tasks are paused or slowed down.
+type circuitBreakerOutput struct {
+	breakers  map[string]CircuitBreaker
+	publisher eventPublisher
+
+	lock sync.Mutex
+	// failing counts the intervals in a row which exceed the failure ratio, by request name.
+	failing map[string]int
+	// open is the tripped breakers, by task name.
+	open map[string]*openCircuit
+}
+
+func newCircuitBreakerOutput(breakers map[string]CircuitBreaker, publisher eventPublisher) *circuitBreakerOutput {
+	return &circuitBreakerOutput{
+		breakers:  breakers,
+		publisher: publisher,
+		failing:   make(map[string]int),
+		open:      make(map[string]*openCircuit),
+	}
+}
+
+// OnStart closes the breakers left by the last test, so every test starts at full speed.
+func (o *circuitBreakerOutput) OnStart() {
+	o.reset()
+}
+
+// OnEvent sums up the requests and the failures of every request name in the interval, and trips the breakers.
+func (o *circuitBreakerOutput) OnEvent(data map[string]interface{}) {
+	requests := make(map[string]int64)
+	failures := make(map[string]int64)
+	stats, _ := data["stats"].([]interface{})
+	for _, stat := range stats {
+		s, ok := stat.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name := toString(s["name"])
+		if _, ok := o.breakers[name]; !ok {
+			continue
+		}
+		requests[name] += toInt64(s["num_requests"])
+		failures[name] += toInt64(s["num_failures"])
+	}
+
+	for name, breaker := range o.breakers {
+		minRequests := breaker.MinRequests
+		if minRequests <= 0 {
+			minRequests = 1
+		}
+		if requests[name] < minRequests {
+			continue
+		}
+		ratio := float64(failures[name]) / float64(requests[name])
+		if o.judge(name, breaker, ratio) {
+			logError("The failure ratio of %s is %.4f, the circuit breaker is open for %v", name, ratio, breaker.CoolDown)
+			o.publisher.publishCircuitOpen(name, ratio)
+		}
+	}
+}
+
+// OnStop closes the breakers, nothing is running anyway.
+func (o *circuitBreakerOutput) OnStop() {
+	o.reset()
+}
+
+// judge counts an interval of name whose failure ratio is ratio, and returns true if the breaker is tripped.
+func (o *circuitBreakerOutput) judge(name string, breaker CircuitBreaker, ratio float64) bool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	task := breaker.task(name)
+	if _, ok := o.open[task]; ok {
+		return false
+	}
+	if ratio <= breaker.FailRatio {
+		o.failing[name] = 0
+		return false
+	}
+	o.failing[name]++
+	intervals := breaker.Intervals
+	if intervals <= 0 {
+		intervals = 1
+	}
+	if o.failing[name] < intervals {
+		return false
+	}
+
+	o.failing[name] = 0
+	circuit := &openCircuit{name: name, delay: breaker.Delay}
+	circuit.timer = time.AfterFunc(breaker.CoolDown, func() {
+		o.close(task, circuit)
+	})
+	o.open[task] = circuit
+	return true
+}
+
+// close closes the breaker of task, if it's still circuit.
+func (o *circuitBreakerOutput) close(task string, circuit *openCircuit) {
+	o.lock.Lock()
+	if o.open[task] != circuit {
+		o.lock.Unlock()
+		return
+	}
+	delete(o.open, task)
+	o.lock.Unlock()
+
+	logInfo("The circuit breaker of %s is closed", circuit.name)
+	o.publisher.publishCircuitClose(circuit.name)
+}
+
+func (o *circuitBreakerOutput) reset() {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	for _, circuit := range o.open {
+		circuit.timer.Stop()
+	}
+	o.failing = make(map[string]int)
+	o.open = make(map[string]*openCircuit)
+}
+
+// wait returns whether task is paused, or how long its calls are delayed by, while the breaker is open.
+func (o *circuitBreakerOutput) wait(task string) (paused bool, delay time.Duration) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	circuit, ok := o.open[task]
+	if !ok {
+		return false, 0
+	}
+	return circuit.delay == 0, circuit.delay
+}
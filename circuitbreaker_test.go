@@ -0,0 +1,113 @@
+package boomer
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func recordInterval(o *circuitBreakerOutput, successes, failures int) {
+	collector := NewStatsCollector()
+	for i := 0; i < successes; i++ {
+		collector.RecordSuccess("http", "foo", 10, 100)
+	}
+	for i := 0; i < failures; i++ {
+		collector.RecordFailure("http", "foo", 10, "500 error")
+	}
+	collector.RecordFailure("http", "bar", 10, "500 error")
+	o.OnEvent(collector.Report())
+}
+
+func TestCircuitBreakerValid(t *testing.T) {
+	if !(CircuitBreaker{FailRatio: 0.5, CoolDown: time.Second}).valid() {
+		t.Error("The circuit breaker should be valid")
+	}
+	for _, breaker := range []CircuitBreaker{
+		{CoolDown: time.Second},
+		{FailRatio: 1, CoolDown: time.Second},
+		{FailRatio: 0.5},
+		{FailRatio: 0.5, CoolDown: time.Second, Intervals: -1},
+		{FailRatio: 0.5, CoolDown: time.Second, Delay: -time.Second},
+	} {
+		if breaker.valid() {
+			t.Error("The circuit breaker should be invalid", breaker)
+		}
+	}
+}
+
+func TestCircuitBreakerTrips(t *testing.T) {
+	hooks := &Hooks{}
+	opened := make([]float64, 0)
+	hooks.OnCircuitOpen(func(name string, failRatio float64) {
+		if name != "foo" {
+			t.Error("Unexpected request name", name)
+		}
+		opened = append(opened, failRatio)
+	})
+	o := newCircuitBreakerOutput(map[string]CircuitBreaker{
+		"foo": {FailRatio: 0.5, Intervals: 2, MinRequests: 2, CoolDown: time.Hour},
+	}, eventPublisher{hooks: hooks})
+	o.OnStart()
+	defer o.OnStop()
+
+	recordInterval(o, 1, 3)
+	// a healthy interval starts over
+	recordInterval(o, 3, 1)
+	recordInterval(o, 1, 3)
+	// too few requests to be judged
+	recordInterval(o, 0, 1)
+	if paused, _ := o.wait("foo"); paused || len(opened) != 0 {
+		t.Fatal("The breaker shouldn't be tripped yet")
+	}
+
+	recordInterval(o, 0, 4)
+	if paused, _ := o.wait("foo"); !paused {
+		t.Error("The task should be paused once the breaker is tripped")
+	}
+	if len(opened) != 1 || opened[0] != 1 {
+		t.Error("The open hook should be called once with the failure ratio, got", opened)
+	}
+	if paused, _ := o.wait("bar"); paused {
+		t.Error("The requests without a breaker shouldn't pause their tasks")
+	}
+
+	o.OnStop()
+	if paused, _ := o.wait("foo"); paused {
+		t.Error("The breakers should be closed when the test is stopped")
+	}
+}
+
+func TestCircuitBreakerCoolDown(t *testing.T) {
+	hooks := &Hooks{}
+	closed := int32(0)
+	hooks.OnCircuitClose(func(name string) {
+		if name != "foo" {
+			t.Error("Unexpected request name", name)
+		}
+		atomic.AddInt32(&closed, 1)
+	})
+	o := newCircuitBreakerOutput(map[string]CircuitBreaker{
+		"foo": {FailRatio: 0.1, CoolDown: 50 * time.Millisecond, Delay: 10 * time.Millisecond, Task: "checkout"},
+	}, eventPublisher{hooks: hooks})
+	o.OnStart()
+	defer o.OnStop()
+
+	recordInterval(o, 1, 1)
+	if paused, delay := o.wait("checkout"); paused || delay != 10*time.Millisecond {
+		t.Error("The task should be slowed down by the delay, got", paused, delay)
+	}
+	if _, delay := o.wait("foo"); delay != 0 {
+		t.Error("Only the task of the breaker should be slowed down")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(&closed) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if atomic.LoadInt32(&closed) != 1 {
+		t.Fatal("The close hook should be called after the cool-down")
+	}
+	if _, delay := o.wait("checkout"); delay != 0 {
+		t.Error("The task should run at full speed after the cool-down, got", delay)
+	}
+}
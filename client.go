@@ -1,9 +1,89 @@
 package boomer
 
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+)
+
 type client interface {
 	connect() (err error)
 	close()
-	recvChannel() chan *message
-	sendChannel() chan *message
+	recvChannel() chan *Message
+	sendChannel() chan *Message
 	disconnectedChannel() chan bool
 }
+
+// clientSecurity is the ZMQ security mechanism of the connection to the master, it's NULL if both CURVE and PLAIN
+// are disabled. The master must be configured with the same mechanism.
+type clientSecurity struct {
+	// the CURVE keys are Z85 encoded, 40 characters long
+	curveServerKey string
+	curvePublicKey string
+	curveSecretKey string
+
+	plainUsername string
+	plainPassword string
+
+	// tls isn't ZMQ, it's only supported by the tcp backend.
+	tls *tls.Config
+}
+
+func (s clientSecurity) curve() bool {
+	return s.curveServerKey != ""
+}
+
+func (s clientSecurity) plain() bool {
+	return s.plainUsername != ""
+}
+
+// newClientTLSConfig returns the TLS config of the connection to the master. The master is verified by the CA
+// certificate of caFile, or the system roots if it's empty. certFile and keyFile are the client certificate,
+// if the master requires one.
+func newClientTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	config := &tls.Config{}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the CA certificate: %v", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no CA certificates are found in " + caFile)
+		}
+	}
+	return config, nil
+}
+
+// clientBackends are the implementations of ZMQ to connect to the master, by name. gomq is always available,
+// goczmq is only available if boomer is built with goczmq, because it requires libzmq. tcp isn't ZMQ, it only
+// connects to a MasterRunner with the tcp server backend.
+var clientBackends = map[string]func(masterHost string, masterPort int, identity string, security clientSecurity) client{}
+
+// defaultClientBackend is goczmq if it's available, otherwise gomq.
+var defaultClientBackend = "gomq"
+
+// newClient returns a client of the default backend, with NULL security.
+func newClient(masterHost string, masterPort int, identity string) client {
+	return clientBackends[defaultClientBackend](masterHost, masterPort, identity, clientSecurity{})
+}
+
+// availableClientBackends returns the names of the available backends, in order.
+func availableClientBackends() []string {
+	names := make([]string, 0, len(clientBackends))
+	for name := range clientBackends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -3,8 +3,8 @@
 package boomer
 
 import (
+	"errors"
 	"fmt"
-	"log"
 
 	"github.com/zeromq/goczmq"
 )
@@ -13,23 +13,33 @@ type czmqSocketClient struct {
 	masterHost string
 	masterPort int
 	identity   string
+	security   clientSecurity
 
 	dealerSocket *goczmq.Sock
 
-	fromMaster             chan *message
-	toMaster               chan *message
+	fromMaster             chan *Message
+	toMaster               chan *Message
 	disconnectedFromMaster chan bool
 	shutdownChan           chan bool
 }
 
-func newClient(masterHost string, masterPort int, identity string) (client *czmqSocketClient) {
-	log.Println("Boomer is built with goczmq support.")
+func init() {
+	clientBackends["goczmq"] = func(masterHost string, masterPort int, identity string, security clientSecurity) client {
+		return newCzmqClient(masterHost, masterPort, identity, security)
+	}
+	// prefer goczmq if it's built in, for its stability
+	defaultClientBackend = "goczmq"
+}
+
+func newCzmqClient(masterHost string, masterPort int, identity string, security clientSecurity) (client *czmqSocketClient) {
+	logInfo("Boomer uses goczmq to connect to the master.")
 	client = &czmqSocketClient{
 		masterHost:             masterHost,
 		masterPort:             masterPort,
 		identity:               identity,
-		fromMaster:             make(chan *message, 100),
-		toMaster:               make(chan *message, 100),
+		security:               security,
+		fromMaster:             make(chan *Message, 100),
+		toMaster:               make(chan *Message, 100),
 		disconnectedFromMaster: make(chan bool),
 		shutdownChan:           make(chan bool),
 	}
@@ -38,9 +48,24 @@ func newClient(masterHost string, masterPort int, identity string) (client *czmq
 }
 
 func (c *czmqSocketClient) connect() (err error) {
+	if c.security.tls != nil {
+		return errors.New("TLS is not supported by goczmq, use the tcp client backend")
+	}
 	addr := fmt.Sprintf("tcp://%s:%d", c.masterHost, c.masterPort)
 	dealer := goczmq.NewSock(goczmq.Dealer)
 	dealer.SetOption(goczmq.SockSetIdentity(c.identity))
+	if c.security.curve() {
+		dealer.SetOption(
+			goczmq.SockSetCurveServerkey(c.security.curveServerKey),
+			goczmq.SockSetCurvePublickey(c.security.curvePublicKey),
+			goczmq.SockSetCurveSecretkey(c.security.curveSecretKey),
+		)
+	} else if c.security.plain() {
+		dealer.SetOption(
+			goczmq.SockSetPlainUsername(c.security.plainUsername),
+			goczmq.SockSetPlainPassword(c.security.plainPassword),
+		)
+	}
 	err = dealer.Connect(addr)
 	if err != nil {
 		return err
@@ -48,7 +73,7 @@ func (c *czmqSocketClient) connect() (err error) {
 
 	c.dealerSocket = dealer
 
-	log.Printf("Boomer is connected to master(%s) press Ctrl+c to quit.\n", addr)
+	logInfo("Boomer is connected to master(%s) press Ctrl+c to quit.\n", addr)
 
 	go c.recv()
 	go c.send()
@@ -63,7 +88,7 @@ func (c *czmqSocketClient) close() {
 	}
 }
 
-func (c *czmqSocketClient) recvChannel() chan *message {
+func (c *czmqSocketClient) recvChannel() chan *Message {
 	return c.fromMaster
 }
 
@@ -75,16 +100,16 @@ func (c *czmqSocketClient) recv() {
 		default:
 			msg, _, err := c.dealerSocket.RecvFrame()
 			if err != nil {
-				log.Printf("Error reading: %v\n", err)
+				logError("Error reading: %v\n", err)
 				continue
 			}
 			decodedMsg, err := newMessageFromBytes(msg)
 			if err != nil {
-				log.Printf("Msgpack decode fail: %v\n", err)
+				logError("Msgpack decode fail: %v\n", err)
 				continue
 			}
 			if decodedMsg.NodeID != c.identity {
-				log.Printf("Recv a %s message for node(%s), not for me(%s), dropped.\n", decodedMsg.Type, decodedMsg.NodeID, c.identity)
+				logDebug("Recv a %s message for node(%s), not for me(%s), dropped.\n", decodedMsg.Type, decodedMsg.NodeID, c.identity)
 				continue
 			}
 			c.fromMaster <- decodedMsg
@@ -92,7 +117,7 @@ func (c *czmqSocketClient) recv() {
 	}
 }
 
-func (c *czmqSocketClient) sendChannel() chan *message {
+func (c *czmqSocketClient) sendChannel() chan *Message {
 	return c.toMaster
 }
 
@@ -110,15 +135,16 @@ func (c *czmqSocketClient) send() {
 	}
 }
 
-func (c *czmqSocketClient) sendMessage(msg *message) {
+func (c *czmqSocketClient) sendMessage(msg *Message) {
+	logDebug("Send a %s message to master", msg.Type)
 	serializedMessage, err := msg.serialize()
 	if err != nil {
-		log.Printf("Msgpack encode fail: %v\n", err)
+		logError("Msgpack encode fail: %v\n", err)
 		return
 	}
 	err = c.dealerSocket.SendFrame(serializedMessage, goczmq.FlagNone)
 	if err != nil {
-		log.Printf("Error sending: %v\n", err)
+		logError("Error sending: %v\n", err)
 	}
 }
 
@@ -1,10 +1,8 @@
-// +build !goczmq
-
 package boomer
 
 import (
+	"errors"
 	"fmt"
-	"log"
 
 	"github.com/zeromq/gomq"
 	"github.com/zeromq/gomq/zmtp"
@@ -14,23 +12,31 @@ type gomqSocketClient struct {
 	masterHost string
 	masterPort int
 	identity   string
+	security   clientSecurity
 
 	dealerSocket gomq.Dealer
 
-	fromMaster             chan *message
-	toMaster               chan *message
+	fromMaster             chan *Message
+	toMaster               chan *Message
 	disconnectedFromMaster chan bool
 	shutdownChan           chan bool
 }
 
-func newClient(masterHost string, masterPort int, identity string) (client *gomqSocketClient) {
-	log.Println("Boomer is built with gomq support.")
+func init() {
+	clientBackends["gomq"] = func(masterHost string, masterPort int, identity string, security clientSecurity) client {
+		return newGomqClient(masterHost, masterPort, identity, security)
+	}
+}
+
+func newGomqClient(masterHost string, masterPort int, identity string, security clientSecurity) (client *gomqSocketClient) {
+	logInfo("Boomer uses gomq to connect to the master.")
 	client = &gomqSocketClient{
 		masterHost:             masterHost,
 		masterPort:             masterPort,
 		identity:               identity,
-		fromMaster:             make(chan *message, 100),
-		toMaster:               make(chan *message, 100),
+		security:               security,
+		fromMaster:             make(chan *Message, 100),
+		toMaster:               make(chan *Message, 100),
 		disconnectedFromMaster: make(chan bool),
 		shutdownChan:           make(chan bool),
 	}
@@ -38,6 +44,12 @@ func newClient(masterHost string, masterPort int, identity string) (client *gomq
 }
 
 func (c *gomqSocketClient) connect() (err error) {
+	if c.security.curve() || c.security.plain() {
+		return errors.New("CURVE and PLAIN security are not supported by gomq, build boomer with -tags goczmq")
+	}
+	if c.security.tls != nil {
+		return errors.New("TLS is not supported by gomq, use the tcp client backend")
+	}
 	addr := fmt.Sprintf("tcp://%s:%d", c.masterHost, c.masterPort)
 	c.dealerSocket = gomq.NewDealer(zmtp.NewSecurityNull(), c.identity)
 
@@ -45,7 +57,7 @@ func (c *gomqSocketClient) connect() (err error) {
 		return err
 	}
 
-	log.Printf("Boomer is connected to master(%s) press Ctrl+c to quit.\n", addr)
+	logInfo("Boomer is connected to master(%s) press Ctrl+c to quit.\n", addr)
 	go c.recv()
 	go c.send()
 
@@ -59,7 +71,7 @@ func (c *gomqSocketClient) close() {
 	}
 }
 
-func (c *gomqSocketClient) recvChannel() chan *message {
+func (c *gomqSocketClient) recvChannel() chan *Message {
 	return c.fromMaster
 }
 
@@ -77,16 +89,16 @@ func (c *gomqSocketClient) recv() {
 			}
 			body, err := msg.Body[0], msg.Err
 			if err != nil {
-				log.Printf("Error reading: %v\n", err)
+				logError("Error reading: %v\n", err)
 				continue
 			}
 			decodedMsg, err := newMessageFromBytes(body)
 			if err != nil {
-				log.Printf("Msgpack decode fail: %v\n", err)
+				logError("Msgpack decode fail: %v\n", err)
 				continue
 			}
 			if decodedMsg.NodeID != c.identity {
-				log.Printf("Recv a %s message for node(%s), not for me(%s), dropped.\n", decodedMsg.Type, decodedMsg.NodeID, c.identity)
+				logDebug("Recv a %s message for node(%s), not for me(%s), dropped.\n", decodedMsg.Type, decodedMsg.NodeID, c.identity)
 				continue
 			}
 			c.fromMaster <- decodedMsg
@@ -94,7 +106,7 @@ func (c *gomqSocketClient) recv() {
 	}
 }
 
-func (c *gomqSocketClient) sendChannel() chan *message {
+func (c *gomqSocketClient) sendChannel() chan *Message {
 	return c.toMaster
 }
 
@@ -112,15 +124,16 @@ func (c *gomqSocketClient) send() {
 	}
 }
 
-func (c *gomqSocketClient) sendMessage(msg *message) {
+func (c *gomqSocketClient) sendMessage(msg *Message) {
+	logDebug("Send a %s message to master", msg.Type)
 	serializedMessage, err := msg.serialize()
 	if err != nil {
-		log.Printf("Msgpack encode fail: %v\n", err)
+		logError("Msgpack encode fail: %v\n", err)
 		return
 	}
 	err = c.dealerSocket.Send(serializedMessage)
 	if err != nil {
-		log.Printf("Error sending: %v\n", err)
+		logError("Error sending: %v\n", err)
 	}
 }
 
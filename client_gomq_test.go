@@ -80,8 +80,8 @@ type testServer struct {
 	bindHost       string
 	bindPort       int
 	nodeID         string
-	fromClient     chan *message
-	toClient       chan *message
+	fromClient     chan *Message
+	toClient       chan *Message
 	routerSocket   Router
 	shutdownSignal chan bool
 }
@@ -91,8 +91,8 @@ func newTestServer(bindHost string, bindPort int) (server *testServer) {
 		bindHost:       bindHost,
 		bindPort:       bindPort,
 		nodeID:         getNodeID(),
-		fromClient:     make(chan *message, 100),
-		toClient:       make(chan *message, 100),
+		fromClient:     make(chan *Message, 100),
+		toClient:       make(chan *Message, 100),
 		shutdownSignal: make(chan bool, 1),
 	}
 }
@@ -116,7 +116,7 @@ func (s *testServer) send() {
 	}
 }
 
-func (s *testServer) sendMessage(msg *message) {
+func (s *testServer) sendMessage(msg *Message) {
 	defer func() {
 		// don't panic
 		err := recover()
@@ -198,3 +198,19 @@ func TestPingPong(t *testing.T) {
 		t.Error("client doesn't recv pong message")
 	}
 }
+
+func TestSecurityIsNotSupported(t *testing.T) {
+	client := newGomqClient("localhost", 5557, "testing security", clientSecurity{plainUsername: "boomer", plainPassword: "secret"})
+	if err := client.connect(); err == nil {
+		t.Error("gomq client should refuse to connect with PLAIN security")
+	}
+}
+
+func TestGomqClientBackend(t *testing.T) {
+	if _, ok := clientBackends["gomq"]; !ok {
+		t.Fatal("gomq should be always available")
+	}
+	if _, ok := newClient("localhost", 5557, "testing backend").(*gomqSocketClient); !ok {
+		t.Error("gomq should be the default backend without goczmq")
+	}
+}
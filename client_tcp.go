@@ -0,0 +1,176 @@
+package boomer
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+// maxFrameSize limits the frames of the tcp transport, a longer frame means the stream is corrupted.
+const maxFrameSize = 64 << 20
+
+// writeFrame writes body prefixed by its length, as a 4-byte big-endian integer.
+func writeFrame(w io.Writer, body []byte) error {
+	frame := make([]byte, 4+len(body))
+	binary.BigEndian.PutUint32(frame, uint32(len(body)))
+	copy(frame[4:], body)
+	_, err := w.Write(frame)
+	return err
+}
+
+// readFrame reads a frame written by writeFrame.
+func readFrame(r io.Reader) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size > maxFrameSize {
+		return nil, fmt.Errorf("frame of %d bytes exceeds the limit", size)
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// tcpClient connects to boomer's MasterRunner over plain TCP without ZMQ, for the clusters of boomers only,
+// locust doesn't speak it. The messages are serialized by msgpack like ZMQ, and framed by writeFrame.
+// The connection is wrapped in TLS if the security has a TLS config, see Boomer.SetMasterTLS.
+type tcpClient struct {
+	masterHost string
+	masterPort int
+	identity   string
+	security   clientSecurity
+
+	conn net.Conn
+
+	fromMaster             chan *Message
+	toMaster               chan *Message
+	disconnectedFromMaster chan bool
+	shutdownChan           chan bool
+}
+
+func init() {
+	clientBackends["tcp"] = func(masterHost string, masterPort int, identity string, security clientSecurity) client {
+		return newTCPClient(masterHost, masterPort, identity, security)
+	}
+}
+
+func newTCPClient(masterHost string, masterPort int, identity string, security clientSecurity) *tcpClient {
+	logInfo("Boomer uses plain TCP to connect to the master.")
+	return &tcpClient{
+		masterHost:             masterHost,
+		masterPort:             masterPort,
+		identity:               identity,
+		security:               security,
+		fromMaster:             make(chan *Message, 100),
+		toMaster:               make(chan *Message, 100),
+		disconnectedFromMaster: make(chan bool),
+		shutdownChan:           make(chan bool),
+	}
+}
+
+func (c *tcpClient) connect() (err error) {
+	if c.security.curve() || c.security.plain() {
+		return errors.New("CURVE and PLAIN security are not supported by tcp")
+	}
+	addr := net.JoinHostPort(c.masterHost, strconv.Itoa(c.masterPort))
+	scheme := "tcp"
+	if c.security.tls != nil {
+		scheme = "tls"
+		c.conn, err = tls.Dial("tcp", addr, c.security.tls)
+	} else {
+		c.conn, err = net.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+
+	logInfo("Boomer is connected to master(%s://%s) press Ctrl+c to quit.\n", scheme, addr)
+	go c.recv()
+	go c.send()
+
+	return nil
+}
+
+func (c *tcpClient) close() {
+	close(c.shutdownChan)
+	if c.conn != nil {
+		c.conn.Close()
+	}
+}
+
+func (c *tcpClient) recvChannel() chan *Message {
+	return c.fromMaster
+}
+
+func (c *tcpClient) recv() {
+	reader := bufio.NewReader(c.conn)
+	for {
+		body, err := readFrame(reader)
+		if err != nil {
+			select {
+			case <-c.shutdownChan:
+			default:
+				// the master will be missing without heartbeats, then the runner reconnects
+				logError("Error reading: %v\n", err)
+			}
+			return
+		}
+		decodedMsg, err := newMessageFromBytes(body)
+		if err != nil {
+			logError("Msgpack decode fail: %v\n", err)
+			continue
+		}
+		if decodedMsg.NodeID != c.identity {
+			logDebug("Recv a %s message for node(%s), not for me(%s), dropped.\n", decodedMsg.Type, decodedMsg.NodeID, c.identity)
+			continue
+		}
+		select {
+		case c.fromMaster <- decodedMsg:
+		case <-c.shutdownChan:
+			return
+		}
+	}
+}
+
+func (c *tcpClient) sendChannel() chan *Message {
+	return c.toMaster
+}
+
+func (c *tcpClient) send() {
+	for {
+		select {
+		case <-c.shutdownChan:
+			return
+		case msg := <-c.toMaster:
+			c.sendMessage(msg)
+			if msg.Type == "quit" {
+				c.disconnectedFromMaster <- true
+			}
+		}
+	}
+}
+
+func (c *tcpClient) sendMessage(msg *Message) {
+	logDebug("Send a %s message to master", msg.Type)
+	serializedMessage, err := msg.serialize()
+	if err != nil {
+		logError("Msgpack encode fail: %v\n", err)
+		return
+	}
+	if err = writeFrame(c.conn, serializedMessage); err != nil {
+		logError("Error sending: %v\n", err)
+	}
+}
+
+func (c *tcpClient) disconnectedChannel() chan bool {
+	return c.disconnectedFromMaster
+}
@@ -0,0 +1,256 @@
+package boomer
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFrame(t *testing.T) {
+	var buf bytes.Buffer
+	writeFrame(&buf, []byte("hello"))
+	writeFrame(&buf, nil)
+
+	if body, err := readFrame(&buf); err != nil || string(body) != "hello" {
+		t.Error("The first frame should be read, got", string(body), err)
+	}
+	if body, err := readFrame(&buf); err != nil || len(body) != 0 {
+		t.Error("The empty frame should be read, got", body, err)
+	}
+	if _, err := readFrame(&buf); err == nil {
+		t.Error("Reading should fail at the end of the stream")
+	}
+
+	if _, err := readFrame(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff})); err == nil {
+		t.Error("A frame longer than the limit should be refused")
+	}
+}
+
+// tcpServerPort returns the port of a bound tcpServer.
+func tcpServerPort(s *tcpServer) int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// recvMessage returns the next message of ch, skipping the "worker_count" messages, or nil after a second.
+func recvMessage(ch chan *Message) *Message {
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case msg := <-ch:
+			if msg.Type != "worker_count" {
+				return msg
+			}
+		case <-timeout:
+			return nil
+		}
+	}
+}
+
+func TestTCPClientAndServer(t *testing.T) {
+	server := newTCPServer("127.0.0.1", 0, "master")
+	if err := server.bind(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.close()
+
+	clientA := newTCPClient("127.0.0.1", tcpServerPort(server), "worker-a", clientSecurity{})
+	clientB := newTCPClient("127.0.0.1", tcpServerPort(server), "worker-b", clientSecurity{})
+	for _, client := range []*tcpClient{clientA, clientB} {
+		if err := client.connect(); err != nil {
+			t.Fatal(err)
+		}
+		defer client.close()
+		client.sendChannel() <- newMessage("client_ready", nil, client.identity)
+		if msg := recvMessage(server.recvChannel()); msg == nil || msg.Type != "client_ready" || msg.NodeID != client.identity {
+			t.Fatal("The server should recv the message of", client.identity, msg)
+		}
+	}
+
+	server.sendChannel() <- newMessage("spawn", nil, "worker-b")
+	msg := recvMessage(clientB.recvChannel())
+	if msg == nil || msg.Type != "spawn" || msg.NodeID != "worker-b" {
+		t.Fatal("The message should be sent to worker-b, got", msg)
+	}
+	select {
+	case msg := <-clientA.recvChannel():
+		t.Error("The message of worker-b shouldn't be sent to worker-a, got", msg)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	clientA.sendChannel() <- newMessage("quit", nil, "worker-a")
+	select {
+	case <-clientA.disconnectedChannel():
+	case <-time.After(time.Second):
+		t.Error("The client should be disconnected once it quits")
+	}
+}
+
+func TestTCPSecurityIsNotSupported(t *testing.T) {
+	client := newTCPClient("localhost", 5557, "testing security", clientSecurity{plainUsername: "boomer", plainPassword: "secret"})
+	if err := client.connect(); err == nil {
+		t.Error("tcp client should refuse to connect with PLAIN security")
+	}
+}
+
+func TestMasterWithTCPServerBackend(t *testing.T) {
+	master := NewMasterRunner("127.0.0.1", 0)
+	master.SetServerBackend("unknown")
+	if _, ok := master.server.(*tcpServer); ok {
+		t.Fatal("An unknown backend should be ignored")
+	}
+	master.SetServerBackend("tcp")
+	server, ok := master.server.(*tcpServer)
+	if !ok {
+		t.Fatal("The tcp backend should be used")
+	}
+	if err := master.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer master.Quit()
+
+	client := clientBackends["tcp"]("127.0.0.1", tcpServerPort(server), "worker-a", clientSecurity{})
+	if err := client.connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.close()
+	client.sendChannel() <- newMessage("client_ready", nil, "worker-a")
+
+	deadline := time.Now().Add(time.Second)
+	for master.WorkerCount() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := master.Start(10, 10); err != nil {
+		t.Fatal(err)
+	}
+	msg := recvMessage(client.recvChannel())
+	if msg == nil || msg.Type != "spawn" {
+		t.Fatal("The worker should be asked to spawn, got", msg)
+	}
+}
+
+// newTestCertificate returns a self-signed certificate of 127.0.0.1 and its key in PEM.
+func newTestCertificate(t *testing.T) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "boomer"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM
+}
+
+func TestNewClientTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boomer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certPEM, keyPEM := newTestCertificate(t)
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	ioutil.WriteFile(certFile, certPEM, 0600)
+	ioutil.WriteFile(keyFile, keyPEM, 0600)
+
+	config, err := newClientTLSConfig(certFile, keyFile, certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Certificates) != 1 || config.RootCAs == nil {
+		t.Error("The client certificate and the CA should be loaded, got", config)
+	}
+
+	config, err = newClientTLSConfig("", "", "")
+	if err != nil || len(config.Certificates) != 0 || config.RootCAs != nil {
+		t.Error("The system roots should be used by default, got", config, err)
+	}
+	if _, err := newClientTLSConfig(certFile, "", ""); err == nil {
+		t.Error("A client certificate without the key should be refused")
+	}
+	if _, err := newClientTLSConfig("", "", keyFile); err == nil {
+		t.Error("A CA file without certificates should be refused")
+	}
+	if _, err := newClientTLSConfig("", "", filepath.Join(dir, "missing.pem")); err == nil {
+		t.Error("A missing CA file should be refused")
+	}
+}
+
+func TestTLSClientAndServer(t *testing.T) {
+	certPEM, keyPEM := newTestCertificate(t)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(certPEM)
+
+	server := newTCPServer("127.0.0.1", 0, "master")
+	server.tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	if err := server.bind(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.close()
+
+	client := newTCPClient("127.0.0.1", tcpServerPort(server), "worker-a", clientSecurity{tls: &tls.Config{RootCAs: roots}})
+	if err := client.connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.close()
+	client.sendChannel() <- newMessage("client_ready", nil, "worker-a")
+	if msg := recvMessage(server.recvChannel()); msg == nil || msg.Type != "client_ready" {
+		t.Fatal("The server should recv the message over TLS, got", msg)
+	}
+	server.sendChannel() <- newMessage("spawn", nil, "worker-a")
+	if msg := recvMessage(client.recvChannel()); msg == nil || msg.Type != "spawn" {
+		t.Fatal("The client should recv the message over TLS, got", msg)
+	}
+
+	untrusted := newTCPClient("127.0.0.1", tcpServerPort(server), "worker-b", clientSecurity{tls: &tls.Config{}})
+	if err := untrusted.connect(); err == nil {
+		untrusted.close()
+		t.Error("The client should refuse a master which isn't signed by its CA")
+	}
+}
+
+func TestMasterTLSRequiresTCP(t *testing.T) {
+	master := NewMasterRunner("127.0.0.1", 0)
+	master.SetTLS(nil)
+	if master.tlsConfig != nil {
+		t.Fatal("A nil TLS config should be ignored")
+	}
+	master.SetTLS(&tls.Config{})
+	if err := master.Run(); err == nil {
+		master.Quit()
+		t.Error("The zmq server backend should refuse TLS")
+	}
+}
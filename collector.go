@@ -0,0 +1,118 @@
+package boomer
+
+// Recorder records the results of requests, it's implemented by Boomer and StatsCollector.
+// Code which records requests can depend on a Recorder, and be unit-tested with a StatsCollector.
+type Recorder interface {
+	RecordSuccess(requestType, name string, responseTime int64, responseLength int64)
+	RecordFailure(requestType, name string, responseTime int64, exception string)
+}
+
+// StatsCollector aggregates the recorded requests in the same way as the runner does, but synchronously,
+// without spawning goroutines or connecting to a master. It's meant for unit tests.
+// A StatsCollector is not safe for concurrent use.
+type StatsCollector struct {
+	stats *requestStats
+}
+
+// NewStatsCollector returns a new StatsCollector.
+func NewStatsCollector() *StatsCollector {
+	return &StatsCollector{
+		stats: newRequestStats(),
+	}
+}
+
+// SetAggregationMode works like Boomer.SetAggregationMode.
+func (c *StatsCollector) SetAggregationMode(mode AggregationMode) {
+	switch mode {
+	case ByName, ByType:
+		c.stats.setAggregationMode(mode)
+	default:
+		logError("Invalid aggregation mode, ignored!")
+	}
+}
+
+// SetErrorExemplars works like Boomer.SetErrorExemplars.
+func (c *StatsCollector) SetErrorExemplars(n int) {
+	if n < 0 {
+		logError("Invalid number of error exemplars, ignored!")
+		return
+	}
+	c.stats.setErrorExemplars(n)
+}
+
+// SetErrorNormalizer works like Boomer.SetErrorNormalizer.
+func (c *StatsCollector) SetErrorNormalizer(normalizer ErrorNormalizer) {
+	c.stats.setErrorNormalizer(normalizer)
+}
+
+// RecordSuccess aggregates a success.
+func (c *StatsCollector) RecordSuccess(requestType, name string, responseTime int64, responseLength int64) {
+	c.RecordSuccessWithLabels(requestType, name, nil, responseTime, responseLength)
+}
+
+// RecordFailure aggregates a failure.
+func (c *StatsCollector) RecordFailure(requestType, name string, responseTime int64, exception string) {
+	c.RecordFailureWithLabels(requestType, name, nil, responseTime, exception)
+}
+
+// RecordError aggregates a failure of err with its category, like Boomer.RecordError.
+func (c *StatsCollector) RecordError(requestType, name string, responseTime int64, err error) {
+	if err == nil {
+		logError("RecordError is called with a nil error, ignored!")
+		return
+	}
+	c.stats.onRequestFailure(&requestFailure{
+		requestType:  requestType,
+		name:         name,
+		responseTime: responseTime,
+		error:        err.Error(),
+		category:     ClassifyError(err),
+		timestamp:    Now(),
+	})
+}
+
+// RecordSuccessWithLabels aggregates a success with labels.
+func (c *StatsCollector) RecordSuccessWithLabels(requestType, name string, labels map[string]string, responseTime int64, responseLength int64) {
+	c.stats.onRequestSuccess(&requestSuccess{
+		requestType:    requestType,
+		name:           name,
+		responseTime:   responseTime,
+		responseLength: responseLength,
+		timestamp:      Now(),
+		labels:         copyLabels(labels),
+	})
+}
+
+// RecordFailureWithLabels aggregates a failure with labels.
+func (c *StatsCollector) RecordFailureWithLabels(requestType, name string, labels map[string]string, responseTime int64, exception string) {
+	c.stats.onRequestFailure(&requestFailure{
+		requestType:  requestType,
+		name:         name,
+		responseTime: responseTime,
+		error:        exception,
+		timestamp:    Now(),
+		labels:       copyLabels(labels),
+	})
+}
+
+// NumRequests returns the number of requests aggregated into the stats entry of requestType and name,
+// including the failures. In ByType mode, name is ignored.
+func (c *StatsCollector) NumRequests(requestType, name string) int64 {
+	return c.entry(requestType, name).numRequests
+}
+
+// NumFailures returns the number of failures aggregated into the stats entry of requestType and name.
+// In ByType mode, name is ignored.
+func (c *StatsCollector) NumFailures(requestType, name string) int64 {
+	return c.entry(requestType, name).numFailures
+}
+
+// Report returns the aggregated data in the same format as Output.OnEvent receives, except
+// for "user_count", and resets the stats like every report interval does.
+func (c *StatsCollector) Report() map[string]interface{} {
+	return c.stats.collectReportData()
+}
+
+func (c *StatsCollector) entry(requestType, name string) *statsEntry {
+	return c.stats.get(c.stats.aggregatedName(requestType, name), requestType)
+}
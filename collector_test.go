@@ -0,0 +1,73 @@
+package boomer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStatsCollector(t *testing.T) {
+	var recorder Recorder = NewStatsCollector()
+	recorder.RecordSuccess("http", "foo", 10, 100)
+	recorder.RecordSuccess("http", "foo", 20, 100)
+	recorder.RecordFailure("http", "foo", 30, "500 error")
+	recorder.RecordSuccess("http", "bar", 10, 100)
+
+	collector := recorder.(*StatsCollector)
+	if collector.NumRequests("http", "foo") != 3 {
+		t.Error("NumRequests of foo is wrong, expected: 3, got:", collector.NumRequests("http", "foo"))
+	}
+	if collector.NumFailures("http", "foo") != 1 {
+		t.Error("NumFailures of foo is wrong, expected: 1, got:", collector.NumFailures("http", "foo"))
+	}
+	if collector.NumRequests("http", "bar") != 1 {
+		t.Error("NumRequests of bar is wrong, expected: 1, got:", collector.NumRequests("http", "bar"))
+	}
+
+	report := collector.Report()
+	if len(report["stats"].([]interface{})) != 2 {
+		t.Error("There should be 2 stats entries in the report, got:", len(report["stats"].([]interface{})))
+	}
+	if len(report["errors"].(map[string]map[string]interface{})) != 1 {
+		t.Error("There should be 1 error in the report")
+	}
+	if report["stats_total"].(map[string]interface{})["num_requests"].(int64) != 4 {
+		t.Error("num_requests of total is wrong, expected: 4, got:", report["stats_total"].(map[string]interface{})["num_requests"])
+	}
+
+	if collector.NumRequests("http", "foo") != 0 {
+		t.Error("Stats should be reset after Report")
+	}
+}
+
+func TestStatsCollectorErrorNormalizer(t *testing.T) {
+	collector := NewStatsCollector()
+	collector.SetErrorNormalizer(func(err string) string {
+		return strings.SplitN(err, " at ", 2)[0]
+	})
+	collector.RecordFailure("http", "foo", 10, "connection reset at 2024-05-01T10:00:00Z")
+	collector.RecordFailure("http", "foo", 10, "connection reset at 2024-05-01T10:00:01Z")
+	collector.RecordFailure("http", "foo", 10, "500 error")
+
+	errors := collector.Report()["errors"].(map[string]map[string]interface{})
+	if len(errors) != 2 {
+		t.Fatal("The errors should be grouped by the normalizer, got", errors)
+	}
+	reset := errors[MD5("http", "foo", "connection reset")]
+	if reset == nil || reset["occurrences"].(int64) != 2 {
+		t.Error("The normalized error should occur twice, got", reset)
+	}
+	if _, ok := reset["exemplars"]; ok {
+		t.Error("The exemplars shouldn't be sampled without SetErrorExemplars")
+	}
+}
+
+func TestStatsCollectorByType(t *testing.T) {
+	collector := NewStatsCollector()
+	collector.SetAggregationMode(ByType)
+	collector.RecordSuccess("GET", "/users/1", 10, 100)
+	collector.RecordSuccess("GET", "/users/2", 10, 100)
+
+	if collector.NumRequests("GET", "") != 2 {
+		t.Error("NumRequests of GET is wrong, expected: 2, got:", collector.NumRequests("GET", ""))
+	}
+}
@@ -0,0 +1,116 @@
+package boomer
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// applyConfigFile sets the flags of fs by the config file of path, the flags already set by the command line
+// or the environment variables are kept, so they override the file. The file is TOML if its extension is ".toml", otherwise it's YAML. The keys are
+// the names of the flags, and the values are scalars, like
+//
+//	master-host: 10.0.0.1
+//	master-port: 5557
+//	max-rps: 1000
+//	run-time: 10m
+//	report-html: report.html
+func applyConfigFile(fs *flag.FlagSet, path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s, %v", path, err)
+	}
+	values := make(map[string]interface{})
+	if strings.ToLower(filepath.Ext(path)) == ".toml" {
+		_, err = toml.Decode(string(content), &values)
+	} else {
+		err = yaml.Unmarshal(content, &values)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s, %v", path, err)
+	}
+
+	alreadySet := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		alreadySet[f.Name] = true
+	})
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == "config" || fs.Lookup(name) == nil {
+			return fmt.Errorf("unknown option %s in config file %s", name, path)
+		}
+		if alreadySet[name] {
+			continue
+		}
+		value, err := configValue(values[name])
+		if err != nil {
+			return fmt.Errorf("invalid %s in config file %s, %v", name, path, err)
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("invalid %s in config file %s, %v", name, path, err)
+		}
+	}
+	return nil
+}
+
+// envPrefix is the prefix of the environment variables of the flags.
+const envPrefix = "BOOMER_"
+
+// flagEnvName returns the environment variable of a flag, like BOOMER_MASTER_HOST for master-host.
+func flagEnvName(name string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+// applyEnvironment sets the flags of fs by the BOOMER_* environment variables, see flagEnvName.
+// The flags set by the command line are kept, so they override the environment variables.
+func applyEnvironment(fs *flag.FlagSet) error {
+	setByCommandLine := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		setByCommandLine[f.Name] = true
+	})
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || setByCommandLine[f.Name] {
+			return
+		}
+		name := flagEnvName(f.Name)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return
+		}
+		if e := fs.Set(f.Name, value); e != nil {
+			err = fmt.Errorf("invalid environment variable %s, %v", name, e)
+		}
+	})
+	return err
+}
+
+// configValue converts a value of the config file to the string of a flag.
+func configValue(v interface{}) (string, error) {
+	switch value := v.(type) {
+	case string:
+		return value, nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	case int:
+		return strconv.Itoa(value), nil
+	case int64:
+		return strconv.FormatInt(value, 10), nil
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), nil
+	default:
+		return "", fmt.Errorf("expected a string, a number or a boolean, got %T", v)
+	}
+}
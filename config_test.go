@@ -0,0 +1,168 @@
+package boomer
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newConfigTestFlagSet() (*flag.FlagSet, *string, *int, *int64, *time.Duration, *bool) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	host := fs.String("master-host", "127.0.0.1", "")
+	port := fs.Int("master-port", 5557, "")
+	maxRPS := fs.Int64("max-rps", 0, "")
+	runTime := fs.Duration("run-time", 0, "")
+	standalone := fs.Bool("standalone", false, "")
+	fs.String("config", "", "")
+	return fs, host, port, maxRPS, runTime, standalone
+}
+
+func writeConfigFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestApplyConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boomer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	yamlPath := writeConfigFile(t, dir, "boomer.yaml", "master-host: 10.0.0.1\nmaster-port: 5558\nmax-rps: 1000\nrun-time: 10m\nstandalone: true\n")
+	tomlPath := writeConfigFile(t, dir, "boomer.toml", "master-host = \"10.0.0.1\"\nmaster-port = 5558\nmax-rps = 1000\nrun-time = \"10m\"\nstandalone = true\n")
+
+	for _, path := range []string{yamlPath, tomlPath} {
+		fs, host, port, maxRPS, runTime, standalone := newConfigTestFlagSet()
+		if err := fs.Parse([]string{"--config", path}); err != nil {
+			t.Fatal(err)
+		}
+		if err := applyConfigFile(fs, path); err != nil {
+			t.Fatal(err)
+		}
+		if *host != "10.0.0.1" || *port != 5558 || *maxRPS != 1000 || *runTime != 10*time.Minute || !*standalone {
+			t.Error("The options should be set by", filepath.Base(path), *host, *port, *maxRPS, *runTime, *standalone)
+		}
+	}
+}
+
+func TestApplyConfigFileOverriddenByCommandLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boomer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeConfigFile(t, dir, "boomer.yaml", "master-host: 10.0.0.1\nmax-rps: 1000\n")
+
+	fs, host, _, maxRPS, _, _ := newConfigTestFlagSet()
+	if err := fs.Parse([]string{"--max-rps", "500"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfigFile(fs, path); err != nil {
+		t.Fatal(err)
+	}
+	if *maxRPS != 500 {
+		t.Error("The command line should override the config file, got", *maxRPS)
+	}
+	if *host != "10.0.0.1" {
+		t.Error("The master host should be set by the config file, got", *host)
+	}
+}
+
+func TestApplyConfigFileInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boomer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	contents := map[string]string{
+		"unknown.yaml": "unknown-option: 1\n",
+		"nested.yaml":  "master-host:\n  name: 10.0.0.1\n",
+		"invalid.yaml": "master-port: abc\n",
+		"config.yaml":  "config: other.yaml\n",
+	}
+	for name, content := range contents {
+		path := writeConfigFile(t, dir, name, content)
+		fs, _, _, _, _, _ := newConfigTestFlagSet()
+		if err := applyConfigFile(fs, path); err == nil {
+			t.Error("The config file should be refused,", name)
+		}
+	}
+
+	fs, _, _, _, _, _ := newConfigTestFlagSet()
+	if err := applyConfigFile(fs, filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("A missing config file should be refused")
+	}
+}
+
+func TestFlagEnvName(t *testing.T) {
+	if name := flagEnvName("master-host"); name != "BOOMER_MASTER_HOST" {
+		t.Error("Unexpected environment variable", name)
+	}
+	if name := flagEnvName("cpuprofile"); name != "BOOMER_CPUPROFILE" {
+		t.Error("Unexpected environment variable", name)
+	}
+}
+
+func TestApplyEnvironment(t *testing.T) {
+	os.Setenv("BOOMER_MASTER_HOST", "10.0.0.1")
+	os.Setenv("BOOMER_MAX_RPS", "1000")
+	os.Setenv("BOOMER_RUN_TIME", "10m")
+	defer os.Unsetenv("BOOMER_MASTER_HOST")
+	defer os.Unsetenv("BOOMER_MAX_RPS")
+	defer os.Unsetenv("BOOMER_RUN_TIME")
+
+	fs, host, port, maxRPS, runTime, _ := newConfigTestFlagSet()
+	if err := fs.Parse([]string{"--max-rps", "500"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyEnvironment(fs); err != nil {
+		t.Fatal(err)
+	}
+	if *host != "10.0.0.1" || *runTime != 10*time.Minute {
+		t.Error("The options should be set by the environment variables", *host, *runTime)
+	}
+	if *maxRPS != 500 {
+		t.Error("The command line should override the environment variables, got", *maxRPS)
+	}
+	if *port != 5557 {
+		t.Error("The options without environment variables should be kept, got", *port)
+	}
+
+	os.Setenv("BOOMER_MASTER_PORT", "abc")
+	defer os.Unsetenv("BOOMER_MASTER_PORT")
+	fs, _, _, _, _, _ = newConfigTestFlagSet()
+	if err := applyEnvironment(fs); err == nil {
+		t.Error("An invalid environment variable should be refused")
+	}
+}
+
+func TestApplyEnvironmentOverridesConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boomer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeConfigFile(t, dir, "boomer.yaml", "master-host: 10.0.0.1\nmax-rps: 1000\n")
+
+	os.Setenv("BOOMER_MAX_RPS", "200")
+	defer os.Unsetenv("BOOMER_MAX_RPS")
+
+	fs, host, _, maxRPS, _, _ := newConfigTestFlagSet()
+	if err := applyEnvironment(fs); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfigFile(fs, path); err != nil {
+		t.Fatal(err)
+	}
+	if *maxRPS != 200 || *host != "10.0.0.1" {
+		t.Error("The environment variables should override the config file", *maxRPS, *host)
+	}
+}
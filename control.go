@@ -0,0 +1,247 @@
+package boomer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// controlStats is the response of /stats, the stats of the last interval.
+type controlStats struct {
+	State     string              `json:"state"`
+	UserCount int                 `json:"user_count"`
+	Time      int64               `json:"time"`
+	Warmup    bool                `json:"warmup"`
+	Stats     []*finalReportEntry `json:"stats"`
+	Total     *finalReportEntry   `json:"total"`
+	Errors    []*finalReportError `json:"errors"`
+}
+
+// scalingStatus is the response of /scaling, the load of boomer for the autoscalers of the workers, like the
+// metrics-api scaler of KEDA, or an external metric of HPA.
+type scalingStatus struct {
+	State           string `json:"state"`
+	UserCount       int    `json:"user_count"`
+	TargetUserCount int    `json:"target_user_count"`
+	// WorkerCount is the number of workers reported by the master, 0 in standalone mode.
+	WorkerCount     int `json:"worker_count"`
+	ExpectedWorkers int `json:"expected_workers"`
+}
+
+// controlOutput serves the control API, which is used by the orchestration tools to start and stop
+// a standalone boomer and to scrape its stats and health, see Boomer.SetControlAddr.
+type controlOutput struct {
+	addr     string
+	server   *http.Server
+	listener net.Listener
+
+	// state returns the state and the number of users of the runner.
+	state func() (string, int)
+	// scaling returns the response of /scaling, it's made of state if it's nil.
+	scaling func() *scalingStatus
+	// controller must be set before OnStart, /start and /stop are refused if it's nil, like in distributed mode.
+	controller testController
+
+	lock      sync.RWMutex
+	lastTime  time.Time
+	stats     *controlStats
+	listening chan bool
+}
+
+func newControlOutput(addr string, state func() (string, int)) *controlOutput {
+	o := &controlOutput{
+		addr:      addr,
+		state:     state,
+		stats:     &controlStats{Stats: []*finalReportEntry{}, Errors: []*finalReportError{}},
+		listening: make(chan bool),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/start", o.handleStart)
+	mux.HandleFunc("/stop", o.handleStop)
+	mux.HandleFunc("/stats", o.handleStats)
+	mux.HandleFunc("/healthz", o.handleHealthz)
+	mux.HandleFunc("/scaling", o.handleScaling)
+	o.server = &http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+	return o
+}
+
+// Init binds the address, so boomer can fail fast if the address is in use.
+func (o *controlOutput) Init() error {
+	ln, err := net.Listen("tcp", o.addr)
+	if err != nil {
+		return fmt.Errorf("failed to start the control API on %s, %v", o.addr, err)
+	}
+	o.listener = ln
+	return nil
+}
+
+// OnStart starts the http server.
+func (o *controlOutput) OnStart() {
+	defer close(o.listening)
+	o.lastTime = time.Now()
+	if o.listener == nil {
+		if err := o.Init(); err != nil {
+			logError("%v", err)
+			return
+		}
+	}
+	logInfo("The control API is serving on http://%s", o.listener.Addr().String())
+	go o.server.Serve(o.listener)
+}
+
+// OnEvent keeps the last interval's stats for /stats.
+func (o *controlOutput) OnEvent(data map[string]interface{}) {
+	interval := ParseIntervalStats(data)
+	duration := interval.Time.Sub(o.lastTime)
+	o.lastTime = interval.Time
+
+	stats := &controlStats{
+		Time:   interval.Time.Unix(),
+		Warmup: interval.Warmup,
+		Stats:  make([]*finalReportEntry, 0, len(interval.Stats)),
+		Errors: make([]*finalReportError, 0, len(interval.Errors)),
+	}
+	for _, s := range interval.Stats {
+		stats.Stats = append(stats.Stats, newControlEntry(s, duration))
+	}
+	if interval.Total != nil {
+		stats.Total = newControlEntry(interval.Total, duration)
+	}
+	for _, e := range interval.Errors {
+		stats.Errors = append(stats.Errors, &finalReportError{
+			Method:      e.Method,
+			Name:        e.Name,
+			Error:       e.Error,
+			Occurrences: e.Occurrences,
+		})
+	}
+	o.lock.Lock()
+	o.stats = stats
+	o.lock.Unlock()
+}
+
+// OnStop shuts down the http server.
+func (o *controlOutput) OnStop() {
+	<-o.listening
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	o.server.Shutdown(ctx)
+}
+
+func newControlEntry(s *RequestStats, duration time.Duration) *finalReportEntry {
+	entry := &finalReportEntry{
+		Method:             s.Method,
+		Name:               s.Name,
+		NumRequests:        s.NumRequests,
+		NumFailures:        s.NumFailures,
+		MinResponseTime:    s.MinResponseTime,
+		MaxResponseTime:    s.MaxResponseTime,
+		MinContentLength:   s.MinContentLength,
+		MaxContentLength:   s.MaxContentLength,
+		totalResponseTime:  s.TotalResponseTime,
+		totalContentLength: s.TotalContentLength,
+		responseTimes:      s.ResponseTimes,
+	}
+	entry.summarize(duration)
+	return entry
+}
+
+// handleStart starts the test with the users and the spawn rate of the query or the form, like
+// POST /start?users=10&spawn_rate=5, or rescales the running test.
+func (o *controlOutput) handleStart(w http.ResponseWriter, req *http.Request) {
+	if !o.checkControl(w, req) {
+		return
+	}
+	spawnCount, err := strconv.Atoi(req.FormValue("users"))
+	if err != nil || spawnCount <= 0 {
+		writeControlError(w, http.StatusBadRequest, "invalid users, expected a positive integer")
+		return
+	}
+	spawnRate, err := strconv.ParseFloat(req.FormValue("spawn_rate"), 64)
+	if err != nil || spawnRate <= 0 {
+		writeControlError(w, http.StatusBadRequest, "invalid spawn rate, expected a positive number")
+		return
+	}
+	logInfo("The test is started by the control API with %d users at %.2f users/s", spawnCount, spawnRate)
+	o.controller.startTest(spawnCount, spawnRate)
+	o.writeState(w)
+}
+
+// handleStop stops the users, boomer keeps running, so the test can be started again.
+func (o *controlOutput) handleStop(w http.ResponseWriter, req *http.Request) {
+	if !o.checkControl(w, req) {
+		return
+	}
+	logInfo("The test is stopped by the control API")
+	o.controller.stopTest()
+	o.writeState(w)
+}
+
+func (o *controlOutput) handleStats(w http.ResponseWriter, req *http.Request) {
+	o.lock.RLock()
+	stats := *o.stats
+	o.lock.RUnlock()
+	stats.State, stats.UserCount = o.state()
+	writeControlJSON(w, http.StatusOK, &stats)
+}
+
+// handleHealthz responds 200 as long as boomer is running, with its state.
+func (o *controlOutput) handleHealthz(w http.ResponseWriter, req *http.Request) {
+	o.writeState(w)
+}
+
+// handleScaling responds the number of users and workers, see scalingStatus.
+func (o *controlOutput) handleScaling(w http.ResponseWriter, req *http.Request) {
+	if o.scaling != nil {
+		writeControlJSON(w, http.StatusOK, o.scaling())
+		return
+	}
+	state, users := o.state()
+	writeControlJSON(w, http.StatusOK, &scalingStatus{
+		State:           state,
+		UserCount:       users,
+		TargetUserCount: users,
+	})
+}
+
+// checkControl responds an error if the request can't control the test.
+func (o *controlOutput) checkControl(w http.ResponseWriter, req *http.Request) bool {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeControlError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return false
+	}
+	if o.controller == nil {
+		writeControlError(w, http.StatusConflict, "the test is controlled by the master")
+		return false
+	}
+	return true
+}
+
+func (o *controlOutput) writeState(w http.ResponseWriter) {
+	state, users := o.state()
+	writeControlJSON(w, http.StatusOK, map[string]interface{}{
+		"state":      state,
+		"user_count": users,
+	})
+}
+
+func writeControlError(w http.ResponseWriter, code int, message string) {
+	writeControlJSON(w, code, map[string]string{"error": message})
+}
+
+func writeControlJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logDebug("Failed to write the response of the control API, %v", err)
+	}
+}
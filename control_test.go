@@ -0,0 +1,144 @@
+package boomer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func serveControl(o *controlOutput, method, target string) (int, map[string]interface{}) {
+	recorder := httptest.NewRecorder()
+	o.server.Handler.ServeHTTP(recorder, httptest.NewRequest(method, target, nil))
+	var body map[string]interface{}
+	json.Unmarshal(recorder.Body.Bytes(), &body)
+	return recorder.Code, body
+}
+
+func TestControlOutput(t *testing.T) {
+	controller := &fakeTestController{state: stateInit}
+	o := newControlOutput("127.0.0.1:0", func() (string, int) {
+		return controller.state, controller.spawnCount
+	})
+	o.controller = controller
+
+	code, body := serveControl(o, http.MethodGet, "/healthz")
+	if code != http.StatusOK || body["state"] != stateInit {
+		t.Error("Expected the state ready, got", code, body)
+	}
+
+	if code, _ := serveControl(o, http.MethodGet, "/start?users=10&spawn_rate=5"); code != http.StatusMethodNotAllowed {
+		t.Error("Expected status code 405 for GET, got", code)
+	}
+	if code, body := serveControl(o, http.MethodPost, "/start?users=-1&spawn_rate=5"); code != http.StatusBadRequest || body["error"] == nil {
+		t.Error("Expected status code 400 for invalid users, got", code)
+	}
+	if code, _ := serveControl(o, http.MethodPost, "/start?users=10"); code != http.StatusBadRequest {
+		t.Error("Expected status code 400 without spawn rate, got", code)
+	}
+
+	code, body = serveControl(o, http.MethodPost, "/start?users=10&spawn_rate=5")
+	if code != http.StatusOK || controller.spawnCount != 10 || controller.spawnRate != 5 {
+		t.Error("The test should be started with 10 users at 5 users/s, got", controller.spawnCount, controller.spawnRate)
+	}
+	if body["state"] != stateSpawning || body["user_count"] != 10.0 {
+		t.Error("The state should be responded, got", body)
+	}
+
+	code, body = serveControl(o, http.MethodPost, "/stop")
+	if code != http.StatusOK || !controller.stopped || body["state"] != stateStopped {
+		t.Error("The test should be stopped, got", code, body)
+	}
+}
+
+func TestControlOutputStats(t *testing.T) {
+	o := newControlOutput("127.0.0.1:0", func() (string, int) {
+		return stateRunning, 10
+	})
+	code, body := serveControl(o, http.MethodGet, "/stats")
+	if code != http.StatusOK || len(body["stats"].([]interface{})) != 0 {
+		t.Error("The stats should be empty before the first interval, got", body)
+	}
+
+	o.lastTime = time.Now().Add(-2 * time.Second)
+	collector := NewStatsCollector()
+	collector.RecordSuccess("http", "foo", 10, 100)
+	collector.RecordSuccess("http", "foo", 30, 100)
+	collector.RecordFailure("http", "foo", 20, "500 error")
+	o.OnEvent(collector.Report())
+
+	_, body = serveControl(o, http.MethodGet, "/stats")
+	if body["state"] != stateRunning || body["user_count"] != 10.0 {
+		t.Error("The state should be responded, got", body)
+	}
+	stats := body["stats"].([]interface{})
+	if len(stats) != 1 {
+		t.Fatal("Expected the stats of foo, got", stats)
+	}
+	foo := stats[0].(map[string]interface{})
+	if foo["name"] != "foo" || foo["num_requests"] != 3.0 || foo["num_failures"] != 1.0 || foo["avg_response_time"] != 20.0 {
+		t.Error("Unexpected stats of foo", foo)
+	}
+	if rps := foo["rps"].(float64); rps < 1.4 || rps > 1.5 {
+		t.Error("The RPS should be calculated over the interval, got", rps)
+	}
+	if total := body["total"].(map[string]interface{}); total["num_requests"] != 3.0 {
+		t.Error("Unexpected total", total)
+	}
+	if errors := body["errors"].([]interface{}); len(errors) != 1 || errors[0].(map[string]interface{})["error"] != "500 error" {
+		t.Error("Unexpected errors", errors)
+	}
+}
+
+func TestControlOutputInDistributedMode(t *testing.T) {
+	o := newControlOutput("127.0.0.1:0", func() (string, int) {
+		return stateRunning, 10
+	})
+	if code, _ := serveControl(o, http.MethodPost, "/start?users=10&spawn_rate=5"); code != http.StatusConflict {
+		t.Error("Expected status code 409 without a controller, got", code)
+	}
+	if code, _ := serveControl(o, http.MethodPost, "/stop"); code != http.StatusConflict {
+		t.Error("Expected status code 409 without a controller, got", code)
+	}
+}
+
+func TestControlOutputScaling(t *testing.T) {
+	o := newControlOutput("127.0.0.1:0", func() (string, int) {
+		return stateRunning, 10
+	})
+	code, body := serveControl(o, http.MethodGet, "/scaling")
+	if code != http.StatusOK || body["state"] != stateRunning || body["user_count"] != 10.0 || body["target_user_count"] != 10.0 {
+		t.Error("The scaling status should be made of the state, got", code, body)
+	}
+
+	o.scaling = func() *scalingStatus {
+		return &scalingStatus{State: stateSpawning, UserCount: 5, TargetUserCount: 20, WorkerCount: 2, ExpectedWorkers: 4}
+	}
+	_, body = serveControl(o, http.MethodGet, "/scaling")
+	if body["target_user_count"] != 20.0 || body["worker_count"] != 2.0 || body["expected_workers"] != 4.0 {
+		t.Error("The scaling status should be responded, got", body)
+	}
+}
+
+func TestControlOutputServe(t *testing.T) {
+	o := newControlOutput("127.0.0.1:0", func() (string, int) {
+		return stateRunning, 10
+	})
+	if err := o.Init(); err != nil {
+		t.Fatal(err)
+	}
+	o.OnStart()
+	resp, err := http.Get("http://" + o.listener.Addr().String() + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Error("Expected status code 200, got", resp.StatusCode)
+	}
+	o.OnStop()
+	if _, err := http.Get("http://" + o.listener.Addr().String() + "/healthz"); err == nil {
+		t.Error("The server should be shut down")
+	}
+}
@@ -0,0 +1,206 @@
+package boomer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// csvPercentiles are the percentiles written by locust, the last one is the max response time.
+var csvPercentiles = []float64{0.5, 0.66, 0.75, 0.8, 0.9, 0.95, 0.98, 0.99, 0.999, 0.9999, 1.0}
+
+var csvPercentileHeaders = []string{"50%", "66%", "75%", "80%", "90%", "95%", "98%", "99%", "99.9%", "99.99%", "100%"}
+
+// CSVOutput writes the stats to CSV files in the same schema as the --csv option of locust, so the tools
+// which post-process the CSV files of locust can be reused.
+//   - prefix_stats.csv has the lifetime stats of each request name, and an "Aggregated" row at last.
+//   - prefix_stats_history.csv has a row of the aggregated stats of every interval.
+//   - prefix_failures.csv has the lifetime occurrences of each error.
+//
+// The files are flushed every report interval, and when the test is stopped.
+// The percentiles are calculated from the rounded response times reported to the master.
+type CSVOutput struct {
+	prefix string
+	stats  *lifetimeStats
+
+	historyFile *os.File
+	history     *csv.Writer
+}
+
+// NewCSVOutput returns a CSVOutput, which writes to the files of prefix, like "results/test1".
+// The files are truncated if they exist.
+func NewCSVOutput(prefix string) *CSVOutput {
+	return &CSVOutput{
+		prefix: prefix,
+		stats:  newLifetimeStats(),
+	}
+}
+
+// Init creates the history file and writes the header, so boomer can fail fast if the files can't be written.
+func (o *CSVOutput) Init() error {
+	path := o.prefix + "_stats_history.csv"
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create CSV file %s, %v", path, err)
+	}
+	o.historyFile = file
+	o.history = csv.NewWriter(file)
+	header := []string{"Timestamp", "User Count", "Type", "Name", "Requests/s", "Failures/s"}
+	header = append(header, csvPercentileHeaders...)
+	header = append(header, "Total Request Count", "Total Failure Count", "Total Median Response Time",
+		"Total Average Response Time", "Total Min Response Time", "Total Max Response Time", "Total Average Content Size")
+	o.history.Write(header)
+	o.history.Flush()
+	return nil
+}
+
+// OnStart creates the history file if it's not done by Init, and starts timing the test.
+func (o *CSVOutput) OnStart() {
+	o.stats.startTime = time.Now()
+	if o.history != nil {
+		return
+	}
+	if err := o.Init(); err != nil {
+		logError("%v", err)
+	}
+}
+
+// OnEvent appends the interval's stats to the history file, and rewrites the stats and failures files.
+func (o *CSVOutput) OnEvent(data map[string]interface{}) {
+	now := time.Now()
+	o.stats.add(data)
+	entries := o.stats.summarize(now)
+
+	if o.history != nil {
+		if total, ok := data["stats_total"].(map[string]interface{}); ok {
+			userCount, _ := data["user_count"].(int32)
+			o.history.Write(o.historyRow(now, int64(userCount), total))
+			o.history.Flush()
+			if err := o.history.Error(); err != nil {
+				logError("Failed to write CSV file %s_stats_history.csv, %v", o.prefix, err)
+			}
+		}
+	}
+	o.writeStats(now, entries)
+	o.writeFailures()
+}
+
+// OnStop rewrites the stats and failures files, and closes the history file.
+func (o *CSVOutput) OnStop() {
+	now := time.Now()
+	o.writeStats(now, o.stats.summarize(now))
+	o.writeFailures()
+	if o.history == nil {
+		return
+	}
+	o.history.Flush()
+	o.historyFile.Close()
+	o.history = nil
+}
+
+func (o *CSVOutput) historyRow(now time.Time, userCount int64, total map[string]interface{}) []string {
+	numRequests := total["num_requests"].(int64)
+	numFailures := total["num_failures"].(int64)
+	numFailPerSec, _ := total["num_fail_per_sec"].(map[int64]int64)
+	responseTimes := total["response_times"].(map[int64]int64)
+	failuresPerSec := float64(0)
+	if len(numFailPerSec) != 0 {
+		failuresPerSec = float64(numFailures) / float64(len(numFailPerSec))
+	}
+
+	row := []string{
+		strconv.FormatInt(now.Unix(), 10),
+		strconv.FormatInt(userCount, 10),
+		"",
+		"Aggregated",
+		strconv.FormatInt(getCurrentRps(numRequests, total["num_reqs_per_sec"].(map[int64]int64)), 10),
+		formatCSVFloat(failuresPerSec),
+	}
+	row = append(row, csvPercentileColumns(numRequests, responseTimes)...)
+
+	lifetime := o.stats.total
+	return append(row,
+		strconv.FormatInt(lifetime.NumRequests, 10),
+		strconv.FormatInt(lifetime.NumFailures, 10),
+		strconv.FormatInt(lifetime.P50, 10),
+		formatCSVFloat(lifetime.AvgResponseTime),
+		strconv.FormatInt(lifetime.MinResponseTime, 10),
+		strconv.FormatInt(lifetime.MaxResponseTime, 10),
+		strconv.FormatInt(lifetime.AvgContentLength, 10),
+	)
+}
+
+func (o *CSVOutput) writeStats(now time.Time, entries []*finalReportEntry) {
+	header := []string{"Type", "Name", "Request Count", "Failure Count", "Median Response Time", "Average Response Time",
+		"Min Response Time", "Max Response Time", "Average Content Size", "Requests/s", "Failures/s"}
+	rows := [][]string{append(header, csvPercentileHeaders...)}
+
+	duration := now.Sub(o.stats.startTime).Seconds()
+	for _, entry := range append(entries, o.stats.total) {
+		name := entry.Name
+		if entry == o.stats.total {
+			name = "Aggregated"
+		}
+		failuresPerSec := float64(0)
+		if duration > 0 {
+			failuresPerSec = float64(entry.NumFailures) / duration
+		}
+		row := []string{
+			entry.Method,
+			name,
+			strconv.FormatInt(entry.NumRequests, 10),
+			strconv.FormatInt(entry.NumFailures, 10),
+			strconv.FormatInt(entry.P50, 10),
+			formatCSVFloat(entry.AvgResponseTime),
+			strconv.FormatInt(entry.MinResponseTime, 10),
+			strconv.FormatInt(entry.MaxResponseTime, 10),
+			strconv.FormatInt(entry.AvgContentLength, 10),
+			formatCSVFloat(entry.RPS),
+			formatCSVFloat(failuresPerSec),
+		}
+		rows = append(rows, append(row, csvPercentileColumns(entry.NumRequests, entry.responseTimes)...))
+	}
+	o.writeFile(o.prefix+"_stats.csv", rows)
+}
+
+func (o *CSVOutput) writeFailures() {
+	rows := [][]string{{"Method", "Name", "Error", "Occurrences"}}
+	for _, e := range o.stats.sortedErrors() {
+		rows = append(rows, []string{e.Method, e.Name, e.Error, strconv.FormatInt(e.Occurrences, 10)})
+	}
+	o.writeFile(o.prefix+"_failures.csv", rows)
+}
+
+func (o *CSVOutput) writeFile(path string, rows [][]string) {
+	file, err := os.Create(path)
+	if err != nil {
+		logError("Failed to create CSV file %s, %v", path, err)
+		return
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.WriteAll(rows)
+	if err := writer.Error(); err != nil {
+		logError("Failed to write CSV file %s, %v", path, err)
+	}
+}
+
+// csvPercentileColumns returns the percentiles, or "N/A" like locust, if there is no request.
+func csvPercentileColumns(numRequests int64, responseTimes map[int64]int64) []string {
+	columns := make([]string, len(csvPercentiles))
+	for i, percent := range csvPercentiles {
+		if numRequests == 0 {
+			columns[i] = "N/A"
+			continue
+		}
+		columns[i] = strconv.FormatInt(getPercentileResponseTime(numRequests, responseTimes, percent), 10)
+	}
+	return columns
+}
+
+func formatCSVFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,81 @@
+package boomer
+
+import (
+	"encoding/csv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readCSV(t *testing.T, path string) [][]string {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func TestCSVOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boomer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	prefix := filepath.Join(dir, "test")
+
+	o := NewCSVOutput(prefix)
+	if err := o.Init(); err != nil {
+		t.Fatal(err)
+	}
+	o.OnStart()
+
+	collector := NewStatsCollector()
+	collector.RecordSuccess("http", "foo", 10, 100)
+	collector.RecordFailure("http", "foo", 30, "500 error")
+	data := collector.Report()
+	data["user_count"] = int32(10)
+	o.OnEvent(data)
+	collector.RecordSuccess("http", "bar", 20, 100)
+	o.OnEvent(collector.Report())
+	o.OnStop()
+
+	stats := readCSV(t, prefix+"_stats.csv")
+	if len(stats) != 4 {
+		t.Fatal("Expected a header, 2 entries and the aggregated, got:", stats)
+	}
+	if len(stats[0]) != 22 || stats[0][2] != "Request Count" || stats[0][21] != "100%" {
+		t.Error("Unexpected header of stats:", stats[0])
+	}
+	foo := stats[2]
+	if foo[0] != "http" || foo[1] != "foo" || foo[2] != "2" || foo[3] != "1" || foo[6] != "10" || foo[7] != "30" || foo[21] != "30" {
+		t.Error("Unexpected row of foo:", foo)
+	}
+	if stats[3][1] != "Aggregated" || stats[3][2] != "3" {
+		t.Error("Unexpected row of aggregated:", stats[3])
+	}
+
+	history := readCSV(t, prefix+"_stats_history.csv")
+	if len(history) != 3 {
+		t.Fatal("Expected a header and 2 intervals, got:", history)
+	}
+	if len(history[0]) != 24 {
+		t.Error("Unexpected header of history:", history[0])
+	}
+	if history[1][1] != "10" || history[1][3] != "Aggregated" || history[1][17] != "2" {
+		t.Error("Unexpected row of the first interval:", history[1])
+	}
+	if history[2][17] != "3" || history[2][18] != "1" {
+		t.Error("The total counts should be cumulative, got:", history[2])
+	}
+
+	failures := readCSV(t, prefix+"_failures.csv")
+	if len(failures) != 2 || failures[1][1] != "foo" || failures[1][2] != "500 error" || failures[1][3] != "1" {
+		t.Error("Unexpected failures:", failures)
+	}
+}
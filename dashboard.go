@@ -0,0 +1,127 @@
+package boomer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// dashboardMaxErrors is the number of the most frequent errors shown by ConsoleDashboardOutput.
+const dashboardMaxErrors = 5
+
+// ConsoleDashboardOutput redraws a live dashboard in the terminal every report interval, instead of appending
+// tables like ConsoleOutput. It shows the users, the total RPS and failure rate, and a table of the RPS,
+// the failure rate and the percentiles of each request name in the interval, followed by the most frequent errors.
+// The logs printed between the intervals are cleared by the next redraw, see SetLogger to keep them in a file.
+type ConsoleDashboardOutput struct {
+	writer    io.Writer
+	startTime time.Time
+	lastTime  time.Time
+}
+
+// NewConsoleDashboardOutput returns a ConsoleDashboardOutput, which draws on the standard output.
+func NewConsoleDashboardOutput() *ConsoleDashboardOutput {
+	return &ConsoleDashboardOutput{
+		writer: os.Stdout,
+	}
+}
+
+// OnStart records the start time, to show the elapsed time.
+func (o *ConsoleDashboardOutput) OnStart() {
+	o.startTime = time.Now()
+	o.lastTime = o.startTime
+}
+
+// OnEvent redraws the dashboard.
+func (o *ConsoleDashboardOutput) OnEvent(data map[string]interface{}) {
+	stats := ParseIntervalStats(data)
+	interval := stats.Time.Sub(o.lastTime).Seconds()
+	o.lastTime = stats.Time
+	buf := &bytes.Buffer{}
+	// move the cursor to the top left corner and clear the screen
+	buf.WriteString("\033[H\033[2J")
+
+	elapsed := stats.Time.Sub(o.startTime).Truncate(time.Second)
+	status := "running"
+	if stats.Warmup {
+		status = "warm-up"
+	}
+	fmt.Fprintf(buf, "boomer  %s  elapsed %s  %s\n", stats.Time.Format("2006/01/02 15:04:05"), elapsed, status)
+
+	var rps, failureRate float64
+	if stats.Total != nil {
+		rps = dashboardRPS(stats.Total, interval)
+		failureRate = dashboardFailureRate(stats.Total)
+	}
+	fmt.Fprintf(buf, "Users: %d  RPS: %.1f  Failures: %.2f%%  CPU: %.1f%%  Memory: %d MB\n\n",
+		stats.UserCount, rps, failureRate, stats.CPUUsage, stats.MemoryUsage/1024/1024)
+
+	table := tablewriter.NewWriter(buf)
+	table.SetHeader([]string{"Type", "Name", "# requests", "# fails", "Fails %", "RPS", "Average", "50%", "90%", "95%", "99%", "Max"})
+	for _, s := range stats.Stats {
+		table.Append(dashboardRow(s, interval))
+	}
+	if stats.Total != nil && len(stats.Stats) > 1 {
+		table.Append(dashboardRow(stats.Total, interval))
+	}
+	table.Render()
+
+	if len(stats.Errors) > 0 {
+		buf.WriteString("\nErrors:\n")
+		for i, e := range stats.Errors {
+			if i == dashboardMaxErrors {
+				fmt.Fprintf(buf, "  ... and %d more\n", len(stats.Errors)-dashboardMaxErrors)
+				break
+			}
+			fmt.Fprintf(buf, "  %d  %s %s: %s\n", e.Occurrences, e.Method, e.Name, e.Error)
+		}
+	}
+
+	// write the whole dashboard at once, to avoid flickering
+	o.writer.Write(buf.Bytes())
+}
+
+// OnStop of ConsoleDashboardOutput has nothing to do, the last dashboard is kept on the screen.
+func (o *ConsoleDashboardOutput) OnStop() {
+
+}
+
+func dashboardRow(s *RequestStats, interval float64) []string {
+	responseTime := func(percent float64) string {
+		return strconv.FormatInt(getPercentileResponseTime(s.NumRequests, s.ResponseTimes, percent), 10)
+	}
+	return []string{
+		s.Method,
+		s.Name,
+		strconv.FormatInt(s.NumRequests, 10),
+		strconv.FormatInt(s.NumFailures, 10),
+		strconv.FormatFloat(dashboardFailureRate(s), 'f', 2, 64),
+		strconv.FormatFloat(dashboardRPS(s, interval), 'f', 1, 64),
+		strconv.FormatFloat(s.AvgResponseTime(), 'f', 2, 64),
+		responseTime(0.5),
+		responseTime(0.9),
+		responseTime(0.95),
+		responseTime(0.99),
+		strconv.FormatInt(s.MaxResponseTime, 10),
+	}
+}
+
+// dashboardRPS returns the RPS of the requests in an interval of seconds.
+func dashboardRPS(s *RequestStats, interval float64) float64 {
+	if interval <= 0 {
+		return 0
+	}
+	return float64(s.NumRequests) / interval
+}
+
+func dashboardFailureRate(s *RequestStats) float64 {
+	if s.NumRequests == 0 {
+		return 0
+	}
+	return float64(s.NumFailures) * 100 / float64(s.NumRequests)
+}
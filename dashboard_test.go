@@ -0,0 +1,51 @@
+package boomer
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConsoleDashboardOutput(t *testing.T) {
+	buf := &bytes.Buffer{}
+	o := NewConsoleDashboardOutput()
+	o.writer = buf
+	o.OnStart()
+	o.startTime = o.startTime.Add(-2 * time.Second)
+	o.lastTime = o.startTime
+
+	collector := NewStatsCollector()
+	collector.RecordSuccess("http", "foo", 10, 100)
+	collector.RecordSuccess("http", "foo", 30, 100)
+	collector.RecordSuccess("http", "bar", 20, 100)
+	collector.RecordFailure("http", "bar", 40, "500 error")
+	collector.RecordFailure("http", "bar", 40, "500 error")
+	for i := 0; i < 5; i++ {
+		collector.RecordFailure("http", "bar", 40, fmt.Sprintf("error %d", i))
+	}
+	data := collector.Report()
+	data["user_count"] = int32(10)
+	o.OnEvent(data)
+	o.OnStop()
+
+	output := buf.String()
+	if !strings.HasPrefix(output, "\033[H\033[2J") {
+		t.Error("The screen should be cleared before drawing")
+	}
+	if !strings.Contains(output, "elapsed 2s") {
+		t.Error("The elapsed time should be shown, got", output)
+	}
+	if !strings.Contains(output, "Users: 10  RPS: 5.0  Failures: 70.00%") {
+		t.Error("The users, RPS and failure rate should be shown, got", output)
+	}
+	for _, name := range []string{"foo", "bar", "Total"} {
+		if !strings.Contains(output, name) {
+			t.Error("The stats of", name, "should be shown")
+		}
+	}
+	if !strings.Contains(output, "2  http bar: 500 error") || !strings.Contains(output, "... and 1 more") {
+		t.Error("The most frequent errors should be shown, got", output)
+	}
+}
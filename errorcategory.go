@@ -0,0 +1,84 @@
+package boomer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// ErrorCategory is the kind of the error of a failure recorded by RecordError, the errors are
+// reported with their categories, so the outputs can tell the timeouts from the server errors
+// without parsing the error messages.
+type ErrorCategory string
+
+const (
+	// ErrorTimeout is a timeout, like a net.Error whose Timeout is true or context.DeadlineExceeded.
+	ErrorTimeout ErrorCategory = "timeout"
+	// ErrorCanceled is a request canceled by its context.
+	ErrorCanceled ErrorCategory = "canceled"
+	// ErrorDNS is a failed DNS lookup.
+	ErrorDNS ErrorCategory = "dns"
+	// ErrorConnectionRefused is a connection refused by the host.
+	ErrorConnectionRefused ErrorCategory = "connection_refused"
+	// ErrorConnectionReset is a connection reset or closed by the peer.
+	ErrorConnectionReset ErrorCategory = "connection_reset"
+	// ErrorHTTPClient is a response with a 4xx status code.
+	ErrorHTTPClient ErrorCategory = "http_4xx"
+	// ErrorHTTPServer is a response with a 5xx status code.
+	ErrorHTTPServer ErrorCategory = "http_5xx"
+	// ErrorOther is any other error.
+	ErrorOther ErrorCategory = "other"
+	// ErrorPanic is a panic of a task, which is recovered by boomer and recorded as a failure.
+	ErrorPanic ErrorCategory = "panic"
+)
+
+// StatusError is an error of a response status, like an HTTP 503, which is classified by its status code.
+// Any error with a StatusCode() int method is classified in the same way.
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("HTTP %d", e.Code)
+}
+
+// StatusCode returns the status code of the response.
+func (e *StatusError) StatusCode() int {
+	return e.Code
+}
+
+// ClassifyError returns the category of err, the wrapped errors are unwrapped.
+func ClassifyError(err error) ErrorCategory {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ErrorDNS
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorTimeout
+	}
+	if errors.Is(err, context.Canceled) {
+		return ErrorCanceled
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return ErrorConnectionRefused
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return ErrorConnectionReset
+	}
+	var statusErr interface{ StatusCode() int }
+	if errors.As(err, &statusErr) {
+		switch code := statusErr.StatusCode(); {
+		case code >= 400 && code < 500:
+			return ErrorHTTPClient
+		case code >= 500 && code < 600:
+			return ErrorHTTPServer
+		}
+	}
+	return ErrorOther
+}
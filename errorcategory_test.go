@@ -0,0 +1,60 @@
+package boomer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassifyError(t *testing.T) {
+	for _, c := range []struct {
+		err      error
+		expected ErrorCategory
+	}{
+		{context.DeadlineExceeded, ErrorTimeout},
+		{&net.OpError{Op: "read", Net: "tcp", Err: timeoutError{}}, ErrorTimeout},
+		{fmt.Errorf("get user: %w", context.Canceled), ErrorCanceled},
+		{&net.DNSError{Err: "no such host", Name: "example.invalid"}, ErrorDNS},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, ErrorConnectionRefused},
+		{&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, ErrorConnectionReset},
+		{&StatusError{Code: 404}, ErrorHTTPClient},
+		{fmt.Errorf("checkout: %w", &StatusError{Code: 502}), ErrorHTTPServer},
+		{&StatusError{Code: 302}, ErrorOther},
+		{errors.New("unexpected body"), ErrorOther},
+	} {
+		if category := ClassifyError(c.err); category != c.expected {
+			t.Errorf("%v should be classified as %s, got %s", c.err, c.expected, category)
+		}
+	}
+}
+
+func TestRecordErrorWithCategory(t *testing.T) {
+	collector := NewStatsCollector()
+	collector.RecordError("http", "foo", 10, &StatusError{Code: 503})
+	collector.RecordError("http", "foo", 10, &StatusError{Code: 503})
+	collector.RecordFailure("http", "foo", 10, "500 error")
+	if collector.NumFailures("http", "foo") != 3 {
+		t.Error("NumFailures of foo is wrong, expected: 3, got:", collector.NumFailures("http", "foo"))
+	}
+
+	stats := ParseIntervalStats(collector.Report())
+	if len(stats.Errors) != 2 {
+		t.Fatal("There should be 2 errors, got", stats.Errors)
+	}
+	if e := stats.Errors[0]; e.Error != "HTTP 503" || e.Occurrences != 2 || e.Category != ErrorHTTPServer {
+		t.Error("The error should be reported with its category, got", *e)
+	}
+	if e := stats.Errors[1]; e.Category != "" {
+		t.Error("The failures of RecordFailure have no category, got", e.Category)
+	}
+}
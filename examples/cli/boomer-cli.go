@@ -48,9 +48,8 @@ func createTask(pluginPath string) (task *boomer.Task, err error) {
 }
 
 func main() {
-	if !flag.Parsed() {
-		flag.Parse()
-	}
+	boomer.RegisterFlags(flag.CommandLine)
+	flag.Parse()
 	plugins := strings.Split(plugins, ",")
 	tasks := make([]*boomer.Task, 0)
 	for _, plugin := range plugins {
@@ -77,6 +77,7 @@ func main() {
 
 	flag.BoolVar(&verbose, "verbose", false, "Print debug log")
 
+	boomer.RegisterFlags(flag.CommandLine)
 	flag.Parse()
 
 	log.Printf(`Fasthttp benchmark is running with these args:
@@ -1,12 +1,15 @@
 local http = require("http")
+local boomer = require("boomer")
 
-function execute()
-    local start = get_millis()
+function get()
     local resp = http.get("http://localhost:8000")
-    local elapsed = get_millis() - start
     if not resp.error then
-        record_success("http", "get", elapsed, #resp.body)
+        boomer.record_success("http", "get", resp.elapsed, #resp.body)
     else
-        record_failure("http", "get", elapsed, "empty body")
+        boomer.record_failure("http", "get", resp.elapsed, resp.error)
     end
-end
\ No newline at end of file
+end
+
+tasks = {
+    {name = "get", weight = 1, fn = get},
+}
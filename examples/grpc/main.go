@@ -61,6 +61,7 @@ func rpcReq() {
 func main() {
 	flag.StringVar(&addr, "a", "", "ip:port")
 	flag.StringVar(&reqJSONStr, "r", "{}", "request message in json form")
+	boomer.RegisterFlags(flag.CommandLine)
 	flag.Parse()
 
 	log.Printf(reqJSONStr)
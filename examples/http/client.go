@@ -81,6 +81,7 @@ func main() {
 
 	flag.BoolVar(&verbose, "verbose", false, "Print debug log")
 
+	boomer.RegisterFlags(flag.CommandLine)
 	flag.Parse()
 
 	log.Printf(`HTTP benchmark is running with these args:
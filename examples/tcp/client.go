@@ -67,6 +67,7 @@ func worker() {
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
+	boomer.RegisterFlags(flag.CommandLine)
 	flag.Parse()
 
 	task := &boomer.Task{
@@ -179,6 +179,7 @@ func init() {
 	udpBufferSize = flag.Int("udp-buffer-size", 4096, "udp recv buffer size")
 	number = flag.Int("number", 1, "the number of replication for multi-copying")
 	dontRead = flag.Bool("dontread", false, "do not wait for backend's response")
+	boomer.RegisterFlags(flag.CommandLine)
 	flag.Parse()
 
 	backendTimeout = time.Duration(*timeout) * time.Millisecond
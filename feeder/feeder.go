@@ -0,0 +1,208 @@
+// Package feeder hands out the rows of test data, loaded from CSV or JSON files, to the users of boomer,
+// so parameterized tests don't have to write their own loader and locking.
+//
+//	accounts, err := feeder.LoadCSV("accounts.csv", feeder.UniquePerUser)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	task := &boomer.Task{
+//		Name: "login",
+//		FnWithContext: func(ctx context.Context) {
+//			row, err := accounts.Next(ctx)
+//			if err != nil {
+//				return
+//			}
+//			login(row["username"].(string), row["password"].(string))
+//		},
+//	}
+package feeder
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/myzhan/boomer"
+)
+
+// Row is a row of test data, the values of a CSV file are strings, the values of a JSON file are decoded
+// like encoding/json does with interface{}.
+type Row map[string]interface{}
+
+// Strategy decides which row is handed out by Feeder.Next.
+type Strategy int
+
+const (
+	// Circular hands out the rows in order, and starts over from the first row after the last one.
+	Circular Strategy = iota
+	// Random hands out a random row, the random number generator of the user is used if there is one,
+	// so the rows are reproducible with Boomer.SetRandomSeed.
+	Random
+	// UniquePerUser hands out the same row to a user all the time, and different rows to different users,
+	// the row is picked by the index of the user, like a row of credentials for each user.
+	UniquePerUser
+)
+
+var (
+	// ErrNoRows is returned when a feeder is created without rows.
+	ErrNoRows = errors.New("feeder: no rows")
+	// ErrExhausted is returned by Next with UniquePerUser, if there are more users than rows.
+	ErrExhausted = errors.New("feeder: not enough rows for every user")
+	// ErrNoUser is returned by Next with UniquePerUser, if the context isn't passed by boomer to a task.
+	ErrNoUser = errors.New("feeder: no user in the context, use the context passed to the task")
+)
+
+// Feeder hands out rows to the users, it's safe for concurrent use.
+type Feeder struct {
+	strategy Strategy
+
+	lock sync.Mutex
+	rows []Row
+	next int
+	rand *rand.Rand
+}
+
+// New returns a Feeder of rows.
+func New(rows []Row, strategy Strategy) (*Feeder, error) {
+	if len(rows) == 0 {
+		return nil, ErrNoRows
+	}
+	switch strategy {
+	case Circular, Random, UniquePerUser:
+	default:
+		return nil, fmt.Errorf("feeder: unknown strategy %d", strategy)
+	}
+	return &Feeder{
+		strategy: strategy,
+		rows:     rows,
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
+
+// LoadCSV returns a Feeder of the rows in a CSV file, whose first line is the header, the columns are named by it.
+func LoadCSV(path string, strategy Strategy) (*Feeder, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rows, err := ReadCSV(file)
+	if err != nil {
+		return nil, fmt.Errorf("feeder: %s: %v", path, err)
+	}
+	return New(rows, strategy)
+}
+
+// LoadJSON returns a Feeder of the rows in a JSON file, which is an array of objects.
+func LoadJSON(path string, strategy Strategy) (*Feeder, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rows, err := ReadJSON(file)
+	if err != nil {
+		return nil, fmt.Errorf("feeder: %s: %v", path, err)
+	}
+	return New(rows, strategy)
+}
+
+// ReadCSV reads the rows from CSV, whose first line is the header, the columns are named by it.
+func ReadCSV(r io.Reader) ([]Row, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	header := records[0]
+	rows := make([]Row, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := make(Row, len(header))
+		for i, name := range header {
+			row[name] = record[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// ReadJSON reads the rows from JSON, which is an array of objects.
+func ReadJSON(r io.Reader) ([]Row, error) {
+	var rows []Row
+	if err := json.NewDecoder(r).Decode(&rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// Len returns the number of rows.
+func (f *Feeder) Len() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return len(f.rows)
+}
+
+// Partition keeps only the index-th of count disjoint parts of the rows, so distributed workers, which
+// load the same file, don't hand out the same rows, e.g. the unique accounts. boomer doesn't know the index of
+// a worker among the workers, it should be given by the command line or sent by the master with a custom message.
+// The rows are dealt out like cards, the i-th row belongs to the part i % count.
+// It must be called before the test is started.
+func (f *Feeder) Partition(index, count int) error {
+	if count <= 0 || index < 0 || index >= count {
+		return fmt.Errorf("feeder: invalid partition %d of %d", index, count)
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	rows := make([]Row, 0, len(f.rows)/count+1)
+	for i := index; i < len(f.rows); i += count {
+		rows = append(rows, f.rows[i])
+	}
+	if len(rows) == 0 {
+		return ErrNoRows
+	}
+	f.rows = rows
+	f.next = 0
+	return nil
+}
+
+// Next returns a row by the strategy of the feeder, ctx should be the context passed to the task,
+// which carries the user.
+func (f *Feeder) Next(ctx context.Context) (Row, error) {
+	user := boomer.UserFromContext(ctx)
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	switch f.strategy {
+	case Random:
+		random := f.rand
+		if user != nil {
+			random = user.Rand
+		}
+		return f.rows[random.Intn(len(f.rows))], nil
+	case UniquePerUser:
+		if user == nil {
+			return nil, ErrNoUser
+		}
+		if user.Index >= len(f.rows) {
+			return nil, ErrExhausted
+		}
+		return f.rows[user.Index], nil
+	default:
+		row := f.rows[f.next]
+		f.next = (f.next + 1) % len(f.rows)
+		return row, nil
+	}
+}
@@ -0,0 +1,140 @@
+package feeder
+
+import (
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/myzhan/boomer"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "feeder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func userContext(index int) context.Context {
+	return boomer.ContextWithUser(context.Background(), &boomer.User{
+		Index: index,
+		Rand:  rand.New(rand.NewSource(int64(index))),
+	})
+}
+
+func TestLoadCSV(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := writeFile(t, dir, "accounts.csv", "username,password\nalice,a\nbob,b\n")
+	feeder, err := LoadCSV(path, Circular)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feeder.Len() != 2 {
+		t.Fatal("There should be 2 rows, got", feeder.Len())
+	}
+
+	expected := []string{"alice", "bob", "alice"}
+	for _, username := range expected {
+		row, err := feeder.Next(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if row["username"] != username {
+			t.Error("The rows should be handed out in circle, expected", username, "got", row["username"])
+		}
+	}
+}
+
+func TestLoadJSON(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := writeFile(t, dir, "products.json", `[{"id": 1, "name": "foo"}, {"id": 2, "name": "bar"}]`)
+	feeder, err := LoadJSON(path, Random)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		row, err := feeder.Next(userContext(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id := row["id"]; id != float64(1) && id != float64(2) {
+			t.Error("Unexpected row", row)
+		}
+	}
+
+	if _, err := LoadJSON(writeFile(t, dir, "broken.json", `{"id": 1}`), Random); err == nil {
+		t.Error("A JSON file which isn't an array should be refused")
+	}
+	if _, err := LoadJSON(writeFile(t, dir, "empty.json", `[]`), Random); err != ErrNoRows {
+		t.Error("An empty file should be refused, got", err)
+	}
+}
+
+func TestUniquePerUser(t *testing.T) {
+	rows, err := ReadCSV(strings.NewReader("username\nalice\nbob\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	feeder, err := New(rows, UniquePerUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		row, _ := feeder.Next(userContext(1))
+		if row["username"] != "bob" {
+			t.Error("A user should get the same row all the time, got", row["username"])
+		}
+	}
+	if row, _ := feeder.Next(userContext(0)); row["username"] != "alice" {
+		t.Error("Different users should get different rows, got", row["username"])
+	}
+	if _, err := feeder.Next(userContext(2)); err != ErrExhausted {
+		t.Error("There should be no row for the third user, got", err)
+	}
+	if _, err := feeder.Next(context.Background()); err != ErrNoUser {
+		t.Error("There should be no row without a user, got", err)
+	}
+}
+
+func TestPartition(t *testing.T) {
+	rows, _ := ReadCSV(strings.NewReader("id\n0\n1\n2\n3\n4\n"))
+	feeder, _ := New(rows, UniquePerUser)
+	if err := feeder.Partition(1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if feeder.Len() != 2 {
+		t.Fatal("The second of 2 parts should have 2 rows, got", feeder.Len())
+	}
+	if row, _ := feeder.Next(userContext(0)); row["id"] != "1" {
+		t.Error("The first user should get the row 1, got", row["id"])
+	}
+	if row, _ := feeder.Next(userContext(1)); row["id"] != "3" {
+		t.Error("The second user should get the row 3, got", row["id"])
+	}
+
+	if err := feeder.Partition(2, 2); err == nil {
+		t.Error("An invalid partition should be refused")
+	}
+}
+
+func TestInvalidStrategy(t *testing.T) {
+	if _, err := New([]Row{{"id": 1}}, Strategy(10)); err == nil {
+		t.Error("An unknown strategy should be refused")
+	}
+}
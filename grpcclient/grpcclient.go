@@ -0,0 +1,144 @@
+// Package grpcclient provides gRPC client interceptors for boomer, every RPC made by a client connection
+// with the interceptors is recorded with RecordSuccess or RecordFailure.
+//
+//	conn, err := grpc.Dial(addr,
+//		grpc.WithUnaryInterceptor(grpcclient.UnaryClientInterceptor(nil)),
+//		grpc.WithStreamInterceptor(grpcclient.StreamClientInterceptor(nil)),
+//	)
+//
+// The request type is "grpc", the name is the full method, like "/helloworld.Greeter/SayHello",
+// and the exception of a failure is the status code, like "Unavailable".
+package grpcclient
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/myzhan/boomer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const requestType = "grpc"
+
+// Recorder records the result of the RPCs, *boomer.Boomer implements it.
+type Recorder interface {
+	RecordSuccess(requestType, name string, responseTime int64, responseLength int64)
+	RecordFailure(requestType, name string, responseTime int64, exception string)
+}
+
+// defaultRecorder records to the defaultBoomer of boomer.
+type defaultRecorder struct{}
+
+func (defaultRecorder) RecordSuccess(requestType, name string, responseTime int64, responseLength int64) {
+	boomer.RecordSuccess(requestType, name, responseTime, responseLength)
+}
+
+func (defaultRecorder) RecordFailure(requestType, name string, responseTime int64, exception string) {
+	boomer.RecordFailure(requestType, name, responseTime, exception)
+}
+
+// record records an RPC started at start. An RPC canceled by its context, e.g. the user is stopped, is not recorded.
+func record(recorder Recorder, method string, start time.Time, err error) {
+	elapsed := time.Since(start).Nanoseconds() / int64(time.Millisecond)
+	if err == nil {
+		recorder.RecordSuccess(requestType, method, elapsed, 0)
+		return
+	}
+	code := status.Code(err)
+	if code == codes.Unknown {
+		// errors of the context are not converted to status by the interceptors
+		if s := status.FromContextError(err); s != nil {
+			code = s.Code()
+		}
+	}
+	if code == codes.Canceled {
+		return
+	}
+	recorder.RecordFailure(requestType, method, elapsed, code.String())
+}
+
+// UnaryClientInterceptor returns an interceptor, which records every unary RPC to recorder.
+// The package-level boomer.RecordSuccess and boomer.RecordFailure are used if recorder is nil.
+func UnaryClientInterceptor(recorder Recorder) grpc.UnaryClientInterceptor {
+	if recorder == nil {
+		recorder = defaultRecorder{}
+	}
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		record(recorder, method, start, err)
+		return err
+	}
+}
+
+// StreamClientInterceptor returns an interceptor, which records every streaming RPC to recorder, as a single
+// request from opening the stream until it's finished, i.e. RecvMsg returns io.EOF or an error, or the only response
+// of a client streaming RPC is received. A stream which is not read until it's finished is not recorded.
+// The package-level boomer.RecordSuccess and boomer.RecordFailure are used if recorder is nil.
+func StreamClientInterceptor(recorder Recorder) grpc.StreamClientInterceptor {
+	if recorder == nil {
+		recorder = defaultRecorder{}
+	}
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+		streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			record(recorder, method, start, err)
+			return nil, err
+		}
+		return &clientStream{
+			ClientStream:  stream,
+			serverStreams: desc.ServerStreams,
+			recorder:      recorder,
+			method:        method,
+			start:         start,
+		}, nil
+	}
+}
+
+// clientStream records the stream once it's finished.
+type clientStream struct {
+	grpc.ClientStream
+
+	serverStreams bool
+	recorder      Recorder
+	method        string
+	start         time.Time
+	finishOnce    sync.Once
+}
+
+func (s *clientStream) finish(err error) {
+	s.finishOnce.Do(func() {
+		record(s.recorder, s.method, s.start, err)
+	})
+}
+
+func (s *clientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	// io.EOF means the stream is finished by the server, the status is returned by RecvMsg
+	if err != nil && err != io.EOF {
+		s.finish(err)
+	}
+	return err
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case err == nil:
+		if !s.serverStreams {
+			s.finish(nil)
+		}
+	case err == io.EOF:
+		s.finish(nil)
+	default:
+		s.finish(err)
+	}
+	return err
+}
@@ -0,0 +1,136 @@
+package grpcclient
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type recordedRPC struct {
+	success     bool
+	requestType string
+	name        string
+	exception   string
+}
+
+type fakeRecorder struct {
+	records []recordedRPC
+}
+
+func (r *fakeRecorder) RecordSuccess(requestType, name string, responseTime int64, responseLength int64) {
+	r.records = append(r.records, recordedRPC{true, requestType, name, ""})
+}
+
+func (r *fakeRecorder) RecordFailure(requestType, name string, responseTime int64, exception string) {
+	r.records = append(r.records, recordedRPC{false, requestType, name, exception})
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	recorder := &fakeRecorder{}
+	interceptor := UnaryClientInterceptor(recorder)
+
+	var result error
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return result
+	}
+
+	err := interceptor(context.Background(), "/helloworld.Greeter/SayHello", nil, nil, nil, invoker)
+	assert.Nil(t, err)
+
+	result = status.Error(codes.Unavailable, "connection refused")
+	err = interceptor(context.Background(), "/helloworld.Greeter/SayHello", nil, nil, nil, invoker)
+	assert.Equal(t, result, err)
+
+	result = status.Error(codes.Canceled, "canceled")
+	interceptor(context.Background(), "/helloworld.Greeter/SayHello", nil, nil, nil, invoker)
+
+	result = context.DeadlineExceeded
+	interceptor(context.Background(), "/helloworld.Greeter/SayHello", nil, nil, nil, invoker)
+
+	assert.Equal(t, []recordedRPC{
+		{true, "grpc", "/helloworld.Greeter/SayHello", ""},
+		{false, "grpc", "/helloworld.Greeter/SayHello", "Unavailable"},
+		{false, "grpc", "/helloworld.Greeter/SayHello", "DeadlineExceeded"},
+	}, recorder.records)
+}
+
+type fakeClientStream struct {
+	responses []error
+	sendErr   error
+}
+
+func (s *fakeClientStream) Header() (metadata.MD, error) { return nil, nil }
+func (s *fakeClientStream) Trailer() metadata.MD         { return nil }
+func (s *fakeClientStream) CloseSend() error             { return nil }
+func (s *fakeClientStream) Context() context.Context     { return context.Background() }
+func (s *fakeClientStream) SendMsg(m interface{}) error  { return s.sendErr }
+
+func (s *fakeClientStream) RecvMsg(m interface{}) error {
+	err := s.responses[0]
+	s.responses = s.responses[1:]
+	return err
+}
+
+func openStream(t *testing.T, recorder Recorder, desc *grpc.StreamDesc, stream grpc.ClientStream) grpc.ClientStream {
+	interceptor := StreamClientInterceptor(recorder)
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return stream, nil
+	}
+	s, err := interceptor(context.Background(), desc, nil, "/routeguide.RouteGuide/ListFeatures", streamer)
+	assert.Nil(t, err)
+	return s
+}
+
+func TestStreamClientInterceptorServerStreams(t *testing.T) {
+	recorder := &fakeRecorder{}
+	stream := openStream(t, recorder, &grpc.StreamDesc{ServerStreams: true},
+		&fakeClientStream{responses: []error{nil, nil, io.EOF}})
+
+	stream.SendMsg(nil)
+	stream.RecvMsg(nil)
+	stream.RecvMsg(nil)
+	assert.Len(t, recorder.records, 0)
+
+	stream.RecvMsg(nil)
+	assert.Equal(t, []recordedRPC{{true, "grpc", "/routeguide.RouteGuide/ListFeatures", ""}}, recorder.records)
+}
+
+func TestStreamClientInterceptorClientStreams(t *testing.T) {
+	recorder := &fakeRecorder{}
+	stream := openStream(t, recorder, &grpc.StreamDesc{ClientStreams: true},
+		&fakeClientStream{responses: []error{nil}})
+
+	stream.SendMsg(nil)
+	stream.SendMsg(nil)
+	stream.CloseSend()
+	stream.RecvMsg(nil)
+	assert.Equal(t, []recordedRPC{{true, "grpc", "/routeguide.RouteGuide/ListFeatures", ""}}, recorder.records)
+}
+
+func TestStreamClientInterceptorFailure(t *testing.T) {
+	recorder := &fakeRecorder{}
+	stream := openStream(t, recorder, &grpc.StreamDesc{ServerStreams: true},
+		&fakeClientStream{responses: []error{nil, status.Error(codes.Internal, "oops"), io.EOF}})
+
+	stream.RecvMsg(nil)
+	stream.RecvMsg(nil)
+	stream.RecvMsg(nil)
+	assert.Equal(t, []recordedRPC{{false, "grpc", "/routeguide.RouteGuide/ListFeatures", "Internal"}}, recorder.records)
+}
+
+func TestStreamClientInterceptorOpenFailure(t *testing.T) {
+	recorder := &fakeRecorder{}
+	interceptor := StreamClientInterceptor(recorder)
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return nil, status.Error(codes.Unavailable, "connection refused")
+	}
+	_, err := interceptor(context.Background(), &grpc.StreamDesc{}, nil, "/routeguide.RouteGuide/ListFeatures", streamer)
+	assert.NotNil(t, err)
+	assert.Equal(t, []recordedRPC{{false, "grpc", "/routeguide.RouteGuide/ListFeatures", "Unavailable"}}, recorder.records)
+}
@@ -0,0 +1,101 @@
+package boomer
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// HatchStrategy decides the shape of the ramp-up, when each user is spawned, see Boomer.SetHatchStrategy.
+// Implement it for a custom shape, Delay is called before spawning every user.
+type HatchStrategy interface {
+	// Delay returns the time to wait before spawning the i-th user, counted from 0, of the count users to spawn.
+	// rate is the spawn rate asked for by the master or NewStandaloneBoomer in users per second,
+	// 0 means as soon as possible, like the spawn messages of locust 2.x.
+	Delay(i, count int, rate float64) time.Duration
+}
+
+// AsapHatch spawns all the users at once, whatever the spawn rate is.
+type AsapHatch struct{}
+
+// Delay is always 0.
+func (AsapHatch) Delay(i, count int, rate float64) time.Duration {
+	return 0
+}
+
+// SmoothHatch spawns the users evenly at the spawn rate, it's the default.
+type SmoothHatch struct{}
+
+// Delay is the interval of the spawn rate.
+func (SmoothHatch) Delay(i, count int, rate float64) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / rate)
+}
+
+// ExponentialHatch starts spawning at the spawn rate, and multiplies the rate by Factor every second,
+// so the ramp-up is slow at first, while the target is warming up, and fast at last. Factor defaults to 2.
+type ExponentialHatch struct {
+	Factor float64
+}
+
+// Delay is the interval between the times when the i-th and the (i+1)-th users are due, by the growing rate.
+func (h ExponentialHatch) Delay(i, count int, rate float64) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+	factor := h.Factor
+	if factor <= 1 {
+		factor = 2
+	}
+	// the rate at t is rate*factor^t, so n users are due at log(1+n*ln(factor)/rate)/ln(factor)
+	logFactor := math.Log(factor)
+	due := func(n int) float64 {
+		return math.Log1p(float64(n)*logFactor/rate) / logFactor
+	}
+	return time.Duration((due(i+1) - due(i)) * float64(time.Second))
+}
+
+// StepHatch spawns Step users at once every Interval, so the load is held at each step for a while.
+// Step defaults to the spawn rate, at least 1, and Interval defaults to a second.
+type StepHatch struct {
+	Step     int
+	Interval time.Duration
+}
+
+// Delay is Interval before the first user of every step but the first, and 0 for the others.
+func (h StepHatch) Delay(i, count int, rate float64) time.Duration {
+	step := h.Step
+	if step <= 0 {
+		if rate <= 0 {
+			return 0
+		}
+		step = int(math.Max(rate, 1))
+	}
+	interval := h.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	if i == 0 || i%step != 0 {
+		return 0
+	}
+	return interval
+}
+
+// ParseHatchStrategy returns the hatch strategy of name, asap, smooth, exponential or step, with the default options.
+func ParseHatchStrategy(name string) (HatchStrategy, error) {
+	switch strings.ToLower(name) {
+	case "asap":
+		return AsapHatch{}, nil
+	case "smooth":
+		return SmoothHatch{}, nil
+	case "exponential":
+		return ExponentialHatch{}, nil
+	case "step":
+		return StepHatch{}, nil
+	default:
+		return nil, fmt.Errorf("invalid hatch strategy %q, expected asap, smooth, exponential or step", name)
+	}
+}
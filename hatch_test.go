@@ -0,0 +1,114 @@
+package boomer
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAsapHatch(t *testing.T) {
+	if d := (AsapHatch{}).Delay(5, 10, 1); d != 0 {
+		t.Error("The users should be spawned at once, got", d)
+	}
+}
+
+func TestSmoothHatch(t *testing.T) {
+	if d := (SmoothHatch{}).Delay(5, 10, 4); d != 250*time.Millisecond {
+		t.Error("The users should be spawned at the spawn rate, got", d)
+	}
+	if d := (SmoothHatch{}).Delay(5, 10, 0); d != 0 {
+		t.Error("The users should be spawned at once without a spawn rate, got", d)
+	}
+}
+
+func TestExponentialHatch(t *testing.T) {
+	h := ExponentialHatch{}
+	first := h.Delay(0, 100, 10)
+	if first <= 0 || first > 100*time.Millisecond {
+		t.Error("The first user should be spawned at about the spawn rate, got", first)
+	}
+	total := time.Duration(0)
+	last := first
+	for i := 0; i < 100; i++ {
+		d := h.Delay(i, 100, 10)
+		if d > last {
+			t.Fatal("The spawn rate should grow, got", d, "after", last)
+		}
+		last = d
+		total += d
+	}
+	// the rate doubles every second, so 100 users at 10 users/s are due in log2(1+100*ln2/10) seconds
+	if total < 2900*time.Millisecond || total > 3100*time.Millisecond {
+		t.Error("100 users should be spawned in about 3 seconds, got", total)
+	}
+
+	if d := (ExponentialHatch{Factor: 10}).Delay(50, 100, 10); d >= h.Delay(50, 100, 10) {
+		t.Error("A larger factor should grow faster, got", d)
+	}
+	if d := h.Delay(5, 10, 0); d != 0 {
+		t.Error("The users should be spawned at once without a spawn rate, got", d)
+	}
+}
+
+func TestStepHatch(t *testing.T) {
+	h := StepHatch{Step: 3, Interval: time.Minute}
+	expected := []time.Duration{0, 0, 0, time.Minute, 0, 0, time.Minute}
+	for i, e := range expected {
+		if d := h.Delay(i, 7, 1); d != e {
+			t.Errorf("Expected the delay of user %d to be %v, got %v", i, e, d)
+		}
+	}
+
+	h = StepHatch{}
+	if h.Delay(1, 10, 2) != 0 || h.Delay(2, 10, 2) != time.Second {
+		t.Error("The steps should be the spawn rate of users every second by default")
+	}
+	if h.Delay(2, 10, 0) != 0 {
+		t.Error("The users should be spawned at once without a step or a spawn rate")
+	}
+}
+
+func TestParseHatchStrategy(t *testing.T) {
+	for name, expected := range map[string]HatchStrategy{
+		"asap":        AsapHatch{},
+		"Smooth":      SmoothHatch{},
+		"exponential": ExponentialHatch{},
+		"step":        StepHatch{},
+	} {
+		if strategy, err := ParseHatchStrategy(name); err != nil || strategy != expected {
+			t.Error("Unexpected hatch strategy of", name, strategy, err)
+		}
+	}
+	if _, err := ParseHatchStrategy("linear"); err == nil {
+		t.Error("An unknown hatch strategy should be refused")
+	}
+}
+
+func TestSetHatchStrategy(t *testing.T) {
+	b := NewStandaloneBoomer(10, 10)
+	b.SetHatchStrategy(AsapHatch{})
+	b.SetHatchStrategy(nil)
+	if b.hatchStrategy != (AsapHatch{}) {
+		t.Error("hatchStrategy should be AsapHatch, got", b.hatchStrategy)
+	}
+}
+
+func TestSpawnWithHatchStrategy(t *testing.T) {
+	runner := newSlaveRunner("localhost", 5557, []*Task{{Fn: func() {
+		time.Sleep(time.Second)
+	}}}, nil)
+	defer runner.close()
+	runner.hatchStrategy = StepHatch{Step: 2, Interval: 50 * time.Millisecond}
+	runner.workers = make(map[*worker]bool)
+
+	quit := make(chan bool)
+	defer close(quit)
+	start := time.Now()
+	runner.spawn(5, quit, nil, nil)
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > 500*time.Millisecond {
+		t.Error("5 users should be spawned in 3 steps of 50ms, got", elapsed)
+	}
+	if n := atomic.LoadInt32(&runner.numClients); n != 5 {
+		t.Error("5 users should be spawned, got", n)
+	}
+}
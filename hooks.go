@@ -0,0 +1,220 @@
+package boomer
+
+import (
+	"sync"
+
+	"github.com/asaskevich/EventBus"
+)
+
+// DefaultHooks is the global Hooks instance, it's called together with the topics published to Events,
+// by the Boomers without their own hooks, see Boomer.SetHooks.
+var DefaultHooks = &Hooks{}
+
+// Hooks are the typed callbacks of boomer's lifecycle events, they are called together with the string topics
+// of Events, which keep working, but typed hooks are discoverable and checked by the compiler.
+//   - OnSpawn is the same as subscribing to "boomer:spawn".
+//   - OnStop is the same as subscribing to "boomer:stop".
+//   - OnQuit is the same as subscribing to "boomer:quit".
+//   - OnStateChange is the same as subscribing to "boomer:state".
+//   - OnCircuitOpen is the same as subscribing to "boomer:circuit_open".
+//   - OnCircuitClose is the same as subscribing to "boomer:circuit_close".
+//   - OnSLOViolation is the same as subscribing to "boomer:slo_violation".
+//
+// The hooks are called synchronously by the goroutine which publishes the event, they shouldn't block.
+type Hooks struct {
+	lock  sync.RWMutex
+	spawn []func(workers int, spawnRate float64)
+	stop  []func()
+	quit  []func()
+	state []func(state string)
+
+	circuitOpen  []func(name string, failRatio float64)
+	circuitClose []func(name string)
+	sloViolation []func(slo SLO, value float64)
+}
+
+// OnSpawn adds a hook, which is called when boomer starts spawning goroutines or rescales them,
+// with the number of goroutines and the spawn rate.
+func (h *Hooks) OnSpawn(hook func(workers int, spawnRate float64)) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.spawn = append(h.spawn, hook)
+}
+
+// OnHatch is the same as OnSpawn, named after the hatch of locust before 1.0, like "boomer:hatch".
+func (h *Hooks) OnHatch(hook func(workers int, hatchRate float64)) {
+	h.OnSpawn(hook)
+}
+
+// OnStop adds a hook, which is called when boomer starts to stop the running goroutines.
+func (h *Hooks) OnStop(hook func()) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.stop = append(h.stop, hook)
+}
+
+// OnQuit adds a hook, which is called when boomer quits.
+func (h *Hooks) OnQuit(hook func()) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.quit = append(h.quit, hook)
+}
+
+// OnStateChange adds a hook, which is called when the state of the runner changes, with the new state,
+// one of "ready", "spawning", "running" and "stopped", like Boomer.State returns.
+func (h *Hooks) OnStateChange(hook func(state string)) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.state = append(h.state, hook)
+}
+
+// OnCircuitOpen adds a hook, which is called when the circuit breaker of a request name is tripped, see
+// Boomer.SetCircuitBreaker, with the request name and the failure ratio of the last interval.
+func (h *Hooks) OnCircuitOpen(hook func(name string, failRatio float64)) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.circuitOpen = append(h.circuitOpen, hook)
+}
+
+// OnCircuitClose adds a hook, which is called when the circuit breaker of a request name is closed after the cool-down.
+func (h *Hooks) OnCircuitClose(hook func(name string)) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.circuitClose = append(h.circuitClose, hook)
+}
+
+// OnSLOViolation adds a hook, which is called when an interval violates an SLO, see Boomer.AddSLO,
+// with the SLO and the value of its metric in the interval.
+func (h *Hooks) OnSLOViolation(hook func(slo SLO, value float64)) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.sloViolation = append(h.sloViolation, hook)
+}
+
+func (h *Hooks) fireSpawn(workers int, spawnRate float64) {
+	h.lock.RLock()
+	hooks := h.spawn
+	h.lock.RUnlock()
+	for _, hook := range hooks {
+		hook(workers, spawnRate)
+	}
+}
+
+func (h *Hooks) fireStop() {
+	h.lock.RLock()
+	hooks := h.stop
+	h.lock.RUnlock()
+	for _, hook := range hooks {
+		hook()
+	}
+}
+
+func (h *Hooks) fireQuit() {
+	h.lock.RLock()
+	hooks := h.quit
+	h.lock.RUnlock()
+	for _, hook := range hooks {
+		hook()
+	}
+}
+
+func (h *Hooks) fireStateChange(state string) {
+	h.lock.RLock()
+	hooks := h.state
+	h.lock.RUnlock()
+	for _, hook := range hooks {
+		hook(state)
+	}
+}
+
+func (h *Hooks) fireCircuitOpen(name string, failRatio float64) {
+	h.lock.RLock()
+	hooks := h.circuitOpen
+	h.lock.RUnlock()
+	for _, hook := range hooks {
+		hook(name, failRatio)
+	}
+}
+
+func (h *Hooks) fireCircuitClose(name string) {
+	h.lock.RLock()
+	hooks := h.circuitClose
+	h.lock.RUnlock()
+	for _, hook := range hooks {
+		hook(name)
+	}
+}
+
+func (h *Hooks) fireSLOViolation(slo SLO, value float64) {
+	h.lock.RLock()
+	hooks := h.sloViolation
+	h.lock.RUnlock()
+	for _, hook := range hooks {
+		hook(slo, value)
+	}
+}
+
+// eventPublisher publishes the lifecycle events to an event bus and calls the hooks, its zero value uses
+// the package-level Events and DefaultHooks.
+type eventPublisher struct {
+	events EventBus.Bus
+	hooks  *Hooks
+}
+
+func (p *eventPublisher) getEvents() EventBus.Bus {
+	if p.events != nil {
+		return p.events
+	}
+	return Events
+}
+
+func (p *eventPublisher) getHooks() *Hooks {
+	if p.hooks != nil {
+		return p.hooks
+	}
+	return DefaultHooks
+}
+
+// publishSpawn publishes "boomer:hatch" and "boomer:spawn", and calls the spawn hooks.
+func (p *eventPublisher) publishSpawn(workers int, spawnRate float64) {
+	events := p.getEvents()
+	events.Publish("boomer:hatch", workers, spawnRate)
+	events.Publish("boomer:spawn", workers, spawnRate)
+	p.getHooks().fireSpawn(workers, spawnRate)
+}
+
+// publishStop publishes "boomer:stop", and calls the stop hooks.
+func (p *eventPublisher) publishStop() {
+	p.getEvents().Publish("boomer:stop")
+	p.getHooks().fireStop()
+}
+
+// publishQuit publishes "boomer:quit", and calls the quit hooks.
+func (p *eventPublisher) publishQuit() {
+	p.getEvents().Publish("boomer:quit")
+	p.getHooks().fireQuit()
+}
+
+// publishState publishes "boomer:state", and calls the state change hooks.
+func (p *eventPublisher) publishState(state string) {
+	p.getEvents().Publish("boomer:state", state)
+	p.getHooks().fireStateChange(state)
+}
+
+// publishCircuitOpen publishes "boomer:circuit_open", and calls the circuit open hooks.
+func (p *eventPublisher) publishCircuitOpen(name string, failRatio float64) {
+	p.getEvents().Publish("boomer:circuit_open", name, failRatio)
+	p.getHooks().fireCircuitOpen(name, failRatio)
+}
+
+// publishCircuitClose publishes "boomer:circuit_close", and calls the circuit close hooks.
+func (p *eventPublisher) publishCircuitClose(name string) {
+	p.getEvents().Publish("boomer:circuit_close", name)
+	p.getHooks().fireCircuitClose(name)
+}
+
+// publishSLOViolation publishes "boomer:slo_violation", and calls the SLO violation hooks.
+func (p *eventPublisher) publishSLOViolation(slo SLO, value float64) {
+	p.getEvents().Publish("boomer:slo_violation", slo, value)
+	p.getHooks().fireSLOViolation(slo, value)
+}
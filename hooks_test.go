@@ -0,0 +1,114 @@
+package boomer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHooks(t *testing.T) {
+	hooks := &Hooks{}
+
+	spawned := make([]float64, 0)
+	hooks.OnSpawn(func(workers int, spawnRate float64) {
+		spawned = append(spawned, float64(workers), spawnRate)
+	})
+	hooks.OnHatch(func(workers int, hatchRate float64) {
+		spawned = append(spawned, float64(workers), hatchRate)
+	})
+	states := make([]string, 0)
+	hooks.OnStateChange(func(state string) {
+		states = append(states, state)
+	})
+	stopped, quited := 0, 0
+	hooks.OnStop(func() {
+		stopped++
+	})
+	hooks.OnQuit(func() {
+		quited++
+	})
+
+	circuits := make([]string, 0)
+	hooks.OnCircuitOpen(func(name string, failRatio float64) {
+		circuits = append(circuits, "open "+name)
+	})
+	hooks.OnCircuitClose(func(name string) {
+		circuits = append(circuits, "close "+name)
+	})
+	violations := make([]float64, 0)
+	hooks.OnSLOViolation(func(slo SLO, value float64) {
+		violations = append(violations, value)
+	})
+
+	hooks.fireSpawn(10, 2.5)
+	hooks.fireStop()
+	hooks.fireQuit()
+	hooks.fireQuit()
+	hooks.fireStateChange(stateRunning)
+	hooks.fireCircuitOpen("foo", 0.5)
+	hooks.fireCircuitClose("foo")
+	hooks.fireSLOViolation(SLO{Metric: SLOP99, Threshold: 300}, 450)
+
+	assert.Equal(t, []float64{10, 2.5, 10, 2.5}, spawned)
+	assert.Equal(t, 1, stopped)
+	assert.Equal(t, 2, quited)
+	assert.Equal(t, []string{stateRunning}, states)
+	assert.Equal(t, []string{"open foo", "close foo"}, circuits)
+	assert.Equal(t, []float64{450}, violations)
+}
+
+func TestPublishCallsHooksAndEvents(t *testing.T) {
+	defaultHooks := DefaultHooks
+	DefaultHooks = &Hooks{}
+	defer func() {
+		DefaultHooks = defaultHooks
+	}()
+
+	hookWorkers, eventWorkers := 0, 0
+	DefaultHooks.OnSpawn(func(workers int, spawnRate float64) {
+		hookWorkers = workers
+	})
+	callback := func(workers int, spawnRate float64) {
+		eventWorkers = workers
+	}
+	Events.Subscribe("boomer:spawn", callback)
+	defer Events.Unsubscribe("boomer:spawn", callback)
+
+	hookQuit, eventQuit := false, false
+	DefaultHooks.OnQuit(func() {
+		hookQuit = true
+	})
+	receiver := func() {
+		eventQuit = true
+	}
+	Events.Subscribe("boomer:quit", receiver)
+	defer Events.Unsubscribe("boomer:quit", receiver)
+
+	publisher := &eventPublisher{}
+	publisher.publishSpawn(10, 10)
+	publisher.publishQuit()
+
+	assert.Equal(t, 10, hookWorkers)
+	assert.Equal(t, 10, eventWorkers)
+	assert.True(t, hookQuit)
+	assert.True(t, eventQuit)
+}
+
+func TestRunnerStopCallsStopHooks(t *testing.T) {
+	defaultHooks := DefaultHooks
+	DefaultHooks = &Hooks{}
+	defer func() {
+		DefaultHooks = defaultHooks
+	}()
+
+	stopped := false
+	DefaultHooks.OnStop(func() {
+		stopped = true
+	})
+
+	runner := newSlaveRunner("localhost", 5557, []*Task{}, nil)
+	runner.stopChan = make(chan bool)
+	runner.stop()
+
+	assert.True(t, stopped)
+}
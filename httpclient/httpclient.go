@@ -0,0 +1,202 @@
+// Package httpclient wraps net/http for boomer, every request made by a Client is recorded
+// with RecordSuccess or RecordFailure, so tasks don't have to time the requests themselves.
+//
+//	client := httpclient.New(httpclient.Config{MaxConnsPerHost: 1000})
+//	task := &boomer.Task{
+//		Name: "foo",
+//		FnWithContext: func(ctx context.Context) {
+//			client.Get(ctx, "http://localhost:8080/foo")
+//		},
+//	}
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/myzhan/boomer"
+)
+
+// Recorder records the result of the requests, *boomer.Boomer implements it.
+type Recorder interface {
+	RecordSuccess(requestType, name string, responseTime int64, responseLength int64)
+	RecordFailure(requestType, name string, responseTime int64, exception string)
+}
+
+// defaultRecorder records to the defaultBoomer of boomer.
+type defaultRecorder struct{}
+
+func (defaultRecorder) RecordSuccess(requestType, name string, responseTime int64, responseLength int64) {
+	boomer.RecordSuccess(requestType, name, responseTime, responseLength)
+}
+
+func (defaultRecorder) RecordFailure(requestType, name string, responseTime int64, exception string) {
+	boomer.RecordFailure(requestType, name, responseTime, exception)
+}
+
+// Config is used to create a Client, the zero value is ready to use.
+type Config struct {
+	// Recorder records the requests, the package-level boomer.RecordSuccess and boomer.RecordFailure are used if it's nil.
+	Recorder Recorder
+
+	// Timeout limits the time of a request, including reading the response body. Zero means no timeout.
+	Timeout time.Duration
+
+	// MaxIdleConnsPerHost is the number of idle connections kept for every host, it should be close to
+	// the number of users when testing a single host, or the connections are closed and reopened all the time.
+	// It's 2000 if it's zero.
+	MaxIdleConnsPerHost int
+
+	// MaxConnsPerHost limits the number of connections of every host, zero means no limit.
+	MaxConnsPerHost int
+
+	// DisableKeepAlives opens a new connection for every request.
+	DisableKeepAlives bool
+
+	// InsecureSkipVerify skips verifying the certificates of the servers.
+	InsecureSkipVerify bool
+}
+
+// Client makes HTTP requests and records them, it's safe for concurrent use by all the users.
+// The request type is the method of the request, and the name is the path of the URL, without the query,
+// use WithName to group the requests with different paths, like "/users/:id", under one name.
+// A request fails if the response can't be read or its status code is 400 or above.
+type Client struct {
+	client   *http.Client
+	recorder Recorder
+}
+
+// New returns a new Client.
+func New(config Config) *Client {
+	maxIdleConnsPerHost := config.MaxIdleConnsPerHost
+	if maxIdleConnsPerHost <= 0 {
+		maxIdleConnsPerHost = 2000
+	}
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConnsPerHost: maxIdleConnsPerHost,
+		MaxConnsPerHost:     config.MaxConnsPerHost,
+		IdleConnTimeout:     90 * time.Second,
+		DisableKeepAlives:   config.DisableKeepAlives,
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: config.InsecureSkipVerify,
+		},
+	}
+
+	recorder := config.Recorder
+	if recorder == nil {
+		recorder = defaultRecorder{}
+	}
+	return &Client{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   config.Timeout,
+		},
+		recorder: recorder,
+	}
+}
+
+// HTTPClient returns the underlying http.Client, requests made by it directly are not recorded.
+func (c *Client) HTTPClient() *http.Client {
+	return c.client
+}
+
+type nameKey struct{}
+
+// WithName returns a copy of ctx, the requests made with it are recorded under name, instead of the URL path.
+func WithName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, nameKey{}, name)
+}
+
+// Get makes a GET request.
+func (c *Client) Get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+// Post makes a POST request.
+func (c *Client) Post(ctx context.Context, url, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return c.Do(req)
+}
+
+// Do sends the request and records it. The response body is read and closed before Do returns, so the
+// response time covers the whole body. The returned response has the body buffered in memory, closing it is optional.
+// A response with a status code of 400 or above is recorded as a failure, but no error is returned, like net/http.
+// A request canceled by its context, e.g. the user is stopped, is not recorded.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	name, _ := req.Context().Value(nameKey{}).(string)
+	if name == "" {
+		name = req.URL.Path
+		if name == "" {
+			name = "/"
+		}
+	}
+
+	start := time.Now()
+	resp, err := c.client.Do(req)
+	var body []byte
+	if err == nil {
+		body, err = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			resp = nil
+		} else {
+			resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+	}
+	elapsed := time.Since(start).Nanoseconds() / int64(time.Millisecond)
+
+	switch {
+	case err != nil:
+		if !errors.Is(err, context.Canceled) {
+			c.recorder.RecordFailure(req.Method, name, elapsed, classifyError(err))
+		}
+	case resp.StatusCode >= 400:
+		c.recorder.RecordFailure(req.Method, name, elapsed, fmt.Sprintf("HTTP %d", resp.StatusCode))
+	default:
+		c.recorder.RecordSuccess(req.Method, name, elapsed, int64(len(body)))
+	}
+	return resp, err
+}
+
+// classifyError returns the exception of a failed request, the URL is removed from the error,
+// so the failures of the same kind are grouped together.
+func classifyError(err error) string {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "timeout"
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout"
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return fmt.Sprintf("%s: %v", opErr.Op, opErr.Err)
+	}
+	return err.Error()
+}
@@ -0,0 +1,152 @@
+package httpclient
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type record struct {
+	success        bool
+	requestType    string
+	name           string
+	responseTime   int64
+	responseLength int64
+	exception      string
+}
+
+type fakeRecorder struct {
+	lock    sync.Mutex
+	records []record
+}
+
+func (r *fakeRecorder) RecordSuccess(requestType, name string, responseTime int64, responseLength int64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.records = append(r.records, record{true, requestType, name, responseTime, responseLength, ""})
+}
+
+func (r *fakeRecorder) RecordFailure(requestType, name string, responseTime int64, exception string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.records = append(r.records, record{false, requestType, name, responseTime, 0, exception})
+}
+
+func newTestServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("hello"))
+	})
+	mux.HandleFunc("/error", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestGet(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+	recorder := &fakeRecorder{}
+	client := New(Config{Recorder: recorder})
+
+	resp, err := client.Get(context.Background(), server.URL+"/ok?id=1")
+	assert.Nil(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, "hello", string(body))
+
+	assert.Len(t, recorder.records, 1)
+	r := recorder.records[0]
+	assert.True(t, r.success)
+	assert.Equal(t, "GET", r.requestType)
+	assert.Equal(t, "/ok", r.name)
+	assert.Equal(t, int64(5), r.responseLength)
+	assert.True(t, r.responseTime >= 20, "response time should include the handler")
+}
+
+func TestPostWithName(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+	recorder := &fakeRecorder{}
+	client := New(Config{Recorder: recorder})
+
+	ctx := WithName(context.Background(), "echo")
+	resp, err := client.Post(ctx, server.URL+"/echo", "text/plain", strings.NewReader("foobar"))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	assert.Len(t, recorder.records, 1)
+	assert.Equal(t, record{true, "POST", "echo", recorder.records[0].responseTime, 6, ""}, recorder.records[0])
+}
+
+func TestStatusCodeFailure(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+	recorder := &fakeRecorder{}
+	client := New(Config{Recorder: recorder})
+
+	resp, err := client.Get(context.Background(), server.URL+"/error")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+	assert.Len(t, recorder.records, 1)
+	assert.False(t, recorder.records[0].success)
+	assert.Equal(t, "HTTP 500", recorder.records[0].exception)
+}
+
+func TestTimeoutFailure(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+	recorder := &fakeRecorder{}
+	client := New(Config{Recorder: recorder, Timeout: 50 * time.Millisecond})
+
+	_, err := client.Get(context.Background(), server.URL+"/slow")
+	assert.NotNil(t, err)
+
+	assert.Len(t, recorder.records, 1)
+	assert.False(t, recorder.records[0].success)
+	assert.Equal(t, "timeout", recorder.records[0].exception)
+}
+
+func TestConnectionFailure(t *testing.T) {
+	server := newTestServer()
+	addr := server.URL
+	server.Close()
+	recorder := &fakeRecorder{}
+	client := New(Config{Recorder: recorder})
+
+	_, err := client.Get(context.Background(), addr+"/ok")
+	assert.NotNil(t, err)
+
+	assert.Len(t, recorder.records, 1)
+	assert.False(t, recorder.records[0].success)
+	assert.False(t, strings.Contains(recorder.records[0].exception, addr), "the URL should be removed from the exception")
+	assert.True(t, strings.HasPrefix(recorder.records[0].exception, "dial: "), recorder.records[0].exception)
+}
+
+func TestCanceledRequestIsNotRecorded(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+	recorder := &fakeRecorder{}
+	client := New(Config{Recorder: recorder})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err := client.Get(ctx, server.URL+"/slow")
+	assert.NotNil(t, err)
+	assert.Len(t, recorder.records, 0)
+}
@@ -0,0 +1,206 @@
+package boomer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InfluxDBOutput writes the stats of every interval to InfluxDB, using the line protocol over HTTP.
+// Both the v1 API(/write with a database) and the v2 API(/api/v2/write with an org, a bucket and a token) are supported.
+//
+// Each request name is written as a point of the "boomer_stats" measurement, tagged by method and name,
+// the total is written with name "Total". The user count is written to the "boomer_users" measurement.
+// Extra tags, like the hostname, a run id or the task name, can be added to all the points by AddTag.
+type InfluxDBOutput struct {
+	writeURL string
+	pingURL  string
+	token    string
+	username string
+	password string
+	tags     map[string]string
+	client   *http.Client
+}
+
+// NewInfluxDBOutput returns an InfluxDBOutput, which writes to database with the v1 API.
+// serverURL is like "http://localhost:8086".
+func NewInfluxDBOutput(serverURL, database string) *InfluxDBOutput {
+	query := url.Values{}
+	query.Set("db", database)
+	query.Set("precision", "ms")
+	return newInfluxDBOutput(serverURL, "/write?"+query.Encode())
+}
+
+// NewInfluxDBV2Output returns an InfluxDBOutput, which writes to the bucket of org with the v2 API.
+// serverURL is like "http://localhost:8086", token is an API token with the write permission of the bucket.
+func NewInfluxDBV2Output(serverURL, org, bucket, token string) *InfluxDBOutput {
+	query := url.Values{}
+	query.Set("org", org)
+	query.Set("bucket", bucket)
+	query.Set("precision", "ms")
+	o := newInfluxDBOutput(serverURL, "/api/v2/write?"+query.Encode())
+	o.token = token
+	return o
+}
+
+func newInfluxDBOutput(serverURL, writePath string) *InfluxDBOutput {
+	serverURL = strings.TrimRight(serverURL, "/")
+	return &InfluxDBOutput{
+		writeURL: serverURL + writePath,
+		pingURL:  serverURL + "/ping",
+		tags:     make(map[string]string),
+		client:   &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// SetCredentials sets the username and password of the v1 API, it's sent by the basic authentication.
+func (o *InfluxDBOutput) SetCredentials(username, password string) {
+	o.username = username
+	o.password = password
+}
+
+// AddTag adds a tag to all the points, like AddTag("host", hostname).
+// The tags "method" and "name" are reserved for the stats. It must be called before the test is started.
+func (o *InfluxDBOutput) AddTag(key, value string) {
+	o.tags[key] = value
+}
+
+// Init pings the server, so boomer can fail fast if InfluxDB is unreachable.
+func (o *InfluxDBOutput) Init() error {
+	req, err := http.NewRequest(http.MethodGet, o.pingURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to ping InfluxDB, %v", err)
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to ping InfluxDB, %v", err)
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	return nil
+}
+
+// OnStart of InfluxDBOutput has nothing to do.
+func (o *InfluxDBOutput) OnStart() {
+
+}
+
+// OnEvent writes the interval's stats as a batch of points.
+func (o *InfluxDBOutput) OnEvent(data map[string]interface{}) {
+	body := o.encode(data, time.Now())
+	if body.Len() == 0 {
+		return
+	}
+	if err := o.write(body); err != nil {
+		logError("Failed to write stats to InfluxDB, %v", err)
+	}
+}
+
+// OnStop of InfluxDBOutput has nothing to do.
+func (o *InfluxDBOutput) OnStop() {
+
+}
+
+func (o *InfluxDBOutput) write(body *bytes.Buffer) error {
+	req, err := http.NewRequest(http.MethodPost, o.writeURL, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if o.token != "" {
+		req.Header.Set("Authorization", "Token "+o.token)
+	} else if o.username != "" {
+		req.SetBasicAuth(o.username, o.password)
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %s, %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
+
+// encode converts the interval's stats to the line protocol.
+func (o *InfluxDBOutput) encode(data map[string]interface{}, now time.Time) *bytes.Buffer {
+	timestamp := strconv.FormatInt(now.UnixNano()/int64(time.Millisecond), 10)
+	buf := &bytes.Buffer{}
+
+	if userCount, ok := data["user_count"].(int32); ok {
+		buf.WriteString("boomer_users")
+		o.writeTags(buf, nil)
+		buf.WriteString(" user_count=" + strconv.FormatInt(int64(userCount), 10) + "i " + timestamp + "\n")
+	}
+
+	stats, _ := data["stats"].([]interface{})
+	if total, ok := data["stats_total"].(map[string]interface{}); ok {
+		stats = append(stats, total)
+	}
+	for _, stat := range stats {
+		s := stat.(map[string]interface{})
+		numRequests := s["num_requests"].(int64)
+		if numRequests == 0 {
+			continue
+		}
+		responseTimes := s["response_times"].(map[int64]int64)
+
+		buf.WriteString("boomer_stats")
+		o.writeTags(buf, map[string]string{
+			"method": s["method"].(string),
+			"name":   s["name"].(string),
+		})
+		fields := []string{
+			"num_requests=" + strconv.FormatInt(numRequests, 10) + "i",
+			"num_failures=" + strconv.FormatInt(s["num_failures"].(int64), 10) + "i",
+			"avg_response_time=" + strconv.FormatFloat(getAvgResponseTime(numRequests, s["total_response_time"].(int64)), 'f', 2, 64),
+			"min_response_time=" + strconv.FormatInt(s["min_response_time"].(int64), 10) + "i",
+			"max_response_time=" + strconv.FormatInt(s["max_response_time"].(int64), 10) + "i",
+			"median_response_time=" + strconv.FormatInt(getMedianResponseTime(numRequests, responseTimes), 10) + "i",
+			"p90_response_time=" + strconv.FormatInt(getPercentileResponseTime(numRequests, responseTimes, 0.9), 10) + "i",
+			"p95_response_time=" + strconv.FormatInt(getPercentileResponseTime(numRequests, responseTimes, 0.95), 10) + "i",
+			"p99_response_time=" + strconv.FormatInt(getPercentileResponseTime(numRequests, responseTimes, 0.99), 10) + "i",
+			"avg_content_length=" + strconv.FormatInt(getAvgContentLength(numRequests, s["total_content_length"].(int64)), 10) + "i",
+			"min_content_length=" + strconv.FormatInt(toInt64(s["min_content_length"]), 10) + "i",
+			"max_content_length=" + strconv.FormatInt(toInt64(s["max_content_length"]), 10) + "i",
+			"current_rps=" + strconv.FormatInt(getCurrentRps(numRequests, s["num_reqs_per_sec"].(map[int64]int64)), 10) + "i",
+		}
+		buf.WriteString(" " + strings.Join(fields, ",") + " " + timestamp + "\n")
+	}
+	return buf
+}
+
+var influxDBTagEscaper = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `, "\n", `\n`)
+
+// writeTags writes the extra tags and tags, sorted by key as InfluxDB recommends. Empty values are skipped,
+// which are not allowed by the line protocol.
+func (o *InfluxDBOutput) writeTags(buf *bytes.Buffer, tags map[string]string) {
+	all := make(map[string]string, len(o.tags)+len(tags))
+	for k, v := range o.tags {
+		all[k] = v
+	}
+	for k, v := range tags {
+		all[k] = v
+	}
+	keys := make([]string, 0, len(all))
+	for k, v := range all {
+		if k != "" && v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		buf.WriteString("," + influxDBTagEscaper.Replace(k) + "=" + influxDBTagEscaper.Replace(all[k]))
+	}
+}
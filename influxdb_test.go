@@ -0,0 +1,101 @@
+package boomer
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newInfluxDBTestServer(t *testing.T, requests chan *http.Request, bodies chan string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ping" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		requests <- r
+		bodies <- string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+func TestInfluxDBOutput(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	bodies := make(chan string, 1)
+	server := newInfluxDBTestServer(t, requests, bodies)
+	defer server.Close()
+
+	o := NewInfluxDBOutput(server.URL, "loadtest")
+	o.SetCredentials("user", "secret")
+	o.AddTag("host", "node 1")
+	o.AddTag("run_id", "42")
+	if err := o.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	collector := NewStatsCollector()
+	collector.RecordSuccess("http", "foo", 10, 100)
+	collector.RecordFailure("http", "foo", 30, "500 error")
+	data := collector.Report()
+	data["user_count"] = int32(10)
+	o.OnEvent(data)
+
+	r := <-requests
+	body := <-bodies
+	if r.URL.Path != "/write" || r.URL.Query().Get("db") != "loadtest" || r.URL.Query().Get("precision") != "ms" {
+		t.Error("Unexpected write url of the v1 API:", r.URL)
+	}
+	if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "secret" {
+		t.Error("The credentials should be sent by the basic authentication")
+	}
+
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	if len(lines) != 3 {
+		t.Fatal("Expected the users, foo and the total, got:", body)
+	}
+	if !strings.HasPrefix(lines[0], `boomer_users,host=node\ 1,run_id=42 user_count=10i `) {
+		t.Error("Unexpected line of users:", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], `boomer_stats,host=node\ 1,method=http,name=foo,run_id=42 num_requests=2i,num_failures=1i,avg_response_time=20.00,min_response_time=10i,max_response_time=30i,`) {
+		t.Error("Unexpected line of foo:", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], `boomer_stats,host=node\ 1,name=Total,run_id=42 num_requests=2i,`) {
+		t.Error("Unexpected line of total:", lines[2])
+	}
+}
+
+func TestInfluxDBV2Output(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	bodies := make(chan string, 1)
+	server := newInfluxDBTestServer(t, requests, bodies)
+	defer server.Close()
+
+	o := NewInfluxDBV2Output(server.URL+"/", "my-org", "my-bucket", "my-token")
+	collector := NewStatsCollector()
+	collector.RecordSuccess("http", "foo", 10, 100)
+	o.OnEvent(collector.Report())
+
+	r := <-requests
+	<-bodies
+	if r.URL.Path != "/api/v2/write" || r.URL.Query().Get("org") != "my-org" || r.URL.Query().Get("bucket") != "my-bucket" {
+		t.Error("Unexpected write url of the v2 API:", r.URL)
+	}
+	if r.Header.Get("Authorization") != "Token my-token" {
+		t.Error("The token should be sent in the Authorization header")
+	}
+}
+
+func TestInfluxDBOutputInitFails(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	o := NewInfluxDBOutput(server.URL, "loadtest")
+	if err := o.Init(); err == nil {
+		t.Error("Init should fail if InfluxDB is unreachable")
+	}
+}
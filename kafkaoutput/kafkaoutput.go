@@ -0,0 +1,242 @@
+// Package kafkaoutput streams every request recorded by boomer to a Kafka topic, as a JSON message by default,
+// so the raw events can be analyzed offline, like calculating the exact percentiles of a large-scale test.
+//
+//	output := kafkaoutput.New([]string{"localhost:9092"}, "boomer-requests", kafkaoutput.Config{})
+//	globalBoomer.AddRawSampleOutput(output)
+//
+// The messages are sent in batches by a goroutine. When Kafka can't keep up, the queue in front of it
+// is filled up and OnSample blocks, which slows down the stats collecting and the users at last,
+// instead of dropping the events or running out of memory.
+package kafkaoutput
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/myzhan/boomer"
+	"github.com/segmentio/kafka-go"
+)
+
+// Encoder encodes a sample to the value of a message, e.g. to use Avro instead of JSON.
+// The sample is reused after Encoder returns, don't keep it.
+type Encoder func(sample *boomer.RawSample) ([]byte, error)
+
+// Config is used to create an Output, the zero value is ready to use.
+type Config struct {
+	// BatchSize is the max number of messages sent in a request to Kafka, it's 1000 if it's zero.
+	BatchSize int
+
+	// FlushInterval is the max time a message waits for its batch to be filled up, it's 1 second if it's zero.
+	FlushInterval time.Duration
+
+	// QueueSize is the number of messages buffered in front of Kafka, before OnSample blocks.
+	// It's 10 times BatchSize if it's zero.
+	QueueSize int
+
+	// WriteTimeout limits the time to send a batch, it's 10 seconds if it's zero.
+	WriteTimeout time.Duration
+
+	// Encoder encodes the samples, EncodeJSON is used if it's nil.
+	Encoder Encoder
+}
+
+// event is the JSON message of a sample.
+type event struct {
+	Timestamp      int64             `json:"timestamp"`
+	RequestType    string            `json:"request_type"`
+	Name           string            `json:"name"`
+	ResponseTime   int64             `json:"response_time"`
+	ResponseLength int64             `json:"response_length"`
+	Success        bool              `json:"success"`
+	Error          string            `json:"error,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+}
+
+// EncodeJSON encodes a sample as a JSON object, like
+// {"timestamp":1600000000000,"request_type":"http","name":"foo","response_time":10,"response_length":100,"success":true}
+func EncodeJSON(sample *boomer.RawSample) ([]byte, error) {
+	return json.Marshal(&event{
+		Timestamp:      sample.Timestamp,
+		RequestType:    sample.RequestType,
+		Name:           sample.Name,
+		ResponseTime:   sample.ResponseTime,
+		ResponseLength: sample.ResponseLength,
+		Success:        sample.Success,
+		Error:          sample.Error,
+		Labels:         sample.Labels,
+	})
+}
+
+// messageWriter is the part of kafka.Writer used by Output.
+type messageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// Output sends every request to a Kafka topic, it's a boomer.RawSampleOutput, add it by Boomer.AddRawSampleOutput.
+type Output struct {
+	batchSize     int
+	flushInterval time.Duration
+	queueSize     int
+	writeTimeout  time.Duration
+	encode        Encoder
+
+	// connect checks the brokers and returns the writer, it's replaced in tests.
+	connect func() (messageWriter, error)
+
+	writer messageWriter
+	queue  chan kafka.Message
+	done   chan bool
+}
+
+// New returns an Output, which sends to topic on the brokers, like "localhost:9092".
+func New(brokers []string, topic string, config Config) *Output {
+	batchSize := config.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	flushInterval := config.FlushInterval
+	if flushInterval <= 0 {
+		flushInterval = time.Second
+	}
+	queueSize := config.QueueSize
+	if queueSize <= 0 {
+		queueSize = 10 * batchSize
+	}
+	writeTimeout := config.WriteTimeout
+	if writeTimeout <= 0 {
+		writeTimeout = 10 * time.Second
+	}
+	encode := config.Encoder
+	if encode == nil {
+		encode = EncodeJSON
+	}
+	return &Output{
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		queueSize:     queueSize,
+		writeTimeout:  writeTimeout,
+		encode:        encode,
+		connect: func() (messageWriter, error) {
+			if err := dialAny(brokers); err != nil {
+				return nil, err
+			}
+			return &kafka.Writer{
+				Addr:         kafka.TCP(brokers...),
+				Topic:        topic,
+				Balancer:     &kafka.LeastBytes{},
+				BatchSize:    batchSize,
+				BatchTimeout: flushInterval,
+				RequiredAcks: kafka.RequireOne,
+			}, nil
+		},
+	}
+}
+
+// dialAny returns an error if none of the brokers can be connected.
+func dialAny(brokers []string) error {
+	if len(brokers) == 0 {
+		return fmt.Errorf("no Kafka broker")
+	}
+	var err error
+	for _, broker := range brokers {
+		var conn *kafka.Conn
+		conn, err = kafka.Dial("tcp", broker)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to connect to Kafka %v, %v", brokers, err)
+}
+
+// Init connects to the brokers, so boomer can fail fast if they are unavailable.
+func (o *Output) Init() error {
+	writer, err := o.connect()
+	if err != nil {
+		return err
+	}
+	o.writer = writer
+	return nil
+}
+
+// OnStart connects to the brokers if it's not done by Init, and starts sending the messages.
+func (o *Output) OnStart() {
+	if o.writer == nil {
+		if err := o.Init(); err != nil {
+			log.Printf("%v\n", err)
+			return
+		}
+	}
+	o.queue = make(chan kafka.Message, o.queueSize)
+	o.done = make(chan bool)
+	go o.loop(o.queue, o.done)
+}
+
+// OnSample encodes a sample and queues it, it blocks if the queue is full.
+func (o *Output) OnSample(sample *boomer.RawSample) {
+	if o.queue == nil {
+		return
+	}
+	value, err := o.encode(sample)
+	if err != nil {
+		log.Printf("Failed to encode a sample, %v\n", err)
+		return
+	}
+	o.queue <- kafka.Message{Value: value, Time: time.Unix(0, sample.Timestamp*int64(time.Millisecond))}
+}
+
+// OnStop sends the queued messages and closes the writer.
+func (o *Output) OnStop() {
+	if o.queue == nil {
+		return
+	}
+	close(o.queue)
+	<-o.done
+	o.queue = nil
+	if err := o.writer.Close(); err != nil {
+		log.Printf("Failed to close the Kafka writer, %v\n", err)
+	}
+	o.writer = nil
+}
+
+// loop sends the messages in batches, a batch is sent when it's full or every flushInterval.
+func (o *Output) loop(queue chan kafka.Message, done chan bool) {
+	defer close(done)
+	ticker := time.NewTicker(o.flushInterval)
+	defer ticker.Stop()
+	batch := make([]kafka.Message, 0, o.batchSize)
+	for {
+		select {
+		case message, ok := <-queue:
+			if !ok {
+				o.write(batch)
+				return
+			}
+			batch = append(batch, message)
+			if len(batch) >= o.batchSize {
+				o.write(batch)
+				batch = make([]kafka.Message, 0, o.batchSize)
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				o.write(batch)
+				batch = make([]kafka.Message, 0, o.batchSize)
+			}
+		}
+	}
+}
+
+func (o *Output) write(batch []kafka.Message) {
+	if len(batch) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), o.writeTimeout)
+	defer cancel()
+	if err := o.writer.WriteMessages(ctx, batch...); err != nil {
+		log.Printf("Failed to send %d samples to Kafka, %v\n", len(batch), err)
+	}
+}
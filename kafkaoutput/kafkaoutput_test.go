@@ -0,0 +1,165 @@
+package kafkaoutput
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/myzhan/boomer"
+	"github.com/segmentio/kafka-go"
+)
+
+type fakeWriter struct {
+	lock    sync.Mutex
+	batches [][]kafka.Message
+	closed  bool
+	// release blocks WriteMessages until it's closed, if it's not nil.
+	release chan bool
+}
+
+func (w *fakeWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if w.release != nil {
+		<-w.release
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.batches = append(w.batches, msgs)
+	return nil
+}
+
+func (w *fakeWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+func (w *fakeWriter) numBatches() int {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return len(w.batches)
+}
+
+func newTestOutput(writer *fakeWriter, config Config) *Output {
+	o := New([]string{"localhost:9092"}, "boomer", config)
+	o.connect = func() (messageWriter, error) {
+		return writer, nil
+	}
+	return o
+}
+
+func TestEncodeJSON(t *testing.T) {
+	value, err := EncodeJSON(&boomer.RawSample{
+		Timestamp:    1600000000000,
+		RequestType:  "http",
+		Name:         "foo",
+		ResponseTime: 10,
+		Error:        "500 error",
+		Labels:       map[string]string{"region": "us"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"timestamp":1600000000000,"request_type":"http","name":"foo","response_time":10,"response_length":0,"success":false,"error":"500 error","labels":{"region":"us"}}`
+	if string(value) != expected {
+		t.Error("Unexpected JSON:", string(value))
+	}
+}
+
+func TestOutputBatches(t *testing.T) {
+	writer := &fakeWriter{}
+	o := newTestOutput(writer, Config{BatchSize: 2, FlushInterval: time.Hour})
+	if err := o.Init(); err != nil {
+		t.Fatal(err)
+	}
+	o.OnStart()
+	for i := 0; i < 5; i++ {
+		o.OnSample(&boomer.RawSample{RequestType: "http", Name: "foo", ResponseTime: int64(i), Success: true})
+	}
+	o.OnStop()
+
+	if !writer.closed {
+		t.Error("The writer should be closed")
+	}
+	if len(writer.batches) != 3 || len(writer.batches[0]) != 2 || len(writer.batches[2]) != 1 {
+		t.Fatal("The samples should be sent in 3 batches, got", writer.batches)
+	}
+	var e event
+	if err := json.Unmarshal(writer.batches[2][0].Value, &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Name != "foo" || e.ResponseTime != 4 || !e.Success {
+		t.Error("Unexpected event:", e)
+	}
+}
+
+func TestOutputFlushInterval(t *testing.T) {
+	writer := &fakeWriter{}
+	o := newTestOutput(writer, Config{BatchSize: 100, FlushInterval: 10 * time.Millisecond})
+	o.OnStart()
+	defer o.OnStop()
+	o.OnSample(&boomer.RawSample{RequestType: "http", Name: "foo", Success: true})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for writer.numBatches() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if writer.numBatches() != 1 {
+		t.Error("A partial batch should be sent after the flush interval")
+	}
+}
+
+func TestOutputBackpressure(t *testing.T) {
+	writer := &fakeWriter{release: make(chan bool)}
+	o := newTestOutput(writer, Config{BatchSize: 1, QueueSize: 1})
+	o.OnStart()
+
+	sent := make(chan bool)
+	go func() {
+		for i := 0; i < 3; i++ {
+			o.OnSample(&boomer.RawSample{RequestType: "http", Name: "foo", Success: true})
+		}
+		close(sent)
+	}()
+
+	select {
+	case <-sent:
+		t.Fatal("OnSample should block when the queue is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(writer.release)
+	<-sent
+	o.OnStop()
+	if len(writer.batches) != 3 {
+		t.Error("All the samples should be sent, got", len(writer.batches))
+	}
+}
+
+func TestOutputEncoder(t *testing.T) {
+	writer := &fakeWriter{}
+	o := newTestOutput(writer, Config{Encoder: func(sample *boomer.RawSample) ([]byte, error) {
+		if !sample.Success {
+			return nil, errors.New("failures are skipped")
+		}
+		return []byte(sample.Name), nil
+	}})
+	o.OnStart()
+	o.OnSample(&boomer.RawSample{Name: "foo", Success: true})
+	o.OnSample(&boomer.RawSample{Name: "bar"})
+	o.OnStop()
+
+	if len(writer.batches) != 1 || len(writer.batches[0]) != 1 || string(writer.batches[0][0].Value) != "foo" {
+		t.Error("The samples should be encoded by the Encoder, got", writer.batches)
+	}
+}
+
+func TestOutputInitFailed(t *testing.T) {
+	o := New(nil, "boomer", Config{})
+	if err := o.Init(); err == nil {
+		t.Error("Init should fail without brokers")
+	}
+	o.OnStart()
+	o.OnSample(&boomer.RawSample{Name: "foo"})
+	o.OnStop()
+}
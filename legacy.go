@@ -3,9 +3,9 @@
 package boomer
 
 import (
+	"errors"
 	"flag"
 	"fmt"
-	"log"
 	"math"
 	"reflect"
 	"sync"
@@ -14,13 +14,58 @@ import (
 
 var masterHost string
 var masterPort int
+var clientBackend string
+var masterTLS bool
+var masterTLSCert string
+var masterTLSKey string
+var masterTLSCA string
+var workerID string
+var curveServerKey string
+var curvePublicKey string
+var curveSecretKey string
+var plainUsername string
+var plainPassword string
 var maxRPS int64
 var requestIncreaseRate string
+var splitMaxRPS bool
 var runTasks string
+var tags string
+var excludeTags string
 var memoryProfile string
 var memoryProfileDuration time.Duration
 var cpuProfile string
 var cpuProfileDuration time.Duration
+var pprofAddr string
+var summaryFile string
+var consoleDashboard bool
+var webUIAddr string
+var controlAddr string
+var configFile string
+var reportHTML string
+var checkFailRatio float64
+var checkAvgResponseTime int64
+var checkP95 int64
+var logLevelName string
+var logFormat string
+var runTime time.Duration
+var startAt string
+var runID string
+var runLabels string
+var hatchStrategyName string
+var iterations int64
+var arrivalRate float64
+var arrivalDistribution string
+var maxWorkers int
+var expectedWorkers int
+var maxMemoryMB int
+var statsReportInterval time.Duration
+var statsBatch int
+var compressStats bool
+var warmupDuration time.Duration
+var adaptiveP99 int64
+
+// boomerFlags is the flag set which the options are registered in, see RegisterFlags.
+var boomerFlags *flag.FlagSet
 
 var successRetiredWarning = &sync.Once{}
 var failureRetiredWarning = &sync.Once{}
@@ -28,21 +73,33 @@ var failureRetiredWarning = &sync.Once{}
 func createRateLimiter(maxRPS int64, requestIncreaseRate string) (rateLimiter RateLimiter, err error) {
 	if requestIncreaseRate != "-1" {
 		if maxRPS > 0 {
-			log.Println("The max RPS that boomer may generate is limited to", maxRPS, "with a increase rate", requestIncreaseRate)
+			logInfo("The max RPS that boomer may generate is limited to %d with a increase rate %s", maxRPS, requestIncreaseRate)
 			rateLimiter, err = NewRampUpRateLimiter(maxRPS, requestIncreaseRate, time.Second)
 		} else {
-			log.Println("The max RPS that boomer may generate is limited by a increase rate", requestIncreaseRate)
+			logInfo("The max RPS that boomer may generate is limited by a increase rate %s", requestIncreaseRate)
 			rateLimiter, err = NewRampUpRateLimiter(math.MaxInt64, requestIncreaseRate, time.Second)
 		}
 	} else {
 		if maxRPS > 0 {
-			log.Println("The max RPS that boomer may generate is limited to", maxRPS)
+			logInfo("The max RPS that boomer may generate is limited to %d", maxRPS)
 			rateLimiter = NewStableRateLimiter(maxRPS, time.Second)
 		}
 	}
 	return rateLimiter, err
 }
 
+// createDistributedRateLimiter splits maxRPS over all the workers, the increase rate is not supported.
+func createDistributedRateLimiter(maxRPS int64, requestIncreaseRate string) (rateLimiter RateLimiter, err error) {
+	if maxRPS <= 0 {
+		return nil, errors.New("--split-max-rps requires --max-rps")
+	}
+	if requestIncreaseRate != "-1" {
+		return nil, errors.New("--split-max-rps can't be used with --request-increase-rate")
+	}
+	logInfo("The max RPS that all the workers may generate is limited to %d", maxRPS)
+	return NewDistributedRateLimiter(maxRPS, time.Second), nil
+}
+
 // According to locust, responseTime should be int64, in milliseconds.
 // But previous version of boomer required responseTime to be float64, so sad.
 func convertResponseTime(origin interface{}) int64 {
@@ -59,14 +116,14 @@ func convertResponseTime(origin interface{}) int64 {
 
 func legacySuccessHandler(requestType string, name string, responseTime interface{}, responseLength int64) {
 	successRetiredWarning.Do(func() {
-		log.Println("boomer.Events.Publish(\"request_success\") is less performant and deprecated, use boomer.RecordSuccess() instead.")
+		logError("boomer.Events.Publish(\"request_success\") is less performant and deprecated, use boomer.RecordSuccess() instead.")
 	})
 	defaultBoomer.RecordSuccess(requestType, name, convertResponseTime(responseTime), responseLength)
 }
 
 func legacyFailureHandler(requestType string, name string, responseTime interface{}, exception string) {
 	failureRetiredWarning.Do(func() {
-		log.Println("boomer.Events.Publish(\"request_failure\") is less performant and deprecated, use boomer.RecordFailure() instead.")
+		logError("boomer.Events.Publish(\"request_failure\") is less performant and deprecated, use boomer.RecordFailure() instead.")
 	})
 	defaultBoomer.RecordFailure(requestType, name, convertResponseTime(responseTime), exception)
 }
@@ -76,14 +133,62 @@ func initLegacyEventHandlers() {
 	Events.Subscribe("request_failure", legacyFailureHandler)
 }
 
-func init() {
-	flag.Int64Var(&maxRPS, "max-rps", 0, "Max RPS that boomer can generate, disabled by default.")
-	flag.StringVar(&requestIncreaseRate, "request-increase-rate", "-1", "Request increase rate, disabled by default.")
-	flag.StringVar(&runTasks, "run-tasks", "", "Run tasks without connecting to the master, multiply tasks is separated by comma. Usually, it's for debug purpose.")
-	flag.StringVar(&masterHost, "master-host", "127.0.0.1", "Host or IP address of locust master for distributed load testing.")
-	flag.IntVar(&masterPort, "master-port", 5557, "The port to connect to that is used by the locust master for distributed load testing.")
-	flag.StringVar(&memoryProfile, "mem-profile", "", "Enable memory profiling.")
-	flag.DurationVar(&memoryProfileDuration, "mem-profile-duration", 30*time.Second, "Memory profile duration.")
-	flag.StringVar(&cpuProfile, "cpu-profile", "", "Enable CPU profiling.")
-	flag.DurationVar(&cpuProfileDuration, "cpu-profile-duration", 30*time.Second, "CPU profile duration.")
+// RegisterFlags defines the options of boomer, like --master-host and --max-rps, in fs, and Run reads them from fs,
+// so boomer can be embedded in an application which has its own flags. It must be called before fs is parsed.
+//
+// If it's not called, Run defines the options in flag.CommandLine and parses the command line, so an application
+// which parses flag.CommandLine itself before Run must call RegisterFlags(flag.CommandLine) first.
+func RegisterFlags(fs *flag.FlagSet) {
+	boomerFlags = fs
+	fs.Int64Var(&maxRPS, "max-rps", 0, "Max RPS that boomer can generate, disabled by default.")
+	fs.StringVar(&requestIncreaseRate, "request-increase-rate", "-1", "Request increase rate, disabled by default.")
+	fs.Int64Var(&adaptiveP99, "adaptive-p99", 0, "Adjust the RPS limit every report interval to find the max RPS which keeps the p99 response time under the milliseconds, capped by --max-rps. Disabled by default.")
+	fs.BoolVar(&splitMaxRPS, "split-max-rps", false, "Split --max-rps over all the workers, so it limits the RPS of the whole cluster. The master must send the number of workers.")
+	fs.StringVar(&runTasks, "run-tasks", "", "Run tasks without connecting to the master, multiply tasks is separated by comma. Usually, it's for debug purpose.")
+	fs.StringVar(&tags, "tags", "", "Run only the tasks which have any of the tags, separated by comma.")
+	fs.StringVar(&excludeTags, "exclude-tags", "", "Don't run the tasks which have any of the tags, separated by comma.")
+	fs.StringVar(&masterHost, "master-host", "127.0.0.1", "Host or IP address of locust master for distributed load testing.")
+	fs.IntVar(&masterPort, "master-port", 5557, "The port to connect to that is used by the locust master for distributed load testing.")
+	fs.StringVar(&workerID, "worker-id", "", "ID of boomer reported to the master, e.g. the name of the pod, which must be unique among the workers. A random hostname_uuid by default.")
+	fs.StringVar(&clientBackend, "client-backend", "", "ZMQ implementation to connect to the master, gomq or goczmq. goczmq is only available if boomer is built with goczmq, and used by default. tcp connects to a boomer master with the tcp server backend, without ZMQ.")
+	fs.StringVar(&curveServerKey, "curve-server-key", "", "Z85 encoded public key of the master, enables CURVE security of the connection to the master.")
+	fs.StringVar(&curvePublicKey, "curve-public-key", "", "Z85 encoded public key of boomer, used with --curve-server-key.")
+	fs.StringVar(&curveSecretKey, "curve-secret-key", "", "Z85 encoded secret key of boomer, used with --curve-server-key.")
+	fs.StringVar(&plainUsername, "plain-username", "", "Username of PLAIN authentication of the connection to the master.")
+	fs.StringVar(&plainPassword, "plain-password", "", "Password of PLAIN authentication of the connection to the master.")
+	fs.BoolVar(&masterTLS, "master-tls", false, "Wrap the connection to the master in TLS, only supported by --client-backend tcp.")
+	fs.StringVar(&masterTLSCert, "master-tls-cert", "", "Client certificate of --master-tls in PEM, if the master requires one.")
+	fs.StringVar(&masterTLSKey, "master-tls-key", "", "Private key of --master-tls-cert in PEM.")
+	fs.StringVar(&masterTLSCA, "master-tls-ca", "", "CA certificate in PEM to verify the master of --master-tls, the system roots by default.")
+	fs.StringVar(&memoryProfile, "mem-profile", "", "Enable memory profiling.")
+	fs.DurationVar(&memoryProfileDuration, "mem-profile-duration", 30*time.Second, "Memory profile duration.")
+	fs.StringVar(&cpuProfile, "cpu-profile", "", "Enable CPU profiling.")
+	fs.DurationVar(&cpuProfileDuration, "cpu-profile-duration", 30*time.Second, "CPU profile duration.")
+	fs.StringVar(&pprofAddr, "pprof-addr", "", "Serve the live profiles of net/http/pprof on the address, e.g. :6060, disabled by default.")
+	fs.StringVar(&logLevelName, "log-level", "normal", "Verbosity of boomer's logs, quiet, normal or debug.")
+	fs.StringVar(&logFormat, "log-format", "text", "Format of boomer's logs, text or json.")
+	fs.StringVar(&hatchStrategyName, "hatch-strategy", "smooth", "Shape of the ramp-up, asap, smooth, exponential or step. smooth spawns the users evenly at the spawn rate, exponential doubles the spawn rate every second, step spawns the spawn rate of users at once every second.")
+	fs.StringVar(&startAt, "start-at", "", "Start spawning the users at the RFC3339 time, e.g. 2024-01-02T15:04:05Z, so all the workers start at the same instant. At once by default.")
+	fs.StringVar(&runID, "run-id", "", "ID of the test run, which is reported in the stats of every interval to the master and the outputs.")
+	fs.StringVar(&runLabels, "labels", "", "Labels of the test run, comma separated key=value pairs like env=staging,build=42, which are reported with the stats like --run-id.")
+	fs.DurationVar(&runTime, "run-time", 0, "Stop the test after the specified amount of time, e.g. 300s, 20m, 1h30m. Unlimited by default.")
+	fs.Float64Var(&arrivalRate, "arrival-rate", 0, "Start the iterations at the rate per second regardless of the iterations in flight, which are limited by the users, split over the workers in distributed mode. Disabled by default.")
+	fs.StringVar(&arrivalDistribution, "arrival-distribution", "fixed", "Distribution of the intervals between the arrivals of --arrival-rate, fixed or poisson.")
+	fs.Int64Var(&iterations, "iterations", 0, "Stop the test after the task functions are called the specified times, split over the workers in distributed mode. Unlimited by default.")
+	fs.IntVar(&maxWorkers, "max-workers", 0, "Stop spawning once the users of this process reach the number, whatever the master asks for. Unlimited by default.")
+	fs.IntVar(&expectedWorkers, "expected-workers", 0, "Wait until the master reports the number of workers before spawning, so the test doesn't start with a part of the workers. The master must send the number of workers.")
+	fs.IntVar(&maxMemoryMB, "max-memory-mb", 0, "Stop spawning once the resident memory of this process reaches the megabytes, and warn when it's approaching. Unlimited by default.")
+	fs.DurationVar(&statsReportInterval, "stats-report-interval", slaveReportInterval, "How often the stats are reported to the master and the outputs.")
+	fs.IntVar(&statsBatch, "stats-batch", 1, "Merge the stats of the report intervals into one message to the master, e.g. 5 sends every 5 intervals.")
+	fs.BoolVar(&compressStats, "compress-stats", false, "Compress the stats messages to the master by zlib, only supported by boomer's master, not by locust.")
+	fs.StringVar(&reportHTML, "report-html", "", "Write a self-contained HTML report of the test, with the charts over time, to the file when the test is stopped.")
+	fs.Float64Var(&checkFailRatio, "check-fail-ratio", 0, "Exit with status 1 if the ratio of failures exceeds it at the end of the test, e.g. 0.01 for 1%.")
+	fs.Int64Var(&checkAvgResponseTime, "check-avg-response-time", 0, "Exit with status 1 if the average response time in milliseconds exceeds it at the end of the test.")
+	fs.Int64Var(&checkP95, "check-p95", 0, "Exit with status 1 if the 95th percentile response time in milliseconds exceeds it at the end of the test.")
+	fs.StringVar(&summaryFile, "summary-file", "", "Write the summary of the test, which is printed when the test is stopped, to the file too.")
+	fs.BoolVar(&consoleDashboard, "dashboard", false, "Draw a live dashboard of the stats in the terminal, instead of printing a table every report interval.")
+	fs.StringVar(&webUIAddr, "web-ui", "", "Run in standalone mode without a master, and serve a web UI to start and stop the test on the address, e.g. :8089.")
+	fs.StringVar(&controlAddr, "control-addr", "", "Serve the control API, /start, /stop, /stats and /healthz, on the address, e.g. :8090, disabled by default.")
+	fs.StringVar(&configFile, "config", "", "Read the options from a YAML or TOML file, e.g. boomer.yaml, the options of the command line override the file.")
+	fs.DurationVar(&warmupDuration, "warmup-duration", 0, "Exclude the stats of the specified amount of time since the test starts from the aggregated stats, e.g. 30s.")
 }
@@ -1,6 +1,7 @@
 package boomer
 
 import (
+	"flag"
 	"testing"
 )
 
@@ -35,7 +36,11 @@ func TestInitEvents(t *testing.T) {
 	Events.Publish("request_success", "http", "foo", int64(1), int64(10))
 	Events.Publish("request_failure", "udp", "bar", int64(2), "udp error")
 
-	requestSuccessMsg := <-defaultBoomer.slaveRunner.stats.requestSuccessChan
+	successes, failures := takeRecords(defaultBoomer.slaveRunner.stats)
+	if len(successes) != 1 || len(failures) != 1 {
+		t.Fatal("Expected 1 success and 1 failure, got:", len(successes), len(failures))
+	}
+	requestSuccessMsg := successes[0]
 	if requestSuccessMsg.requestType != "http" {
 		t.Error("Expected: http, got:", requestSuccessMsg.requestType)
 	}
@@ -43,7 +48,7 @@ func TestInitEvents(t *testing.T) {
 		t.Error("Expected: 1, got:", requestSuccessMsg.responseTime)
 	}
 
-	requestFailureMsg := <-defaultBoomer.slaveRunner.stats.requestFailureChan
+	requestFailureMsg := failures[0]
 	if requestFailureMsg.requestType != "udp" {
 		t.Error("Expected: udp, got:", requestFailureMsg.requestType)
 	}
@@ -54,3 +59,28 @@ func TestInitEvents(t *testing.T) {
 		t.Error("Expected: udp error, got:", requestFailureMsg.error)
 	}
 }
+
+func TestRegisterFlags(t *testing.T) {
+	defer func() {
+		boomerFlags = nil
+		masterHost = "127.0.0.1"
+		maxRPS = 0
+	}()
+
+	fs := flag.NewFlagSet("app", flag.ContinueOnError)
+	url := fs.String("url", "", "")
+	RegisterFlags(fs)
+	if boomerFlags != fs {
+		t.Error("Run should read the options from the registered flag set")
+	}
+	if fs.Lookup("master-host") == nil || fs.Lookup("max-rps") == nil {
+		t.Error("The options should be registered in the flag set")
+	}
+
+	if err := fs.Parse([]string{"--url", "http://localhost", "--master-host", "10.0.0.1", "--max-rps", "100"}); err != nil {
+		t.Fatal(err)
+	}
+	if *url != "http://localhost" || masterHost != "10.0.0.1" || maxRPS != 100 {
+		t.Error("The options should be parsed along with the application's flags", *url, masterHost, maxRPS)
+	}
+}
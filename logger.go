@@ -0,0 +1,187 @@
+package boomer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LogLevel controls how verbose boomer's internal logs are.
+type LogLevel int32
+
+const (
+	// QuietLogLevel only prints errors and warnings.
+	QuietLogLevel LogLevel = iota
+	// NormalLogLevel prints errors, warnings and messages like spawning and stopping.
+	NormalLogLevel
+	// DebugLogLevel prints everything, including per-message traces of the protocol with the master.
+	DebugLogLevel
+)
+
+var logLevel = int32(NormalLogLevel)
+
+// Logger prints boomer's internal logs, the messages are filtered by the log level before they reach the Logger.
+// Implement it to integrate boomer's logs into the logging of a larger service.
+type Logger interface {
+	Debugf(format string, v ...interface{})
+	Infof(format string, v ...interface{})
+	Errorf(format string, v ...interface{})
+}
+
+// loggerHolder is stored in currentLogger, because atomic.Value requires the same concrete type.
+type loggerHolder struct {
+	logger Logger
+}
+
+var currentLogger atomic.Value
+
+func init() {
+	currentLogger.Store(loggerHolder{NewStdLogger()})
+}
+
+// SetLogger replaces the logger of boomer's internal logs, which is NewStdLogger by default.
+// A nil logger discards all the logs, to silence boomer inside a larger service.
+// It's safe to call SetLogger while the test is running.
+func SetLogger(logger Logger) {
+	currentLogger.Store(loggerHolder{logger})
+}
+
+func getLogger() Logger {
+	return currentLogger.Load().(loggerHolder).logger
+}
+
+// stdLogger prints to the standard logger of package log.
+type stdLogger struct{}
+
+// NewStdLogger returns a Logger, which prints the messages as is to the standard logger of package log.
+func NewStdLogger() Logger {
+	return stdLogger{}
+}
+
+func (stdLogger) Debugf(format string, v ...interface{}) {
+	log.Printf(format, v...)
+}
+
+func (stdLogger) Infof(format string, v ...interface{}) {
+	log.Printf(format, v...)
+}
+
+func (stdLogger) Errorf(format string, v ...interface{}) {
+	log.Printf(format, v...)
+}
+
+// jsonLogger prints every message as a JSON object in a line.
+type jsonLogger struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+// NewJSONLogger returns a Logger, which writes every message to w as a JSON object in a line, like
+// {"time":"2021-01-02T15:04:05.000Z","level":"info","msg":"Spawning 10 clients at the rate 1 clients/s..."}.
+func NewJSONLogger(w io.Writer) Logger {
+	return &jsonLogger{w: w}
+}
+
+func (l *jsonLogger) Debugf(format string, v ...interface{}) {
+	l.write("debug", format, v...)
+}
+
+func (l *jsonLogger) Infof(format string, v ...interface{}) {
+	l.write("info", format, v...)
+}
+
+func (l *jsonLogger) Errorf(format string, v ...interface{}) {
+	l.write("error", format, v...)
+}
+
+func (l *jsonLogger) write(level, format string, v ...interface{}) {
+	line, err := json.Marshal(struct {
+		Time  string `json:"time"`
+		Level string `json:"level"`
+		Msg   string `json:"msg"`
+	}{
+		Time:  time.Now().UTC().Format("2006-01-02T15:04:05.000Z07:00"),
+		Level: level,
+		Msg:   strings.TrimSpace(fmt.Sprintf(format, v...)),
+	})
+	if err != nil {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.w.Write(append(line, '\n'))
+}
+
+// ParseLogFormat returns the Logger of "text" or "json", which prints to the stderr.
+func ParseLogFormat(format string) (Logger, error) {
+	switch strings.ToLower(format) {
+	case "text":
+		return NewStdLogger(), nil
+	case "json":
+		return NewJSONLogger(os.Stderr), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q, expected text or json", format)
+	}
+}
+
+// SetLogLevel changes the verbosity of boomer's internal logs, defaults to NormalLogLevel.
+// It's safe to call SetLogLevel while the test is running.
+func SetLogLevel(level LogLevel) {
+	switch level {
+	case QuietLogLevel, NormalLogLevel, DebugLogLevel:
+		atomic.StoreInt32(&logLevel, int32(level))
+	default:
+		logError("Invalid log level, ignored!")
+	}
+}
+
+// ParseLogLevel converts "quiet", "normal" or "debug" to a LogLevel.
+func ParseLogLevel(level string) (LogLevel, error) {
+	switch strings.ToLower(level) {
+	case "quiet":
+		return QuietLogLevel, nil
+	case "normal":
+		return NormalLogLevel, nil
+	case "debug":
+		return DebugLogLevel, nil
+	default:
+		return NormalLogLevel, fmt.Errorf("invalid log level %q, expected quiet, normal or debug", level)
+	}
+}
+
+func logEnabled(level LogLevel) bool {
+	return LogLevel(atomic.LoadInt32(&logLevel)) >= level
+}
+
+// logError prints errors and warnings, whatever the log level is.
+func logError(format string, v ...interface{}) {
+	if logger := getLogger(); logger != nil {
+		logger.Errorf(format, v...)
+	}
+}
+
+// logInfo prints messages like spawning and stopping, unless the log level is QuietLogLevel.
+func logInfo(format string, v ...interface{}) {
+	if logger := getLogger(); logger != nil && logEnabled(NormalLogLevel) {
+		logger.Infof(format, v...)
+	}
+}
+
+// logDebug prints noisy messages like protocol traces, only if the log level is DebugLogLevel.
+func logDebug(format string, v ...interface{}) {
+	if logger := getLogger(); logger != nil && logEnabled(DebugLogLevel) {
+		logger.Debugf(format, v...)
+	}
+}
+
+// logFatal prints an error and exits, like log.Fatalf.
+func logFatal(format string, v ...interface{}) {
+	logError(format, v...)
+	os.Exit(1)
+}
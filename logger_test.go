@@ -0,0 +1,149 @@
+package boomer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	level, err := ParseLogLevel("quiet")
+	if err != nil || level != QuietLogLevel {
+		t.Error("Expected QuietLogLevel, got", level, err)
+	}
+	level, err = ParseLogLevel("Normal")
+	if err != nil || level != NormalLogLevel {
+		t.Error("Expected NormalLogLevel, got", level, err)
+	}
+	level, err = ParseLogLevel("debug")
+	if err != nil || level != DebugLogLevel {
+		t.Error("Expected DebugLogLevel, got", level, err)
+	}
+	_, err = ParseLogLevel("verbose")
+	if err == nil {
+		t.Error("Expected error for invalid log level")
+	}
+}
+
+func TestSetLogLevel(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	defer SetLogLevel(NormalLogLevel)
+
+	SetLogLevel(QuietLogLevel)
+	logError("error message")
+	logInfo("info message")
+	logDebug("debug message")
+	output := buf.String()
+	if !strings.Contains(output, "error message") {
+		t.Error("Errors should be printed in quiet level")
+	}
+	if strings.Contains(output, "info message") || strings.Contains(output, "debug message") {
+		t.Error("Only errors should be printed in quiet level")
+	}
+
+	buf.Reset()
+	SetLogLevel(NormalLogLevel)
+	logInfo("info message")
+	logDebug("debug message")
+	output = buf.String()
+	if !strings.Contains(output, "info message") {
+		t.Error("Info messages should be printed in normal level")
+	}
+	if strings.Contains(output, "debug message") {
+		t.Error("Debug messages should not be printed in normal level")
+	}
+
+	buf.Reset()
+	SetLogLevel(DebugLogLevel)
+	logDebug("debug message")
+	if !strings.Contains(buf.String(), "debug message") {
+		t.Error("Debug messages should be printed in debug level")
+	}
+
+	SetLogLevel(LogLevel(10))
+	if !logEnabled(DebugLogLevel) {
+		t.Error("Invalid log level should be ignored")
+	}
+}
+
+type recordingLogger struct {
+	messages []string
+}
+
+func (l *recordingLogger) Debugf(format string, v ...interface{}) {
+	l.messages = append(l.messages, "debug: "+fmt.Sprintf(format, v...))
+}
+
+func (l *recordingLogger) Infof(format string, v ...interface{}) {
+	l.messages = append(l.messages, "info: "+fmt.Sprintf(format, v...))
+}
+
+func (l *recordingLogger) Errorf(format string, v ...interface{}) {
+	l.messages = append(l.messages, "error: "+fmt.Sprintf(format, v...))
+}
+
+func TestSetLogger(t *testing.T) {
+	defer SetLogger(NewStdLogger())
+	defer SetLogLevel(NormalLogLevel)
+
+	logger := &recordingLogger{}
+	SetLogger(logger)
+	logError("error %d", 1)
+	logInfo("info %d", 2)
+	logDebug("debug %d", 3)
+	if fmt.Sprint(logger.messages) != "[error: error 1 info: info 2]" {
+		t.Error("The messages should be filtered by the log level, got", logger.messages)
+	}
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	SetLogger(nil)
+	logError("error message")
+	if buf.Len() != 0 {
+		t.Error("A nil logger should discard the logs, got", buf.String())
+	}
+}
+
+func TestJSONLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewJSONLogger(&buf)
+	logger.Infof("Spawning %d clients\n", 10)
+	logger.Errorf("Failed to connect to \"%s\"", "master")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatal("Expected a line per message, got", buf.String())
+	}
+	entry := make(map[string]string)
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatal("Expected a JSON object, got", lines[0], err)
+	}
+	if entry["level"] != "info" || entry["msg"] != "Spawning 10 clients" || entry["time"] == "" {
+		t.Error("Unexpected log entry", entry)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil {
+		t.Fatal("Expected a JSON object, got", lines[1], err)
+	}
+	if entry["level"] != "error" || entry["msg"] != `Failed to connect to "master"` {
+		t.Error("Unexpected log entry", entry)
+	}
+}
+
+func TestParseLogFormat(t *testing.T) {
+	if _, err := ParseLogFormat("JSON"); err != nil {
+		t.Error("Expected json format, got", err)
+	}
+	if _, err := ParseLogFormat("text"); err != nil {
+		t.Error("Expected text format, got", err)
+	}
+	if _, err := ParseLogFormat("xml"); err == nil {
+		t.Error("Expected error for invalid log format")
+	}
+}
@@ -0,0 +1,337 @@
+// Package luatask runs boomer tasks written in Lua, by the embedded gopher-lua, so simple scenarios can be authored
+// without learning Go. A script declares its tasks in the global table "tasks", each has a name, a weight and
+// a function, which is called by the users in a loop, like Task.Fn.
+//
+//	local http = require("http")
+//	local boomer = require("boomer")
+//
+//	function search()
+//		local resp = http.get("http://localhost:8080/search?q=boomer")
+//		if resp.error then
+//			boomer.record_failure("http", "search", resp.elapsed, resp.error)
+//		else
+//			boomer.record_success("http", "search", resp.elapsed, #resp.body)
+//		end
+//	end
+//
+//	tasks = {
+//		{name = "search", weight = 10, fn = search},
+//	}
+//
+// A script which defines a global function "execute" instead is a single task, named after the file.
+//
+// The "boomer" module has record_success(type, name, response_time, response_length), record_failure(type, name,
+// response_time, exception) and now(), which returns the Unix time in milliseconds. The "http" module has
+// request(method, url, options), get(url, options) and post(url, body, options), the options are a table of body,
+// headers and timeout in milliseconds, and the response is a table of status, body, headers and elapsed in
+// milliseconds, or error and elapsed if the request fails.
+//
+// Every user runs the script in a Lua state of its own, so the globals of the script are kept per user across
+// the iterations, like User.Storage.
+//
+//	tasks, err := luatask.Load("scenario.lua", luatask.Config{})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	globalBoomer.Run(tasks...)
+package luatask
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/myzhan/boomer"
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// stateKey is the key of the Lua state of a user in User.Storage.
+const stateKey = "luatask.state"
+
+// Recorder records the requests of the scripts, *boomer.Boomer implements it.
+type Recorder interface {
+	RecordSuccess(requestType, name string, responseTime int64, responseLength int64)
+	RecordFailure(requestType, name string, responseTime int64, exception string)
+}
+
+// defaultRecorder records to the defaultBoomer of boomer.
+type defaultRecorder struct{}
+
+func (defaultRecorder) RecordSuccess(requestType, name string, responseTime int64, responseLength int64) {
+	boomer.RecordSuccess(requestType, name, responseTime, responseLength)
+}
+
+func (defaultRecorder) RecordFailure(requestType, name string, responseTime int64, exception string) {
+	boomer.RecordFailure(requestType, name, responseTime, exception)
+}
+
+// Config is used to load a script, the zero value is ready to use.
+type Config struct {
+	// Recorder records the requests, the package-level boomer.RecordSuccess and boomer.RecordFailure are used if it's nil.
+	Recorder Recorder
+
+	// HTTPClient sends the requests of the "http" module, http.DefaultClient is used if it's nil.
+	HTTPClient *http.Client
+}
+
+// script is a compiled script, which is run by every user in a Lua state of its own.
+type script struct {
+	path     string
+	proto    *lua.FunctionProto
+	recorder Recorder
+	client   *http.Client
+}
+
+// declaredTask is a task declared by a script.
+type declaredTask struct {
+	name   string
+	weight int
+	fn     *lua.LFunction
+}
+
+// userState is the Lua state of a user, with the functions of the tasks in it.
+type userState struct {
+	l     *lua.LState
+	tasks []declaredTask
+}
+
+// Load compiles the script of path, and returns its tasks.
+func Load(path string, config Config) ([]*boomer.Task, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	chunk, err := parse.Parse(bufio.NewReader(file), path)
+	if err != nil {
+		return nil, fmt.Errorf("luatask: %v", err)
+	}
+	proto, err := lua.Compile(chunk, path)
+	if err != nil {
+		return nil, fmt.Errorf("luatask: %v", err)
+	}
+
+	s := &script{
+		path:     path,
+		proto:    proto,
+		recorder: config.Recorder,
+		client:   config.HTTPClient,
+	}
+	if s.recorder == nil {
+		s.recorder = defaultRecorder{}
+	}
+	if s.client == nil {
+		s.client = http.DefaultClient
+	}
+
+	// run the script once to find out its tasks
+	state, err := s.newState()
+	if err != nil {
+		return nil, err
+	}
+	defer state.l.Close()
+
+	tasks := make([]*boomer.Task, 0, len(state.tasks))
+	for i, declared := range state.tasks {
+		index := i
+		tasks = append(tasks, &boomer.Task{
+			Name:   declared.name,
+			Weight: declared.weight,
+			FnWithUser: func(ctx context.Context, user *boomer.User) {
+				s.run(ctx, user, index)
+			},
+		})
+	}
+	return tasks, nil
+}
+
+// newState runs the script in a new Lua state, and returns the state with the declared tasks.
+func (s *script) newState() (*userState, error) {
+	l := lua.NewState()
+	l.PreloadModule("boomer", s.loadBoomerModule)
+	l.PreloadModule("http", s.loadHTTPModule)
+	l.Push(l.NewFunctionFromProto(s.proto))
+	if err := l.PCall(0, lua.MultRet, nil); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("luatask: %v", err)
+	}
+	tasks, err := s.declaredTasks(l)
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	return &userState{l: l, tasks: tasks}, nil
+}
+
+// declaredTasks returns the tasks in the global table "tasks", or the global function "execute".
+func (s *script) declaredTasks(l *lua.LState) ([]declaredTask, error) {
+	if table, ok := l.GetGlobal("tasks").(*lua.LTable); ok {
+		tasks := make([]declaredTask, 0, table.Len())
+		for i := 1; i <= table.Len(); i++ {
+			task, ok := table.RawGetInt(i).(*lua.LTable)
+			if !ok {
+				return nil, fmt.Errorf("luatask: %s: tasks[%d] isn't a table", s.path, i)
+			}
+			fn, ok := task.RawGetString("fn").(*lua.LFunction)
+			if !ok {
+				return nil, fmt.Errorf("luatask: %s: tasks[%d].fn isn't a function", s.path, i)
+			}
+			tasks = append(tasks, declaredTask{
+				name:   lua.LVAsString(task.RawGetString("name")),
+				weight: int(lua.LVAsNumber(task.RawGetString("weight"))),
+				fn:     fn,
+			})
+		}
+		return tasks, nil
+	}
+	if fn, ok := l.GetGlobal("execute").(*lua.LFunction); ok {
+		name := strings.TrimSuffix(filepath.Base(s.path), filepath.Ext(s.path))
+		return []declaredTask{{name: name, fn: fn}}, nil
+	}
+	return nil, fmt.Errorf("luatask: %s: neither tasks nor execute is defined", s.path)
+}
+
+// run calls the function of the task at index in the Lua state of user, the call is aborted once ctx is canceled.
+func (s *script) run(ctx context.Context, user *boomer.User, index int) {
+	var state *userState
+	if user != nil {
+		state, _ = user.Storage[stateKey].(*userState)
+	}
+	if state == nil {
+		var err error
+		if state, err = s.newState(); err != nil {
+			log.Printf("%v\n", err)
+			return
+		}
+		if user != nil {
+			user.Storage[stateKey] = state
+		} else {
+			defer state.l.Close()
+		}
+	}
+	if index >= len(state.tasks) {
+		log.Printf("luatask: %s: the tasks are changed\n", s.path)
+		return
+	}
+
+	state.l.SetContext(ctx)
+	defer state.l.RemoveContext()
+	task := state.tasks[index]
+	if err := state.l.CallByParam(lua.P{Fn: task.fn, NRet: 0, Protect: true}); err != nil && ctx.Err() == nil {
+		log.Printf("luatask: %s: task %s failed, %v\n", s.path, task.name, err)
+	}
+}
+
+func (s *script) loadBoomerModule(l *lua.LState) int {
+	l.Push(l.SetFuncs(l.NewTable(), map[string]lua.LGFunction{
+		"record_success": s.recordSuccess,
+		"record_failure": s.recordFailure,
+		"now":            now,
+	}))
+	return 1
+}
+
+func (s *script) recordSuccess(l *lua.LState) int {
+	s.recorder.RecordSuccess(l.CheckString(1), l.CheckString(2), l.CheckInt64(3), l.OptInt64(4, 0))
+	return 0
+}
+
+func (s *script) recordFailure(l *lua.LState) int {
+	s.recorder.RecordFailure(l.CheckString(1), l.CheckString(2), l.CheckInt64(3), l.OptString(4, ""))
+	return 0
+}
+
+func now(l *lua.LState) int {
+	l.Push(lua.LNumber(time.Now().UnixNano() / int64(time.Millisecond)))
+	return 1
+}
+
+func (s *script) loadHTTPModule(l *lua.LState) int {
+	l.Push(l.SetFuncs(l.NewTable(), map[string]lua.LGFunction{
+		"request": s.httpRequest,
+		"get":     s.httpGet,
+		"post":    s.httpPost,
+	}))
+	return 1
+}
+
+func (s *script) httpRequest(l *lua.LState) int {
+	options := l.OptTable(3, l.NewTable())
+	return s.doRequest(l, strings.ToUpper(l.CheckString(1)), l.CheckString(2), lua.LVAsString(options.RawGetString("body")), options)
+}
+
+func (s *script) httpGet(l *lua.LState) int {
+	return s.doRequest(l, http.MethodGet, l.CheckString(1), "", l.OptTable(2, l.NewTable()))
+}
+
+func (s *script) httpPost(l *lua.LState) int {
+	return s.doRequest(l, http.MethodPost, l.CheckString(1), l.OptString(2, ""), l.OptTable(3, l.NewTable()))
+}
+
+// doRequest sends a request, and pushes the response table.
+func (s *script) doRequest(l *lua.LState, method, url, body string, options *lua.LTable) int {
+	ctx := l.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if timeout := lua.LVAsNumber(options.RawGetString("timeout")); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(float64(timeout)*float64(time.Millisecond)))
+		defer cancel()
+	}
+
+	result := l.NewTable()
+	start := time.Now()
+	status, header, data, err := s.send(ctx, method, url, body, options)
+	result.RawSetString("elapsed", lua.LNumber(time.Since(start).Nanoseconds()/int64(time.Millisecond)))
+	if err != nil {
+		result.RawSetString("error", lua.LString(err.Error()))
+		l.Push(result)
+		return 1
+	}
+	headers := l.NewTable()
+	for key := range header {
+		headers.RawSetString(key, lua.LString(header.Get(key)))
+	}
+	result.RawSetString("status", lua.LNumber(status))
+	result.RawSetString("headers", headers)
+	result.RawSetString("body", lua.LString(data))
+	l.Push(result)
+	return 1
+}
+
+func (s *script) send(ctx context.Context, method, url, body string, options *lua.LTable) (int, http.Header, []byte, error) {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	if headers, ok := options.RawGetString("headers").(*lua.LTable); ok {
+		headers.ForEach(func(key, value lua.LValue) {
+			req.Header.Set(lua.LVAsString(key), lua.LVAsString(value))
+		})
+	}
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	return resp.StatusCode, resp.Header, data, nil
+}
@@ -0,0 +1,169 @@
+package luatask
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/myzhan/boomer"
+)
+
+type record struct {
+	requestType, name string
+	responseTime      int64
+	responseLength    int64
+	exception         string
+}
+
+type fakeRecorder struct {
+	lock    sync.Mutex
+	records []record
+}
+
+func (r *fakeRecorder) RecordSuccess(requestType, name string, responseTime int64, responseLength int64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.records = append(r.records, record{requestType, name, responseTime, responseLength, ""})
+}
+
+func (r *fakeRecorder) RecordFailure(requestType, name string, responseTime int64, exception string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.records = append(r.records, record{requestType, name, responseTime, 0, exception})
+}
+
+// writeScript writes a script named name to a temporary directory, which is removed by the returned function.
+func writeScript(t *testing.T, name, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "luatask")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err = ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	path, cleanup := writeScript(t, "scenario.lua", `
+local http = require("http")
+local boomer = require("boomer")
+
+local count = 0
+
+function hello()
+	count = count + 1
+	local resp = http.get("`+server.URL+`", {headers = {["X-Token"] = "secret"}})
+	if resp.error or resp.status ~= 200 then
+		boomer.record_failure("http", "hello", resp.elapsed, resp.error or tostring(resp.status))
+	else
+		boomer.record_success("http", "hello", resp.elapsed, #resp.body)
+	end
+end
+
+function counter()
+	boomer.record_success("lua", "counter", 0, count)
+end
+
+function unauthorized()
+	local resp = http.request("get", "`+server.URL+`")
+	boomer.record_failure("http", "unauthorized", resp.elapsed, tostring(resp.status))
+end
+
+tasks = {
+	{name = "hello", weight = 10, fn = hello},
+	{name = "counter", weight = 1, fn = counter},
+	{name = "unauthorized", fn = unauthorized},
+}
+`)
+	defer cleanup()
+
+	recorder := &fakeRecorder{}
+	tasks, err := Load(path, Config{Recorder: recorder})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 3 || tasks[0].Name != "hello" || tasks[0].Weight != 10 || tasks[1].Name != "counter" || tasks[1].Weight != 1 {
+		t.Fatal("The tasks of the script should be loaded, got", tasks)
+	}
+
+	user := &boomer.User{Storage: make(map[string]interface{})}
+	for i := 0; i < 3; i++ {
+		tasks[0].FnWithUser(context.Background(), user)
+	}
+	tasks[1].FnWithUser(context.Background(), user)
+	tasks[2].FnWithUser(context.Background(), user)
+
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	if len(recorder.records) != 5 {
+		t.Fatal("The requests of the script should be recorded, got", recorder.records)
+	}
+	if r := recorder.records[0]; r.requestType != "http" || r.name != "hello" || r.responseLength != 5 || r.exception != "" {
+		t.Error("The response should be passed to the script, got", r)
+	}
+	if r := recorder.records[3]; r.name != "counter" || r.responseLength != 3 {
+		t.Error("The globals should be kept per user across the iterations, got", r)
+	}
+	if r := recorder.records[4]; r.name != "unauthorized" || r.exception != "401" {
+		t.Error("The status should be passed to the script, got", r)
+	}
+}
+
+func TestLoadExecute(t *testing.T) {
+	path, cleanup := writeScript(t, "demo.lua", `
+function execute()
+	require("boomer").record_success("lua", "execute", 1, 2)
+end
+`)
+	defer cleanup()
+
+	recorder := &fakeRecorder{}
+	tasks, err := Load(path, Config{Recorder: recorder})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || tasks[0].Name != "demo" {
+		t.Fatal("The script should be a single task named after the file, got", tasks)
+	}
+	tasks[0].FnWithUser(context.Background(), nil)
+	if len(recorder.records) != 1 || recorder.records[0] != (record{"lua", "execute", 1, 2, ""}) {
+		t.Error("The request of execute should be recorded, got", recorder.records)
+	}
+}
+
+func TestLoadInvalidScripts(t *testing.T) {
+	for name, content := range map[string]string{
+		"syntax.lua":  "function (",
+		"empty.lua":   "local x = 1",
+		"runtime.lua": "error('boom')",
+		"tasks.lua":   "tasks = {{name = 'a'}}",
+	} {
+		path, cleanup := writeScript(t, name, content)
+		if _, err := Load(path, Config{}); err == nil || !strings.HasPrefix(err.Error(), "luatask: ") {
+			t.Error("The invalid script should be refused,", name, err)
+		}
+		cleanup()
+	}
+	if _, err := Load("missing.lua", Config{}); err == nil {
+		t.Error("A missing script should be refused")
+	}
+}
@@ -0,0 +1,604 @@
+package boomer
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// workerStateMissing is the state of a worker which doesn't send heartbeats any more.
+	workerStateMissing = "missing"
+
+	// A worker is missing after heartbeatLiveness heartbeat intervals without a heartbeat.
+	heartbeatLiveness = 3
+
+	// A warning is logged once if the CPU usage of a worker exceeds cpuWarningThreshold percent, like locust does.
+	cpuWarningThreshold = 90
+)
+
+// MasterRunner makes boomer act as the master, so a pure-Go deployment doesn't depend on locust.
+// It accepts the workers over ZeroMQ, both boomer and locust 1.x workers are supported,
+// broadcasts the spawn, stop and quit messages, and aggregates the stats reported by the workers,
+// which are delivered to the outputs every interval like a worker does.
+//
+// The workers which connect after Start are ready for the next Start, they don't get users until then.
+// Locust 2.x workers are not supported, they use a different protocol.
+type MasterRunner struct {
+	bindHost  string
+	bindPort  int
+	nodeID    string
+	server    server
+	tlsConfig *tls.Config
+	outputs   []Output
+
+	// messageHandlers handle the custom messages from the workers, by message type.
+	messageHandlers map[string]func(nodeID string, data interface{})
+
+	lock     sync.Mutex
+	workers  map[string]*workerNode
+	stats    *requestStats
+	running  bool
+	spawning bool
+
+	// targetUsers is the user count of the last Start, 0 once stopped.
+	targetUsers int
+	// startDelay is added to the time of the spawn messages, the workers start spawning at the same instant then.
+	startDelay time.Duration
+	// expectedWorkers defers Start until the number of workers are ready, pendingStart is the deferred Start.
+	expectedWorkers int
+	pendingStart    *pendingStart
+
+	closeChan chan bool
+	closeOnce sync.Once
+}
+
+type pendingStart struct {
+	users     int
+	spawnRate float64
+}
+
+type workerNode struct {
+	id        string
+	state     string
+	heartbeat int
+	userCount int64
+
+	cpuUsage    float64
+	cpuWarned   bool
+	memoryUsage int64
+}
+
+// NewMasterRunner returns a MasterRunner, which listens on bindHost:bindPort for the workers,
+// 5557 is the default port of locust.
+func NewMasterRunner(bindHost string, bindPort int) *MasterRunner {
+	nodeID := getNodeID()
+	return &MasterRunner{
+		bindHost:  bindHost,
+		bindPort:  bindPort,
+		nodeID:    nodeID,
+		server:    newServer(bindHost, bindPort, nodeID),
+		workers:   make(map[string]*workerNode),
+		stats:     newRequestStats(),
+		closeChan: make(chan bool),
+	}
+}
+
+// AddOutput accepts outputs which implements the boomer.Output interface, it must be called before Run.
+func (m *MasterRunner) AddOutput(o Output) {
+	m.outputs = append(m.outputs, o)
+}
+
+// SetServerBackend chooses the transport to talk to the workers, "zmq" or "tcp". zmq is the default and talks to
+// both locust and boomer workers. tcp is plain TCP without ZMQ, which only talks to boomer workers with the tcp
+// client backend, so a cluster of boomers needs neither ZMQ nor Python. It must be called before Run.
+func (m *MasterRunner) SetServerBackend(backend string) {
+	newBackend, ok := serverBackends[backend]
+	if !ok {
+		logError("Unknown server backend %s, expected one of %v, ignored!", backend, availableServerBackends())
+		return
+	}
+	m.server = newBackend(m.bindHost, m.bindPort, m.nodeID)
+}
+
+// SetTLS wraps the connections of the workers in TLS, so the channel to the workers, including the control of the test,
+// can cross untrusted networks. It's only supported by the tcp server backend, the workers must connect with TLS too,
+// see Boomer.SetMasterTLS. Set ClientAuth and ClientCAs of config to authenticate the workers by their certificates.
+// It must be called before Run.
+func (m *MasterRunner) SetTLS(config *tls.Config) {
+	if config == nil {
+		logError("Invalid TLS config, ignored!")
+		return
+	}
+	m.tlsConfig = config
+}
+
+// SetStartDelay asks the workers to start spawning at the same instant, d after the spawn messages are sent,
+// instead of as soon as they receive them, so the ramp-up of the cluster isn't staggered. d must cover the delivery
+// of the spawn messages and the skew of the clocks of the workers. Only boomer workers support it.
+// Defaults to 0, which starts at once.
+func (m *MasterRunner) SetStartDelay(d time.Duration) {
+	if d < 0 {
+		logError("Invalid start delay, ignored!")
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.startDelay = d
+}
+
+// SetExpectedWorkers defers Start until n workers are ready, so an auto-scaled fleet of workers doesn't start
+// the test with a part of its capacity. Defaults to 0, which starts with the workers connected.
+func (m *MasterRunner) SetExpectedWorkers(n int) {
+	if n < 0 {
+		logError("Invalid expected workers, ignored!")
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.expectedWorkers = n
+}
+
+// RegisterMessage registers a handler of the custom messages of messageType from the workers, like
+// runner.register_message of locust. The handler receives the node id of the worker and the data decoded from msgpack.
+// It's called with the lock of the master held, so it shouldn't block or call the methods of MasterRunner.
+// It must be called before Run.
+func (m *MasterRunner) RegisterMessage(messageType string, handler func(nodeID string, data interface{})) {
+	if m.messageHandlers == nil {
+		m.messageHandlers = make(map[string]func(nodeID string, data interface{}))
+	}
+	m.messageHandlers[messageType] = handler
+}
+
+// SendCustomMessage sends a custom message of messageType to all the workers which are not missing,
+// like runner.send_message of locust. The data can be anything serializable by msgpack.
+func (m *MasterRunner) SendCustomMessage(messageType string, data interface{}) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, w := range m.availableWorkers() {
+		m.sendCustomMessage(w.id, messageType, data)
+	}
+}
+
+// SendCustomMessageTo sends a custom message of messageType to the worker of nodeID,
+// so every worker can get different data, like credentials or shard assignments.
+func (m *MasterRunner) SendCustomMessageTo(nodeID string, messageType string, data interface{}) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.sendCustomMessage(nodeID, messageType, data)
+}
+
+func (m *MasterRunner) sendCustomMessage(nodeID string, messageType string, data interface{}) {
+	m.server.sendChannel() <- newCustomMessage(messageType, data, nodeID)
+}
+
+// Run binds the address and starts accepting the workers, it doesn't block.
+func (m *MasterRunner) Run() error {
+	for _, o := range m.outputs {
+		if initializer, ok := o.(OutputInitializer); ok {
+			if err := initializer.Init(); err != nil {
+				return err
+			}
+		}
+	}
+	if m.tlsConfig != nil {
+		s, ok := m.server.(*tcpServer)
+		if !ok {
+			return errors.New("TLS is only supported by the tcp server backend")
+		}
+		s.tlsConfig = m.tlsConfig
+	}
+	if err := m.server.bind(); err != nil {
+		return err
+	}
+
+	callOutputs(m.outputs, func(o Output) {
+		o.OnStart()
+	})
+
+	go m.listen()
+	go m.checkHeartbeats()
+	go m.report()
+	return nil
+}
+
+// Start spawns users over all the ready workers, the users and the spawn rate are split evenly.
+// If the test is running, the workers are rescaled to the new user count.
+// If fewer workers than SetExpectedWorkers are ready, the spawning is deferred until they are.
+func (m *MasterRunner) Start(users int, spawnRate float64) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	workers := m.availableWorkers()
+	if len(workers) < m.expectedWorkers {
+		m.pendingStart = &pendingStart{users: users, spawnRate: spawnRate}
+		logInfo("Waiting for %d workers to start the test, %d are connected", m.expectedWorkers, len(workers))
+		return nil
+	}
+	if len(workers) == 0 {
+		return errors.New("no worker is connected")
+	}
+	m.start(workers, users, spawnRate)
+	return nil
+}
+
+// startPending starts the deferred Start, once the expected workers are ready.
+func (m *MasterRunner) startPending() {
+	if m.pendingStart == nil {
+		return
+	}
+	workers := m.availableWorkers()
+	if len(workers) < m.expectedWorkers {
+		return
+	}
+	pending := m.pendingStart
+	m.pendingStart = nil
+	m.start(workers, pending.users, pending.spawnRate)
+}
+
+func (m *MasterRunner) start(workers []*workerNode, users int, spawnRate float64) {
+	if !m.running {
+		m.stats.clearAll()
+	}
+	m.running = true
+	m.spawning = true
+
+	startAt := int64(0)
+	if m.startDelay > 0 {
+		startAt = time.Now().Add(m.startDelay).UnixNano() / int64(time.Millisecond)
+	}
+	n := len(workers)
+	for i, w := range workers {
+		workerUsers := users / n
+		if i < users%n {
+			workerUsers++
+		}
+		data := map[string]interface{}{
+			"num_users":    int64(workerUsers),
+			"spawn_rate":   spawnRate / float64(n),
+			"host":         nil,
+			"stop_timeout": nil,
+			"timestamp":    time.Now().Unix(),
+		}
+		if startAt > 0 {
+			data["start_at"] = startAt
+		}
+		m.server.sendChannel() <- newMessage("spawn", data, w.id)
+	}
+	m.targetUsers = users
+	logInfo("Sending spawn messages to %d workers, %d users at %.2f users/s in total", n, users, spawnRate)
+}
+
+// Pause tells all the workers to suspend the iterations of their users, like Boomer.Pause, the users and
+// the connections are kept. Only boomer workers support it, locust workers ignore it.
+func (m *MasterRunner) Pause() {
+	m.sendToRunningWorkers("pause")
+}
+
+// Resume tells all the workers to continue the iterations suspended by Pause.
+func (m *MasterRunner) Resume() {
+	m.sendToRunningWorkers("resume")
+}
+
+func (m *MasterRunner) sendToRunningWorkers(messageType string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, w := range m.sortedWorkers() {
+		if w.state == stateSpawning || w.state == stateRunning {
+			m.server.sendChannel() <- newMessage(messageType, nil, w.id)
+		}
+	}
+}
+
+// Stop tells all the workers to stop their users, the workers keep connected for the next Start.
+func (m *MasterRunner) Stop() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, w := range m.sortedWorkers() {
+		if w.state != workerStateMissing {
+			m.server.sendChannel() <- newMessage("stop", nil, w.id)
+		}
+	}
+	m.running = false
+	m.spawning = false
+	m.targetUsers = 0
+	m.pendingStart = nil
+}
+
+// Quit tells all the workers to quit, delivers the last stats to the outputs and closes the socket.
+func (m *MasterRunner) Quit() {
+	m.closeOnce.Do(func() {
+		m.lock.Lock()
+		for _, w := range m.sortedWorkers() {
+			m.server.sendChannel() <- newMessage("quit", nil, w.id)
+		}
+		m.running = false
+		m.lock.Unlock()
+
+		// wait for the quit messages to be sent, but not forever
+		deadline := time.Now().Add(3 * time.Second)
+		for len(m.server.sendChannel()) > 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		close(m.closeChan)
+
+		m.lock.Lock()
+		data := m.reportData()
+		m.lock.Unlock()
+		callOutputs(m.outputs, func(o Output) {
+			o.OnEvent(data)
+		})
+		callOutputs(m.outputs, func(o Output) {
+			o.OnStop()
+		})
+		m.server.close()
+	})
+}
+
+// ScalingHandler returns the handler which responds the number of users and workers of the cluster as JSON,
+// like /scaling of the control API of the workers, for the autoscalers of the workers, like the metrics-api
+// scaler of KEDA. The target_user_count over the users per worker is the number of workers needed.
+func (m *MasterRunner) ScalingHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		m.lock.Lock()
+		status := &scalingStatus{
+			State:           m.state(),
+			UserCount:       int(m.userCount()),
+			TargetUserCount: m.targetUsers,
+			WorkerCount:     len(m.availableWorkers()),
+			ExpectedWorkers: m.expectedWorkers,
+		}
+		if m.pendingStart != nil {
+			status.TargetUserCount = m.pendingStart.users
+		}
+		m.lock.Unlock()
+		writeControlJSON(w, http.StatusOK, status)
+	})
+}
+
+// state returns the state of the cluster, like the state of a worker.
+func (m *MasterRunner) state() string {
+	switch {
+	case m.spawning:
+		return stateSpawning
+	case m.running:
+		return stateRunning
+	}
+	return stateInit
+}
+
+// WorkerCount returns the number of workers which are not missing.
+func (m *MasterRunner) WorkerCount() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	count := 0
+	for _, w := range m.workers {
+		if w.state != workerStateMissing {
+			count++
+		}
+	}
+	return count
+}
+
+// UserCount returns the number of users reported by the workers which are not missing.
+func (m *MasterRunner) UserCount() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return int(m.userCount())
+}
+
+func (m *MasterRunner) userCount() int64 {
+	count := int64(0)
+	for _, w := range m.workers {
+		if w.state != workerStateMissing {
+			count += w.userCount
+		}
+	}
+	return count
+}
+
+// sortedWorkers returns all the workers sorted by id, so the users are distributed deterministically.
+func (m *MasterRunner) sortedWorkers() []*workerNode {
+	workers := make([]*workerNode, 0, len(m.workers))
+	for _, w := range m.workers {
+		workers = append(workers, w)
+	}
+	sort.Slice(workers, func(i, j int) bool {
+		return workers[i].id < workers[j].id
+	})
+	return workers
+}
+
+func (m *MasterRunner) availableWorkers() []*workerNode {
+	workers := make([]*workerNode, 0, len(m.workers))
+	for _, w := range m.sortedWorkers() {
+		if w.state != workerStateMissing {
+			workers = append(workers, w)
+		}
+	}
+	return workers
+}
+
+func (m *MasterRunner) listen() {
+	for {
+		select {
+		case msg := <-m.server.recvChannel():
+			m.onMessage(msg)
+		case <-m.closeChan:
+			return
+		}
+	}
+}
+
+func (m *MasterRunner) onMessage(msg *Message) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	logDebug("Recv a %s message from worker(%s)", msg.Type, msg.NodeID)
+
+	if msg.Type == "client_ready" {
+		if w, ok := m.workers[msg.NodeID]; ok {
+			missing := w.state == workerStateMissing
+			w.state = stateInit
+			w.heartbeat = heartbeatLiveness
+			w.userCount = 0
+			if missing {
+				m.broadcastWorkerCount()
+			}
+			m.startPending()
+			return
+		}
+		m.workers[msg.NodeID] = &workerNode{
+			id:        msg.NodeID,
+			state:     stateInit,
+			heartbeat: heartbeatLiveness,
+		}
+		logInfo("Worker(%s) is ready, %d workers are connected", msg.NodeID, len(m.workers))
+		m.broadcastWorkerCount()
+		m.startPending()
+		return
+	}
+
+	w, ok := m.workers[msg.NodeID]
+	if !ok {
+		logDebug("Ignore a %s message from unknown worker(%s)", msg.Type, msg.NodeID)
+		return
+	}
+
+	switch msg.Type {
+	case "heartbeat":
+		missing := w.state == workerStateMissing
+		if missing {
+			logInfo("Worker(%s) is back", w.id)
+		}
+		w.heartbeat = heartbeatLiveness
+		if state := toString(msg.Data["state"]); state != "" {
+			w.state = state
+		}
+		if missing && w.state != workerStateMissing {
+			m.broadcastWorkerCount()
+		}
+		if cpuUsage, ok := msg.Data["current_cpu_usage"].(float64); ok {
+			w.cpuUsage = cpuUsage
+			if cpuUsage > cpuWarningThreshold && !w.cpuWarned {
+				w.cpuWarned = true
+				logError("Worker(%s) exceeded the CPU threshold, %.1f%%, the results may be inaccurate", w.id, cpuUsage)
+			}
+		}
+		w.memoryUsage = toInt64(msg.Data["current_memory_usage"])
+	case "spawning":
+		w.state = stateSpawning
+	case "spawning_complete":
+		w.state = stateRunning
+		w.userCount = toInt64(msg.Data["count"])
+		if m.spawning && m.allSpawned() {
+			m.spawning = false
+			logInfo("All the workers have spawned their users, %d users in total", m.userCount())
+		}
+	case "client_stopped":
+		w.state = stateStopped
+		w.userCount = 0
+	case "stats":
+		m.stats.extend(msg.Data)
+		if _, ok := msg.Data["user_count"]; ok {
+			w.userCount = toInt64(msg.Data["user_count"])
+		}
+	case "quit":
+		delete(m.workers, w.id)
+		logInfo("Worker(%s) quit, %d workers are connected", w.id, len(m.workers))
+		m.broadcastWorkerCount()
+	case "exception":
+		logError("Worker(%s) reported an exception, %s\n%s", w.id, toString(msg.Data["msg"]), toString(msg.Data["traceback"]))
+	default:
+		if handler, ok := m.messageHandlers[msg.Type]; ok {
+			handler(w.id, msg.customData())
+		}
+	}
+}
+
+func (m *MasterRunner) allSpawned() bool {
+	for _, w := range m.workers {
+		if w.state == stateSpawning {
+			return false
+		}
+	}
+	return true
+}
+
+// checkHeartbeats marks the workers which don't send heartbeats as missing, their users are not counted.
+func (m *MasterRunner) checkHeartbeats() {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.lock.Lock()
+			m.tickHeartbeats()
+			m.lock.Unlock()
+		case <-m.closeChan:
+			return
+		}
+	}
+}
+
+func (m *MasterRunner) tickHeartbeats() {
+	changed := false
+	for _, w := range m.workers {
+		if w.state == workerStateMissing {
+			continue
+		}
+		w.heartbeat--
+		if w.heartbeat <= 0 {
+			w.state = workerStateMissing
+			changed = true
+			logError("Worker(%s) failed to send heartbeat, it's marked as missing", w.id)
+		}
+	}
+	if changed {
+		m.broadcastWorkerCount()
+	}
+}
+
+// broadcastWorkerCount sends the number of the workers which are not missing to all of them as the "worker_count"
+// message, so DistributedRateLimiter can split the RPS of the cluster. It must be called with the lock held.
+func (m *MasterRunner) broadcastWorkerCount() {
+	workers := m.availableWorkers()
+	for _, w := range workers {
+		m.sendCustomMessage(w.id, "worker_count", len(workers))
+	}
+}
+
+// report delivers the aggregated stats to the outputs every interval, while the test is running.
+func (m *MasterRunner) report() {
+	ticker := time.NewTicker(slaveReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.lock.Lock()
+			running := m.running
+			data := m.reportData()
+			m.lock.Unlock()
+			if !running {
+				continue
+			}
+			callOutputs(m.outputs, func(o Output) {
+				o.OnEvent(data)
+			})
+		case <-m.closeChan:
+			return
+		}
+	}
+}
+
+func (m *MasterRunner) reportData() map[string]interface{} {
+	data := m.stats.collectReportData()
+	data["user_count"] = int32(m.userCount())
+	return data
+}
@@ -0,0 +1,367 @@
+package boomer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type fakeServer struct {
+	fromWorkers chan *Message
+	toWorkers   chan *Message
+}
+
+func newFakeServer() *fakeServer {
+	return &fakeServer{
+		fromWorkers: make(chan *Message, 100),
+		toWorkers:   make(chan *Message, 100),
+	}
+}
+
+func (s *fakeServer) bind() error {
+	return nil
+}
+
+func (s *fakeServer) close() {
+}
+
+func (s *fakeServer) recvChannel() chan *Message {
+	return s.fromWorkers
+}
+
+func (s *fakeServer) sendChannel() chan *Message {
+	return s.toWorkers
+}
+
+func newTestMasterRunner() (*MasterRunner, *fakeServer) {
+	server := newFakeServer()
+	master := NewMasterRunner("127.0.0.1", 0)
+	master.server = server
+	return master, server
+}
+
+// nextMessage returns the next message to the workers, skipping the "worker_count" messages.
+func (s *fakeServer) nextMessage() *Message {
+	for {
+		msg := <-s.toWorkers
+		if msg.Type != "worker_count" {
+			return msg
+		}
+	}
+}
+
+func TestMasterStartWithoutWorkers(t *testing.T) {
+	master, _ := newTestMasterRunner()
+	if err := master.Start(10, 10); err == nil {
+		t.Error("Start should fail without any worker")
+	}
+}
+
+func TestMasterStartDistributesUsers(t *testing.T) {
+	master, server := newTestMasterRunner()
+	master.onMessage(newMessage("client_ready", nil, "worker-b"))
+	master.onMessage(newMessage("client_ready", nil, "worker-a"))
+	master.onMessage(newMessage("client_ready", nil, "worker-c"))
+
+	if master.WorkerCount() != 3 {
+		t.Fatalf("Expected 3 workers, got %d", master.WorkerCount())
+	}
+	if err := master.Start(10, 6); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]int64{"worker-a": 4, "worker-b": 3, "worker-c": 3}
+	for i := 0; i < 3; i++ {
+		msg := server.nextMessage()
+		if msg.Type != "spawn" {
+			t.Errorf("Expected a spawn message, got %s", msg.Type)
+		}
+		if msg.Data["num_users"].(int64) != expected[msg.NodeID] {
+			t.Errorf("Expected %d users for %s, got %v", expected[msg.NodeID], msg.NodeID, msg.Data["num_users"])
+		}
+		if msg.Data["spawn_rate"].(float64) != 2 {
+			t.Errorf("Expected spawn rate 2, got %v", msg.Data["spawn_rate"])
+		}
+	}
+}
+
+func TestMasterExpectedWorkers(t *testing.T) {
+	master, server := newTestMasterRunner()
+	master.SetExpectedWorkers(2)
+	master.onMessage(newMessage("client_ready", nil, "worker-a"))
+	if err := master.Start(10, 10); err != nil {
+		t.Fatal("Start should be deferred instead of failing, got", err)
+	}
+	select {
+	case msg := <-server.toWorkers:
+		if msg.Type != "worker_count" {
+			t.Fatal("Nothing should be spawned until 2 workers are ready, got", msg.Type)
+		}
+	default:
+	}
+
+	code, body := serveScaling(master)
+	if code != http.StatusOK || body["target_user_count"] != 10.0 || body["worker_count"] != 1.0 || body["expected_workers"] != 2.0 {
+		t.Error("The deferred users should be the target, got", code, body)
+	}
+
+	master.onMessage(newMessage("client_ready", nil, "worker-b"))
+	for i := 0; i < 2; i++ {
+		if msg := server.nextMessage(); msg.Type != "spawn" || msg.Data["num_users"].(int64) != 5 {
+			t.Errorf("Expected 5 users for every worker once 2 workers are ready, got %s %v", msg.Type, msg.Data)
+		}
+	}
+	_, body = serveScaling(master)
+	if body["state"] != stateSpawning || body["target_user_count"] != 10.0 || body["worker_count"] != 2.0 {
+		t.Error("The scaling status should be updated, got", body)
+	}
+
+	master.Stop()
+	_, body = serveScaling(master)
+	if body["state"] != stateInit || body["target_user_count"] != 0.0 {
+		t.Error("The target should be reset once stopped, got", body)
+	}
+}
+
+func TestMasterPauseAndResume(t *testing.T) {
+	master, server := newTestMasterRunner()
+	master.onMessage(newMessage("client_ready", nil, "worker-a"))
+	master.onMessage(newMessage("client_ready", nil, "worker-b"))
+	master.Start(10, 10)
+	server.nextMessage()
+	server.nextMessage()
+	master.onMessage(newMessage("spawning_complete", map[string]interface{}{"count": int64(5)}, "worker-a"))
+
+	master.Pause()
+	if msg := server.nextMessage(); msg.Type != "pause" || msg.NodeID != "worker-a" {
+		t.Error("The running worker should be paused, got", msg.Type, msg.NodeID)
+	}
+	master.Resume()
+	if msg := server.nextMessage(); msg.Type != "resume" || msg.NodeID != "worker-a" {
+		t.Error("The running worker should be resumed, got", msg.Type, msg.NodeID)
+	}
+}
+
+func TestMasterStartDelay(t *testing.T) {
+	master, server := newTestMasterRunner()
+	master.SetStartDelay(-time.Second)
+	master.SetStartDelay(5 * time.Second)
+	master.onMessage(newMessage("client_ready", nil, "worker-a"))
+	master.onMessage(newMessage("client_ready", nil, "worker-b"))
+	master.Start(10, 10)
+
+	expected := time.Now().Add(5*time.Second).UnixNano() / int64(time.Millisecond)
+	startAt := int64(0)
+	for i := 0; i < 2; i++ {
+		msg := server.nextMessage()
+		if i > 0 && msg.Data["start_at"] != startAt {
+			t.Error("All the workers should start at the same time, got", msg.Data["start_at"], startAt)
+		}
+		startAt = msg.Data["start_at"].(int64)
+	}
+	if startAt < expected-1000 || startAt > expected {
+		t.Error("The start time should be 5 seconds later, got", startAt, expected)
+	}
+}
+
+func serveScaling(master *MasterRunner) (int, map[string]interface{}) {
+	recorder := httptest.NewRecorder()
+	master.ScalingHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/scaling", nil))
+	var body map[string]interface{}
+	json.Unmarshal(recorder.Body.Bytes(), &body)
+	return recorder.Code, body
+}
+
+func TestMasterWorkerStates(t *testing.T) {
+	master, server := newTestMasterRunner()
+	master.onMessage(newMessage("client_ready", nil, "worker-a"))
+	master.Start(10, 10)
+	server.nextMessage()
+
+	master.onMessage(newMessage("spawning", nil, "worker-a"))
+	if !master.spawning {
+		t.Error("The master should be spawning")
+	}
+	master.onMessage(newMessage("spawning_complete", map[string]interface{}{"count": uint64(10)}, "worker-a"))
+	if master.spawning {
+		t.Error("The master should not be spawning after all the workers complete")
+	}
+	if master.UserCount() != 10 {
+		t.Errorf("Expected 10 users, got %d", master.UserCount())
+	}
+
+	master.Stop()
+	if msg := server.nextMessage(); msg.Type != "stop" {
+		t.Errorf("Expected a stop message, got %s", msg.Type)
+	}
+	master.onMessage(newMessage("client_stopped", nil, "worker-a"))
+	if master.UserCount() != 0 {
+		t.Errorf("Expected 0 users, got %d", master.UserCount())
+	}
+
+	master.onMessage(newMessage("quit", nil, "worker-a"))
+	if master.WorkerCount() != 0 {
+		t.Errorf("Expected 0 workers, got %d", master.WorkerCount())
+	}
+}
+
+func TestMasterHeartbeatMissing(t *testing.T) {
+	master, _ := newTestMasterRunner()
+	master.onMessage(newMessage("client_ready", nil, "worker-a"))
+	master.onMessage(newMessage("client_ready", nil, "worker-b"))
+
+	for i := 0; i < heartbeatLiveness; i++ {
+		master.onMessage(newMessage("heartbeat", map[string]interface{}{"state": []byte("ready")}, "worker-a"))
+		master.tickHeartbeats()
+	}
+	if master.workers["worker-b"].state != workerStateMissing {
+		t.Error("worker-b should be missing")
+	}
+	if master.workers["worker-a"].state != stateInit {
+		t.Error("worker-a should be ready")
+	}
+	if master.WorkerCount() != 1 {
+		t.Errorf("Expected 1 worker, got %d", master.WorkerCount())
+	}
+
+	master.onMessage(newMessage("heartbeat", map[string]interface{}{
+		"state":                "ready",
+		"current_cpu_usage":    float64(95),
+		"current_memory_usage": uint64(1024),
+	}, "worker-b"))
+	if master.WorkerCount() != 2 {
+		t.Errorf("Expected 2 workers after worker-b is back, got %d", master.WorkerCount())
+	}
+	worker := master.workers["worker-b"]
+	if worker.cpuUsage != 95 || !worker.cpuWarned || worker.memoryUsage != 1024 {
+		t.Errorf("Expected the usage of worker-b to be recorded, got %v%% and %d bytes", worker.cpuUsage, worker.memoryUsage)
+	}
+}
+
+func TestMasterAggregatesStats(t *testing.T) {
+	master, _ := newTestMasterRunner()
+	master.onMessage(newMessage("client_ready", nil, "worker-a"))
+	master.onMessage(newMessage("client_ready", nil, "worker-b"))
+
+	for i, id := range []string{"worker-a", "worker-b"} {
+		worker := newRequestStats()
+		worker.logRequest("http", "success", int64(10*(i+1)), 100)
+		worker.logError("http", "failure", "500 error")
+		data := worker.collectReportData()
+		data["user_count"] = int32(5)
+		master.onMessage(newMessage("stats", data, id))
+	}
+
+	data := master.reportData()
+	if data["user_count"].(int32) != 10 {
+		t.Errorf("Expected 10 users, got %v", data["user_count"])
+	}
+	total := data["stats_total"].(map[string]interface{})
+	if total["num_requests"].(int64) != 2 {
+		t.Errorf("Expected 2 requests, got %v", total["num_requests"])
+	}
+	if total["num_failures"].(int64) != 2 {
+		t.Errorf("Expected 2 failures, got %v", total["num_failures"])
+	}
+	if total["min_response_time"].(int64) != 10 || total["max_response_time"].(int64) != 20 {
+		t.Errorf("Expected response times between 10 and 20, got %v and %v", total["min_response_time"], total["max_response_time"])
+	}
+	errors := data["errors"].(map[string]map[string]interface{})
+	if len(errors) != 1 {
+		t.Fatalf("Expected 1 error, got %d", len(errors))
+	}
+	for _, e := range errors {
+		if e["occurrences"].(int64) != 2 {
+			t.Errorf("Expected 2 occurrences, got %v", e["occurrences"])
+		}
+	}
+}
+
+func TestMasterIgnoresUnknownWorkers(t *testing.T) {
+	master, _ := newTestMasterRunner()
+	master.onMessage(newMessage("stats", map[string]interface{}{"user_count": int32(5)}, "worker-a"))
+	if master.UserCount() != 0 {
+		t.Errorf("Expected 0 users, got %d", master.UserCount())
+	}
+}
+
+func TestMasterCustomMessages(t *testing.T) {
+	master, server := newTestMasterRunner()
+	var receivedFrom string
+	var received interface{}
+	master.RegisterMessage("acknowledge", func(nodeID string, data interface{}) {
+		receivedFrom, received = nodeID, data
+	})
+	master.onMessage(newMessage("client_ready", nil, "worker-a"))
+	master.onMessage(newMessage("client_ready", nil, "worker-b"))
+
+	master.onMessage(newCustomMessage("acknowledge", "done", "worker-b"))
+	if receivedFrom != "worker-b" || received != "done" {
+		t.Errorf("Expected done from worker-b, got %v from %s", received, receivedFrom)
+	}
+
+	master.SendCustomMessage("credentials", map[string]interface{}{"user": "foo"})
+	for _, id := range []string{"worker-a", "worker-b"} {
+		msg := server.nextMessage()
+		if msg.Type != "credentials" || msg.NodeID != id {
+			t.Errorf("Expected credentials to %s, got %s to %s", id, msg.Type, msg.NodeID)
+		}
+		if msg.Data["user"] != "foo" {
+			t.Errorf("Expected user foo, got %v", msg.Data["user"])
+		}
+	}
+}
+
+func TestMasterBroadcastsWorkerCount(t *testing.T) {
+	master, server := newTestMasterRunner()
+	expectWorkerCount := func(count int, ids ...string) {
+		for _, id := range ids {
+			msg := <-server.toWorkers
+			if msg.Type != "worker_count" || msg.NodeID != id || msg.customData() != count {
+				t.Errorf("Expected worker_count %d to %s, got %s %v to %s", count, id, msg.Type, msg.customData(), msg.NodeID)
+			}
+		}
+		if len(server.toWorkers) != 0 {
+			t.Errorf("Expected no more messages, got %d", len(server.toWorkers))
+		}
+	}
+
+	master.onMessage(newMessage("client_ready", nil, "worker-a"))
+	expectWorkerCount(1, "worker-a")
+	master.onMessage(newMessage("client_ready", nil, "worker-b"))
+	expectWorkerCount(2, "worker-a", "worker-b")
+	// a worker is ready again after the test is stopped, the count doesn't change
+	master.onMessage(newMessage("client_ready", nil, "worker-a"))
+	expectWorkerCount(0)
+
+	for i := 0; i < heartbeatLiveness; i++ {
+		master.onMessage(newMessage("heartbeat", map[string]interface{}{"state": "ready"}, "worker-a"))
+		master.tickHeartbeats()
+	}
+	expectWorkerCount(1, "worker-a")
+	master.onMessage(newMessage("heartbeat", map[string]interface{}{"state": "ready"}, "worker-b"))
+	expectWorkerCount(2, "worker-a", "worker-b")
+
+	master.onMessage(newMessage("quit", nil, "worker-b"))
+	expectWorkerCount(1, "worker-a")
+}
+
+func TestToStringMap(t *testing.T) {
+	m := toStringMap(map[interface{}]interface{}{
+		"name":  []byte("foo"),
+		"count": uint64(3),
+	})
+	if toString(m["name"]) != "foo" {
+		t.Errorf("Expected foo, got %v", m["name"])
+	}
+	if toInt64(m["count"]) != 3 {
+		t.Errorf("Expected 3, got %v", m["count"])
+	}
+
+	times := toInt64Map(map[interface{}]interface{}{uint64(10): int64(2)})
+	if times[10] != 2 {
+		t.Errorf("Expected 2, got %v", times[10])
+	}
+}
@@ -1,6 +1,11 @@
 package boomer
 
 import (
+	"bytes"
+	"compress/zlib"
+	"io/ioutil"
+	"sync"
+
 	"github.com/ugorji/go/codec"
 )
 
@@ -8,31 +13,210 @@ var (
 	mh codec.MsgpackHandle
 )
 
-type message struct {
+func init() {
+	mh.StructToArray = true
+}
+
+// maxPooledBufferSize is the max capacity of a buffer kept by the pools, a larger one is dropped after use.
+const maxPooledBufferSize = 1 << 20
+
+// messageEncoder is an encoder with its buffer, they are reused by serialize, so a large report doesn't
+// grow a new buffer from scratch every interval.
+type messageEncoder struct {
+	buf []byte
+	enc *codec.Encoder
+}
+
+var encoderPool = sync.Pool{
+	New: func() interface{} {
+		e := &messageEncoder{}
+		e.enc = codec.NewEncoderBytes(&e.buf, &mh)
+		return e
+	},
+}
+
+var zlibWriterPool = sync.Pool{
+	New: func() interface{} {
+		return zlib.NewWriter(nil)
+	},
+}
+
+// Message is the message exchanged between boomer and the master.
+type Message struct {
 	Type   string                 `codec:"type"`
 	Data   map[string]interface{} `codec:"data"`
 	NodeID string                 `codec:"node_id"`
+
+	// rawData is the data of a custom message, if it's not a map.
+	rawData interface{}
+	// compressed messages are compressed by zlib after they are serialized, see Boomer.SetStatsCompression.
+	compressed bool
+}
+
+// rawMessage has the same layout as Message, but its data can be anything, like the custom messages of locust.
+type rawMessage struct {
+	Type   string      `codec:"type"`
+	Data   interface{} `codec:"data"`
+	NodeID string      `codec:"node_id"`
 }
 
-func newMessage(t string, data map[string]interface{}, nodeID string) (msg *message) {
-	return &message{
+func newMessage(t string, data map[string]interface{}, nodeID string) (msg *Message) {
+	return &Message{
 		Type:   t,
 		Data:   data,
 		NodeID: nodeID,
 	}
 }
 
-func (m *message) serialize() (out []byte, err error) {
-	mh.StructToArray = true
-	enc := codec.NewEncoderBytes(&out, &mh)
-	err = enc.Encode(m)
-	return out, err
+// newCustomMessage returns a message whose data can be anything serializable by msgpack.
+func newCustomMessage(t string, data interface{}, nodeID string) (msg *Message) {
+	msg = newMessage(t, toStringMap(data), nodeID)
+	if msg.Data == nil {
+		msg.rawData = data
+	}
+	return msg
 }
 
-func newMessageFromBytes(raw []byte) (newMsg *message, err error) {
-	mh.StructToArray = true
+// customData returns the data of a custom message.
+func (m *Message) customData() interface{} {
+	if m.rawData != nil {
+		return m.rawData
+	}
+	return m.Data
+}
+
+func (m *Message) serialize() (out []byte, err error) {
+	e := encoderPool.Get().(*messageEncoder)
+	defer func() {
+		if cap(e.buf) <= maxPooledBufferSize {
+			encoderPool.Put(e)
+		}
+	}()
+	e.buf = e.buf[:0]
+	e.enc.ResetBytes(&e.buf)
+
+	if m.rawData != nil {
+		err = e.enc.Encode(&rawMessage{
+			Type:   m.Type,
+			Data:   m.rawData,
+			NodeID: m.NodeID,
+		})
+	} else {
+		err = e.enc.Encode(m)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if m.compressed {
+		return compress(e.buf)
+	}
+	out = make([]byte, len(e.buf))
+	copy(out, e.buf)
+	return out, nil
+}
+
+// compress compresses raw by zlib. The compressed messages begin with the zlib header 0x78, while the serialized
+// messages begin with 0x93, the header of a msgpack array of 3, so they are told apart by newMessageFromBytes.
+func compress(raw []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zlibWriterPool.Get().(*zlib.Writer)
+	defer zlibWriterPool.Put(w)
+	w.Reset(&buf)
+	if _, err := w.Write(raw); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func newMessageFromBytes(raw []byte) (newMsg *Message, err error) {
+	if len(raw) > 0 && raw[0] == 0x78 {
+		r, err := zlib.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, err
+		}
+		raw, err = ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
 	dec := codec.NewDecoderBytes(raw, &mh)
-	newMsg = &message{}
-	err = dec.Decode(newMsg)
+	decoded := &rawMessage{}
+	err = dec.Decode(decoded)
+	newMsg = newCustomMessage(decoded.Type, decoded.Data, decoded.NodeID)
 	return newMsg, err
 }
+
+// The data decoded from msgpack has loose types, the integers may be int64 or uint64, the strings may be []byte,
+// and the nested maps are map[interface{}]interface{}. The helpers below convert them to the types used by boomer.
+
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int:
+		return int64(n)
+	case int32:
+		return int64(n)
+	case int64:
+		return n
+	case uint32:
+		return int64(n)
+	case uint64:
+		return int64(n)
+	case float64:
+		return int64(n)
+	}
+	return 0
+}
+
+func toString(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case []byte:
+		return string(s)
+	}
+	return ""
+}
+
+func toStringMap(v interface{}) map[string]interface{} {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m
+	case map[string]string:
+		result := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			result[k] = v
+		}
+		return result
+	case map[string]map[string]interface{}:
+		result := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			result[k] = v
+		}
+		return result
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			result[toString(k)] = v
+		}
+		return result
+	}
+	return nil
+}
+
+func toInt64Map(v interface{}) map[int64]int64 {
+	switch m := v.(type) {
+	case map[int64]int64:
+		return m
+	case map[interface{}]interface{}:
+		result := make(map[int64]int64, len(m))
+		for k, v := range m {
+			result[toInt64(k)] = toInt64(v)
+		}
+		return result
+	}
+	return nil
+}
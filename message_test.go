@@ -36,3 +36,51 @@ func TestEncodeAndDecode(t *testing.T) {
 		t.Error("message data mismatched.", msg.Data, decoded.Data)
 	}
 }
+
+func TestEncodeAndDecodeCompressed(t *testing.T) {
+	data := make(map[string]interface{})
+	data["a"] = 1
+	msg := newMessage("stats", data, "nodeID")
+	msg.compressed = true
+
+	encoded, err := msg.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encoded[0] != 0x78 {
+		t.Error("The message should be compressed by zlib, got header", encoded[0])
+	}
+	decoded, err := newMessageFromBytes(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Type != "stats" || decoded.NodeID != "nodeID" || decoded.Data["a"].(int64) != 1 {
+		t.Error("message mismatched.", decoded.Type, decoded.NodeID, decoded.Data)
+	}
+
+	// the buffers of the encoders are reused
+	msg.compressed = false
+	first, _ := msg.serialize()
+	second, _ := msg.serialize()
+	if string(first) != string(second) || &first[0] == &second[0] {
+		t.Error("Every serialized message should be a copy")
+	}
+}
+
+func TestNewCustomMessage(t *testing.T) {
+	msg := newCustomMessage("custom", []byte("data"), "nodeID")
+	if msg.Data != nil {
+		t.Error("Data should be nil if the custom data is not a map")
+	}
+	if data, ok := msg.customData().([]byte); !ok || string(data) != "data" {
+		t.Error("custom data mismatched.", msg.customData())
+	}
+
+	msg = newCustomMessage("custom", map[string]interface{}{"a": 1}, "nodeID")
+	if msg.Data["a"] != 1 {
+		t.Error("Data should be the map of custom data.", msg.Data)
+	}
+	if data, ok := msg.customData().(map[string]interface{}); !ok || data["a"] != 1 {
+		t.Error("custom data mismatched.", msg.customData())
+	}
+}
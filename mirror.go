@@ -0,0 +1,62 @@
+package boomer
+
+import (
+	"sync/atomic"
+)
+
+// mirrorClient sends copies of the stats messages to a secondary master or aggregator, best-effort.
+// It never blocks the primary master, the messages are dropped if the secondary can't keep up,
+// and it keeps silent on connection errors, except for logging them.
+type mirrorClient struct {
+	host   string
+	port   int
+	client client
+
+	connected int32
+	closeChan chan bool
+}
+
+func newMirrorClient(host string, port int, identity string) *mirrorClient {
+	return &mirrorClient{
+		host:      host,
+		port:      port,
+		client:    newClient(host, port, identity),
+		closeChan: make(chan bool),
+	}
+}
+
+// connect is called in a separate goroutine, so a slow or unreachable secondary doesn't delay the primary.
+func (m *mirrorClient) connect() {
+	if err := m.client.connect(); err != nil {
+		logError("Failed to connect to secondary master(%s:%d) with error %v, no stats will be mirrored to it.", m.host, m.port, err)
+		return
+	}
+	atomic.StoreInt32(&m.connected, 1)
+
+	// the secondary doesn't control the test, discard the messages from it
+	for {
+		select {
+		case <-m.client.recvChannel():
+		case <-m.closeChan:
+			atomic.StoreInt32(&m.connected, 0)
+			m.client.close()
+			return
+		}
+	}
+}
+
+func (m *mirrorClient) send(msg *Message) {
+	if atomic.LoadInt32(&m.connected) == 0 {
+		return
+	}
+	select {
+	case m.client.sendChannel() <- msg:
+	default:
+		logDebug("The send channel of secondary master(%s:%d) is full, a %s message is dropped", m.host, m.port, msg.Type)
+	}
+}
+
+// close makes the connecting goroutine close the connection, once it's connected.
+func (m *mirrorClient) close() {
+	close(m.closeChan)
+}
@@ -0,0 +1,144 @@
+// Package oteloutput exports the requests recorded by boomer as OpenTelemetry metrics, and optionally creates
+// a span for every iteration of a task, so the latency seen by boomer can be correlated with the traces
+// of the system under test in Jaeger or Tempo.
+//
+//	output, err := oteloutput.NewOTLPOutput(context.Background(), "localhost:4317", true)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	globalBoomer.AddRawSampleOutput(output)
+//	globalBoomer.Run(oteloutput.TraceTask(task, otel.Tracer("boomer")))
+//
+// The metrics are "boomer.requests", "boomer.failures" and "boomer.request.duration", a histogram in milliseconds,
+// with the attributes "request_type", "name" and "success".
+package oteloutput
+
+import (
+	"context"
+	"time"
+
+	"github.com/myzhan/boomer"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/myzhan/boomer"
+
+// exportInterval is how often the metrics are exported by NewOTLPOutput.
+const exportInterval = 10 * time.Second
+
+// Output records every request to the OpenTelemetry instruments, it's a boomer.RawSampleOutput,
+// add it by Boomer.AddRawSampleOutput.
+type Output struct {
+	requests metric.Int64Counter
+	failures metric.Int64Counter
+	duration metric.Float64Histogram
+
+	// shutdown flushes and shuts down the MeterProvider created by NewOTLPOutput, it's nil otherwise.
+	shutdown func(ctx context.Context) error
+}
+
+// NewOutput returns an Output, which records to the meters of provider. The provider is owned by the caller,
+// which should shut it down to flush the metrics.
+func NewOutput(provider metric.MeterProvider) (*Output, error) {
+	meter := provider.Meter(instrumentationName)
+	requests, err := meter.Int64Counter("boomer.requests",
+		metric.WithDescription("The number of requests, including the failures."))
+	if err != nil {
+		return nil, err
+	}
+	failures, err := meter.Int64Counter("boomer.failures",
+		metric.WithDescription("The number of failed requests."))
+	if err != nil {
+		return nil, err
+	}
+	duration, err := meter.Float64Histogram("boomer.request.duration",
+		metric.WithDescription("The response time of the requests."),
+		metric.WithUnit("ms"))
+	if err != nil {
+		return nil, err
+	}
+	return &Output{
+		requests: requests,
+		failures: failures,
+		duration: duration,
+	}, nil
+}
+
+// NewOTLPOutput returns an Output, which exports the metrics to an OTLP endpoint over gRPC, like "localhost:4317",
+// every 10 seconds. The metrics are flushed when the test is stopped.
+func NewOTLPOutput(ctx context.Context, endpoint string, insecure bool) (*Output, error) {
+	options := []otlpmetricgrpc.Option{otlpmetricgrpc.WithEndpoint(endpoint)}
+	if insecure {
+		options = append(options, otlpmetricgrpc.WithInsecure())
+	}
+	exporter, err := otlpmetricgrpc.New(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(exportInterval))),
+	)
+	o, err := NewOutput(provider)
+	if err != nil {
+		provider.Shutdown(ctx)
+		return nil, err
+	}
+	o.shutdown = provider.Shutdown
+	return o, nil
+}
+
+// OnStart of Output has nothing to do.
+func (o *Output) OnStart() {
+
+}
+
+// OnSample records a request.
+func (o *Output) OnSample(sample *boomer.RawSample) {
+	ctx := context.Background()
+	attributes := metric.WithAttributes(
+		attribute.String("request_type", sample.RequestType),
+		attribute.String("name", sample.Name),
+		attribute.Bool("success", sample.Success),
+	)
+	o.requests.Add(ctx, 1, attributes)
+	if !sample.Success {
+		o.failures.Add(ctx, 1, attributes)
+	}
+	o.duration.Record(ctx, float64(sample.ResponseTime), attributes)
+}
+
+// OnStop shuts down the MeterProvider created by NewOTLPOutput, which flushes the metrics.
+func (o *Output) OnStop() {
+	if o.shutdown == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	o.shutdown(ctx)
+	o.shutdown = nil
+}
+
+// TraceTask returns a copy of task, which runs every iteration in a span named after the task, started by tracer.
+// The context passed to the task carries the span, so the requests made with it, e.g. by an instrumented HTTP client,
+// are traced as its children. The User of the goroutine is still available by boomer.UserFromContext.
+func TraceTask(task *boomer.Task, tracer trace.Tracer) *boomer.Task {
+	traced := *task
+	traced.FnWithUser = nil
+	traced.FnWithContext = func(ctx context.Context) {
+		ctx, span := tracer.Start(ctx, task.Name)
+		defer span.End()
+		switch {
+		case task.FnWithUser != nil:
+			task.FnWithUser(ctx, boomer.UserFromContext(ctx))
+		case task.FnWithContext != nil:
+			task.FnWithContext(ctx)
+		default:
+			task.Fn()
+		}
+	}
+	return &traced
+}
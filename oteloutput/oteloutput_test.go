@@ -0,0 +1,155 @@
+package oteloutput
+
+import (
+	"context"
+	"testing"
+
+	"github.com/myzhan/boomer"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type fakeMeterProvider struct {
+	metric.MeterProvider
+	meter *fakeMeter
+}
+
+func (p *fakeMeterProvider) Meter(name string, opts ...metric.MeterOption) metric.Meter {
+	return p.meter
+}
+
+type fakeMeter struct {
+	metric.Meter
+	counters   map[string]*fakeCounter
+	histograms map[string]*fakeHistogram
+}
+
+func newFakeMeterProvider() *fakeMeterProvider {
+	return &fakeMeterProvider{
+		meter: &fakeMeter{
+			counters:   make(map[string]*fakeCounter),
+			histograms: make(map[string]*fakeHistogram),
+		},
+	}
+}
+
+func (m *fakeMeter) Int64Counter(name string, options ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	counter := &fakeCounter{}
+	m.counters[name] = counter
+	return counter, nil
+}
+
+func (m *fakeMeter) Float64Histogram(name string, options ...metric.Float64HistogramOption) (metric.Float64Histogram, error) {
+	histogram := &fakeHistogram{}
+	m.histograms[name] = histogram
+	return histogram, nil
+}
+
+type fakeCounter struct {
+	metric.Int64Counter
+	value int64
+}
+
+func (c *fakeCounter) Add(ctx context.Context, incr int64, options ...metric.AddOption) {
+	c.value += incr
+}
+
+type fakeHistogram struct {
+	metric.Float64Histogram
+	values []float64
+}
+
+func (h *fakeHistogram) Record(ctx context.Context, value float64, options ...metric.RecordOption) {
+	h.values = append(h.values, value)
+}
+
+type fakeTracer struct {
+	trace.Tracer
+	spans []*fakeSpan
+}
+
+type spanContextKey struct{}
+
+func (t *fakeTracer) Start(ctx context.Context, spanName string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	span := &fakeSpan{name: spanName}
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, spanContextKey{}, span), span
+}
+
+type fakeSpan struct {
+	trace.Span
+	name  string
+	ended bool
+}
+
+func (s *fakeSpan) End(options ...trace.SpanEndOption) {
+	s.ended = true
+}
+
+func TestOutput(t *testing.T) {
+	provider := newFakeMeterProvider()
+	o, err := NewOutput(provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.OnStart()
+	o.OnSample(&boomer.RawSample{RequestType: "http", Name: "foo", ResponseTime: 10, Success: true})
+	o.OnSample(&boomer.RawSample{RequestType: "http", Name: "foo", ResponseTime: 30, Error: "500 error"})
+	o.OnStop()
+
+	meter := provider.meter
+	if meter.counters["boomer.requests"].value != 2 {
+		t.Error("There should be 2 requests, got", meter.counters["boomer.requests"].value)
+	}
+	if meter.counters["boomer.failures"].value != 1 {
+		t.Error("There should be 1 failure, got", meter.counters["boomer.failures"].value)
+	}
+	durations := meter.histograms["boomer.request.duration"].values
+	if len(durations) != 2 || durations[0] != 10 || durations[1] != 30 {
+		t.Error("The response times should be recorded, got", durations)
+	}
+}
+
+func TestTraceTask(t *testing.T) {
+	tracer := &fakeTracer{}
+	var user *boomer.User
+	var span *fakeSpan
+	task := &boomer.Task{
+		Name:   "foo",
+		Weight: 10,
+		FnWithUser: func(ctx context.Context, u *boomer.User) {
+			user = u
+			span, _ = ctx.Value(spanContextKey{}).(*fakeSpan)
+		},
+	}
+
+	traced := TraceTask(task, tracer)
+	if traced.Name != "foo" || traced.Weight != 10 || traced.FnWithUser != nil || traced.FnWithContext == nil {
+		t.Fatal("The traced task should be a copy of the task, which runs in a span")
+	}
+	expected := &boomer.User{Index: 1}
+	traced.FnWithContext(boomer.ContextWithUser(context.Background(), expected))
+
+	if user != expected {
+		t.Error("The user should be passed to the task")
+	}
+	if len(tracer.spans) != 1 || tracer.spans[0].name != "foo" || !tracer.spans[0].ended {
+		t.Fatal("An iteration should be run in an ended span named after the task")
+	}
+	if span != tracer.spans[0] {
+		t.Error("The context passed to the task should carry the span")
+	}
+	if task.FnWithUser == nil {
+		t.Error("The task shouldn't be changed")
+	}
+}
+
+func TestTraceTaskWithFn(t *testing.T) {
+	tracer := &fakeTracer{}
+	called := false
+	traced := TraceTask(&boomer.Task{Name: "bar", Fn: func() { called = true }}, tracer)
+	traced.FnWithContext(context.Background())
+	if !called || len(tracer.spans) != 1 {
+		t.Error("Fn should be called in a span")
+	}
+}
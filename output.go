@@ -1,6 +1,7 @@
 package boomer
 
 import (
+	"encoding/csv"
 	"fmt"
 	"os"
 	"sort"
@@ -17,18 +18,45 @@ import (
 // an output.
 // All the OnXXX function will be call in a separated goroutine, just in case some output will block.
 // But it will wait for all outputs return to avoid data lost.
+// OutputV2 receives the same data as typed structs, see AdaptOutput.
 type Output interface {
 	// OnStart will be call before the test starts.
 	OnStart()
 
 	// By default, each output receive stats data from runner every three seconds.
 	// OnEvent is responsible for dealing with the data.
+	// Each entry of data["stats"] and data["stats_total"] has "response_time_percentiles",
+	// a map[float64]int64 of the 50%, 90%, 95% and 99% response times in the interval, in milliseconds.
+	// The runners add "user_count", "current_cpu_usage" in percent of all the CPUs, and "current_memory_usage",
+	// the resident set size of boomer in bytes.
+	// data["labeled_stats"] breaks down the interval's requests which have labels, by request type, name and
+	// labels, each entry has the same keys as the entries of data["stats"], plus "labels", a map[string]string.
+	// It's not reported to the master, so the labels don't increase the cardinality of the master's stats.
+	// data["warmup"] is true if the interval is in the warm-up period set by Boomer.SetWarmupDuration,
+	// outputs which aggregate the stats since the test starts should skip it.
 	OnEvent(data map[string]interface{})
 
 	// OnStop will be called before the test ends.
 	OnStop()
 }
 
+// OutputInitializer can be implemented by an Output or a RawSampleOutput which may fail to start,
+// like failing to open a file or to bind a port.
+// Init is called when boomer runs, before connecting to the master or spawning any goroutine.
+// If Init returns an error, the output is dropped with an error logged, or boomer exits
+// if strict outputs are enabled by Boomer.SetStrictOutputs.
+type OutputInitializer interface {
+	Init() error
+}
+
+// initOutput calls Init if o implements OutputInitializer.
+func initOutput(o interface{}) error {
+	if initializer, ok := o.(OutputInitializer); ok {
+		return initializer.Init()
+	}
+	return nil
+}
+
 // ConsoleOutput is the default output for standalone mode.
 type ConsoleOutput struct {
 }
@@ -60,6 +88,28 @@ func getMedianResponseTime(numRequests int64, responseTimes map[int64]int64) int
 	return medianResponseTime
 }
 
+// getPercentileResponseTime returns the response time at the percent, like 0.95, of the rounded response times.
+func getPercentileResponseTime(numRequests int64, responseTimes map[int64]int64, percent float64) int64 {
+	if numRequests == 0 || len(responseTimes) == 0 {
+		return 0
+	}
+	pos := int64(float64(numRequests-1) * percent)
+	sortedKeys := make([]int64, 0, len(responseTimes))
+	for k := range responseTimes {
+		sortedKeys = append(sortedKeys, k)
+	}
+	sort.Slice(sortedKeys, func(i, j int) bool {
+		return sortedKeys[i] < sortedKeys[j]
+	})
+	for _, k := range sortedKeys {
+		if pos < responseTimes[k] {
+			return k
+		}
+		pos -= responseTimes[k]
+	}
+	return sortedKeys[len(sortedKeys)-1]
+}
+
 func getAvgResponseTime(numRequests int64, totalResponseTime int64) (avgResponseTime float64) {
 	avgResponseTime = float64(0)
 	if numRequests != 0 {
@@ -103,13 +153,17 @@ func (o *ConsoleOutput) OnEvent(data map[string]interface{}) {
 	}
 
 	currentTime := time.Now()
-	println(fmt.Sprintf("Current time: %s", currentTime.Format("2006/01/02 15:04:05")))
+	if warmup, _ := data["warmup"].(bool); warmup {
+		println(fmt.Sprintf("Current time: %s (warm-up)", currentTime.Format("2006/01/02 15:04:05")))
+	} else {
+		println(fmt.Sprintf("Current time: %s", currentTime.Format("2006/01/02 15:04:05")))
+	}
 	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Type", "Name", "# requests", "# fails", "Median", "Average", "Min", "Max", "Content Size", "# reqs/sec"})
+	table.SetHeader([]string{"Type", "Name", "# requests", "# fails", "Median", "90%", "99%", "Average", "Min", "Max", "Content Size", "# reqs/sec"})
 
 	for _, stat := range stats {
 		s := stat.(map[string]interface{})
-		row := make([]string, 10)
+		row := make([]string, 12)
 		row[0], row[1] = s["name"].(string), s["method"].(string)
 
 		numRequests := s["num_requests"].(int64)
@@ -121,26 +175,132 @@ func (o *ConsoleOutput) OnEvent(data map[string]interface{}) {
 		medianResponseTime := getMedianResponseTime(numRequests, s["response_times"].(map[int64]int64))
 		row[4] = strconv.FormatInt(medianResponseTime, 10)
 
+		percentiles, _ := s["response_time_percentiles"].(map[float64]int64)
+		row[5] = strconv.FormatInt(percentiles[0.9], 10)
+		row[6] = strconv.FormatInt(percentiles[0.99], 10)
+
 		totalResponseTime := s["total_response_time"].(int64)
 		avgResponseTime := getAvgResponseTime(numRequests, totalResponseTime)
-		row[5] = strconv.FormatFloat(avgResponseTime, 'f', 2, 64)
+		row[7] = strconv.FormatFloat(avgResponseTime, 'f', 2, 64)
 
 		minResponseTime := s["min_response_time"].(int64)
-		row[6] = strconv.FormatInt(minResponseTime, 10)
+		row[8] = strconv.FormatInt(minResponseTime, 10)
 
 		maxResponseTime := s["max_response_time"].(int64)
-		row[7] = strconv.FormatInt(maxResponseTime, 10)
+		row[9] = strconv.FormatInt(maxResponseTime, 10)
 
 		totalContentLength := s["total_content_length"].(int64)
 		avgContentLength := getAvgContentLength(numRequests, totalContentLength)
-		row[8] = strconv.FormatInt(avgContentLength, 10)
+		row[10] = strconv.FormatInt(avgContentLength, 10)
 
 		numReqsPerSecond := s["num_reqs_per_sec"].(map[int64]int64)
 		currentRps := getCurrentRps(numRequests, numReqsPerSecond)
-		row[9] = strconv.FormatInt(currentRps, 10)
+		row[11] = strconv.FormatInt(currentRps, 10)
 
 		table.Append(row)
 	}
 	table.Render()
 	println()
 }
+
+// RawSample is a single request reported by RecordSuccess or RecordFailure.
+type RawSample struct {
+	// Timestamp is when the request started, in milliseconds.
+	// It's calculated as the time the request is recorded minus its response time.
+	Timestamp      int64
+	RequestType    string
+	Name           string
+	ResponseTime   int64
+	ResponseLength int64
+	Success        bool
+	// Error is the exception of a failure, empty for a success.
+	Error string
+	// ErrorCategory is the category of a failure recorded by RecordError, empty for the others.
+	ErrorCategory ErrorCategory
+	// Labels are passed to RecordSuccessWithLabels or RecordFailureWithLabels, nil for the other requests.
+	Labels map[string]string
+}
+
+// RawSampleOutput receives every single request, instead of the aggregated stats received by Output.
+// It's useful for deep analysis after the test, like building latency-over-time heatmaps.
+//
+// WARNING: OnSample is called synchronously in the goroutine which aggregates stats, once per request.
+// A slow RawSampleOutput slows down the stats collecting, and blocks RecordSuccess and RecordFailure
+// at last. Keep OnSample fast, like buffering in memory, and expect extra overhead at high RPS.
+type RawSampleOutput interface {
+	// OnStart will be called before the test starts.
+	OnStart()
+
+	// OnSample is called for each request. Don't keep the sample, it may be reused.
+	OnSample(sample *RawSample)
+
+	// OnStop will be called after the last request is sampled.
+	OnStop()
+}
+
+// RawSampleFileOutput writes raw samples to a CSV file, with a header like
+// timestamp,request_type,name,response_time,response_length,success,error
+type RawSampleFileOutput struct {
+	path   string
+	file   *os.File
+	writer *csv.Writer
+}
+
+// NewRawSampleFileOutput returns a RawSampleFileOutput, which writes to the file of path.
+// The file is truncated if it exists.
+func NewRawSampleFileOutput(path string) *RawSampleFileOutput {
+	return &RawSampleFileOutput{
+		path: path,
+	}
+}
+
+// Init creates the file and writes the header, it returns an error if the file can't be created.
+func (o *RawSampleFileOutput) Init() error {
+	file, err := os.Create(o.path)
+	if err != nil {
+		return fmt.Errorf("failed to create raw sample file %s, %v", o.path, err)
+	}
+	o.file = file
+	o.writer = csv.NewWriter(file)
+	o.writer.Write([]string{"timestamp", "request_type", "name", "response_time", "response_length", "success", "error"})
+	return nil
+}
+
+// OnStart creates the file and writes the header, if they are not done by Init.
+func (o *RawSampleFileOutput) OnStart() {
+	if o.writer != nil {
+		return
+	}
+	if err := o.Init(); err != nil {
+		logError("%v", err)
+	}
+}
+
+// OnSample writes a sample as a line, it's buffered.
+func (o *RawSampleFileOutput) OnSample(sample *RawSample) {
+	if o.writer == nil {
+		return
+	}
+	o.writer.Write([]string{
+		strconv.FormatInt(sample.Timestamp, 10),
+		sample.RequestType,
+		sample.Name,
+		strconv.FormatInt(sample.ResponseTime, 10),
+		strconv.FormatInt(sample.ResponseLength, 10),
+		strconv.FormatBool(sample.Success),
+		sample.Error,
+	})
+}
+
+// OnStop flushes the buffer and closes the file.
+func (o *RawSampleFileOutput) OnStop() {
+	if o.writer == nil {
+		return
+	}
+	o.writer.Flush()
+	if err := o.writer.Error(); err != nil {
+		logError("Failed to write raw sample file %s, %v", o.path, err)
+	}
+	o.file.Close()
+	o.writer = nil
+}
@@ -1,7 +1,11 @@
 package boomer
 
 import (
+	"io/ioutil"
 	"math"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -26,6 +30,28 @@ func TestGetMedianResponseTime(t *testing.T) {
 	}
 }
 
+func TestGetPercentileResponseTime(t *testing.T) {
+	numRequests := int64(10)
+	responseTimes := map[int64]int64{
+		100: 1,
+		200: 3,
+		300: 6,
+	}
+
+	if p := getPercentileResponseTime(numRequests, responseTimes, 0.5); p != 300 {
+		t.Error("50% percentile should be 300, got", p)
+	}
+	if p := getPercentileResponseTime(numRequests, responseTimes, 0.2); p != 200 {
+		t.Error("20% percentile should be 200, got", p)
+	}
+	if p := getPercentileResponseTime(numRequests, responseTimes, 0); p != 100 {
+		t.Error("0% percentile should be 100, got", p)
+	}
+	if p := getPercentileResponseTime(numRequests, map[int64]int64{}, 0.5); p != 0 {
+		t.Error("percentile of empty response times should be 0, got", p)
+	}
+}
+
 func TestGetAvgResponseTime(t *testing.T) {
 	numRequests := int64(3)
 	totalResponseTime := int64(100)
@@ -106,3 +132,47 @@ func TestConsoleOutput(t *testing.T) {
 
 	o.OnStop()
 }
+
+func TestRawSampleFileOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boomer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "samples.csv")
+
+	o := NewRawSampleFileOutput(path)
+	o.OnStart()
+	o.OnSample(&RawSample{
+		Timestamp:      1000,
+		RequestType:    "http",
+		Name:           "foo",
+		ResponseTime:   10,
+		ResponseLength: 20,
+		Success:        true,
+	})
+	o.OnSample(&RawSample{
+		Timestamp:    1001,
+		RequestType:  "udp",
+		Name:         "bar",
+		ResponseTime: 1,
+		Success:      false,
+		Error:        "udp error",
+	})
+	o.OnStop()
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 3 {
+		t.Fatal("Expected 3 lines, got", len(lines))
+	}
+	if lines[1] != "1000,http,foo,10,20,true," {
+		t.Error("Unexpected line of success:", lines[1])
+	}
+	if lines[2] != "1001,udp,bar,1,0,false,udp error" {
+		t.Error("Unexpected line of failure:", lines[2])
+	}
+}
@@ -0,0 +1,334 @@
+package boomer
+
+import (
+	"sort"
+	"time"
+)
+
+// OutputV2 receives typed structs instead of the map[string]interface{} received by Output, so the data is documented
+// and checked by the compiler. Add it to boomer with AdaptOutput, which converts the data for it.
+// The lifecycle of a test is OnStart, OnInterval for every report interval, then OnFinal and OnStop when the test
+// is stopped. Subscribe to the hooks of the Boomer, see Boomer.Hooks, for the other lifecycle events, like the state changes.
+// Like Output, the methods are called in a separated goroutine, but not concurrently.
+type OutputV2 interface {
+	// OnStart is called before the test starts.
+	OnStart()
+
+	// OnInterval is called with the stats of every report interval.
+	OnInterval(stats *IntervalStats)
+
+	// OnFinal is called with the aggregates of the whole test, when the test is stopped, before OnStop.
+	OnFinal(stats *FinalStats)
+
+	// OnStop is called before the test ends.
+	OnStop()
+}
+
+// RequestStats is the stats of the requests of a request type and name in an interval,
+// or of all the requests as the total, whose Method is empty and Name is "Total".
+type RequestStats struct {
+	Method             string
+	Name               string
+	NumRequests        int64
+	NumFailures        int64
+	TotalResponseTime  int64
+	MinResponseTime    int64
+	MaxResponseTime    int64
+	TotalContentLength int64
+	MinContentLength   int64
+	MaxContentLength   int64
+	// ResponseTimes counts the requests by the rounded response time, in milliseconds.
+	ResponseTimes map[int64]int64
+	// Percentiles are the 50%, 90%, 95% and 99% response times, like 0.95, in milliseconds.
+	Percentiles map[float64]int64
+	// Labels are the labels of the requests in IntervalStats.LabeledStats, nil for the others.
+	Labels map[string]string
+}
+
+// AvgResponseTime returns the average response time, in milliseconds.
+func (s *RequestStats) AvgResponseTime() float64 {
+	return getAvgResponseTime(s.NumRequests, s.TotalResponseTime)
+}
+
+// RequestError is an error of the requests of a request type and name.
+type RequestError struct {
+	Method      string
+	Name        string
+	Error       string
+	Occurrences int64
+	// Category is the category of the errors recorded by RecordError, empty for the others.
+	Category ErrorCategory
+	// Exemplars are the raw errors sampled from the occurrences, if the errors are normalized
+	// by Boomer.SetErrorExemplars, Error is the normalized error then.
+	Exemplars []*ErrorExemplar
+	// Stack is the stack trace of a panic recovered by boomer, whose Category is ErrorPanic, empty for the others.
+	Stack string
+}
+
+// ErrorExemplar is a raw error sampled from the occurrences of a normalized error.
+type ErrorExemplar struct {
+	Error string
+	// Timestamp is when the error is recorded, in milliseconds.
+	Timestamp int64
+}
+
+// IntervalStats is the data of a report interval.
+type IntervalStats struct {
+	// Time is when the data is received.
+	Time time.Time
+	// UserCount is the number of running goroutines.
+	UserCount int64
+	// CPUUsage is the CPU usage of boomer in percent of all the CPUs.
+	CPUUsage float64
+	// MemoryUsage is the resident set size of boomer in bytes.
+	MemoryUsage int64
+	// Warmup is true if the interval is in the warm-up period set by Boomer.SetWarmupDuration.
+	Warmup bool
+	// NumRetries is the number of retries made by Retry in the interval.
+	NumRetries int64
+	// NumDroppedRecords is the number of the records dropped in the interval, because the stats can't keep up with them.
+	NumDroppedRecords int64
+	// Stats are sorted by name and method.
+	Stats []*RequestStats
+	Total *RequestStats
+	// LabeledStats break down the requests which have labels, by request type, name and labels.
+	LabeledStats []*RequestStats
+	// Errors are sorted by the occurrences, the most frequent first.
+	Errors []*RequestError
+	// SLOs are the statuses of the SLOs added by Boomer.AddSLO, in the order they're added.
+	SLOs []*SLOStatus
+	// RunID and RunLabels are the metadata of the test run set by Boomer.SetRunID and Boomer.SetRunLabels.
+	RunID     string
+	RunLabels map[string]string
+}
+
+// RequestSummary is the aggregates of the requests of a request type and name in the whole test,
+// or of all the requests as the total, whose Method is empty and Name is "Total".
+type RequestSummary struct {
+	Method           string
+	Name             string
+	NumRequests      int64
+	NumFailures      int64
+	RPS              float64
+	AvgResponseTime  float64
+	MinResponseTime  int64
+	MaxResponseTime  int64
+	P50              int64
+	P90              int64
+	P95              int64
+	P99              int64
+	AvgContentLength int64
+	MinContentLength int64
+	MaxContentLength int64
+}
+
+// FinalStats is the aggregates of the whole test, the intervals in the warm-up period are excluded.
+type FinalStats struct {
+	StartTime time.Time
+	EndTime   time.Time
+	// Stats are sorted by name and method.
+	Stats []*RequestSummary
+	Total *RequestSummary
+	// Errors are sorted by the occurrences, the most frequent first.
+	Errors []*RequestError
+}
+
+// ParseIntervalStats converts the data received by Output.OnEvent to IntervalStats,
+// so an Output can be migrated bit by bit.
+func ParseIntervalStats(data map[string]interface{}) *IntervalStats {
+	stats := &IntervalStats{
+		Time:              time.Now(),
+		UserCount:         toInt64(data["user_count"]),
+		MemoryUsage:       toInt64(data["current_memory_usage"]),
+		NumRetries:        toInt64(data["num_retries"]),
+		NumDroppedRecords: toInt64(data["num_dropped_records"]),
+	}
+	stats.CPUUsage, _ = data["current_cpu_usage"].(float64)
+	stats.Warmup, _ = data["warmup"].(bool)
+	stats.RunID = toString(data["run_id"])
+	if labels := toStringMap(data["run_labels"]); len(labels) > 0 {
+		stats.RunLabels = make(map[string]string, len(labels))
+		for k, v := range labels {
+			stats.RunLabels[k] = toString(v)
+		}
+	}
+
+	for _, entry := range toSlice(data["stats"]) {
+		stats.Stats = append(stats.Stats, parseRequestStats(toStringMap(entry)))
+	}
+	sort.Slice(stats.Stats, func(i, j int) bool {
+		if stats.Stats[i].Name == stats.Stats[j].Name {
+			return stats.Stats[i].Method < stats.Stats[j].Method
+		}
+		return stats.Stats[i].Name < stats.Stats[j].Name
+	})
+	if total := toStringMap(data["stats_total"]); total != nil {
+		stats.Total = parseRequestStats(total)
+	}
+	for _, entry := range toSlice(data["labeled_stats"]) {
+		stats.LabeledStats = append(stats.LabeledStats, parseRequestStats(toStringMap(entry)))
+	}
+
+	for _, e := range toStringMap(data["errors"]) {
+		m := toStringMap(e)
+		requestError := &RequestError{
+			Method:      toString(m["method"]),
+			Name:        toString(m["name"]),
+			Error:       toString(m["error"]),
+			Occurrences: toInt64(m["occurrences"]),
+			Category:    ErrorCategory(toString(m["category"])),
+			Stack:       toString(m["stack"]),
+		}
+		for _, exemplar := range toSlice(m["exemplars"]) {
+			e := toStringMap(exemplar)
+			requestError.Exemplars = append(requestError.Exemplars, &ErrorExemplar{
+				Error:     toString(e["error"]),
+				Timestamp: toInt64(e["timestamp"]),
+			})
+		}
+		stats.Errors = append(stats.Errors, requestError)
+	}
+	sort.Slice(stats.Errors, func(i, j int) bool {
+		return stats.Errors[i].Occurrences > stats.Errors[j].Occurrences
+	})
+
+	for _, s := range toSlice(data["slos"]) {
+		m := toStringMap(s)
+		status := &SLOStatus{
+			SLO: SLO{
+				Name:        toString(m["name"]),
+				Metric:      SLOMetric(toString(m["metric"])),
+				MinRequests: toInt64(m["min_requests"]),
+			},
+			Intervals:  toInt64(m["intervals"]),
+			Violations: toInt64(m["violations"]),
+		}
+		status.SLO.Threshold, _ = m["threshold"].(float64)
+		status.Value, _ = m["value"].(float64)
+		status.Passed, _ = m["passed"].(bool)
+		stats.SLOs = append(stats.SLOs, status)
+	}
+	return stats
+}
+
+func parseRequestStats(m map[string]interface{}) *RequestStats {
+	s := &RequestStats{
+		Method:             toString(m["method"]),
+		Name:               toString(m["name"]),
+		NumRequests:        toInt64(m["num_requests"]),
+		NumFailures:        toInt64(m["num_failures"]),
+		TotalResponseTime:  toInt64(m["total_response_time"]),
+		MinResponseTime:    toInt64(m["min_response_time"]),
+		MaxResponseTime:    toInt64(m["max_response_time"]),
+		TotalContentLength: toInt64(m["total_content_length"]),
+		MinContentLength:   toInt64(m["min_content_length"]),
+		MaxContentLength:   toInt64(m["max_content_length"]),
+		ResponseTimes:      toInt64Map(m["response_times"]),
+	}
+	s.Percentiles, _ = m["response_time_percentiles"].(map[float64]int64)
+	s.Labels, _ = m["labels"].(map[string]string)
+	return s
+}
+
+func toSlice(v interface{}) []interface{} {
+	s, _ := v.([]interface{})
+	return s
+}
+
+func newRequestSummary(e *finalReportEntry) *RequestSummary {
+	return &RequestSummary{
+		Method:           e.Method,
+		Name:             e.Name,
+		NumRequests:      e.NumRequests,
+		NumFailures:      e.NumFailures,
+		RPS:              e.RPS,
+		AvgResponseTime:  e.AvgResponseTime,
+		MinResponseTime:  e.MinResponseTime,
+		MaxResponseTime:  e.MaxResponseTime,
+		P50:              e.P50,
+		P90:              e.P90,
+		P95:              e.P95,
+		P99:              e.P99,
+		AvgContentLength: e.AvgContentLength,
+		MinContentLength: e.MinContentLength,
+		MaxContentLength: e.MaxContentLength,
+	}
+}
+
+// statsIntervalOutput is an Output, which calls the function with the stats of every interval, see Boomer.OnStatsInterval.
+type statsIntervalOutput func(stats *IntervalStats)
+
+func (o statsIntervalOutput) OnStart() {}
+
+func (o statsIntervalOutput) OnEvent(data map[string]interface{}) {
+	o(ParseIntervalStats(data))
+}
+
+func (o statsIntervalOutput) OnStop() {}
+
+// outputV2Adapter is an Output, which converts the data for an OutputV2.
+type outputV2Adapter struct {
+	output OutputV2
+	stats  *lifetimeStats
+}
+
+// AdaptOutput returns an Output, which converts the data received by it to the typed structs of o,
+// and aggregates the intervals for OnFinal. If o implements OutputInitializer, so does the Output.
+//
+//	globalBoomer.AddOutput(boomer.AdaptOutput(myOutput))
+func AdaptOutput(o OutputV2) Output {
+	adapter := &outputV2Adapter{
+		output: o,
+		stats:  newLifetimeStats(),
+	}
+	if _, ok := o.(OutputInitializer); ok {
+		return &initializingOutputV2Adapter{adapter}
+	}
+	return adapter
+}
+
+// OnStart starts over the aggregates, and calls OnStart of the OutputV2.
+func (a *outputV2Adapter) OnStart() {
+	a.stats = newLifetimeStats()
+	a.output.OnStart()
+}
+
+// OnEvent converts data for OnInterval of the OutputV2.
+func (a *outputV2Adapter) OnEvent(data map[string]interface{}) {
+	a.stats.add(data)
+	a.output.OnInterval(ParseIntervalStats(data))
+}
+
+// OnStop calls OnFinal with the aggregates, then OnStop of the OutputV2.
+func (a *outputV2Adapter) OnStop() {
+	endTime := time.Now()
+	final := &FinalStats{
+		StartTime: a.stats.startTime,
+		EndTime:   endTime,
+	}
+	for _, entry := range a.stats.summarize(endTime) {
+		final.Stats = append(final.Stats, newRequestSummary(entry))
+	}
+	final.Total = newRequestSummary(a.stats.total)
+	for _, e := range a.stats.sortedErrors() {
+		final.Errors = append(final.Errors, &RequestError{
+			Method:      e.Method,
+			Name:        e.Name,
+			Error:       e.Error,
+			Occurrences: e.Occurrences,
+			Category:    e.Category,
+			Stack:       e.Stack,
+		})
+	}
+	a.output.OnFinal(final)
+	a.output.OnStop()
+}
+
+// initializingOutputV2Adapter is an outputV2Adapter of an OutputV2 which implements OutputInitializer.
+type initializingOutputV2Adapter struct {
+	*outputV2Adapter
+}
+
+func (a *initializingOutputV2Adapter) Init() error {
+	return a.output.(OutputInitializer).Init()
+}
@@ -0,0 +1,183 @@
+package boomer
+
+import (
+	"errors"
+	"testing"
+)
+
+type recordingOutputV2 struct {
+	started   bool
+	stopped   bool
+	intervals []*IntervalStats
+	final     *FinalStats
+}
+
+func (o *recordingOutputV2) OnStart() {
+	o.started = true
+}
+
+func (o *recordingOutputV2) OnInterval(stats *IntervalStats) {
+	o.intervals = append(o.intervals, stats)
+}
+
+func (o *recordingOutputV2) OnFinal(stats *FinalStats) {
+	o.final = stats
+}
+
+func (o *recordingOutputV2) OnStop() {
+	o.stopped = true
+}
+
+type initializingOutputV2 struct {
+	recordingOutputV2
+}
+
+func (o *initializingOutputV2) Init() error {
+	return errors.New("address in use")
+}
+
+func TestParseIntervalStats(t *testing.T) {
+	collector := NewStatsCollector()
+	collector.RecordSuccess("http", "foo", 10, 100)
+	collector.RecordSuccess("http", "foo", 30, 100)
+	collector.RecordSuccess("http", "bar", 20, 100)
+	collector.RecordFailure("http", "foo", 40, "500 error")
+	collector.RecordSuccessWithLabels("http", "foo", map[string]string{"region": "us"}, 10, 100)
+	data := collector.Report()
+	data["user_count"] = int32(10)
+	data["current_cpu_usage"] = 12.5
+	data["current_memory_usage"] = uint64(1024)
+	data["num_dropped_records"] = int64(3)
+
+	stats := ParseIntervalStats(data)
+	if stats.UserCount != 10 || stats.CPUUsage != 12.5 || stats.MemoryUsage != 1024 {
+		t.Error("The usage is wrong, got", stats.UserCount, stats.CPUUsage, stats.MemoryUsage)
+	}
+	if stats.NumDroppedRecords != 3 {
+		t.Error("The dropped records should be parsed, got", stats.NumDroppedRecords)
+	}
+	if len(stats.Stats) != 2 || stats.Stats[0].Name != "bar" || stats.Stats[1].Name != "foo" {
+		t.Fatal("There should be 2 stats sorted by name, got", len(stats.Stats))
+	}
+	foo := stats.Stats[1]
+	if foo.Method != "http" || foo.NumRequests != 4 || foo.NumFailures != 1 || foo.MinResponseTime != 10 || foo.MaxResponseTime != 40 {
+		t.Error("The stats of foo are wrong, got", *foo)
+	}
+	if foo.AvgResponseTime() != 22.5 {
+		t.Error("The average response time of foo should be 22.5, got", foo.AvgResponseTime())
+	}
+	if foo.Percentiles[0.5] != 10 || foo.ResponseTimes[40] != 1 {
+		t.Error("The response times of foo are wrong, got", foo.Percentiles, foo.ResponseTimes)
+	}
+	if stats.Total == nil || stats.Total.NumRequests != 5 {
+		t.Error("The total should have 5 requests")
+	}
+	if len(stats.LabeledStats) != 1 || stats.LabeledStats[0].Labels["region"] != "us" {
+		t.Error("The labeled stats should be parsed")
+	}
+	if len(stats.Errors) != 1 || stats.Errors[0].Error != "500 error" || stats.Errors[0].Occurrences != 1 {
+		t.Error("The errors should be parsed, got", stats.Errors)
+	}
+}
+
+func TestParseErrorExemplars(t *testing.T) {
+	collector := NewStatsCollector()
+	collector.SetErrorExemplars(2)
+	collector.RecordFailure("http", "foo", 10, "order 1234 not found")
+	collector.RecordFailure("http", "foo", 10, "order 5678 not found")
+
+	stats := ParseIntervalStats(collector.Report())
+	if len(stats.Errors) != 1 || stats.Errors[0].Error != "order <n> not found" || stats.Errors[0].Occurrences != 2 {
+		t.Fatal("The errors should be grouped by the normalized error, got", stats.Errors)
+	}
+	exemplars := stats.Errors[0].Exemplars
+	if len(exemplars) != 2 || exemplars[0].Error != "order 1234 not found" || exemplars[1].Error != "order 5678 not found" {
+		t.Fatal("The raw errors should be parsed as the exemplars, got", exemplars)
+	}
+	if exemplars[0].Timestamp <= 0 {
+		t.Error("The exemplars should have the timestamps, got", exemplars[0].Timestamp)
+	}
+}
+
+func TestAdaptOutput(t *testing.T) {
+	o := &recordingOutputV2{}
+	adapter := AdaptOutput(o)
+	if _, ok := adapter.(OutputInitializer); ok {
+		t.Error("The adapter shouldn't implement OutputInitializer, if the OutputV2 doesn't")
+	}
+
+	adapter.OnStart()
+	collector := NewStatsCollector()
+	collector.RecordSuccess("http", "foo", 10, 100)
+	adapter.OnEvent(collector.Report())
+	collector.RecordFailure("http", "foo", 30, "500 error")
+	adapter.OnEvent(collector.Report())
+	adapter.OnStop()
+
+	if !o.started || !o.stopped {
+		t.Error("OnStart and OnStop should be called")
+	}
+	if len(o.intervals) != 2 {
+		t.Fatal("OnInterval should be called for every interval, got", len(o.intervals))
+	}
+	if o.final == nil || len(o.final.Stats) != 1 {
+		t.Fatal("OnFinal should be called with the aggregates")
+	}
+	if o.final.Stats[0].NumRequests != 2 || o.final.Stats[0].NumFailures != 1 || o.final.Total.NumRequests != 2 {
+		t.Error("The intervals should be aggregated, got", *o.final.Stats[0])
+	}
+	if o.final.Total.MaxResponseTime != 30 {
+		t.Error("The max response time should be 30, got", o.final.Total.MaxResponseTime)
+	}
+	if len(o.final.Errors) != 1 || o.final.Errors[0].Occurrences != 1 {
+		t.Error("The errors should be aggregated, got", o.final.Errors)
+	}
+}
+
+func TestAdaptOutputWithInit(t *testing.T) {
+	adapter := AdaptOutput(&initializingOutputV2{})
+	if err := initOutput(adapter); err == nil {
+		t.Error("Init of the OutputV2 should be called")
+	}
+}
+
+func TestOnStatsInterval(t *testing.T) {
+	b := NewStandaloneBoomer(10, 10)
+	b.OnStatsInterval(nil)
+	if len(b.outputs) != 0 {
+		t.Fatal("A nil callback should be ignored")
+	}
+
+	var intervals []*IntervalStats
+	b.OnStatsInterval(func(stats *IntervalStats) {
+		intervals = append(intervals, stats)
+	})
+	if len(b.outputs) != 1 {
+		t.Fatal("The callback should be added as an output, got", len(b.outputs))
+	}
+
+	collector := NewStatsCollector()
+	collector.RecordSuccess("http", "foo", 10, 100)
+	collector.RecordFailure("http", "foo", 30, "500 error")
+	b.outputs[0].OnStart()
+	b.outputs[0].OnEvent(collector.Report())
+	b.outputs[0].OnStop()
+
+	if len(intervals) != 1 {
+		t.Fatal("The callback should be called for every interval, got", len(intervals))
+	}
+	if total := intervals[0].Total; total == nil || total.NumRequests != 2 || total.NumFailures != 1 {
+		t.Error("The callback should receive the stats of the interval, got", total)
+	}
+}
+
+func TestParseIntervalStatsWithRunMetadata(t *testing.T) {
+	data := NewStatsCollector().Report()
+	data["run_id"] = "nightly"
+	data["run_labels"] = map[interface{}]interface{}{"env": "staging"}
+
+	stats := ParseIntervalStats(data)
+	if stats.RunID != "nightly" || len(stats.RunLabels) != 1 || stats.RunLabels["env"] != "staging" {
+		t.Error("The run metadata should be parsed, got", stats.RunID, stats.RunLabels)
+	}
+}
@@ -0,0 +1,263 @@
+package boomer
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// prometheusBuckets are the upper bounds of the response time histogram, in milliseconds.
+var prometheusBuckets = []int64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// PrometheusOutput exposes the stats on a /metrics endpoint in the prometheus text format, so every
+// node can be scraped by prometheus. The metrics are cumulative since the test starts, including
+// boomer_requests_total, boomer_failures_total and boomer_response_time_milliseconds,
+// which are labeled by method and name, and boomer_users. The requests recorded with labels are also counted by
+// boomer_labeled_requests_total, boomer_labeled_failures_total and boomer_labeled_response_time_milliseconds,
+// which have their labels too. They are separated metrics, so summing boomer_requests_total doesn't count them twice.
+// The histogram is built from the rounded response times reported to the master.
+type PrometheusOutput struct {
+	addr     string
+	server   *http.Server
+	listener net.Listener
+
+	lock    sync.RWMutex
+	metrics map[string]*prometheusMetric
+	// labeledMetrics are the metrics of the labeled stats, by method, name and labels
+	labeledMetrics map[string]*prometheusMetric
+	users          int64
+
+	listening chan bool
+}
+
+type prometheusMetric struct {
+	method            string
+	name              string
+	numRequests       int64
+	numFailures       int64
+	totalResponseTime int64
+	// extraLabels are the rendered labels of the requests, like `,region="us"`
+	extraLabels string
+	// buckets[i] counts the response times not greater than prometheusBuckets[i], not cumulatively.
+	buckets []int64
+}
+
+// NewPrometheusOutput returns a PrometheusOutput, which serves on addr, like ":9646".
+func NewPrometheusOutput(addr string) *PrometheusOutput {
+	o := &PrometheusOutput{
+		addr:           addr,
+		metrics:        make(map[string]*prometheusMetric),
+		labeledMetrics: make(map[string]*prometheusMetric),
+		listening:      make(chan bool),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", o.handleMetrics)
+	o.server = &http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+	return o
+}
+
+// Init binds the address, so boomer can fail fast if the address is in use.
+func (o *PrometheusOutput) Init() error {
+	ln, err := net.Listen("tcp", o.addr)
+	if err != nil {
+		return fmt.Errorf("failed to start the prometheus endpoint on %s, %v", o.addr, err)
+	}
+	o.listener = ln
+	return nil
+}
+
+// OnStart starts the http server.
+func (o *PrometheusOutput) OnStart() {
+	defer close(o.listening)
+	if o.listener == nil {
+		if err := o.Init(); err != nil {
+			logError("%v", err)
+			return
+		}
+	}
+	logInfo("The prometheus metrics are serving on http://%s/metrics", o.listener.Addr().String())
+	go o.server.Serve(o.listener)
+}
+
+// OnEvent adds the interval's stats to the metrics.
+func (o *PrometheusOutput) OnEvent(data map[string]interface{}) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if userCount, ok := data["user_count"].(int32); ok {
+		o.users = int64(userCount)
+	}
+	// the counters exclude the warm-up period
+	if warmup, _ := data["warmup"].(bool); warmup {
+		return
+	}
+
+	stats, _ := data["stats"].([]interface{})
+	for _, stat := range stats {
+		o.metric(o.metrics, stat.(map[string]interface{})).add(stat.(map[string]interface{}))
+	}
+	labeledStats, _ := data["labeled_stats"].([]interface{})
+	for _, stat := range labeledStats {
+		o.metric(o.labeledMetrics, stat.(map[string]interface{})).add(stat.(map[string]interface{}))
+	}
+}
+
+// metric returns the metric of the stats entry s in metrics, it's created if it doesn't exist.
+func (o *PrometheusOutput) metric(metrics map[string]*prometheusMetric, s map[string]interface{}) *prometheusMetric {
+	method, name := s["method"].(string), s["name"].(string)
+	labels, _ := s["labels"].(map[string]string)
+	key := name + method + labelsKey(labels)
+	metric, ok := metrics[key]
+	if !ok {
+		metric = &prometheusMetric{
+			method:      method,
+			name:        name,
+			extraLabels: prometheusExtraLabels(labels),
+			buckets:     make([]int64, len(prometheusBuckets)),
+		}
+		metrics[key] = metric
+	}
+	return metric
+}
+
+func (m *prometheusMetric) add(s map[string]interface{}) {
+	m.numRequests += s["num_requests"].(int64)
+	m.numFailures += s["num_failures"].(int64)
+	m.totalResponseTime += s["total_response_time"].(int64)
+	for responseTime, count := range s["response_times"].(map[int64]int64) {
+		i := sort.Search(len(prometheusBuckets), func(i int) bool {
+			return prometheusBuckets[i] >= responseTime
+		})
+		// the ones greater than the last bucket are only counted by +Inf
+		if i < len(prometheusBuckets) {
+			m.buckets[i] += count
+		}
+	}
+}
+
+// OnStop shuts down the http server.
+func (o *PrometheusOutput) OnStop() {
+	<-o.listening
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	o.server.Shutdown(ctx)
+}
+
+func (o *PrometheusOutput) handleMetrics(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writer := bufio.NewWriter(w)
+	o.writeMetrics(writer)
+	writer.Flush()
+}
+
+func (o *PrometheusOutput) writeMetrics(w *bufio.Writer) {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+
+	fmt.Fprintln(w, "# HELP boomer_users The current number of users.")
+	fmt.Fprintln(w, "# TYPE boomer_users gauge")
+	fmt.Fprintf(w, "boomer_users %d\n", o.users)
+
+	writeRequestMetrics(w, "boomer", "", sortedPrometheusMetrics(o.metrics))
+	if len(o.labeledMetrics) > 0 {
+		writeRequestMetrics(w, "boomer_labeled", ", by the labels of the requests", sortedPrometheusMetrics(o.labeledMetrics))
+	}
+}
+
+func sortedPrometheusMetrics(m map[string]*prometheusMetric) []*prometheusMetric {
+	metrics := make([]*prometheusMetric, 0, len(m))
+	for _, metric := range m {
+		metrics = append(metrics, metric)
+	}
+	sort.Slice(metrics, func(i, j int) bool {
+		if metrics[i].name != metrics[j].name {
+			return metrics[i].name < metrics[j].name
+		}
+		if metrics[i].method != metrics[j].method {
+			return metrics[i].method < metrics[j].method
+		}
+		return metrics[i].extraLabels < metrics[j].extraLabels
+	})
+	return metrics
+}
+
+// writeRequestMetrics writes the requests, failures and response time metrics, whose names start with prefix.
+func writeRequestMetrics(w *bufio.Writer, prefix, help string, metrics []*prometheusMetric) {
+	fmt.Fprintf(w, "# HELP %s_requests_total The number of requests, including the failures%s.\n", prefix, help)
+	fmt.Fprintf(w, "# TYPE %s_requests_total counter\n", prefix)
+	for _, metric := range metrics {
+		fmt.Fprintf(w, "%s_requests_total{%s} %d\n", prefix, metric.labels(), metric.numRequests)
+	}
+
+	fmt.Fprintf(w, "# HELP %s_failures_total The number of failures%s.\n", prefix, help)
+	fmt.Fprintf(w, "# TYPE %s_failures_total counter\n", prefix)
+	for _, metric := range metrics {
+		fmt.Fprintf(w, "%s_failures_total{%s} %d\n", prefix, metric.labels(), metric.numFailures)
+	}
+
+	fmt.Fprintf(w, "# HELP %s_response_time_milliseconds The response times in milliseconds%s.\n", prefix, help)
+	fmt.Fprintf(w, "# TYPE %s_response_time_milliseconds histogram\n", prefix)
+	for _, metric := range metrics {
+		labels := metric.labels()
+		cumulative := int64(0)
+		for i, le := range prometheusBuckets {
+			cumulative += metric.buckets[i]
+			fmt.Fprintf(w, "%s_response_time_milliseconds_bucket{%s,le=\"%d\"} %d\n", prefix, labels, le, cumulative)
+		}
+		fmt.Fprintf(w, "%s_response_time_milliseconds_bucket{%s,le=\"+Inf\"} %d\n", prefix, labels, metric.numRequests)
+		fmt.Fprintf(w, "%s_response_time_milliseconds_sum{%s} %d\n", prefix, labels, metric.totalResponseTime)
+		fmt.Fprintf(w, "%s_response_time_milliseconds_count{%s} %d\n", prefix, labels, metric.numRequests)
+	}
+}
+
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (m *prometheusMetric) labels() string {
+	return `method="` + prometheusLabelEscaper.Replace(m.method) + `",name="` + prometheusLabelEscaper.Replace(m.name) + `"` + m.extraLabels
+}
+
+// prometheusExtraLabels renders the labels of the requests after method and name, sorted by the label names.
+// The invalid characters of the label names are replaced by "_", and the labels named method, name or le are dropped.
+func prometheusExtraLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	values := make(map[string]string, len(labels))
+	for k, v := range labels {
+		name := prometheusLabelName(k)
+		switch name {
+		case "method", "name", "le":
+			continue
+		}
+		names = append(names, name)
+		values[name] = v
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(`,` + name + `="` + prometheusLabelEscaper.Replace(values[name]) + `"`)
+	}
+	return b.String()
+}
+
+// prometheusLabelName replaces the characters not allowed by prometheus, [a-zA-Z_][a-zA-Z0-9_]*, with "_".
+func prometheusLabelName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		valid := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9')
+		if !valid {
+			b[i] = '_'
+		}
+	}
+	if len(b) == 0 {
+		return "_"
+	}
+	return string(b)
+}
@@ -0,0 +1,83 @@
+package boomer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPrometheusOutput(t *testing.T) {
+	o := NewPrometheusOutput("127.0.0.1:0")
+	o.OnStart()
+	defer o.OnStop()
+
+	collector := NewStatsCollector()
+	collector.RecordSuccess("http", "foo", 3, 10)
+	collector.RecordSuccess("http", "foo", 40, 10)
+	collector.RecordFailure("http", "foo", 20000, "timeout")
+	data := collector.Report()
+	data["user_count"] = int32(10)
+	o.OnEvent(data)
+
+	collector.RecordSuccess("http", "foo", 7, 10)
+	o.OnEvent(collector.Report())
+
+	recorder := httptest.NewRecorder()
+	o.handleMetrics(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := recorder.Body.String()
+
+	expected := []string{
+		`boomer_users 10`,
+		`boomer_requests_total{method="http",name="foo"} 4`,
+		`boomer_failures_total{method="http",name="foo"} 1`,
+		`boomer_response_time_milliseconds_bucket{method="http",name="foo",le="5"} 1`,
+		`boomer_response_time_milliseconds_bucket{method="http",name="foo",le="10"} 2`,
+		`boomer_response_time_milliseconds_bucket{method="http",name="foo",le="50"} 3`,
+		`boomer_response_time_milliseconds_bucket{method="http",name="foo",le="10000"} 3`,
+		`boomer_response_time_milliseconds_bucket{method="http",name="foo",le="+Inf"} 4`,
+		`boomer_response_time_milliseconds_sum{method="http",name="foo"} 20050`,
+		`boomer_response_time_milliseconds_count{method="http",name="foo"} 4`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line+"\n") {
+			t.Error("Expected line not found in the metrics:", line)
+		}
+	}
+}
+
+func TestPrometheusLabelEscaping(t *testing.T) {
+	m := &prometheusMetric{method: "http", name: "say \"hi\"\n"}
+	if m.labels() != `method="http",name="say \"hi\"\n"` {
+		t.Error("The label values should be escaped, got:", m.labels())
+	}
+}
+
+func TestPrometheusLabeledMetrics(t *testing.T) {
+	o := NewPrometheusOutput("127.0.0.1:0")
+	o.OnStart()
+	defer o.OnStop()
+
+	collector := NewStatsCollector()
+	collector.RecordSuccess("http", "foo", 3, 10)
+	collector.RecordSuccessWithLabels("http", "foo", map[string]string{"region": "us", "status-code": "200"}, 7, 10)
+	collector.RecordFailureWithLabels("http", "foo", map[string]string{"region": "eu", "name": "ignored"}, 30, "timeout")
+	o.OnEvent(collector.Report())
+
+	recorder := httptest.NewRecorder()
+	o.handleMetrics(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := recorder.Body.String()
+
+	expected := []string{
+		`boomer_requests_total{method="http",name="foo"} 3`,
+		`boomer_labeled_requests_total{method="http",name="foo",region="eu"} 1`,
+		`boomer_labeled_requests_total{method="http",name="foo",region="us",status_code="200"} 1`,
+		`boomer_labeled_failures_total{method="http",name="foo",region="eu"} 1`,
+		`boomer_labeled_response_time_milliseconds_count{method="http",name="foo",region="us",status_code="200"} 1`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line+"\n") {
+			t.Error("Expected line not found in the metrics:", line)
+		}
+	}
+}
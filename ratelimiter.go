@@ -5,6 +5,7 @@ import (
 	"math"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -64,7 +65,7 @@ func (limiter *StableRateLimiter) Start() {
 			case <-quitChannel:
 				return
 			default:
-				atomic.StoreInt64(&limiter.currentThreshold, limiter.threshold)
+				atomic.StoreInt64(&limiter.currentThreshold, atomic.LoadInt64(&limiter.threshold))
 				time.Sleep(limiter.refillPeriod)
 				close(limiter.broadcastChannel)
 				limiter.broadcastChannel = make(chan bool)
@@ -73,13 +74,26 @@ func (limiter *StableRateLimiter) Start() {
 	}()
 }
 
+// SetThreshold updates the threshold, it takes effect when the bucket is refilled next time.
+func (limiter *StableRateLimiter) SetThreshold(threshold int64) {
+	atomic.StoreInt64(&limiter.threshold, threshold)
+}
+
 // Acquire a token from the bucket, returns true if the bucket is exhausted.
 func (limiter *StableRateLimiter) Acquire() (blocked bool) {
+	return limiter.acquireUntil(nil)
+}
+
+// acquireUntil is like Acquire, but stops waiting for the bucket to be refilled once quit is closed.
+func (limiter *StableRateLimiter) acquireUntil(quit chan bool) (blocked bool) {
 	permit := atomic.AddInt64(&limiter.currentThreshold, -1)
 	if permit < 0 {
 		blocked = true
-		// block until the bucket is refilled
-		<-limiter.broadcastChannel
+		// block until the bucket is refilled or the worker is stopped
+		select {
+		case <-limiter.broadcastChannel:
+		case <-quit:
+		}
 	} else {
 		blocked = false
 	}
@@ -195,11 +209,19 @@ func (limiter *RampUpRateLimiter) Start() {
 
 // Acquire a token from the bucket, returns true if the bucket is exhausted.
 func (limiter *RampUpRateLimiter) Acquire() (blocked bool) {
+	return limiter.acquireUntil(nil)
+}
+
+// acquireUntil is like Acquire, but stops waiting for the bucket to be refilled once quit is closed.
+func (limiter *RampUpRateLimiter) acquireUntil(quit chan bool) (blocked bool) {
 	permit := atomic.AddInt64(&limiter.currentThreshold, -1)
 	if permit < 0 {
 		blocked = true
-		// block until the bucket is refilled
-		<-limiter.broadcastChannel
+		// block until the bucket is refilled or the worker is stopped
+		select {
+		case <-limiter.broadcastChannel:
+		case <-quit:
+		}
 	} else {
 		blocked = false
 	}
@@ -211,3 +233,181 @@ func (limiter *RampUpRateLimiter) Stop() {
 	limiter.nextThreshold = 0
 	close(limiter.quitChannel)
 }
+
+// ErrInvalidTokenBucket is the error returned if the rate or the burst of a TokenBucketRateLimiter is invalid.
+var ErrInvalidTokenBucket = errors.New("ratelimiter: the rate should be positive and the burst should be at least 1")
+
+// A TokenBucketRateLimiter uses the token bucket algorithm with the same semantics as golang.org/x/time/rate.
+// The bucket is refilled continuously at rate tokens per second, up to burst tokens, and it's full when it starts.
+// So short bursts of up to burst requests above the steady rate are allowed, like bursty clients do,
+// while the average rate is still limited to rate.
+// Acquire waits for the next token if the bucket is empty, instead of being refilled at fixed periods.
+type TokenBucketRateLimiter struct {
+	rate  float64
+	burst float64
+
+	lock   sync.Mutex
+	tokens float64
+	last   time.Time
+
+	quitChannel chan bool
+}
+
+// NewTokenBucketRateLimiter returns a TokenBucketRateLimiter, which allows rate requests per second on average,
+// and bursts of up to burst requests.
+func NewTokenBucketRateLimiter(rate float64, burst int) (rateLimiter *TokenBucketRateLimiter, err error) {
+	if rate <= 0 || burst < 1 {
+		return nil, ErrInvalidTokenBucket
+	}
+	rateLimiter = &TokenBucketRateLimiter{
+		rate:        rate,
+		burst:       float64(burst),
+		tokens:      float64(burst),
+		last:        time.Now(),
+		quitChannel: make(chan bool),
+	}
+	return rateLimiter, nil
+}
+
+// Start fills the bucket.
+func (limiter *TokenBucketRateLimiter) Start() {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+	limiter.tokens = limiter.burst
+	limiter.last = time.Now()
+	limiter.quitChannel = make(chan bool)
+}
+
+// Acquire a token from the bucket, it waits for the next token if the bucket is empty.
+// It returns true only if the rate limiter is stopped while waiting.
+func (limiter *TokenBucketRateLimiter) Acquire() (blocked bool) {
+	return limiter.acquireUntil(nil)
+}
+
+// acquireUntil is like Acquire, but stops waiting for the next token once quit is closed.
+func (limiter *TokenBucketRateLimiter) acquireUntil(quit chan bool) (blocked bool) {
+	limiter.lock.Lock()
+	now := time.Now()
+	limiter.tokens += now.Sub(limiter.last).Seconds() * limiter.rate
+	if limiter.tokens > limiter.burst {
+		limiter.tokens = limiter.burst
+	}
+	limiter.last = now
+	// reserve a token, the bucket goes negative if it's empty, so the waiting callers are served in order
+	limiter.tokens--
+	wait := time.Duration(-limiter.tokens / limiter.rate * float64(time.Second))
+	quitChannel := limiter.quitChannel
+	limiter.lock.Unlock()
+
+	if wait <= 0 {
+		return false
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return false
+	case <-quit:
+	case <-quitChannel:
+	}
+	// give back the reserved token
+	limiter.lock.Lock()
+	limiter.tokens++
+	limiter.lock.Unlock()
+	return true
+}
+
+// Stop the rate limiter, the callers waiting for tokens stop waiting and are blocked.
+func (limiter *TokenBucketRateLimiter) Stop() {
+	close(limiter.quitChannel)
+}
+
+// A DistributedRateLimiter limits the RPS of the whole cluster, instead of each worker. The global threshold is
+// split evenly over the workers, by the number of workers sent by the master as the "worker_count" message,
+// so the total RPS stays the same when workers join or leave. The MasterRunner of boomer sends it whenever the
+// workers change, a locust master can send it with runner.send_message("worker_count", worker_count).
+// Before the number of workers is known, the worker is limited to the global threshold.
+// It uses the token bucket algorithm like StableRateLimiter, no burst is allowed. The fractions of the split
+// threshold are carried over to the next refill, so the average is accurate even if the threshold isn't divisible.
+type DistributedRateLimiter struct {
+	globalThreshold  int64
+	workerCount      int64
+	currentThreshold int64
+	refillPeriod     time.Duration
+	broadcastChannel chan bool
+	quitChannel      chan bool
+}
+
+// NewDistributedRateLimiter returns a DistributedRateLimiter, globalThreshold is the threshold of the whole cluster.
+func NewDistributedRateLimiter(globalThreshold int64, refillPeriod time.Duration) (rateLimiter *DistributedRateLimiter) {
+	rateLimiter = &DistributedRateLimiter{
+		globalThreshold:  globalThreshold,
+		workerCount:      1,
+		currentThreshold: globalThreshold,
+		refillPeriod:     refillPeriod,
+		broadcastChannel: make(chan bool),
+	}
+	return rateLimiter
+}
+
+// SetWorkerCount updates the number of workers, it takes effect when the bucket is refilled next time.
+func (limiter *DistributedRateLimiter) SetWorkerCount(n int) {
+	if n <= 0 {
+		return
+	}
+	atomic.StoreInt64(&limiter.workerCount, int64(n))
+}
+
+// Start to refill the bucket periodically.
+func (limiter *DistributedRateLimiter) Start() {
+	limiter.quitChannel = make(chan bool)
+	quitChannel := limiter.quitChannel
+	carry := limiter.refill(0)
+	go func() {
+		for {
+			time.Sleep(limiter.refillPeriod)
+			select {
+			case <-quitChannel:
+				return
+			default:
+				carry = limiter.refill(carry)
+				close(limiter.broadcastChannel)
+				limiter.broadcastChannel = make(chan bool)
+			}
+		}
+	}()
+}
+
+// refill fills the bucket with the share of this worker plus carry, and returns the fraction left.
+func (limiter *DistributedRateLimiter) refill(carry float64) float64 {
+	carry += float64(limiter.globalThreshold) / float64(atomic.LoadInt64(&limiter.workerCount))
+	threshold := int64(carry)
+	atomic.StoreInt64(&limiter.currentThreshold, threshold)
+	return carry - float64(threshold)
+}
+
+// Acquire a token from the bucket, returns true if the bucket is exhausted.
+func (limiter *DistributedRateLimiter) Acquire() (blocked bool) {
+	return limiter.acquireUntil(nil)
+}
+
+// acquireUntil is like Acquire, but stops waiting for the bucket to be refilled once quit is closed.
+func (limiter *DistributedRateLimiter) acquireUntil(quit chan bool) (blocked bool) {
+	permit := atomic.AddInt64(&limiter.currentThreshold, -1)
+	if permit < 0 {
+		blocked = true
+		// block until the bucket is refilled or the worker is stopped
+		select {
+		case <-limiter.broadcastChannel:
+		case <-quit:
+		}
+	} else {
+		blocked = false
+	}
+	return blocked
+}
+
+// Stop the rate limiter.
+func (limiter *DistributedRateLimiter) Stop() {
+	close(limiter.quitChannel)
+}
@@ -99,3 +99,87 @@ func TestParseInvalidRampUpRate(t *testing.T) {
 		t.Error("Expected ErrParsingRampUpRate")
 	}
 }
+
+func TestDistributedRateLimiter(t *testing.T) {
+	rateLimiter := NewDistributedRateLimiter(10, 50*time.Millisecond)
+	rateLimiter.SetWorkerCount(4)
+	rateLimiter.Start()
+	defer rateLimiter.Stop()
+
+	// 10 is split over 4 workers, 2.5 per worker, the fractions are carried over to the next refill
+	acquired := 0
+	for !rateLimiter.Acquire() {
+		acquired++
+	}
+	if acquired != 2 {
+		t.Error("Expected 2 tokens in the first period, got", acquired)
+	}
+	acquired = 0
+	for !rateLimiter.Acquire() {
+		acquired++
+	}
+	if acquired != 3 {
+		t.Error("Expected 3 tokens in the second period, got", acquired)
+	}
+
+	rateLimiter.SetWorkerCount(0)
+	if rateLimiter.workerCount != 4 {
+		t.Error("An invalid worker count should be ignored, got", rateLimiter.workerCount)
+	}
+}
+
+func TestTokenBucketRateLimiter(t *testing.T) {
+	rateLimiter, err := NewTokenBucketRateLimiter(20, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rateLimiter.Start()
+	defer rateLimiter.Stop()
+
+	// the bucket is full, a burst of 5 is allowed at once
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if rateLimiter.Acquire() {
+			t.Error("Unexpected blocked by rate limiter")
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Error("The burst should not wait, took", elapsed)
+	}
+
+	// then the tokens are refilled at 20/s, 50ms per token
+	start = time.Now()
+	for i := 0; i < 2; i++ {
+		if rateLimiter.Acquire() {
+			t.Error("Unexpected blocked by rate limiter")
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Error("The requests above the burst should wait for the tokens, took", elapsed)
+	}
+}
+
+func TestTokenBucketRateLimiterStop(t *testing.T) {
+	rateLimiter, _ := NewTokenBucketRateLimiter(1, 1)
+	rateLimiter.Start()
+	rateLimiter.Acquire()
+
+	quit := make(chan bool)
+	close(quit)
+	if !rateLimiter.acquireUntil(quit) {
+		t.Error("Should be blocked once quit is closed")
+	}
+	rateLimiter.Stop()
+	if !rateLimiter.Acquire() {
+		t.Error("Should be blocked once the rate limiter is stopped")
+	}
+}
+
+func TestInvalidTokenBucketRateLimiter(t *testing.T) {
+	if _, err := NewTokenBucketRateLimiter(0, 1); err != ErrInvalidTokenBucket {
+		t.Error("Expected ErrInvalidTokenBucket, got", err)
+	}
+	if _, err := NewTokenBucketRateLimiter(10, 0); err != ErrInvalidTokenBucket {
+		t.Error("Expected ErrInvalidTokenBucket, got", err)
+	}
+}
@@ -0,0 +1,247 @@
+// Package replay re-drives a recorded request log with boomer. Every line of the log is an entry, which begins with
+// the timestamp of the request, the entries are handed out to the users at the same offsets since the first entry,
+// optionally scaled by a speed factor, so the arrival pattern of the production traffic is reproduced instead of
+// a synthetic constant rate.
+//
+//	2023-10-15T12:00:00.000Z GET /products/1
+//	2023-10-15T12:00:00.120Z GET /products/2
+//	2023-10-15T12:00:00.125Z POST /cart
+//
+// The users should be enough to keep up with the log, an entry is late if all of them are busy.
+//
+//	replayer, err := replay.Load("access.log", replay.Config{Speed: 2})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	task := replayer.Task("replay", func(ctx context.Context, entry *replay.Entry) {
+//		fields := strings.Fields(entry.Line)
+//		request(ctx, fields[0], fields[1])
+//	})
+//	go func() {
+//		<-replayer.Done()
+//		globalBoomer.Quit()
+//	}()
+//	globalBoomer.Run(task)
+package replay
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/myzhan/boomer"
+)
+
+// lateThreshold is how late an entry is handed out before the replayer warns that the users can't keep up.
+const lateThreshold = 100 * time.Millisecond
+
+var (
+	// ErrNoEntries is returned when a replayer is created without entries.
+	ErrNoEntries = errors.New("replay: no entries")
+	// ErrFinished is returned by Next once all the entries are handed out.
+	ErrFinished = errors.New("replay: all the entries are replayed")
+)
+
+// Entry is a request in the log.
+type Entry struct {
+	// Time is the timestamp of the request.
+	Time time.Time
+	// Line is the rest of the line after the timestamp, with the spaces around it trimmed.
+	Line string
+}
+
+// Config configures a Replayer, the zero value is ready to use.
+type Config struct {
+	// Speed scales the arrival pattern, 2 replays the log twice as fast, 0.5 at half speed. Defaults to 1.
+	Speed float64
+	// TimeLayout is the layout of the timestamps, like "2006-01-02 15:04:05.000", it may contain spaces.
+	// By default, the timestamps are RFC 3339, or Unix time in seconds with an optional fraction, like 1697371200.125.
+	TimeLayout string
+}
+
+// Replayer hands out the entries of a log at their times, it's safe for concurrent use.
+type Replayer struct {
+	entries []Entry
+	speed   float64
+
+	lock     sync.Mutex
+	start    time.Time
+	next     int
+	done     chan struct{}
+	lateOnce sync.Once
+}
+
+// New returns a Replayer of entries, which are sorted by time.
+func New(entries []Entry, config Config) (*Replayer, error) {
+	if len(entries) == 0 {
+		return nil, ErrNoEntries
+	}
+	speed := config.Speed
+	if speed == 0 {
+		speed = 1
+	}
+	if speed < 0 || math.IsInf(speed, 0) || math.IsNaN(speed) {
+		return nil, fmt.Errorf("replay: invalid speed %v", config.Speed)
+	}
+	sorted := make([]Entry, len(entries))
+	copy(sorted, entries)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time.Before(sorted[j].Time)
+	})
+	return &Replayer{
+		entries: sorted,
+		speed:   speed,
+		done:    make(chan struct{}),
+	}, nil
+}
+
+// Load returns a Replayer of the entries in the log file of path.
+func Load(path string, config Config) (*Replayer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries, err := Read(file, config.TimeLayout)
+	if err != nil {
+		return nil, fmt.Errorf("replay: %s: %v", path, err)
+	}
+	return New(entries, config)
+}
+
+// Read reads the entries from a log, whose timestamps are in layout, see Config.TimeLayout.
+// The empty lines and the lines beginning with "#" are skipped.
+func Read(r io.Reader, layout string) ([]Entry, error) {
+	// the timestamp is the first fields of a line, as many as the fields of the layout
+	timeFields := 1
+	if layout != "" {
+		timeFields = len(strings.Fields(layout))
+	}
+
+	entries := make([]Entry, 0)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", timeFields+1)
+		if len(fields) < timeFields {
+			return nil, fmt.Errorf("line %d: missing timestamp", lineNumber)
+		}
+		t, err := parseTime(strings.Join(fields[:timeFields], " "), layout)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+		entry := Entry{Time: t}
+		if len(fields) > timeFields {
+			entry.Line = strings.TrimSpace(fields[timeFields])
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func parseTime(value, layout string) (time.Time, error) {
+	if layout != "" {
+		return time.Parse(layout, value)
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q, expected RFC 3339 or Unix time", value)
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second))), nil
+}
+
+// Len returns the number of entries.
+func (r *Replayer) Len() int {
+	return len(r.entries)
+}
+
+// Duration returns how long it takes to replay the entries at the speed.
+func (r *Replayer) Duration() time.Duration {
+	return r.offset(&r.entries[len(r.entries)-1])
+}
+
+// Done returns a channel, which is closed once all the entries are handed out, e.g. to quit boomer.
+func (r *Replayer) Done() <-chan struct{} {
+	return r.done
+}
+
+// offset returns when an entry is due since the replay starts.
+func (r *Replayer) offset(e *Entry) time.Duration {
+	return time.Duration(float64(e.Time.Sub(r.entries[0].Time)) / r.speed)
+}
+
+// Next waits for the next entry to be due and returns it, the replay starts at the first call. Once all the entries
+// are handed out, it blocks until ctx is canceled, and returns ErrFinished. ctx should be the context passed to the task,
+// which is canceled once the user is stopped, then the entry it's waiting for is skipped, and ctx.Err() is returned.
+func (r *Replayer) Next(ctx context.Context) (*Entry, error) {
+	r.lock.Lock()
+	if r.start.IsZero() {
+		r.start = time.Now()
+	}
+	if r.next >= len(r.entries) {
+		r.lock.Unlock()
+		<-ctx.Done()
+		return nil, ErrFinished
+	}
+	entry := &r.entries[r.next]
+	r.next++
+	if r.next == len(r.entries) {
+		close(r.done)
+	}
+	due := r.start.Add(r.offset(entry))
+	r.lock.Unlock()
+
+	wait := time.Until(due)
+	if wait <= 0 {
+		if -wait > lateThreshold {
+			r.lateOnce.Do(func() {
+				log.Printf("replay: the entries are late by %v, there aren't enough users to keep up with the log", -wait)
+			})
+		}
+		return entry, nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return entry, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Task returns a task, which calls fn with every entry at its time, by a free user.
+func (r *Replayer) Task(name string, fn func(ctx context.Context, entry *Entry)) *boomer.Task {
+	return &boomer.Task{
+		Name:   name,
+		Weight: 1,
+		FnWithContext: func(ctx context.Context) {
+			entry, err := r.Next(ctx)
+			if err != nil {
+				return
+			}
+			fn(ctx, entry)
+		},
+	}
+}
@@ -0,0 +1,182 @@
+package replay
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRead(t *testing.T) {
+	log := `# recorded at 2023-10-15
+2023-10-15T12:00:00.120Z GET /products/2
+
+2023-10-15T12:00:00Z GET /products/1
+1697371200.5 POST /cart
+`
+	entries, err := Read(strings.NewReader(log), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatal("Expected 3 entries, got", len(entries))
+	}
+	if entries[0].Line != "GET /products/2" || entries[0].Time.Nanosecond() != 120*int(time.Millisecond) {
+		t.Error("Unexpected entry", entries[0])
+	}
+	if entries[2].Line != "POST /cart" || !entries[2].Time.Equal(time.Unix(1697371200, 5e8)) {
+		t.Error("Unexpected entry", entries[2])
+	}
+
+	entries, err = Read(strings.NewReader("2023-10-15 12:00:00.250 GET /\n"), "2006-01-02 15:04:05.000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Line != "GET /" || entries[0].Time.Nanosecond() != 250*int(time.Millisecond) {
+		t.Error("The timestamp with spaces should be parsed by the layout, got", entries)
+	}
+
+	if _, err := Read(strings.NewReader("yesterday GET /\n"), ""); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Error("An invalid timestamp should be refused with the line number, got", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(nil, Config{}); err != ErrNoEntries {
+		t.Error("Expected ErrNoEntries, got", err)
+	}
+	start := time.Now()
+	entries := []Entry{{Time: start.Add(2 * time.Second), Line: "b"}, {Time: start, Line: "a"}}
+	if _, err := New(entries, Config{Speed: -1}); err == nil {
+		t.Error("A negative speed should be refused")
+	}
+
+	r, err := New(entries, Config{Speed: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Len() != 2 || r.entries[0].Line != "a" {
+		t.Error("The entries should be sorted by time")
+	}
+	if r.Duration() != 500*time.Millisecond {
+		t.Error("The duration should be scaled by the speed, got", r.Duration())
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log")
+	if err := ioutil.WriteFile(path, []byte("1697371200 GET /\n1697371201 GET /\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Load(path, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Len() != 2 || r.Duration() != time.Second {
+		t.Error("Unexpected replayer", r.Len(), r.Duration())
+	}
+
+	if _, err := Load(filepath.Join(dir, "missing.log"), Config{}); err == nil {
+		t.Error("A missing log should be refused")
+	}
+}
+
+func TestNext(t *testing.T) {
+	start := time.Now()
+	entries := []Entry{
+		{Time: start, Line: "a"},
+		{Time: start.Add(100 * time.Millisecond), Line: "b"},
+		{Time: start.Add(200 * time.Millisecond), Line: "c"},
+	}
+	r, err := New(entries, Config{Speed: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	begin := time.Now()
+	for i, expected := range []string{"a", "b", "c"} {
+		entry, err := r.Next(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.Line != expected {
+			t.Error("Expected entry", expected, "got", entry.Line)
+		}
+		elapsed := time.Since(begin)
+		due := time.Duration(i) * 50 * time.Millisecond
+		if elapsed < due || elapsed > due+40*time.Millisecond {
+			t.Error("Entry", expected, "should be handed out after", due, "got", elapsed)
+		}
+	}
+
+	select {
+	case <-r.Done():
+	default:
+		t.Error("Done should be closed once all the entries are handed out")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := r.Next(ctx); err != ErrFinished {
+		t.Error("Expected ErrFinished, got", err)
+	}
+}
+
+func TestNextCanceled(t *testing.T) {
+	start := time.Now()
+	r, err := New([]Entry{{Time: start}, {Time: start.Add(time.Hour)}}, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Next(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := r.Next(ctx); err != context.Canceled {
+		t.Error("Expected context.Canceled, got", err)
+	}
+}
+
+func TestTask(t *testing.T) {
+	start := time.Now()
+	r, err := New([]Entry{{Time: start, Line: "a"}, {Time: start, Line: "b"}}, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lock sync.Mutex
+	lines := make([]string, 0)
+	task := r.Task("replay", func(ctx context.Context, entry *Entry) {
+		lock.Lock()
+		defer lock.Unlock()
+		lines = append(lines, entry.Line)
+	})
+	if task.Name != "replay" || task.Weight != 1 {
+		t.Error("Unexpected task", task.Name, task.Weight)
+	}
+
+	task.FnWithContext(context.Background())
+	task.FnWithContext(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	task.FnWithContext(ctx)
+
+	if strings.Join(lines, ",") != "a,b" {
+		t.Error("fn should be called with every entry, got", lines)
+	}
+}
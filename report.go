@@ -0,0 +1,461 @@
+package boomer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// ReportFormat is the format of the final report, JSON, CSV, HTML and text are supported.
+type ReportFormat int
+
+const (
+	// ReportJSON writes a JSON summary, including the errors.
+	ReportJSON ReportFormat = iota
+	// ReportCSV writes a CSV table with a row for each request name, and a "Total" row at last.
+	ReportCSV
+	// ReportHTML writes a self-contained HTML page, which can be opened without any network access, with the charts of
+	// RPS, response time percentiles and users over time, besides the tables.
+	ReportHTML
+	// ReportText writes plain text tables, like the summary printed by locust on exit, it's the format of the summary.
+	ReportText
+)
+
+var finalReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>boomer report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: right; }
+th:first-child, td:first-child, th:nth-child(2), td:nth-child(2) { text-align: left; }
+</style>
+</head>
+<body>
+<h1>boomer report</h1>
+<p>From {{.StartTime}} to {{.EndTime}}, {{.Duration}} seconds</p>
+{{range .Charts}}<div>{{.}}</div>
+{{end}}<table>
+<tr><th>Type</th><th>Name</th><th># requests</th><th># fails</th><th>RPS</th><th>Average</th><th>Min</th><th>Max</th><th>50%</th><th>90%</th><th>95%</th><th>99%</th><th>Content Size</th><th>Min Content Size</th><th>Max Content Size</th></tr>
+{{range .Stats}}<tr><td>{{.Method}}</td><td>{{.Name}}</td><td>{{.NumRequests}}</td><td>{{.NumFailures}}</td><td>{{printf "%.2f" .RPS}}</td><td>{{printf "%.2f" .AvgResponseTime}}</td><td>{{.MinResponseTime}}</td><td>{{.MaxResponseTime}}</td><td>{{.P50}}</td><td>{{.P90}}</td><td>{{.P95}}</td><td>{{.P99}}</td><td>{{.AvgContentLength}}</td><td>{{.MinContentLength}}</td><td>{{.MaxContentLength}}</td></tr>
+{{end}}{{with .Total}}<tr><th>{{.Method}}</th><th>{{.Name}}</th><th>{{.NumRequests}}</th><th>{{.NumFailures}}</th><th>{{printf "%.2f" .RPS}}</th><th>{{printf "%.2f" .AvgResponseTime}}</th><th>{{.MinResponseTime}}</th><th>{{.MaxResponseTime}}</th><th>{{.P50}}</th><th>{{.P90}}</th><th>{{.P95}}</th><th>{{.P99}}</th><th>{{.AvgContentLength}}</th><th>{{.MinContentLength}}</th><th>{{.MaxContentLength}}</th></tr>{{end}}
+</table>
+{{if .Errors}}<h2>Errors</h2>
+<table>
+<tr><th>Type</th><th>Name</th><th>Error</th><th>Occurrences</th></tr>
+{{range .Errors}}<tr><td>{{.Method}}</td><td>{{.Name}}</td><td>{{.Error}}</td><td>{{.Occurrences}}</td></tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+`))
+
+type finalReportEntry struct {
+	Method           string  `json:"method"`
+	Name             string  `json:"name"`
+	NumRequests      int64   `json:"num_requests"`
+	NumFailures      int64   `json:"num_failures"`
+	RPS              float64 `json:"rps"`
+	AvgResponseTime  float64 `json:"avg_response_time"`
+	MinResponseTime  int64   `json:"min_response_time"`
+	MaxResponseTime  int64   `json:"max_response_time"`
+	P50              int64   `json:"response_time_50"`
+	P90              int64   `json:"response_time_90"`
+	P95              int64   `json:"response_time_95"`
+	P99              int64   `json:"response_time_99"`
+	AvgContentLength int64   `json:"avg_content_length"`
+	MinContentLength int64   `json:"min_content_length"`
+	MaxContentLength int64   `json:"max_content_length"`
+
+	totalResponseTime  int64
+	totalContentLength int64
+	responseTimes      map[int64]int64
+}
+
+type finalReportError struct {
+	Method      string        `json:"method"`
+	Name        string        `json:"name"`
+	Error       string        `json:"error"`
+	Occurrences int64         `json:"occurrences"`
+	Category    ErrorCategory `json:"category,omitempty"`
+	Stack       string        `json:"stack,omitempty"`
+}
+
+type finalReport struct {
+	StartTime string              `json:"start_time"`
+	EndTime   string              `json:"end_time"`
+	Duration  int64               `json:"duration"`
+	Stats     []*finalReportEntry `json:"stats"`
+	Total     *finalReportEntry   `json:"total"`
+	Errors    []*finalReportError `json:"errors"`
+	Timeline  []*timelinePoint    `json:"timeline"`
+}
+
+// htmlReport is a finalReport with the charts of its timeline.
+type htmlReport struct {
+	*finalReport
+	Charts []template.HTML
+}
+
+// lifetimeStats accumulates the stats of every interval since the test starts,
+// and keeps the aggregates of each interval as the timeline.
+type lifetimeStats struct {
+	startTime time.Time
+	entries   map[string]*finalReportEntry
+	total     *finalReportEntry
+	errors    map[string]*finalReportError
+
+	timeline []*timelinePoint
+	// lastEventTime is when the last interval is added, the next interval starts from it.
+	lastEventTime time.Time
+}
+
+func newLifetimeStats() *lifetimeStats {
+	return &lifetimeStats{
+		startTime: time.Now(),
+		entries:   make(map[string]*finalReportEntry),
+		total:     newFinalReportEntry("", "Total"),
+		errors:    make(map[string]*finalReportError),
+	}
+}
+
+func newFinalReportEntry(method, name string) *finalReportEntry {
+	return &finalReportEntry{
+		Method:        method,
+		Name:          name,
+		responseTimes: make(map[int64]int64),
+	}
+}
+
+// add adds the interval's stats and errors. The intervals in the warm-up period are skipped,
+// and the lifetime starts after the warm-up period, so the RPS isn't diluted by it.
+func (l *lifetimeStats) add(data map[string]interface{}) {
+	now := time.Now()
+	if warmup, _ := data["warmup"].(bool); warmup {
+		l.startTime = now
+		l.lastEventTime = now
+		return
+	}
+	stats, _ := data["stats"].([]interface{})
+	for _, stat := range stats {
+		s := stat.(map[string]interface{})
+		method, name := s["method"].(string), s["name"].(string)
+		entry, ok := l.entries[name+method]
+		if !ok {
+			entry = newFinalReportEntry(method, name)
+			l.entries[name+method] = entry
+		}
+		entry.merge(s)
+	}
+	if total, ok := data["stats_total"].(map[string]interface{}); ok {
+		l.total.merge(total)
+		l.addTimelinePoint(now, data, total)
+	}
+
+	errors, _ := data["errors"].(map[string]map[string]interface{})
+	for key, e := range errors {
+		entry, ok := l.errors[key]
+		if !ok {
+			entry = &finalReportError{
+				Method:   e["method"].(string),
+				Name:     e["name"].(string),
+				Error:    e["error"].(string),
+				Category: ErrorCategory(toString(e["category"])),
+				Stack:    toString(e["stack"]),
+			}
+			l.errors[key] = entry
+		}
+		entry.Occurrences += e["occurrences"].(int64)
+	}
+}
+
+// addTimelinePoint adds the aggregates of the interval, which ends now, to the timeline.
+func (l *lifetimeStats) addTimelinePoint(now time.Time, data map[string]interface{}, total map[string]interface{}) {
+	since := l.lastEventTime
+	if since.Before(l.startTime) {
+		since = l.startTime
+	}
+	l.lastEventTime = now
+
+	point := &timelinePoint{
+		Time:  now.Unix(),
+		Users: toInt64(data["user_count"]),
+	}
+	if seconds := now.Sub(since).Seconds(); seconds > 0 {
+		point.RPS = float64(toInt64(total["num_requests"])) / seconds
+		point.FailuresPerSecond = float64(toInt64(total["num_failures"])) / seconds
+	}
+	if percentiles, ok := total["response_time_percentiles"].(map[float64]int64); ok {
+		point.P50, point.P95, point.P99 = percentiles[0.5], percentiles[0.95], percentiles[0.99]
+	}
+	l.timeline = append(l.timeline, point)
+}
+
+// summarize calculates the derived values of all the entries, and returns them sorted by name and method.
+func (l *lifetimeStats) summarize(endTime time.Time) []*finalReportEntry {
+	duration := endTime.Sub(l.startTime)
+	entries := make([]*finalReportEntry, 0, len(l.entries))
+	for _, entry := range l.entries {
+		entry.summarize(duration)
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Name == entries[j].Name {
+			return entries[i].Method < entries[j].Method
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	l.total.summarize(duration)
+	return entries
+}
+
+// sortedErrors returns the errors, the most frequent first.
+func (l *lifetimeStats) sortedErrors() []*finalReportError {
+	errors := make([]*finalReportError, 0, len(l.errors))
+	for _, e := range l.errors {
+		errors = append(errors, e)
+	}
+	sort.Slice(errors, func(i, j int) bool {
+		return errors[i].Occurrences > errors[j].Occurrences
+	})
+	return errors
+}
+
+// finalReportOutput accumulates the stats of every interval, and writes the lifetime aggregates
+// to a file when the test is stopped.
+type finalReportOutput struct {
+	path   string
+	format ReportFormat
+	file   *os.File
+
+	stats *lifetimeStats
+}
+
+func newFinalReportOutput(path string, format ReportFormat) *finalReportOutput {
+	return &finalReportOutput{
+		path:   path,
+		format: format,
+		stats:  newLifetimeStats(),
+	}
+}
+
+// Init creates the file, so boomer can fail fast if the report can't be written.
+func (o *finalReportOutput) Init() error {
+	file, err := os.Create(o.path)
+	if err != nil {
+		return fmt.Errorf("failed to create final report %s, %v", o.path, err)
+	}
+	o.file = file
+	return nil
+}
+
+// OnStart creates the file if it's not done by Init, and starts timing the test.
+func (o *finalReportOutput) OnStart() {
+	o.stats.startTime = time.Now()
+	if o.file != nil {
+		return
+	}
+	if err := o.Init(); err != nil {
+		logError("%v", err)
+	}
+}
+
+// OnEvent adds the interval's stats to the lifetime aggregates.
+func (o *finalReportOutput) OnEvent(data map[string]interface{}) {
+	o.stats.add(data)
+}
+
+// OnStop writes the report and closes the file.
+func (o *finalReportOutput) OnStop() {
+	o.writeFile(o.report(time.Now()))
+}
+
+// writeFile writes report to the file and closes it.
+func (o *finalReportOutput) writeFile(report *finalReport) {
+	if o.file == nil {
+		return
+	}
+	defer func() {
+		o.file.Close()
+		o.file = nil
+	}()
+
+	if err := o.write(o.file, report); err != nil {
+		logError("Failed to write final report %s, %v", o.path, err)
+		return
+	}
+	logInfo("The final report is written to %s", o.path)
+}
+
+func (e *finalReportEntry) merge(s map[string]interface{}) {
+	numRequests := s["num_requests"].(int64)
+	if numRequests == 0 {
+		return
+	}
+	minResponseTime := s["min_response_time"].(int64)
+	if e.NumRequests == 0 || minResponseTime < e.MinResponseTime {
+		e.MinResponseTime = minResponseTime
+	}
+	if maxResponseTime := s["max_response_time"].(int64); maxResponseTime > e.MaxResponseTime {
+		e.MaxResponseTime = maxResponseTime
+	}
+	minContentLength := toInt64(s["min_content_length"])
+	if e.NumRequests == 0 || minContentLength < e.MinContentLength {
+		e.MinContentLength = minContentLength
+	}
+	if maxContentLength := toInt64(s["max_content_length"]); maxContentLength > e.MaxContentLength {
+		e.MaxContentLength = maxContentLength
+	}
+	e.NumRequests += numRequests
+	e.NumFailures += s["num_failures"].(int64)
+	e.totalResponseTime += s["total_response_time"].(int64)
+	e.totalContentLength += s["total_content_length"].(int64)
+	for k, v := range s["response_times"].(map[int64]int64) {
+		e.responseTimes[k] += v
+	}
+}
+
+func (e *finalReportEntry) summarize(duration time.Duration) {
+	if seconds := duration.Seconds(); seconds > 0 {
+		e.RPS = float64(e.NumRequests) / seconds
+	}
+	e.AvgResponseTime = getAvgResponseTime(e.NumRequests, e.totalResponseTime)
+	e.AvgContentLength = getAvgContentLength(e.NumRequests, e.totalContentLength)
+	e.P50 = getPercentileResponseTime(e.NumRequests, e.responseTimes, 0.5)
+	e.P90 = getPercentileResponseTime(e.NumRequests, e.responseTimes, 0.9)
+	e.P95 = getPercentileResponseTime(e.NumRequests, e.responseTimes, 0.95)
+	e.P99 = getPercentileResponseTime(e.NumRequests, e.responseTimes, 0.99)
+}
+
+func (o *finalReportOutput) report(endTime time.Time) *finalReport {
+	return &finalReport{
+		StartTime: o.stats.startTime.Format(time.RFC3339),
+		EndTime:   endTime.Format(time.RFC3339),
+		Duration:  int64(endTime.Sub(o.stats.startTime).Seconds()),
+		Stats:     o.stats.summarize(endTime),
+		Total:     o.stats.total,
+		Errors:    o.stats.sortedErrors(),
+		Timeline:  o.stats.timeline,
+	}
+}
+
+func (o *finalReportOutput) write(w io.Writer, report *finalReport) error {
+	switch o.format {
+	case ReportCSV:
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"Type", "Name", "# requests", "# failures", "RPS", "Average", "Min", "Max", "50%", "90%", "95%", "99%", "Content Size", "Min Content Size", "Max Content Size"})
+		for _, entry := range append(report.Stats, report.Total) {
+			writer.Write([]string{
+				entry.Method,
+				entry.Name,
+				strconv.FormatInt(entry.NumRequests, 10),
+				strconv.FormatInt(entry.NumFailures, 10),
+				strconv.FormatFloat(entry.RPS, 'f', 2, 64),
+				strconv.FormatFloat(entry.AvgResponseTime, 'f', 2, 64),
+				strconv.FormatInt(entry.MinResponseTime, 10),
+				strconv.FormatInt(entry.MaxResponseTime, 10),
+				strconv.FormatInt(entry.P50, 10),
+				strconv.FormatInt(entry.P90, 10),
+				strconv.FormatInt(entry.P95, 10),
+				strconv.FormatInt(entry.P99, 10),
+				strconv.FormatInt(entry.AvgContentLength, 10),
+				strconv.FormatInt(entry.MinContentLength, 10),
+				strconv.FormatInt(entry.MaxContentLength, 10),
+			})
+		}
+		writer.Flush()
+		return writer.Error()
+	case ReportHTML:
+		return finalReportTemplate.Execute(w, &htmlReport{
+			finalReport: report,
+			Charts:      timelineCharts(report.Timeline),
+		})
+	case ReportText:
+		return writeTextReport(w, report)
+	default:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+}
+
+// writeTextReport writes the stats and the errors of report as aligned text tables.
+func writeTextReport(w io.Writer, report *finalReport) error {
+	fmt.Fprintf(w, "From %s to %s, %d seconds\n\n", report.StartTime, report.EndTime, report.Duration)
+
+	writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(writer, "Type\tName\t# requests\t# fails\tRPS\tAverage\tMin\tMax\t50%\t90%\t95%\t99%\t")
+	for _, entry := range append(report.Stats, report.Total) {
+		failureRatio := float64(0)
+		if entry.NumRequests > 0 {
+			failureRatio = float64(entry.NumFailures) / float64(entry.NumRequests) * 100
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%d\t%d(%.2f%%)\t%.2f\t%.2f\t%d\t%d\t%d\t%d\t%d\t%d\t\n",
+			entry.Method, entry.Name, entry.NumRequests, entry.NumFailures, failureRatio, entry.RPS,
+			entry.AvgResponseTime, entry.MinResponseTime, entry.MaxResponseTime, entry.P50, entry.P90, entry.P95, entry.P99)
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	if len(report.Errors) == 0 {
+		return nil
+	}
+	fmt.Fprintln(w, "\nErrors")
+	writer = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "Occurrences\tType\tName\tError")
+	for _, e := range report.Errors {
+		fmt.Fprintf(writer, "%d\t%s\t%s\t%s\n", e.Occurrences, e.Method, e.Name, e.Error)
+	}
+	return writer.Flush()
+}
+
+// summaryOutput prints the lifetime aggregates as text when the test is stopped, like locust does on exit,
+// and writes them to a file too, if path isn't empty.
+type summaryOutput struct {
+	*finalReportOutput
+	stdout io.Writer
+}
+
+func newSummaryOutput(path string) *summaryOutput {
+	return &summaryOutput{
+		finalReportOutput: newFinalReportOutput(path, ReportText),
+		stdout:            os.Stdout,
+	}
+}
+
+// Init creates the file if path isn't empty.
+func (o *summaryOutput) Init() error {
+	if o.path == "" {
+		return nil
+	}
+	return o.finalReportOutput.Init()
+}
+
+// OnStart starts over the lifetime aggregates, so every test has its own summary.
+func (o *summaryOutput) OnStart() {
+	o.stats = newLifetimeStats()
+	if o.path == "" {
+		return
+	}
+	o.finalReportOutput.OnStart()
+}
+
+// OnStop prints the summary, and writes it to the file.
+func (o *summaryOutput) OnStop() {
+	report := o.report(time.Now())
+	fmt.Fprintln(o.stdout)
+	if err := o.write(o.stdout, report); err != nil {
+		logError("Failed to print the summary, %v", err)
+	}
+	fmt.Fprintln(o.stdout)
+	o.writeFile(report)
+}
@@ -0,0 +1,225 @@
+package boomer
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func runFinalReport(t *testing.T, format ReportFormat) string {
+	dir, err := ioutil.TempDir("", "boomer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "report")
+
+	o := newFinalReportOutput(path, format)
+	if err := o.Init(); err != nil {
+		t.Fatal(err)
+	}
+	o.OnStart()
+
+	collector := NewStatsCollector()
+	collector.RecordSuccess("http", "foo", 10, 100)
+	collector.RecordFailure("http", "foo", 30, "500 error")
+	o.OnEvent(collector.Report())
+	collector.RecordSuccess("http", "foo", 20, 100)
+	collector.RecordSuccess("http", "bar", 5, 100)
+	collector.RecordFailure("http", "foo", 30, "500 error")
+	o.OnEvent(collector.Report())
+	o.OnStop()
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestFinalReportJSON(t *testing.T) {
+	content := runFinalReport(t, ReportJSON)
+
+	var report struct {
+		Stats []struct {
+			Name            string `json:"name"`
+			NumRequests     int64  `json:"num_requests"`
+			NumFailures     int64  `json:"num_failures"`
+			MinResponseTime int64  `json:"min_response_time"`
+			MaxResponseTime int64  `json:"max_response_time"`
+		} `json:"stats"`
+		Total struct {
+			NumRequests int64 `json:"num_requests"`
+		} `json:"total"`
+		Errors []struct {
+			Occurrences int64 `json:"occurrences"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal([]byte(content), &report); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Stats) != 2 || report.Stats[1].Name != "foo" {
+		t.Fatal("There should be 2 entries sorted by name, got:", content)
+	}
+	foo := report.Stats[1]
+	if foo.NumRequests != 4 || foo.NumFailures != 2 {
+		t.Error("The intervals should be aggregated, got:", foo.NumRequests, foo.NumFailures)
+	}
+	if foo.MinResponseTime != 10 || foo.MaxResponseTime != 30 {
+		t.Error("The min and max response times are wrong, got:", foo.MinResponseTime, foo.MaxResponseTime)
+	}
+	if report.Total.NumRequests != 5 {
+		t.Error("num_requests of total is wrong, expected: 5, got:", report.Total.NumRequests)
+	}
+	if len(report.Errors) != 1 || report.Errors[0].Occurrences != 2 {
+		t.Error("The errors should be aggregated, got:", report.Errors)
+	}
+}
+
+func TestFinalReportCSV(t *testing.T) {
+	content := runFinalReport(t, ReportCSV)
+	lines := strings.Split(strings.TrimSpace(content), "\n")
+
+	if len(lines) != 4 {
+		t.Fatal("Expected a header, 2 entries and the total, got:", content)
+	}
+	if !strings.HasPrefix(lines[2], "http,foo,4,2,") {
+		t.Error("Unexpected line of foo:", lines[2])
+	}
+	if !strings.HasPrefix(lines[3], ",Total,5,2,") {
+		t.Error("Unexpected line of total:", lines[3])
+	}
+}
+
+func TestFinalReportHTML(t *testing.T) {
+	content := runFinalReport(t, ReportHTML)
+
+	if !strings.Contains(content, "<td>foo</td><td>4</td><td>2</td>") {
+		t.Error("The report should contain foo, got:", content)
+	}
+	if !strings.Contains(content, "500 error") {
+		t.Error("The report should contain the errors, got:", content)
+	}
+	if strings.Count(content, "<svg") != 3 || !regexp.MustCompile(`<polyline [^>]*points="[0-9., ]+"`).MatchString(content) {
+		t.Error("The report should contain the charts, got:", content)
+	}
+}
+
+func TestFinalReportTimeline(t *testing.T) {
+	l := newLifetimeStats()
+	l.startTime = time.Now().Add(-2 * time.Second)
+	collector := NewStatsCollector()
+	for i := 0; i < 10; i++ {
+		collector.RecordSuccess("http", "foo", int64(i*10), 100)
+	}
+	collector.RecordFailure("http", "foo", 100, "500 error")
+	collector.RecordFailure("http", "foo", 100, "500 error")
+	data := collector.Report()
+	data["user_count"] = int32(5)
+	l.add(data)
+
+	if len(l.timeline) != 1 {
+		t.Fatal("There should be a point of the interval, got", len(l.timeline))
+	}
+	point := l.timeline[0]
+	if point.Users != 5 {
+		t.Error("The users should be 5, got", point.Users)
+	}
+	if point.RPS < 5 || point.RPS > 6 || point.FailuresPerSecond < 0.9 || point.FailuresPerSecond > 1 {
+		t.Error("The RPS should be 6 and the failures should be 1 per second, got", point.RPS, point.FailuresPerSecond)
+	}
+	if point.P50 != 50 || point.P99 != 100 {
+		t.Error("The percentiles are wrong, got", point.P50, point.P99)
+	}
+}
+
+func TestFinalReportText(t *testing.T) {
+	content := runFinalReport(t, ReportText)
+
+	if !regexp.MustCompile(`http +foo +4 +2\(50\.00%\)`).MatchString(content) {
+		t.Error("The report should contain foo with the failure ratio, got:", content)
+	}
+	if !regexp.MustCompile(`Total +5 +2\(40\.00%\)`).MatchString(content) {
+		t.Error("The report should contain the total, got:", content)
+	}
+	if !regexp.MustCompile(`2 +http +foo +500 error`).MatchString(content) {
+		t.Error("The report should contain the errors, got:", content)
+	}
+}
+
+func TestSummaryOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boomer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "summary.txt")
+
+	var stdout bytes.Buffer
+	o := newSummaryOutput(path)
+	o.stdout = &stdout
+	if err := o.Init(); err != nil {
+		t.Fatal(err)
+	}
+	o.OnStart()
+	collector := NewStatsCollector()
+	collector.RecordSuccess("http", "foo", 10, 100)
+	o.OnEvent(collector.Report())
+	o.OnStop()
+
+	if !strings.Contains(stdout.String(), "foo") {
+		t.Error("The summary should be printed, got:", stdout.String())
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(content)) != strings.TrimSpace(stdout.String()) {
+		t.Error("The summary file should be the same as the printed summary, got:", string(content))
+	}
+
+	// the next test has its own summary
+	stdout.Reset()
+	o.OnStart()
+	o.OnStop()
+	if strings.Contains(stdout.String(), "foo") {
+		t.Error("The summary of the last test should be cleared, got:", stdout.String())
+	}
+}
+
+func TestSummaryOutputWithoutFile(t *testing.T) {
+	var stdout bytes.Buffer
+	o := newSummaryOutput("")
+	o.stdout = &stdout
+	if err := o.Init(); err != nil {
+		t.Fatal(err)
+	}
+	o.OnStart()
+	o.OnStop()
+	if !strings.Contains(stdout.String(), "Total") {
+		t.Error("The summary should be printed, got:", stdout.String())
+	}
+}
+
+func TestFinalReportSkipsWarmup(t *testing.T) {
+	l := newLifetimeStats()
+	collector := NewStatsCollector()
+	collector.RecordSuccess("http", "foo", 1000, 100)
+	data := collector.Report()
+	data["warmup"] = true
+	l.add(data)
+	collector.RecordSuccess("http", "foo", 10, 100)
+	l.add(collector.Report())
+
+	entries := l.summarize(time.Now())
+	if len(entries) != 1 || entries[0].NumRequests != 1 || entries[0].MaxResponseTime != 10 {
+		t.Error("The warm-up period should be excluded from the lifetime stats, got", entries)
+	}
+}
@@ -0,0 +1,56 @@
+package boomer
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// WithRetry wraps fn, which makes a request and returns an error if it fails, into a function which calls fn
+// again on failure, up to n more times, sleeping backoff between the attempts. It returns nil as soon as
+// an attempt succeeds, or the error of the last attempt if all of them fail. The retried attempts are counted
+// and reported as "num_retries" of each interval, so the retries are still visible while the stats only reflect
+// the final outcome. fn shouldn't record its own result, use RecordWithRetry to record the final outcome,
+// or time the returned function and record it yourself.
+//
+// Only use it for idempotent operations, a failed attempt may have taken effect on the server, e.g. timed out
+// after the server handled the request, so a retried non-idempotent request may be applied more than once.
+func (b *Boomer) WithRetry(n int, backoff time.Duration, fn func() error) func() error {
+	return func() error {
+		err := fn()
+		for i := 0; i < n && err != nil; i++ {
+			if stats := b.getStats(); stats != nil {
+				atomic.AddInt64(&stats.numRetries, 1)
+			}
+			time.Sleep(backoff)
+			err = fn()
+		}
+		return err
+	}
+}
+
+// RecordWithRetry calls fn with WithRetry, and records the final outcome as a single request, whose response time
+// is the cumulative time of all the attempts, including the backoff. A failure is recorded only if all the attempts fail.
+// It returns the error of the last attempt, if all of them fail. Like WithRetry, only use it for idempotent operations.
+func (b *Boomer) RecordWithRetry(requestType, name string, n int, backoff time.Duration, fn func() error) error {
+	start := time.Now()
+	err := b.WithRetry(n, backoff, fn)()
+	elapsed := time.Since(start).Nanoseconds() / int64(time.Millisecond)
+	if err != nil {
+		b.RecordFailure(requestType, name, elapsed, err.Error())
+	} else {
+		b.RecordSuccess(requestType, name, elapsed, 0)
+	}
+	return err
+}
+
+// WithRetry retries fn up to n times on failure, see Boomer.WithRetry.
+// It's a convenience function to use the defaultBoomer.
+func WithRetry(n int, backoff time.Duration, fn func() error) func() error {
+	return defaultBoomer.WithRetry(n, backoff, fn)
+}
+
+// RecordWithRetry retries fn up to n times on failure and records the final outcome, see Boomer.RecordWithRetry.
+// It's a convenience function to use the defaultBoomer.
+func RecordWithRetry(requestType, name string, n int, backoff time.Duration, fn func() error) error {
+	return defaultBoomer.RecordWithRetry(requestType, name, n, backoff, fn)
+}
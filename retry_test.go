@@ -0,0 +1,61 @@
+package boomer
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWithRetry(t *testing.T) {
+	masterHost := "127.0.0.1"
+	masterPort := 5557
+	defaultBoomer = NewBoomer(masterHost, masterPort)
+	defaultBoomer.slaveRunner = newSlaveRunner(masterHost, masterPort, nil, nil)
+
+	attempts := 0
+	fn := WithRetry(3, time.Millisecond, func() error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("flaky")
+		}
+		return nil
+	})
+
+	if err := fn(); err != nil {
+		t.Error("The third attempt should succeed, got:", err)
+	}
+	if attempts != 3 {
+		t.Error("Expected 3 attempts, got:", attempts)
+	}
+	if defaultBoomer.slaveRunner.stats.numRetries != 2 {
+		t.Error("Expected 2 retries, got:", defaultBoomer.slaveRunner.stats.numRetries)
+	}
+}
+
+func TestRecordWithRetry(t *testing.T) {
+	masterHost := "127.0.0.1"
+	masterPort := 5557
+	defaultBoomer = NewBoomer(masterHost, masterPort)
+	defaultBoomer.slaveRunner = newSlaveRunner(masterHost, masterPort, nil, nil)
+
+	attempts := 0
+	err := RecordWithRetry("http", "foo", 2, time.Millisecond, func() error {
+		attempts++
+		return errors.New("always fails")
+	})
+
+	if err == nil || err.Error() != "always fails" {
+		t.Error("The error of the last attempt should be returned, got:", err)
+	}
+	if attempts != 3 {
+		t.Error("Expected 3 attempts, got:", attempts)
+	}
+	_, failures := takeRecords(defaultBoomer.slaveRunner.stats)
+	if len(failures) != 1 {
+		t.Fatal("Only 1 failure should be recorded")
+	}
+	requestFailureMsg := failures[0]
+	if requestFailureMsg.responseTime < 2 {
+		t.Error("The response time should include the backoff, got:", requestFailureMsg.responseTime)
+	}
+}
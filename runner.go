@@ -1,11 +1,12 @@
 package boomer
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"math/rand"
 	"os"
 	"runtime/debug"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -23,13 +24,33 @@ const (
 const (
 	slaveReportInterval = 3 * time.Second
 	heartbeatInterval   = 1 * time.Second
+	// the workers check the iteration quota again after iterationLimitWait once it's reached,
+	// the quota is raised if other workers leave the cluster.
+	iterationLimitWait = 100 * time.Millisecond
+	// the reporting goroutine warns once the memory usage exceeds memoryWarningPercent of the max memory.
+	memoryWarningPercent = 90
+)
+
+// The connection to the master is considered lost if no heartbeat is received from the master within
+// masterHeartbeatTimeout, like locust workers do. The reconnecting backoff is doubled after every failed
+// attempt, up to maxReconnectBackoff. They are variables for testing.
+var (
+	masterHeartbeatTimeout = 60 * time.Second
+	reconnectBackoff       = 1 * time.Second
+	maxReconnectBackoff    = 30 * time.Second
 )
 
 type runner struct {
-	state string
+	state     string
+	stateLock sync.RWMutex
 
+	// tasks can be changed while the test is running by addTask and removeTask, guarded by workersLock.
 	tasks           []*Task
 	totalTaskWeight int
+	// taskUsers is the number of users of each task asked for by the master, if its user classes are named
+	// after the tasks, see selectTasks. nil means the workers are distributed by the weights of the tasks.
+	// Guarded by workersLock.
+	taskUsers map[*Task]int
 
 	rateLimiter      RateLimiter
 	rateLimitEnabled bool
@@ -37,19 +58,164 @@ type runner struct {
 
 	numClients int32
 	spawnRate  float64
+	// targetClients is the number of users asked for by the last spawn or rescale, it's updated atomically.
+	// userCountMismatch is the last mismatch between numClients and targetClients which is logged.
+	targetClients     int32
+	userCountMismatch int32
+
+	// rand is used by all the randomness in scheduling, like assigning a task to a worker when the tasks tie.
+	rand *rand.Rand
 
 	// all running workers(goroutines) will select on this channel.
 	// close this channel will stop all running workers.
 	stopChan chan bool
 
+	// close this channel will stop the spawning goroutine, but not the workers it has spawned.
+	spawnCancelChan chan bool
+
+	// all the running workers, a worker is removed when it exits or is stopped by rescale.
+	workers     map[*worker]bool
+	workersLock sync.Mutex
+
 	// close this channel will stop all goroutines used in runner.
 	closeChan chan bool
 
-	outputs []Output
+	// closed by the reporting goroutine, after the last interval's data is delivered
+	// and all the outputs are stopped.
+	reportDoneChan chan bool
+
+	outputs          []Output
+	rawSampleOutputs []RawSampleOutput
+
+	// paused is 1 while the iterations are suspended by pause, it's updated atomically. The workers wait for
+	// resumeChan to be closed by resume then, resumeChan is guarded by pauseLock.
+	paused     int32
+	pauseLock  sync.Mutex
+	resumeChan chan bool
+
+	// hatchStrategy decides when the users are spawned, SmoothHatch is used if it's nil.
+	hatchStrategy HatchStrategy
+
+	// startAt is the time in nanoseconds when the users start spawning, so the workers start at the same instant,
+	// 0 means at once. It's updated atomically, by the spawn messages of the master too.
+	startAt int64
+
+	// runTime limits the duration of the test since the users are spawned for the first time,
+	// onRunTimeExceeded is called once it's reached.
+	runTime           time.Duration
+	runTimeOnce       sync.Once
+	onRunTimeExceeded func()
+
+	// iterationLimit limits the number of the calls of the task functions, onIterationLimitReached is called
+	// once they are finished. In distributed mode, it's split over the workers, see iterationQuota.
+	iterationLimit          int64
+	iterationOnce           sync.Once
+	onIterationLimitReached func()
+	// startedIterations and finishedIterations count the calls of the task functions, they are updated atomically.
+	startedIterations  int64
+	finishedIterations int64
+	// workerCount is the number of the workers sent by the master, it's updated atomically.
+	workerCount int32
+
+	// arrivalRate enables the open model, the iterations are started at the rate per second by the free workers,
+	// instead of in a loop. An arrival is dropped if all the workers are busy. In distributed mode, it's split
+	// over the workers like iterationLimit.
+	arrivalRate  float64
+	arrivalChan  chan bool
+	interArrival InterArrival
+	// droppedArrivals is updated atomically, reportedDroppedArrivals is used by the reporting goroutine only.
+	droppedArrivals         int64
+	reportedDroppedArrivals int64
+
+	// maxWorkers and maxMemory cap the workers and the resident memory of the process, in bytes, no more workers
+	// are spawned once any of them is reached, so the process doesn't run out of resources in the middle of a test.
+	// memoryUsage returns the resident memory, it's set by setResourceLimits.
+	maxWorkers  int
+	maxMemory   uint64
+	memoryUsage func() uint64
+
+	// drainTimeout is how long stop waits for the running task functions to return,
+	// their contexts are canceled once it's expired.
+	drainTimeout time.Duration
+	// runningWorkers counts the goroutines of workers which haven't returned, it's updated atomically.
+	runningWorkers int32
+
+	// the hooks called when the test starts and stops, besides the OnStart and OnStop of the tasks.
+	testStartHooks []func()
+	testStopHooks  []func()
+
+	// circuitBreakers pauses or slows down the tasks whose requests keep failing, it's nil if there aren't any breakers.
+	circuitBreakers *circuitBreakerOutput
+	// slos evaluates the SLOs before the outputs receive the stats, it's nil if there aren't any SLOs.
+	slos *sloTracker
+
+	// warmupDuration is the warm-up period since the test starts, whose stats are reported with "warmup" true.
+	warmupDuration time.Duration
+
+	// runID and runLabels are reported in every interval as "run_id" and "run_labels", if they're set.
+	runID     string
+	runLabels map[string]string
+
+	// the lifecycle events are published to the event bus and the hooks of the Boomer.
+	eventPublisher
+}
+
+// worker is a goroutine that runs tasks.
+type worker struct {
+	// the task run by this worker, it's assigned when the worker is spawned.
+	task *Task
+	// closed to stop this worker only, or by runner.stop.
+	quit chan bool
+	// set to 1 while the worker is sleeping in think time or waiting for the rate limiter.
+	idle int32
+	// the virtual user, it's passed to the task in every iteration.
+	user *User
+}
+
+// sleep returns false if the worker is stopped before d elapses.
+func (w *worker) sleep(d time.Duration) bool {
+	atomic.StoreInt32(&w.idle, 1)
+	defer atomic.StoreInt32(&w.idle, 0)
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-w.quit:
+		return false
+	}
+}
+
+// workerCountAware is implemented by the rate limiters which depend on the number of workers, like DistributedRateLimiter.
+type workerCountAware interface {
+	SetWorkerCount(n int)
+}
+
+// interruptibleRateLimiter is implemented by the built-in rate limiters.
+type interruptibleRateLimiter interface {
+	acquireUntil(quit chan bool) (blocked bool)
+}
+
+// setState changes the state, and publishes the transition.
+func (r *runner) setState(state string) {
+	r.stateLock.Lock()
+	changed := r.state != state
+	r.state = state
+	r.stateLock.Unlock()
+	if changed {
+		r.publishState(state)
+	}
+}
+
+func (r *runner) getState() string {
+	r.stateLock.RLock()
+	defer r.stateLock.RUnlock()
+	return r.state
 }
 
 // safeRun runs fn and recovers from unexpected panics.
-// it prevents panics from Task.Fn crashing boomer.
+// it prevents panics from the hooks crashing boomer.
 func (r *runner) safeRun(fn func()) {
 	defer func() {
 		// don't panic
@@ -65,52 +231,159 @@ func (r *runner) safeRun(fn func()) {
 	fn()
 }
 
-func (r *runner) addOutput(o Output) {
-	r.outputs = append(r.outputs, o)
+// runTask runs the task of w once, a panic is recovered and recorded as a failure of the task,
+// so a panicking iteration is counted in the stats instead of being only written to stderr.
+// If the task has a Timeout, the iteration is abandoned once it's exceeded, see Task.Timeout.
+func (r *runner) runTask(ctx context.Context, w *worker) {
+	if w.task.Timeout <= 0 {
+		r.safeRunTask(ctx, w.task)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, w.task.Timeout)
+	defer cancel()
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		r.safeRunTask(ctx, w.task)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		if ctx.Err() != context.DeadlineExceeded {
+			// the worker is stopped, wait for the iteration like the tasks without a timeout
+			<-done
+			return
+		}
+		r.recordTaskFailure(w.task, "timeout", w.task.Timeout, fmt.Sprintf("iteration timed out after %v", w.task.Timeout), ErrorTimeout, "")
+	}
 }
 
-func (r *runner) outputOnStart() {
-	size := len(r.outputs)
-	if size == 0 {
+// safeRunTask calls task.run, and recovers from its panic.
+func (r *runner) safeRunTask(ctx context.Context, task *Task) {
+	start := time.Now()
+	defer func() {
+		if err := recover(); err != nil {
+			r.recordPanic(task, err, time.Since(start))
+		}
+	}()
+	task.run(ctx)
+}
+
+// recordPanic logs err recovered from a worker of task, and records it as a failure of the task,
+// whose error is reported with ErrorPanic as the category and the stack trace attached.
+func (r *runner) recordPanic(task *Task, err interface{}, elapsed time.Duration) {
+	stack := string(debug.Stack())
+	logError("Recovered from a panic of task %q: %v\n%s", task.Name, err, stack)
+	r.recordTaskFailure(task, "panic", elapsed, fmt.Sprintf("%v", err), ErrorPanic, stack)
+}
+
+// recordTaskFailure records a failure of task detected by boomer, like a panic or a timeout,
+// named after the task.
+func (r *runner) recordTaskFailure(task *Task, requestType string, elapsed time.Duration, err string, category ErrorCategory, stack string) {
+	if r.stats == nil {
 		return
 	}
-	wg := sync.WaitGroup{}
-	wg.Add(size)
-	for _, output := range r.outputs {
-		go func(o Output) {
-			o.OnStart()
-			wg.Done()
-		}(output)
+	name := task.Name
+	if name == "" {
+		name = "unnamed"
 	}
-	wg.Wait()
+	r.stats.recentResults.add(true)
+	r.stats.recordFailure(requestFailure{
+		requestType:  requestType,
+		name:         name,
+		responseTime: elapsed.Milliseconds(),
+		error:        err,
+		category:     category,
+		stack:        stack,
+		timestamp:    Now(),
+	})
 }
 
-func (r *runner) outputOnEevent(data map[string]interface{}) {
-	size := len(r.outputs)
-	if size == 0 {
+// respawnWorker replaces w, whose goroutine is crashed by a panic out of the task, with a worker of the same
+// task and user, so the user count isn't distorted. It's a noop if w is already removed by rescale or stop.
+func (r *runner) respawnWorker(w *worker, quit chan bool) {
+	r.workersLock.Lock()
+	defer r.workersLock.Unlock()
+
+	if _, ok := r.workers[w]; !ok {
 		return
 	}
-	wg := sync.WaitGroup{}
-	wg.Add(size)
-	for _, output := range r.outputs {
-		go func(o Output) {
-			o.OnEvent(data)
-			wg.Done()
-		}(output)
+	select {
+	case <-quit:
+		return
+	default:
 	}
-	wg.Wait()
+	delete(r.workers, w)
+	replacement := &worker{quit: make(chan bool), task: w.task, user: w.user}
+	r.workers[replacement] = true
+	atomic.AddInt32(&r.runningWorkers, 1)
+	go r.runWorker(replacement, quit)
+}
+
+// addRunMetadata adds the run ID and the run labels to the data of an interval.
+func (r *runner) addRunMetadata(data map[string]interface{}) {
+	if r.runID != "" {
+		data["run_id"] = r.runID
+	}
+	if len(r.runLabels) > 0 {
+		data["run_labels"] = r.runLabels
+	}
+}
+
+func (r *runner) addOutput(o Output) {
+	r.outputs = append(r.outputs, o)
+}
+
+// addRawSampleOutput must be called before the stats goroutine is started.
+func (r *runner) addRawSampleOutput(o RawSampleOutput) {
+	r.rawSampleOutputs = append(r.rawSampleOutputs, o)
+	r.stats.rawSampleOutputs = r.rawSampleOutputs
+}
+
+// rawSampleOutputOnStart must be called before the stats goroutine is started.
+func (r *runner) rawSampleOutputOnStart() {
+	for _, o := range r.rawSampleOutputs {
+		o.OnStart()
+	}
+}
+
+// rawSampleOutputOnStop must be called after the stats goroutine is stopped.
+func (r *runner) rawSampleOutputOnStop() {
+	for _, o := range r.rawSampleOutputs {
+		o.OnStop()
+	}
+}
+
+func (r *runner) outputOnStart() {
+	callOutputs(r.outputs, func(o Output) {
+		o.OnStart()
+	})
+}
+
+func (r *runner) outputOnEevent(data map[string]interface{}) {
+	callOutputs(r.outputs, func(o Output) {
+		o.OnEvent(data)
+	})
 }
 
 func (r *runner) outputOnStop() {
-	size := len(r.outputs)
+	callOutputs(r.outputs, func(o Output) {
+		o.OnStop()
+	})
+}
+
+// callOutputs calls fn with every output in a separated goroutine, and waits for all of them to return.
+func callOutputs(outputs []Output, fn func(o Output)) {
+	size := len(outputs)
 	if size == 0 {
 		return
 	}
 	wg := sync.WaitGroup{}
 	wg.Add(size)
-	for _, output := range r.outputs {
+	for _, output := range outputs {
 		go func(o Output) {
-			o.OnStop()
+			fn(o)
 			wg.Done()
 		}(output)
 	}
@@ -118,120 +391,933 @@ func (r *runner) outputOnStop() {
 }
 
 func (r *runner) spawnWorkers(spawnCount int, quit chan bool, spawnCompleteFunc func()) {
-	log.Println("Spawning", spawnCount, "clients at the rate", r.spawnRate, "clients/s...")
+	r.spawn(spawnCount, quit, nil, spawnCompleteFunc)
+}
 
+// spawn starts spawnCount workers, it stops spawning if quit or cancel is closed.
+// Closing cancel only stops spawning, the workers that are already spawned keep running.
+func (r *runner) spawn(spawnCount int, quit chan bool, cancel chan bool, spawnCompleteFunc func()) {
+	if delay := r.startDelay(); delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-quit:
+			return
+		case <-cancel:
+			return
+		}
+	}
+
+	if r.spawnRate > 0 {
+		logInfo("Spawning %d clients at the rate %v clients/s...", spawnCount, r.spawnRate)
+	} else {
+		logInfo("Spawning %d clients at once...", spawnCount)
+	}
+
+	hatchStrategy := r.hatchStrategy
+	if hatchStrategy == nil {
+		hatchStrategy = SmoothHatch{}
+	}
 	for i := 1; i <= spawnCount; i++ {
-		sleepTime := time.Duration(1000000/r.spawnRate) * time.Microsecond
-		time.Sleep(sleepTime)
+		// a spawn rate of 0 means no limit, like the spawn messages of locust 2.x
+		if delay := hatchStrategy.Delay(i-1, spawnCount, r.spawnRate); delay > 0 {
+			time.Sleep(delay)
+		}
+
+		if reason := r.resourceLimitReached(); reason != "" {
+			logError("Stop spawning at %d clients, %s", atomic.LoadInt32(&r.numClients), reason)
+			break
+		}
+		if len(r.getTasks()) == 0 {
+			logError("Stop spawning at %d clients, there are no tasks to run", atomic.LoadInt32(&r.numClients))
+			break
+		}
 
 		select {
 		case <-quit:
 			// quit spawning goroutine
 			return
 		default:
-			atomic.AddInt32(&r.numClients, 1)
-			go func() {
-				for {
-					select {
-					case <-quit:
+			w := r.addWorker(cancel)
+			if w == nil {
+				// spawning is canceled by rescale
+				return
+			}
+			atomic.AddInt32(&r.runningWorkers, 1)
+			go r.runWorker(w, quit)
+		}
+	}
+
+	if spawnCompleteFunc != nil {
+		spawnCompleteFunc()
+	}
+}
+
+// pause suspends the iterations of the workers, the workers and their users are kept, the running iterations
+// are finished. It returns false if the runner is already paused.
+func (r *runner) pause() bool {
+	r.pauseLock.Lock()
+	defer r.pauseLock.Unlock()
+	if r.resumeChan != nil {
+		return false
+	}
+	r.resumeChan = make(chan bool)
+	atomic.StoreInt32(&r.paused, 1)
+	return true
+}
+
+// resume continues the iterations suspended by pause. It returns false if the runner isn't paused.
+func (r *runner) resume() bool {
+	r.pauseLock.Lock()
+	defer r.pauseLock.Unlock()
+	if r.resumeChan == nil {
+		return false
+	}
+	atomic.StoreInt32(&r.paused, 0)
+	close(r.resumeChan)
+	r.resumeChan = nil
+	return true
+}
+
+func (r *runner) isPaused() bool {
+	return atomic.LoadInt32(&r.paused) == 1
+}
+
+// waitForResume blocks the worker while the runner is paused, it returns false if the worker is stopped.
+func (r *runner) waitForResume(w *worker, quit chan bool) bool {
+	if !r.isPaused() {
+		return true
+	}
+	r.pauseLock.Lock()
+	resumeChan := r.resumeChan
+	r.pauseLock.Unlock()
+	if resumeChan == nil {
+		return true
+	}
+
+	atomic.StoreInt32(&w.idle, 1)
+	defer atomic.StoreInt32(&w.idle, 0)
+	select {
+	case <-resumeChan:
+		return true
+	case <-quit:
+		return false
+	case <-w.quit:
+		return false
+	}
+}
+
+// runWorker calls Fn or FnWithContext of the worker's task in a loop, until the runner is stopped or the worker is removed by rescale.
+func (r *runner) runWorker(w *worker, quit chan bool) {
+	defer atomic.AddInt32(&r.runningWorkers, -1)
+	defer r.removeWorker(w)
+	defer func() {
+		// the task is recovered by runTask, this is a panic of WaitTime, a rate limiter or the like
+		if err := recover(); err != nil {
+			r.recordPanic(w.task, err, 0)
+			r.respawnWorker(w, quit)
+		}
+	}()
+
+	// the context passed to Task.FnWithContext, it's canceled once the worker is stopped,
+	// or the drain timeout is expired after that.
+	ctx, cancel := context.WithCancel(ContextWithUser(context.Background(), w.user))
+	defer cancel()
+	go func() {
+		select {
+		case <-quit:
+		case <-w.quit:
+		case <-ctx.Done():
+			return
+		}
+		if r.drainTimeout > 0 {
+			timer := time.NewTimer(r.drainTimeout)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+			}
+			timer.Stop()
+		}
+		cancel()
+	}()
+
+	for {
+		select {
+		case <-quit:
+			return
+		case <-w.quit:
+			return
+		default:
+			if !r.waitForResume(w, quit) {
+				return
+			}
+			if r.circuitBreakers != nil {
+				paused, delay := r.circuitBreakers.wait(w.task.Name)
+				if paused {
+					if !w.sleep(circuitBreakerWait) {
 						return
-					default:
-						if r.rateLimitEnabled {
-							blocked := r.rateLimiter.Acquire()
-							if !blocked {
-								task := r.getTask()
-								r.safeRun(task.Fn)
-							}
-						} else {
-							task := r.getTask()
-							r.safeRun(task.Fn)
-						}
 					}
+					continue
 				}
-			}()
+				if delay > 0 && !w.sleep(delay) {
+					return
+				}
+			}
+			if r.arrivalChan != nil {
+				atomic.StoreInt32(&w.idle, 1)
+				select {
+				case <-r.arrivalChan:
+				case <-quit:
+					return
+				case <-w.quit:
+					return
+				}
+				atomic.StoreInt32(&w.idle, 0)
+			}
+			if w.task.RateLimiter != nil {
+				atomic.StoreInt32(&w.idle, 1)
+				blocked := acquire(w.task.RateLimiter, w.quit)
+				atomic.StoreInt32(&w.idle, 0)
+				if blocked {
+					continue
+				}
+			}
+			if r.rateLimitEnabled {
+				atomic.StoreInt32(&w.idle, 1)
+				blocked := acquire(r.rateLimiter, w.quit)
+				atomic.StoreInt32(&w.idle, 0)
+				if blocked {
+					continue
+				}
+			}
+			if !r.startIteration() {
+				// the iteration limit is reached, wait for boomer to quit
+				if !w.sleep(iterationLimitWait) {
+					return
+				}
+				continue
+			}
+			r.runTask(ctx, w)
+			r.finishIteration()
+			if w.task.WaitTime != nil && !w.sleep(w.task.WaitTime()) {
+				return
+			}
 		}
 	}
-	
-	if spawnCompleteFunc != nil {
+}
+
+// acquire calls Acquire of rateLimiter, the built-in rate limiters stop waiting once quit is closed.
+func acquire(rateLimiter RateLimiter, quit chan bool) (blocked bool) {
+	if limiter, ok := rateLimiter.(interruptibleRateLimiter); ok {
+		return limiter.acquireUntil(quit)
+	}
+	return rateLimiter.Acquire()
+}
+
+// taskRateLimiters returns the rate limiters of the tasks, a rate limiter shared by several tasks is returned once.
+func (r *runner) taskRateLimiters() []RateLimiter {
+	limiters := make([]RateLimiter, 0)
+	seen := make(map[RateLimiter]bool)
+	for _, task := range r.getTasks() {
+		if task.RateLimiter != nil && !seen[task.RateLimiter] {
+			seen[task.RateLimiter] = true
+			limiters = append(limiters, task.RateLimiter)
+		}
+	}
+	return limiters
+}
+
+// addWorker registers a new worker and increases numClients, it returns nil if cancel is closed.
+func (r *runner) addWorker(cancel chan bool) *worker {
+	r.workersLock.Lock()
+	defer r.workersLock.Unlock()
+
+	select {
+	case <-cancel:
+		return nil
+	default:
+	}
+	if r.workers == nil {
+		r.workers = make(map[*worker]bool)
+	}
+	w := &worker{quit: make(chan bool), task: r.assignTask(), user: newUser(r.freeUserIndex(), r.rand.Int63())}
+	r.workers[w] = true
+	atomic.AddInt32(&r.numClients, 1)
+	return w
+}
+
+// removeWorker is called when a worker exits, the worker is no longer counted in numClients.
+// It's a noop if the worker is already removed by rescale or stop.
+// freeUserIndex returns the lowest index which isn't used by the running workers. Must be called with workersLock held.
+func (r *runner) freeUserIndex() int {
+	used := make(map[int]bool, len(r.workers))
+	for w := range r.workers {
+		used[w.user.Index] = true
+	}
+	index := 0
+	for used[index] {
+		index++
+	}
+	return index
+}
+
+func (r *runner) removeWorker(w *worker) {
+	r.workersLock.Lock()
+	defer r.workersLock.Unlock()
+
+	if _, ok := r.workers[w]; ok {
+		delete(r.workers, w)
+		atomic.AddInt32(&r.numClients, -1)
+	}
+}
+
+// stopWorkers stops count workers, the idle ones that are sleeping in think time or waiting
+// for the rate limiter are stopped first. Must be called with workersLock held.
+func (r *runner) stopWorkers(count int) {
+	r.stopTaskWorkers(nil, count)
+}
+
+// stopTaskWorkers stops count workers running task, or any task if task is nil, like stopWorkers.
+// Must be called with workersLock held.
+func (r *runner) stopTaskWorkers(task *Task, count int) {
+	for _, idleOnly := range []bool{true, false} {
+		for w := range r.workers {
+			if count <= 0 {
+				return
+			}
+			if task != nil && w.task != task {
+				continue
+			}
+			if idleOnly && atomic.LoadInt32(&w.idle) == 0 {
+				continue
+			}
+			close(w.quit)
+			delete(r.workers, w)
+			atomic.AddInt32(&r.numClients, -1)
+			count--
+		}
+	}
+}
+
+// rescale changes the number of workers to spawnCount without restarting the running ones.
+// Missing workers are spawned at spawnRate, excess workers are stopped at once.
+func (r *runner) rescale(spawnCount int, spawnRate float64, spawnCompleteFunc func()) {
+	r.publishSpawn(spawnCount, spawnRate)
+
+	r.workersLock.Lock()
+	// cancel the previous spawning goroutine, if it's still running
+	if r.spawnCancelChan != nil {
+		close(r.spawnCancelChan)
+	}
+	r.spawnCancelChan = make(chan bool)
+	cancel := r.spawnCancelChan
+	// the users of the tasks beyond their shares asked for by the master are stopped, the spawned ones make up the others
+	if r.taskUsers != nil {
+		total := 0
+		for _, users := range r.taskUsers {
+			total += users
+		}
+		counts := make(map[*Task]int, len(r.tasks))
+		for w := range r.workers {
+			counts[w.task]++
+		}
+		for task, count := range counts {
+			share := (r.taskUsers[task]*spawnCount + total - 1) / total
+			if excess := count - share; excess > 0 {
+				r.stopTaskWorkers(task, excess)
+			}
+		}
+	}
+	current := len(r.workers)
+	atomic.StoreInt32(&r.targetClients, int32(spawnCount))
+	if spawnCount < current {
+		r.stopWorkers(current - spawnCount)
+	}
+	r.workersLock.Unlock()
+
+	r.spawnRate = spawnRate
+	if spawnCount > current {
+		go r.spawn(spawnCount-current, r.stopChan, cancel, spawnCompleteFunc)
+	} else if spawnCompleteFunc != nil {
 		spawnCompleteFunc()
 	}
 }
 
-// setTasks will set the runner's task list AND the total task weight
-// which is used to get a random task later
-func (r *runner) setTasks(t []*Task) {
-	r.tasks = t
+// userCount returns the number of the running users. Once the users are spawned, it logs if they don't match
+// the users asked for, e.g. the spawning is stopped by the resource limits, or the users have exited by themselves.
+// A mismatch is logged once, until it changes.
+func (r *runner) userCount(spawned bool) int32 {
+	actual := atomic.LoadInt32(&r.numClients)
+	if !spawned {
+		return actual
+	}
+	mismatch := atomic.LoadInt32(&r.targetClients) - actual
+	if atomic.SwapInt32(&r.userCountMismatch, mismatch) != mismatch && mismatch != 0 {
+		logError("%d users are running, %d users are asked for", actual, actual+mismatch)
+	}
+	return actual
+}
+
+// setRandomSeed makes the scheduling reproducible, it must be called before the test is started.
+func (r *runner) setRandomSeed(seed int64) {
+	r.rand = newRand(seed)
+}
+
+// setTasks will set the runner's task list AND the total task weight
+// which is used to assign tasks to the workers later
+func (r *runner) setTasks(t []*Task) {
+	r.tasks = t
+
+	weightSum := 0
+	for _, task := range r.tasks {
+		weightSum += task.Weight
+	}
+	r.totalTaskWeight = weightSum
+}
+
+// selectTasks lets the master pick the tasks to run and their users by the user_classes_count of a locust 2.x
+// spawn message, whose user classes are named after the tasks, so the master can assign different tasks to
+// the workers of a heterogeneous fleet. The tasks missing from it aren't run, and the users of the other user
+// classes run the selected tasks. If none of the user classes named after the tasks has users, the workers are
+// distributed by the weights of the tasks.
+func (r *runner) selectTasks(userClassesCount map[string]interface{}) {
+	r.workersLock.Lock()
+	defer r.workersLock.Unlock()
+
+	taskUsers := make(map[*Task]int)
+	total := 0
+	for _, task := range r.tasks {
+		if task.Name == "" {
+			continue
+		}
+		if count, ok := userClassesCount[task.Name]; ok {
+			taskUsers[task] = int(toInt64(count))
+			total += taskUsers[task]
+		}
+	}
+	if total <= 0 {
+		taskUsers = nil
+	}
+	r.taskUsers = taskUsers
+}
+
+// getTasks returns the tasks, which may be changed by addTask and removeTask while the test is running.
+func (r *runner) getTasks() []*Task {
+	r.workersLock.Lock()
+	defer r.workersLock.Unlock()
+	return r.tasks
+}
+
+// addTask adds task while the test may be running, the workers are rebalanced onto the tasks.
+// If the test is running, OnStart and the rate limiter of task are started first.
+func (r *runner) addTask(task *Task) {
+	if state := r.getState(); state == stateSpawning || state == stateRunning {
+		if task.OnStart != nil {
+			r.safeRun(task.OnStart)
+		}
+		if task.RateLimiter != nil && !r.usesRateLimiter(task.RateLimiter) {
+			task.RateLimiter.Start()
+		}
+	}
+
+	r.workersLock.Lock()
+	defer r.workersLock.Unlock()
+	// copy on write, the slice returned by getTasks may be in use
+	tasks := make([]*Task, 0, len(r.tasks)+1)
+	r.setTasks(append(append(tasks, r.tasks...), task))
+	r.rebalance()
+}
+
+// removeTask removes the tasks named name while the test may be running, their workers are stopped
+// and the others are spawned again to run the remaining tasks. If the test is running, OnStop and
+// the rate limiters of the removed tasks are stopped. It returns false if there is no such task.
+func (r *runner) removeTask(name string) bool {
+	var removed []*Task
+	r.workersLock.Lock()
+	tasks := make([]*Task, 0, len(r.tasks))
+	for _, task := range r.tasks {
+		if task.Name == name {
+			removed = append(removed, task)
+		} else {
+			tasks = append(tasks, task)
+		}
+	}
+	if len(removed) > 0 {
+		r.setTasks(tasks)
+		r.rebalance()
+	}
+	r.workersLock.Unlock()
+
+	if state := r.getState(); state == stateSpawning || state == stateRunning {
+		for _, task := range removed {
+			if task.OnStop != nil {
+				r.safeRun(task.OnStop)
+			}
+			if task.RateLimiter != nil && !r.usesRateLimiter(task.RateLimiter) {
+				task.RateLimiter.Stop()
+			}
+		}
+	}
+	return len(removed) > 0
+}
+
+// usesRateLimiter returns whether any of the tasks uses limiter.
+func (r *runner) usesRateLimiter(limiter RateLimiter) bool {
+	for _, l := range r.taskRateLimiters() {
+		if l == limiter {
+			return true
+		}
+	}
+	return false
+}
+
+// rebalance stops the workers beyond the shares of their tasks by the weights, including the workers of the
+// removed tasks, and spawns as many, which are assigned to the tasks short of workers.
+// Must be called with workersLock held.
+func (r *runner) rebalance() {
+	n := len(r.workers)
+	if n == 0 {
+		return
+	}
+	weights := make(map[*Task]int, len(r.tasks))
+	total := 0
+	for _, task := range r.tasks {
+		if weight := r.taskWeight(task); weight > 0 {
+			weights[task] = weight
+			total += weight
+		}
+	}
+	counts := make(map[*Task]int, len(r.tasks))
+	for w := range r.workers {
+		counts[w.task]++
+	}
+	stopped := 0
+	for task, count := range counts {
+		share := 0
+		if total > 0 {
+			share = (weights[task]*n + total - 1) / total
+		}
+		if excess := count - share; excess > 0 {
+			r.stopTaskWorkers(task, excess)
+			stopped += excess
+		}
+	}
+	if total == 0 {
+		logError("No tasks to run, %d users are stopped", stopped)
+		return
+	}
+	if stopped > 0 {
+		go r.spawn(stopped, r.stopChan, r.spawnCancelChan, nil)
+	}
+}
+
+// taskWeight returns the weight of task in assigning the workers, which is the users of the task
+// asked for by the master if they are, see selectTasks. Must be called with workersLock held.
+func (r *runner) taskWeight(task *Task) int {
+	if r.taskUsers != nil {
+		return r.taskUsers[task]
+	}
+	if r.totalTaskWeight <= 0 {
+		return 1
+	}
+	return task.Weight
+}
+
+// assignTask picks the task run by a new worker, so the workers are distributed over the tasks
+// in proportion to their weights, like locust does with users. It picks the task which is the least
+// represented after adding the worker, ties are broken randomly. If none of the tasks has a weight,
+// they share the workers equally. The users asked for by the master override the weights, see selectTasks.
+// Must be called with workersLock held.
+func (r *runner) assignTask() *Task {
+	tasksCount := len(r.tasks)
+	if tasksCount <= 1 && r.taskUsers == nil {
+		// Fast path
+		if tasksCount == 0 {
+			return nil
+		}
+		return r.tasks[0]
+	}
+
+	counts := make(map[*Task]int, tasksCount)
+	for w := range r.workers {
+		counts[w.task]++
+	}
+
+	var candidates []*Task
+	var bestCount, bestWeight int
+	for _, task := range r.tasks {
+		weight := r.taskWeight(task)
+		if weight <= 0 {
+			continue
+		}
+		// compare (count+1)/weight without rounding errors
+		count := counts[task] + 1
+		switch {
+		case candidates == nil || count*bestWeight < bestCount*weight:
+			candidates = []*Task{task}
+			bestCount, bestWeight = count, weight
+		case count*bestWeight == bestCount*weight:
+			candidates = append(candidates, task)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil
+	}
+	return candidates[r.rand.Intn(len(candidates))]
+}
+
+func (r *runner) startSpawning(spawnCount int, spawnRate float64, spawnCompleteFunc func()) {
+	r.publishSpawn(spawnCount, spawnRate)
+
+	delay := r.startDelay()
+	if delay > 0 {
+		logInfo("The users start spawning at %s, in %v", time.Unix(0, atomic.LoadInt64(&r.startAt)).Format(time.RFC3339), delay)
+	}
+	r.startRunTimer(delay)
+	r.onTestStart()
+	for _, limiter := range r.taskRateLimiters() {
+		limiter.Start()
+	}
+
+	r.stats.clearStatsChan <- true
+	if r.warmupDuration > 0 {
+		r.stats.warmupChan <- delay + r.warmupDuration
+	}
+	r.stopChan = make(chan bool)
+
+	r.spawnRate = spawnRate
+
+	r.workersLock.Lock()
+	r.workers = make(map[*worker]bool)
+	r.spawnCancelChan = make(chan bool)
+	cancel := r.spawnCancelChan
+	r.numClients = 0
+	atomic.StoreInt32(&r.targetClients, int32(spawnCount))
+	atomic.StoreInt32(&r.userCountMismatch, 0)
+	r.workersLock.Unlock()
+
+	go r.spawn(spawnCount, r.stopChan, cancel, spawnCompleteFunc)
+	if r.arrivalChan != nil {
+		go r.scheduleArrivals(r.stopChan)
+	}
+}
+
+// setArrivalRate must be called before the test is started.
+func (r *runner) setArrivalRate(rate float64, interArrival InterArrival) {
+	if rate <= 0 {
+		return
+	}
+	r.arrivalRate = rate
+	r.arrivalChan = make(chan bool)
+	r.interArrival = interArrival
+}
+
+// arrivalInterval returns the interval between the arrivals of this runner, the arrival rate is split
+// over the workers sent by the master.
+func (r *runner) arrivalInterval() time.Duration {
+	rate := r.arrivalRate
+	if count := atomic.LoadInt32(&r.workerCount); count > 1 {
+		rate /= float64(count)
+	}
+	return time.Duration(float64(time.Second) / rate)
+}
+
+// nextArrivalInterval returns the time until the next arrival, by the distribution of interArrival.
+func (r *runner) nextArrivalInterval() time.Duration {
+	if r.interArrival == nil {
+		return r.arrivalInterval()
+	}
+	// the schedule must move forward
+	if d := r.interArrival(r.rand, r.arrivalInterval()); d > 0 {
+		return d
+	}
+	return time.Nanosecond
+}
+
+// scheduleArrivals hands out the arrivals to the free workers on schedule, until quit is closed. The arrivals
+// are never delayed by the busy workers, they are dropped if no worker is free to take them.
+func (r *runner) scheduleArrivals(quit chan bool) {
+	next := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+		case <-quit:
+			return
+		}
+		now := time.Now()
+		for !next.After(now) {
+			// the arrivals are skipped while paused, they aren't dropped by busy users
+			if !r.isPaused() {
+				select {
+				case r.arrivalChan <- true:
+				default:
+					atomic.AddInt64(&r.droppedArrivals, 1)
+				}
+			}
+			next = next.Add(r.nextArrivalInterval())
+		}
+		timer.Reset(next.Sub(now))
+	}
+}
+
+// logDroppedArrivals warns of the arrivals dropped since the last report, it's called by the reporting goroutine.
+func (r *runner) logDroppedArrivals() {
+	dropped := atomic.LoadInt64(&r.droppedArrivals)
+	if dropped > r.reportedDroppedArrivals {
+		logError("%d arrivals are dropped in the last interval, all the users are busy, add more users to keep up with the arrival rate",
+			dropped-r.reportedDroppedArrivals)
+		r.reportedDroppedArrivals = dropped
+	}
+}
+
+// setResourceLimits caps the workers and the resident memory, in bytes, 0 means no limit.
+// It must be called before the test is started.
+func (r *runner) setResourceLimits(maxWorkers int, maxMemory uint64) {
+	r.maxWorkers = maxWorkers
+	r.maxMemory = maxMemory
+	if maxMemory > 0 && r.memoryUsage == nil {
+		r.memoryUsage = newProcessUsage().memoryUsage
+	}
+}
 
-	weightSum := 0
-	for _, task := range r.tasks {
-		weightSum += task.Weight
+// resourceLimitReached returns why no more workers can be spawned, or "" if they can.
+func (r *runner) resourceLimitReached() string {
+	if r.maxWorkers > 0 && int(atomic.LoadInt32(&r.numClients)) >= r.maxWorkers {
+		return fmt.Sprintf("the max workers %d is reached", r.maxWorkers)
 	}
-	r.totalTaskWeight = weightSum
+	if r.maxMemory > 0 && r.memoryUsage != nil {
+		if used := r.memoryUsage(); used >= r.maxMemory {
+			return fmt.Sprintf("the memory usage %dMB reaches the max memory %dMB", used>>20, r.maxMemory>>20)
+		}
+	}
+	return ""
 }
 
-func (r *runner) getTask() *Task {
-	tasksCount := len(r.tasks)
-	if tasksCount == 1 {
-		// Fast path
-		return r.tasks[0]
+// logMemoryUsage warns if the memory usage is approaching the max memory, it's called by the reporting goroutine.
+func (r *runner) logMemoryUsage(used uint64) {
+	if r.maxMemory > 0 && used >= r.maxMemory*memoryWarningPercent/100 {
+		logError("The memory usage %dMB is approaching the max memory %dMB, no more clients are spawned once it's reached",
+			used>>20, r.maxMemory>>20)
 	}
+}
 
-	rs := rand.New(rand.NewSource(time.Now().UnixNano()))
+// setRunTime must be called before the test is started.
+func (r *runner) setRunTime(runTime time.Duration, onRunTimeExceeded func()) {
+	r.runTime = runTime
+	r.onRunTimeExceeded = onRunTimeExceeded
+}
 
-	totalWeight := r.totalTaskWeight
-	if totalWeight <= 0 {
-		// If all the tasks have not weights defined, they have the same chance to run
-		randNum := rs.Intn(tasksCount)
-		return r.tasks[randNum]
+// setStartAt delays spawning until t, the zero time means at once.
+func (r *runner) setStartAt(t time.Time) {
+	if t.IsZero() {
+		atomic.StoreInt64(&r.startAt, 0)
+		return
 	}
+	atomic.StoreInt64(&r.startAt, t.UnixNano())
+}
 
-	randNum := rs.Intn(totalWeight)
-	runningSum := 0
-	for _, task := range r.tasks {
-		runningSum += task.Weight
-		if runningSum > randNum {
-			return task
-		}
+// startDelay returns the time until startAt, 0 if it's passed.
+func (r *runner) startDelay() time.Duration {
+	startAt := atomic.LoadInt64(&r.startAt)
+	if startAt == 0 {
+		return 0
+	}
+	if delay := time.Until(time.Unix(0, startAt)); delay > 0 {
+		return delay
 	}
+	return 0
+}
 
-	return nil
+// startRunTimer starts counting the run time after delay, only the first call takes effect.
+func (r *runner) startRunTimer(delay time.Duration) {
+	if r.runTime <= 0 || r.onRunTimeExceeded == nil {
+		return
+	}
+	r.runTimeOnce.Do(func() {
+		closeChan := r.closeChan
+		time.AfterFunc(delay+r.runTime, func() {
+			select {
+			case <-closeChan:
+				// already closed
+				return
+			default:
+			}
+			logInfo("The run time limit %v is reached, boomer is quitting", r.runTime)
+			r.onRunTimeExceeded()
+		})
+	})
 }
 
-func (r *runner) startSpawning(spawnCount int, spawnRate float64, spawnCompleteFunc func()) {
-	Events.Publish("boomer:hatch", spawnCount, spawnRate)
-	Events.Publish("boomer:spawn", spawnCount, spawnRate)
+// setIterationLimit must be called before the test is started.
+func (r *runner) setIterationLimit(limit int64, onIterationLimitReached func()) {
+	r.iterationLimit = limit
+	r.onIterationLimitReached = onIterationLimitReached
+}
 
-	r.stats.clearStatsChan <- true
-	r.stopChan = make(chan bool)
+// iterationQuota returns the number of the iterations this runner should run. The iteration limit is split
+// over the workers sent by the master, rounded up, so the cluster runs at least iterationLimit iterations.
+func (r *runner) iterationQuota() int64 {
+	count := int64(atomic.LoadInt32(&r.workerCount))
+	if count <= 1 {
+		return r.iterationLimit
+	}
+	return (r.iterationLimit + count - 1) / count
+}
 
-	r.spawnRate = spawnRate
-	r.numClients = 0
+// startIteration returns false if the iteration limit is reached, and the task function shouldn't be called.
+func (r *runner) startIteration() bool {
+	if r.iterationLimit <= 0 {
+		return true
+	}
+	if atomic.AddInt64(&r.startedIterations, 1) > r.iterationQuota() {
+		atomic.AddInt64(&r.startedIterations, -1)
+		return false
+	}
+	return true
+}
 
-	go r.spawnWorkers(spawnCount, r.stopChan, spawnCompleteFunc)
+// finishIteration calls onIterationLimitReached once all the iterations of the quota are finished.
+func (r *runner) finishIteration() {
+	if r.iterationLimit <= 0 {
+		return
+	}
+	if atomic.AddInt64(&r.finishedIterations, 1) < r.iterationQuota() || r.onIterationLimitReached == nil {
+		return
+	}
+	r.iterationOnce.Do(func() {
+		logInfo("The iteration limit %d is reached, boomer is quitting", r.iterationQuota())
+		// in a new goroutine, because quitting waits for the workers to return
+		go r.onIterationLimitReached()
+	})
 }
 
 func (r *runner) stop() {
 	// publish the boomer stop event
 	// user's code can subscribe to this event and do thins like cleaning up
-	Events.Publish("boomer:stop")
+	r.publishStop()
 
 	// stop previous goroutines without blocking
 	// those goroutines will exit when r.safeRun returns
 	close(r.stopChan)
+
+	// interrupt the workers sleeping in think time or waiting for the rate limiter
+	r.workersLock.Lock()
+	for w := range r.workers {
+		close(w.quit)
+	}
+	r.workers = nil
+	atomic.StoreInt32(&r.numClients, 0)
+	atomic.StoreInt32(&r.targetClients, 0)
+	r.workersLock.Unlock()
+
 	if r.rateLimitEnabled {
 		r.rateLimiter.Stop()
 	}
+	for _, limiter := range r.taskRateLimiters() {
+		limiter.Stop()
+	}
+
+	r.waitForWorkers()
+	// the next test isn't paused
+	r.resume()
+	r.onTestStop()
+	r.setState(stateStopped)
+}
+
+// onTestStart calls the test start hooks, then OnStart of the tasks.
+func (r *runner) onTestStart() {
+	for _, hook := range r.testStartHooks {
+		r.safeRun(hook)
+	}
+	for _, task := range r.getTasks() {
+		if task.OnStart != nil {
+			r.safeRun(task.OnStart)
+		}
+	}
+}
+
+// onTestStop calls OnStop of the tasks, then the test stop hooks.
+func (r *runner) onTestStop() {
+	for _, task := range r.getTasks() {
+		if task.OnStop != nil {
+			r.safeRun(task.OnStop)
+		}
+	}
+	for _, hook := range r.testStopHooks {
+		r.safeRun(hook)
+	}
+}
+
+// waitForWorkers waits for the running task functions to return, up to drainTimeout.
+// The workers don't start new iterations once they are stopped.
+func (r *runner) waitForWorkers() {
+	if r.drainTimeout <= 0 {
+		return
+	}
+	deadline := time.Now().Add(r.drainTimeout)
+	for atomic.LoadInt32(&r.runningWorkers) > 0 {
+		if time.Now().After(deadline) {
+			logError("%d goroutines are still running after the drain timeout %v", atomic.LoadInt32(&r.runningWorkers), r.drainTimeout)
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// shutdown stops the runner in a deterministic order, so the last interval's data
+// reliably reaches the master and all the outputs.
+// 1. Stop spawning and all the running workers, and wait for the running task functions up to the drain timeout.
+// 2. Drain the stats channels and send the last interval's data to the reporting goroutine.
+// 3. Wait for the reporting goroutine to deliver the data, then call OnStop of all the outputs.
+// The connection to the master should be closed after shutdown returns.
+func (r *runner) shutdown() {
+	if r.stopChan != nil {
+		select {
+		case <-r.stopChan:
+			// already stopped
+		default:
+			r.stop()
+		}
+	}
+	if r.stats != nil {
+		r.stats.close()
+	}
+	if r.reportDoneChan != nil {
+		<-r.reportDoneChan
+	}
 }
 
 type localRunner struct {
 	runner
 
 	spawnCount int
+
+	// stages is the load profile, the spawnCount and spawnRate are ignored if it's not empty.
+	stages    []loadStage
+	closeOnce sync.Once
+
+	// waitForStart keeps the runner ready until startTest is called by the web UI, instead of spawning at once.
+	waitForStart bool
+	// controlLock serializes startTest and stopTest, and guards quitting.
+	controlLock sync.Mutex
+	quitting    bool
+}
+
+// loadStage keeps users running for duration, they are spawned or stopped when the stage begins.
+type loadStage struct {
+	duration  time.Duration
+	users     int
+	spawnRate float64
 }
 
 func newLocalRunner(tasks []*Task, rateLimiter RateLimiter, spawnCount int, spawnRate float64) (r *localRunner) {
 	r = &localRunner{}
 	r.setTasks(tasks)
+	r.rand = newRand(time.Now().UnixNano())
 	r.spawnRate = spawnRate
 	r.spawnCount = spawnCount
 	r.closeChan = make(chan bool)
@@ -247,39 +1333,224 @@ func newLocalRunner(tasks []*Task, rateLimiter RateLimiter, spawnCount int, spaw
 }
 
 func (r *localRunner) run() {
-	r.state = stateInit
+	r.setState(stateInit)
+	r.rawSampleOutputOnStart()
 	r.stats.start()
+	if r.slos != nil {
+		r.slos.reset()
+	}
+	r.outputOnStart()
 
-	wg := sync.WaitGroup{}
-	wg.Add(1)
+	r.reportDoneChan = make(chan bool)
 	go func() {
-		for {
-			select {
-			case data := <-r.stats.messageToRunnerChan:
-				data["user_count"] = r.numClients
-				r.outputOnEevent(data)
-			case <-r.closeChan:
-				Events.Publish("boomer:quit")
-				r.stop()
-				wg.Done()
-				return
+		usage := newProcessUsage()
+		// messageToRunnerChan is closed after the last interval's data is sent.
+		for data := range r.stats.messageToRunnerChan {
+			r.logDroppedArrivals()
+			memory := usage.memoryUsage()
+			r.logMemoryUsage(memory)
+			data["user_count"] = r.userCount(r.getState() == stateRunning)
+			data["current_cpu_usage"] = usage.cpuPercent()
+			data["current_memory_usage"] = memory
+			r.addRunMetadata(data)
+			if r.slos != nil {
+				r.slos.evaluate(data)
 			}
+			r.outputOnEevent(data)
 		}
+		r.rawSampleOutputOnStop()
+		r.outputOnStop()
+		close(r.reportDoneChan)
 	}()
 
 	if r.rateLimitEnabled {
 		r.rateLimiter.Start()
 	}
-	r.startSpawning(r.spawnCount, r.spawnRate, nil)
+	if r.waitForStart {
+		logInfo("Waiting for the test to be started by the web UI")
+	} else if len(r.stages) > 0 {
+		r.runStages()
+	} else {
+		r.setState(stateSpawning)
+		r.startSpawning(r.spawnCount, r.spawnRate, r.spawnComplete)
+	}
 
-	wg.Wait()
+	<-r.closeChan
+}
+
+// runStages rescales the users at the beginning of every stage, and quits after the last stage.
+func (r *localRunner) runStages() {
+	first := r.stages[0]
+	r.setState(stateSpawning)
+	r.startSpawning(first.users, first.spawnRate, r.spawnComplete)
+	stopChan := r.stopChan
+
+	go func() {
+		for i, stage := range r.stages {
+			if i > 0 {
+				logInfo("Stage %d begins, rescaling to %d users at %.2f users/s", i+1, stage.users, stage.spawnRate)
+				r.setState(stateSpawning)
+				r.rescale(stage.users, stage.spawnRate, r.spawnComplete)
+			}
+			select {
+			case <-time.After(stage.duration):
+			case <-stopChan:
+				return
+			}
+		}
+		logInfo("All the stages are finished, boomer is quitting")
+		r.shutdown()
+		r.publishQuit()
+		r.close()
+	}()
+}
+
+// updateUserCount rescales the running users to userCount at the current spawn rate.
+// Excess workers are stopped at once, and their contexts are canceled after the drain timeout.
+func (r *localRunner) updateUserCount(userCount int) {
+	stopChan := r.stopChan
+	if stopChan == nil {
+		logError("The test isn't started, user count is not updated!")
+		return
+	}
+	select {
+	case <-stopChan:
+		logError("The test is stopped, user count is not updated!")
+		return
+	default:
+	}
+	logInfo("Updating user count to %d", userCount)
+	r.setState(stateSpawning)
+	r.rescale(userCount, r.spawnRate, r.spawnComplete)
+}
+
+// startTest starts spawning the users if the test isn't running, or rescales the running users.
+func (r *localRunner) startTest(spawnCount int, spawnRate float64) {
+	r.controlLock.Lock()
+	defer r.controlLock.Unlock()
+	if r.quitting {
+		logError("The test is quitting, it's not started!")
+		return
+	}
+	switch r.getState() {
+	case stateStopped:
+		// the rate limiter is stopped with the test
+		if r.rateLimitEnabled {
+			r.rateLimiter.Start()
+		}
+		r.setState(stateSpawning)
+		r.startSpawning(spawnCount, spawnRate, r.spawnComplete)
+	case stateInit:
+		r.setState(stateSpawning)
+		r.startSpawning(spawnCount, spawnRate, r.spawnComplete)
+	case stateSpawning, stateRunning:
+		r.setState(stateSpawning)
+		r.rescale(spawnCount, spawnRate, r.spawnComplete)
+	}
+}
+
+// stopTest stops the users without quitting, the test can be started again by startTest.
+func (r *localRunner) stopTest() {
+	r.controlLock.Lock()
+	defer r.controlLock.Unlock()
+	if r.quitting {
+		return
+	}
+	if state := r.getState(); state == stateSpawning || state == stateRunning {
+		r.stop()
+	}
+}
+
+// shutdown stops the test like runner.shutdown, and the web UI can't start it again.
+func (r *localRunner) shutdown() {
+	r.controlLock.Lock()
+	r.quitting = true
+	r.controlLock.Unlock()
+	r.runner.shutdown()
+}
+
+// spawnComplete is called when the users are spawned, it's ignored if the runner is stopped meanwhile.
+func (r *localRunner) spawnComplete() {
+	if r.getState() == stateSpawning {
+		r.userCount(true)
+		r.setState(stateRunning)
+	}
 }
 
 func (r *localRunner) close() {
-	if r.stats != nil {
-		r.stats.close()
+	r.closeOnce.Do(func() {
+		r.shutdown()
+		close(r.closeChan)
+	})
+}
+
+// masterReportData returns the data reported to the master. The labeled stats are only for the outputs, and the master
+// aggregates all the stats it receives, so the stats of the warm-up period are replaced by empty ones.
+// The other data like "user_count" is kept.
+func masterReportData(data map[string]interface{}) map[string]interface{} {
+	report := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		if k != "labeled_stats" {
+			report[k] = v
+		}
 	}
-	close(r.closeChan)
+	if warmup, _ := data["warmup"].(bool); !warmup {
+		return report
+	}
+	total := &statsEntry{
+		name:   "Total",
+		method: "",
+	}
+	total.reset()
+	report["stats"] = []interface{}{}
+	report["stats_total"] = total.serialize()
+	report["errors"] = map[string]map[string]interface{}{}
+	return report
+}
+
+// statsBatcher merges the reports of several intervals into one stats message, see Boomer.SetStatsBatch.
+type statsBatcher struct {
+	size  int
+	stats *requestStats
+	count int
+	// latest is the latest report merged, its other data, like user_count, is sent as is.
+	latest map[string]interface{}
+}
+
+func newStatsBatcher(size int) *statsBatcher {
+	return &statsBatcher{
+		size:  size,
+		stats: newRequestStats(),
+	}
+}
+
+// add merges report, and returns the merged report once size reports are merged, or nil.
+func (b *statsBatcher) add(report map[string]interface{}) map[string]interface{} {
+	b.stats.extend(report)
+	b.count++
+	b.latest = report
+	if b.count < b.size {
+		return nil
+	}
+	return b.flush()
+}
+
+// flush returns the merged report of the reports which aren't sent yet, or nil if there aren't any.
+func (b *statsBatcher) flush() map[string]interface{} {
+	if b.count == 0 {
+		return nil
+	}
+	merged := make(map[string]interface{}, len(b.latest))
+	for k, v := range b.latest {
+		merged[k] = v
+	}
+	merged["stats"] = b.stats.serializeStats()
+	merged["stats_total"] = b.stats.total.getStrippedReport()
+	merged["errors"] = b.stats.serializeErrors()
+	b.stats.clearAll()
+	b.count = 0
+	b.latest = nil
+	return merged
 }
 
 // SlaveRunner connects to the master, spawns goroutines and collects stats.
@@ -290,6 +1561,41 @@ type slaveRunner struct {
 	masterHost string
 	masterPort int
 	client     client
+	clientLock sync.RWMutex
+	security   clientSecurity
+
+	// the listener of the current client, it's replaced when the runner reconnects.
+	listenerStopChan chan bool
+	listenerDoneChan chan bool
+
+	// lastMasterHeartbeat is the time in nanoseconds of the last heartbeat from the master, 0 if none is received
+	// since connected. Masters which don't send heartbeats, like locust 1.x, are never considered lost.
+	lastMasterHeartbeat int64
+	reconnecting        int32
+
+	// clientBackend is the name of the ZMQ implementation, defaultClientBackend is used if it's empty.
+	clientBackend string
+
+	messageInterceptor func(msg *Message) *Message
+
+	// messageHandlers handle the custom messages from the master, by message type.
+	messageHandlers map[string]func(data interface{})
+
+	// userClassesCount is the user_classes_count of the last spawn message from a locust 2.x master,
+	// it's reported back as is.
+	userClassesCount map[string]interface{}
+
+	// the secondary masters, which receive copies of the stats messages.
+	mirrors []*mirrorClient
+
+	// statsBatchSize is how many intervals are merged into a stats message, statsCompression compresses them.
+	statsBatchSize   int
+	statsCompression bool
+
+	// expectedWorkers holds the spawn messages until the master reports the number of workers, pendingSpawn is
+	// the spawn message being held. They are only accessed by the listener.
+	expectedWorkers int
+	pendingSpawn    *Message
 }
 
 func newSlaveRunner(masterHost string, masterPort int, tasks []*Task, rateLimiter RateLimiter) (r *slaveRunner) {
@@ -297,6 +1603,7 @@ func newSlaveRunner(masterHost string, masterPort int, tasks []*Task, rateLimite
 	r.masterHost = masterHost
 	r.masterPort = masterPort
 	r.setTasks(tasks)
+	r.rand = newRand(time.Now().UnixNano())
 	r.nodeID = getNodeID()
 	r.closeChan = make(chan bool)
 
@@ -309,40 +1616,157 @@ func newSlaveRunner(masterHost string, masterPort int, tasks []*Task, rateLimite
 	return r
 }
 
+// sendMessage passes msg to the interceptor, if any, and sends the returned message to the master.
+// If the interceptor returns nil, or the runner is reconnecting to the master, the message is dropped.
+func (r *slaveRunner) sendMessage(msg *Message) {
+	if atomic.LoadInt32(&r.reconnecting) == 1 {
+		logDebug("Reconnecting to master, a %s message is dropped", msg.Type)
+		return
+	}
+	if r.messageInterceptor != nil {
+		msg = r.messageInterceptor(msg)
+		if msg == nil {
+			return
+		}
+	}
+	r.getClient().sendChannel() <- msg
+	if msg.Type == "stats" {
+		for _, mirror := range r.mirrors {
+			mirror.send(msg)
+		}
+	}
+}
+
+// sendStats sends the report to the master, it's compressed if the stats compression is enabled.
+func (r *slaveRunner) sendStats(report map[string]interface{}) {
+	msg := newMessage("stats", report, r.nodeID)
+	msg.compressed = r.statsCompression
+	r.sendMessage(msg)
+}
+
+// addMirror must be called before run.
+func (r *slaveRunner) addMirror(host string, port int) {
+	r.mirrors = append(r.mirrors, newMirrorClient(host, port, r.nodeID))
+}
+
+// spawnComplete reports the users which are actually running, instead of the users asked for by the master,
+// which differ if the spawning is stopped by the resource limits.
 func (r *slaveRunner) spawnComplete() {
+	userCount := r.userCount(true)
 	data := make(map[string]interface{})
-	data["count"] = r.numClients
-	r.client.sendChannel() <- newMessage("spawning_complete", data, r.nodeID)
-	r.state = stateRunning
+	// count is used by locust 1.x, user_count and user_classes_count are used by locust 2.x.
+	data["count"] = userCount
+	data["user_count"] = userCount
+	data["user_classes_count"] = r.getUserClassesCount(userCount)
+	r.sendMessage(newMessage("spawning_complete", data, r.nodeID))
+	r.setState(stateRunning)
+}
+
+// getUserClassesCount returns the user_classes_count of the master if the users are all running, or scales it down
+// to userCount otherwise, so the user count of a locust 2.x master, which is the sum of them, matches the running users.
+func (r *slaveRunner) getUserClassesCount(userCount int32) map[string]interface{} {
+	if r.userClassesCount == nil {
+		return map[string]interface{}{}
+	}
+	asked := int64(0)
+	for _, count := range r.userClassesCount {
+		asked += toInt64(count)
+	}
+	if asked == int64(userCount) || asked == 0 {
+		return r.userClassesCount
+	}
+
+	// the largest remainder method, the classes are sorted so the result is stable
+	classes := make([]string, 0, len(r.userClassesCount))
+	for class := range r.userClassesCount {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	scaled := make(map[string]interface{}, len(classes))
+	remainders := make(map[string]int64, len(classes))
+	left := int64(userCount)
+	for _, class := range classes {
+		count := toInt64(r.userClassesCount[class]) * int64(userCount)
+		scaled[class] = count / asked
+		remainders[class] = count % asked
+		left -= count / asked
+	}
+	sort.SliceStable(classes, func(i, j int) bool {
+		return remainders[classes[i]] > remainders[classes[j]]
+	})
+	for _, class := range classes[:left] {
+		scaled[class] = scaled[class].(int64) + 1
+	}
+	return scaled
+}
+
+// sendClientReady tells the master that the runner is ready. The data is the version of locust 2.x workers,
+// -1 tells the master to skip the version check, and it's ignored by locust 1.x.
+func (r *slaveRunner) sendClientReady() {
+	r.sendMessage(newCustomMessage("client_ready", -1, r.nodeID))
 }
 
 func (r *slaveRunner) onQuiting() {
-	if r.state != stateQuitting {
-		r.client.sendChannel() <- newMessage("quit", nil, r.nodeID)
+	if r.getState() != stateQuitting {
+		r.sendMessage(newMessage("quit", nil, r.nodeID))
 	}
 }
 
+// publishQuit publishes "boomer:quit" and calls the quit hooks, then tells the master that boomer quits.
+func (r *slaveRunner) publishQuit() {
+	r.runner.publishQuit()
+	r.onQuiting()
+}
+
 func (r *slaveRunner) close() {
 	if r.stats != nil {
 		r.stats.close()
 	}
-	if r.client != nil {
-		r.client.close()
+	if client := r.getClient(); client != nil {
+		client.close()
+	}
+	for _, mirror := range r.mirrors {
+		mirror.close()
 	}
 	close(r.closeChan)
 }
 
-func (r *slaveRunner) onSpawnMessage(msg *message) {
-	r.client.sendChannel() <- newMessage("spawning", nil, r.nodeID)
+// parseSpawnMessage supports the spawn messages of both locust 1.x and 2.x. A locust 2.x master ramps up
+// by sending spawn messages with the user count of each user class, instead of a spawn rate, so the users
+// are spawned at once and the user classes are ignored, the sum is the number of workers.
+func parseSpawnMessage(msg *Message) (workers int, spawnRate float64) {
+	if userClassesCount, ok := msg.Data["user_classes_count"]; ok {
+		for _, count := range toStringMap(userClassesCount) {
+			workers += int(toInt64(count))
+		}
+		return workers, 0
+	}
+
 	rate := msg.Data["spawn_rate"]
 	users := msg.Data["num_users"]
-	spawnRate := rate.(float64)
-	workers := 0
+	spawnRate = rate.(float64)
 	if _, ok := users.(uint64); ok {
 		workers = int(users.(uint64))
 	} else {
 		workers = int(users.(int64))
 	}
+	return workers, spawnRate
+}
+
+// setSpawnStartAt delays spawning until the "start_at" of the spawn message, in Unix milliseconds, which is sent by
+// MasterRunner with SetStartDelay, so all the workers start at the same instant.
+func (r *slaveRunner) setSpawnStartAt(msg *Message) {
+	if startAt := toInt64(msg.Data["start_at"]); startAt > 0 {
+		r.setStartAt(time.Unix(0, startAt*int64(time.Millisecond)))
+	}
+}
+
+func (r *slaveRunner) onSpawnMessage(msg *Message) {
+	r.sendMessage(newMessage("spawning", nil, r.nodeID))
+	workers, spawnRate := parseSpawnMessage(msg)
+	r.setSpawnStartAt(msg)
+	r.userClassesCount = toStringMap(msg.Data["user_classes_count"])
+	r.selectTasks(r.userClassesCount)
 
 	if r.rateLimitEnabled {
 		r.rateLimiter.Start()
@@ -350,61 +1774,165 @@ func (r *slaveRunner) onSpawnMessage(msg *message) {
 	r.startSpawning(workers, spawnRate, r.spawnComplete)
 }
 
+// onRescaleMessage handles a spawn message while the workers are running, it keeps the running workers
+// and the stats, only spawns or stops the difference.
+func (r *slaveRunner) onRescaleMessage(msg *Message) {
+	r.sendMessage(newMessage("spawning", nil, r.nodeID))
+	workers, spawnRate := parseSpawnMessage(msg)
+	r.setSpawnStartAt(msg)
+	r.userClassesCount = toStringMap(msg.Data["user_classes_count"])
+	r.selectTasks(r.userClassesCount)
+	r.rescale(workers, spawnRate, r.spawnComplete)
+}
+
+// expectedWorkersReady returns true if the master has reported the expected number of workers.
+func (r *slaveRunner) expectedWorkersReady() bool {
+	return int(atomic.LoadInt32(&r.workerCount)) >= r.expectedWorkers
+}
+
+// holdSpawn holds the spawn message until the expected number of workers are connected, the last one is kept.
+func (r *slaveRunner) holdSpawn(msg *Message) bool {
+	if r.expectedWorkers <= 0 || r.expectedWorkersReady() {
+		return false
+	}
+	if r.pendingSpawn == nil {
+		logInfo("Waiting for %d workers to spawn, %d are connected", r.expectedWorkers, atomic.LoadInt32(&r.workerCount))
+	}
+	r.pendingSpawn = msg
+	return true
+}
+
 // Runner acts as a state machine.
-func (r *slaveRunner) onMessage(msg *message) {
+func (r *slaveRunner) onMessage(msg *Message) {
+	logDebug("Recv a %s message from master in state %s", msg.Type, r.getState())
+
 	if msg.Type == "hatch" {
-		log.Println("The master sent a 'hatch' message, you are using an unsupported locust version, please update locust to 1.2.")
+		logError("The master sent a 'hatch' message, you are using an unsupported locust version, please update locust to 1.2.")
+		return
+	}
+
+	switch msg.Type {
+	case "heartbeat":
+		atomic.StoreInt64(&r.lastMasterHeartbeat, time.Now().UnixNano())
+		return
+	case "reconnect":
+		// the master doesn't know this worker, e.g. it's restarted
+		go r.reconnect()
+		return
+	case "worker_count":
+		atomic.StoreInt32(&r.workerCount, int32(toInt64(msg.customData())))
+		if limiter, ok := r.rateLimiter.(workerCountAware); ok {
+			limiter.SetWorkerCount(int(toInt64(msg.customData())))
+		}
+		if handler, ok := r.messageHandlers[msg.Type]; ok {
+			handler(msg.customData())
+		}
+		if r.pendingSpawn != nil && r.expectedWorkersReady() {
+			msg, r.pendingSpawn = r.pendingSpawn, nil
+			logInfo("%d workers are connected, start spawning", atomic.LoadInt32(&r.workerCount))
+			r.setState(stateSpawning)
+			r.onSpawnMessage(msg)
+		}
+		return
+	}
+
+	if handler, ok := r.messageHandlers[msg.Type]; ok {
+		handler(msg.customData())
 		return
 	}
 
-	switch r.state {
+	switch r.getState() {
 	case stateInit:
 		switch msg.Type {
 		case "spawn":
-			r.state = stateSpawning
+			if r.holdSpawn(msg) {
+				return
+			}
+			r.setState(stateSpawning)
 			r.onSpawnMessage(msg)
+		case "stop":
+			r.pendingSpawn = nil
 		case "quit":
-			Events.Publish("boomer:quit")
+			r.pendingSpawn = nil
+			r.shutdown()
+			r.publishQuit()
 		}
 	case stateSpawning:
 		fallthrough
 	case stateRunning:
 		switch msg.Type {
 		case "spawn":
-			r.state = stateSpawning
-			r.stop()
-			r.onSpawnMessage(msg)
+			r.setState(stateSpawning)
+			r.onRescaleMessage(msg)
+		case "pause":
+			if r.pause() {
+				logInfo("Recv pause message from master, the users are paused")
+			}
+		case "resume":
+			if r.resume() {
+				logInfo("Recv resume message from master, the users are resumed")
+			}
 		case "stop":
 			r.stop()
-			r.state = stateStopped
-			log.Println("Recv stop message from master, all the goroutines are stopped")
-			r.client.sendChannel() <- newMessage("client_stopped", nil, r.nodeID)
-			r.client.sendChannel() <- newMessage("client_ready", nil, r.nodeID)
-			r.state = stateInit
+			r.setState(stateStopped)
+			logInfo("Recv stop message from master, all the goroutines are stopped")
+			r.sendMessage(newMessage("client_stopped", nil, r.nodeID))
+			r.sendClientReady()
+			r.setState(stateInit)
 		case "quit":
-			r.stop()
-			log.Println("Recv quit message from master, all the goroutines are stopped")
-			Events.Publish("boomer:quit")
-			r.state = stateInit
+			// shutdown stops the goroutines and delivers the last interval's data to the outputs,
+			// so they can be finished like Boomer.Quit does.
+			r.shutdown()
+			logInfo("Recv quit message from master, all the goroutines are stopped")
+			r.publishQuit()
+			r.setState(stateInit)
 		}
 	case stateStopped:
 		switch msg.Type {
 		case "spawn":
-			r.state = stateSpawning
+			if r.holdSpawn(msg) {
+				r.setState(stateInit)
+				return
+			}
+			r.setState(stateSpawning)
 			r.onSpawnMessage(msg)
 		case "quit":
-			Events.Publish("boomer:quit")
-			r.state = stateInit
+			r.shutdown()
+			r.publishQuit()
+			r.setState(stateInit)
 		}
 	}
 }
 
+func (r *slaveRunner) getClient() client {
+	r.clientLock.RLock()
+	defer r.clientLock.RUnlock()
+	return r.client
+}
+
+func (r *slaveRunner) newClient() client {
+	backend := r.clientBackend
+	if backend == "" {
+		backend = defaultClientBackend
+	}
+	return clientBackends[backend](r.masterHost, r.masterPort, r.nodeID, r.security)
+}
+
+// startListener handles the messages from the current client, until stopListener is called or the runner is closed.
 func (r *slaveRunner) startListener() {
+	client := r.getClient()
+	stopChan := make(chan bool)
+	doneChan := make(chan bool)
+	r.listenerStopChan = stopChan
+	r.listenerDoneChan = doneChan
 	go func() {
+		defer close(doneChan)
 		for {
 			select {
-			case msg := <-r.client.recvChannel():
+			case msg := <-client.recvChannel():
 				r.onMessage(msg)
+			case <-stopChan:
+				return
 			case <-r.closeChan:
 				return
 			}
@@ -412,38 +1940,141 @@ func (r *slaveRunner) startListener() {
 	}()
 }
 
+// stopListener waits for the message being handled, if any.
+func (r *slaveRunner) stopListener() {
+	close(r.listenerStopChan)
+	<-r.listenerDoneChan
+}
+
+// masterLost returns true if the master used to send heartbeats, but no heartbeat is received for a while.
+func (r *slaveRunner) masterLost() bool {
+	last := atomic.LoadInt64(&r.lastMasterHeartbeat)
+	return last != 0 && time.Since(time.Unix(0, last)) > masterHeartbeatTimeout
+}
+
+// reconnect replaces the lost connection to the master, it retries with exponential backoff until it's connected
+// or the runner is closed. Then the runner registers as a fresh worker, the running goroutines are stopped, because
+// a restarted master doesn't know them, and it will send a spawn message to the worker.
+func (r *slaveRunner) reconnect() {
+	if !atomic.CompareAndSwapInt32(&r.reconnecting, 0, 1) {
+		return
+	}
+
+	logError("Lost connection to master(%s:%d), reconnecting", r.masterHost, r.masterPort)
+	r.stopListener()
+	if state := r.getState(); state == stateSpawning || state == stateRunning {
+		r.stop()
+	}
+	r.setState(stateInit)
+	r.getClient().close()
+
+	backoff := reconnectBackoff
+	for {
+		client := r.newClient()
+		err := client.connect()
+		if err == nil {
+			r.clientLock.Lock()
+			r.client = client
+			r.clientLock.Unlock()
+			break
+		}
+		client.close()
+		logError("Failed to reconnect to master(%s:%d) with error %v, retry in %v", r.masterHost, r.masterPort, err, backoff)
+
+		select {
+		case <-time.After(backoff):
+		case <-r.closeChan:
+			return
+		}
+		backoff *= 2
+		if backoff > maxReconnectBackoff {
+			backoff = maxReconnectBackoff
+		}
+	}
+
+	atomic.StoreInt64(&r.lastMasterHeartbeat, 0)
+	atomic.StoreInt32(&r.reconnecting, 0)
+	r.startListener()
+	r.sendClientReady()
+	logInfo("Reconnected to master(%s:%d)", r.masterHost, r.masterPort)
+}
+
 func (r *slaveRunner) run() {
-	r.state = stateInit
-	r.client = newClient(r.masterHost, r.masterPort, r.nodeID)
+	r.setState(stateInit)
+	r.client = r.newClient()
 
 	err := r.client.connect()
 	if err != nil {
 		if strings.Contains(err.Error(), "Socket type DEALER is not compatible with PULL") {
-			log.Println("Newer version of locust changes ZMQ socket to DEALER and ROUTER, you should update your locust version.")
+			logError("Newer version of locust changes ZMQ socket to DEALER and ROUTER, you should update your locust version.")
 		} else {
-			log.Printf("Failed to connect to master(%s:%d) with error %v\n", r.masterHost, r.masterPort, err)
+			logError("Failed to connect to master(%s:%d) with error %v\n", r.masterHost, r.masterPort, err)
 		}
 		return
 	}
 
+	for _, mirror := range r.mirrors {
+		go mirror.connect()
+	}
+
 	// listen to master
 	r.startListener()
 
+	r.rawSampleOutputOnStart()
 	r.stats.start()
+	if r.slos != nil {
+		r.slos.reset()
+	}
+	r.outputOnStart()
 
 	// tell master, I'm ready
-	r.client.sendChannel() <- newMessage("client_ready", nil, r.nodeID)
+	r.sendClientReady()
 
 	// report to master
+	r.reportDoneChan = make(chan bool)
 	go func() {
+		usage := newProcessUsage()
+		var batch *statsBatcher
+		if r.statsBatchSize > 1 {
+			batch = newStatsBatcher(r.statsBatchSize)
+		}
 		for {
 			select {
-			case data := <-r.stats.messageToRunnerChan:
-				if r.state == stateInit || r.state == stateStopped {
+			case data, ok := <-r.stats.messageToRunnerChan:
+				if !ok {
+					// the last interval's data has been delivered.
+					if batch != nil {
+						if report := batch.flush(); report != nil {
+							r.sendStats(report)
+						}
+					}
+					r.rawSampleOutputOnStop()
+					r.outputOnStop()
+					close(r.reportDoneChan)
+					return
+				}
+				if state := r.getState(); state == stateInit || state == stateStopped {
 					continue
 				}
-				data["user_count"] = r.numClients
-				r.client.sendChannel() <- newMessage("stats", data, r.nodeID)
+				r.logDroppedArrivals()
+				memory := usage.memoryUsage()
+				r.logMemoryUsage(memory)
+				userCount := r.userCount(r.getState() == stateRunning)
+				data["user_count"] = userCount
+				data["user_classes_count"] = r.getUserClassesCount(userCount)
+				data["current_cpu_usage"] = usage.cpuPercent()
+				data["current_memory_usage"] = memory
+				r.addRunMetadata(data)
+				report := masterReportData(data)
+				if batch != nil {
+					report = batch.add(report)
+				}
+				if report != nil {
+					r.sendStats(report)
+				}
+				if r.slos != nil {
+					r.slos.evaluate(data)
+				}
 				r.outputOnEevent(data)
 			case <-r.closeChan:
 				return
@@ -455,20 +2086,24 @@ func (r *slaveRunner) run() {
 	// See: https://github.com/locustio/locust/commit/a8c0d7d8c588f3980303358298870f2ea394ab93
 	go func() {
 		var ticker = time.NewTicker(heartbeatInterval)
+		usage := newProcessUsage()
 		for {
 			select {
 			case <-ticker.C:
-				CPUUsage := GetCurrentCPUUsage()
+				// current_memory_usage is used by locust 2.x, in bytes.
 				data := map[string]interface{}{
-					"state":             r.state,
-					"current_cpu_usage": CPUUsage,
+					"state":                r.getState(),
+					"current_cpu_usage":    usage.cpuPercent(),
+					"current_memory_usage": usage.memoryUsage(),
+				}
+				r.sendMessage(newMessage("heartbeat", data, r.nodeID))
+				if r.masterLost() {
+					go r.reconnect()
 				}
-				r.client.sendChannel() <- newMessage("heartbeat", data, r.nodeID)
 			case <-r.closeChan:
 				return
 			}
 		}
 	}()
 
-	Events.Subscribe("boomer:quit", r.onQuiting)
 }
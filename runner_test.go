@@ -1,6 +1,12 @@
 package boomer
 
 import (
+	"context"
+	"errors"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -119,18 +125,89 @@ func TestSpawnWorkers(t *testing.T) {
 	}
 }
 
-func TestSpawnWorkersWithManyTasks(t *testing.T) {
-	var lock sync.Mutex
-	taskCalls := map[string]int{}
+func TestSpawnWorkersWithResourceLimits(t *testing.T) {
+	task := &Task{
+		Fn: func() {
+			time.Sleep(10 * time.Millisecond)
+		},
+		Name: "TaskA",
+	}
+	runner := newLocalRunner([]*Task{task}, nil, 10, 0)
+	defer runner.close()
+	runner.stopChan = make(chan bool)
+	defer close(runner.stopChan)
+
+	runner.setResourceLimits(3, 0)
+	completed := false
+	runner.spawnWorkers(10, runner.stopChan, func() {
+		completed = true
+	})
+	if atomic.LoadInt32(&runner.numClients) != 3 {
+		t.Error("The workers should be capped at 3, got", atomic.LoadInt32(&runner.numClients))
+	}
+	if !completed {
+		t.Error("Spawning should be completed once the limit is reached")
+	}
+
+	runner.memoryUsage = func() uint64 {
+		// every spawned worker takes 1MB
+		return uint64(atomic.LoadInt32(&runner.numClients)) << 20
+	}
+	runner.setResourceLimits(0, 5<<20)
+	runner.spawnWorkers(10, runner.stopChan, nil)
+	if atomic.LoadInt32(&runner.numClients) != 5 {
+		t.Error("The workers should be capped by the memory, got", atomic.LoadInt32(&runner.numClients))
+	}
+}
+
+func TestUserCountMismatch(t *testing.T) {
+	defer SetLogger(NewStdLogger())
+	logger := &recordingLogger{}
+	SetLogger(logger)
+
+	runner := newLocalRunner(nil, nil, 10, 0)
+	defer runner.close()
+	atomic.StoreInt32(&runner.targetClients, 10)
+	atomic.StoreInt32(&runner.numClients, 8)
+
+	if runner.userCount(false) != 8 || len(logger.messages) != 0 {
+		t.Error("The mismatch shouldn't be logged while spawning, got", logger.messages)
+	}
+	runner.userCount(true)
+	runner.userCount(true)
+	if len(logger.messages) != 1 || logger.messages[0] != "error: 8 users are running, 10 users are asked for" {
+		t.Error("The mismatch should be logged once, got", logger.messages)
+	}
+	atomic.StoreInt32(&runner.numClients, 7)
+	if runner.userCount(true) != 7 || len(logger.messages) != 2 {
+		t.Error("The mismatch should be logged again once it changes, got", logger.messages)
+	}
+}
+
+func TestGetUserClassesCount(t *testing.T) {
+	runner := newSlaveRunner("localhost", 5557, nil, nil)
+	defer runner.close()
+	if len(runner.getUserClassesCount(0)) != 0 {
+		t.Error("There should be no user classes before the spawn message")
+	}
+
+	runner.userClassesCount = map[string]interface{}{"UserA": uint64(5), "UserB": uint64(3), "UserC": uint64(2)}
+	if counts := runner.getUserClassesCount(10); counts["UserA"] != uint64(5) {
+		t.Error("The user classes should be reported as they're received if all the users are running, got", counts)
+	}
+	counts := runner.getUserClassesCount(7)
+	if counts["UserA"] != int64(4) || counts["UserB"] != int64(2) || counts["UserC"] != int64(1) {
+		t.Error("The user classes should be scaled down to the running users, got", counts)
+	}
+}
 
+func TestSpawnWorkersWithManyTasks(t *testing.T) {
 	createTask := func(name string, weight int) *Task {
 		return &Task{
 			Name:   name,
 			Weight: weight,
 			Fn: func() {
-				lock.Lock()
-				defer lock.Unlock()
-				taskCalls[name]++
+				time.Sleep(time.Second)
 			},
 		}
 	}
@@ -145,46 +222,185 @@ func TestSpawnWorkersWithManyTasks(t *testing.T) {
 
 	runner.client = newClient("localhost", 5557, runner.nodeID)
 
-	const numToSpawn int = 30
-	const spawnRate float64 = 10
+	const numToSpawn int = 111
+	const spawnRate float64 = 1000
 	runner.spawnRate = spawnRate
 
 	runner.spawnWorkers(numToSpawn, runner.stopChan, runner.spawnComplete)
 
 	currentClients := atomic.LoadInt32(&runner.numClients)
-
 	assert.Equal(t, numToSpawn, int(currentClients))
-	lock.Lock()
-	hundreds := taskCalls[`one hundred`]
-	tens := taskCalls[`ten`]
-	ones := taskCalls[`one`]
-	lock.Unlock()
 
-	total := hundreds + tens + ones
-	t.Logf("total tasks run: %d\n", total)
+	workers := map[string]int{}
+	runner.workersLock.Lock()
+	for w := range runner.workers {
+		workers[w.task.Name]++
+	}
+	runner.workersLock.Unlock()
 
-	assert.True(t, total > 111)
+	assert.Equal(t, 100, workers[`one hundred`])
+	assert.Equal(t, 10, workers[`ten`])
+	assert.Equal(t, 1, workers[`one`])
+}
 
-	assert.True(t, ones > 1)
-	actPercentage := float64(ones) / float64(total)
-	expectedPercentage := 1.0 / 111.0
-	if actPercentage > 2*expectedPercentage || actPercentage < 0.5*expectedPercentage {
-		t.Errorf("Unexpected percentage of ones task: exp %v, act %v", expectedPercentage, actPercentage)
+func TestAssignTaskWithoutWeights(t *testing.T) {
+	runner := &runner{rand: newRand(1)}
+	runner.setTasks([]*Task{{Name: "A"}, {Name: "B"}, {Name: "C"}})
+
+	workers := map[string]int{}
+	for i := 0; i < 30; i++ {
+		workers[runner.addWorker(nil).task.Name]++
 	}
 
-	assert.True(t, tens > 10)
-	actPercentage = float64(tens) / float64(total)
-	expectedPercentage = 10.0 / 111.0
-	if actPercentage > 2*expectedPercentage || actPercentage < 0.5*expectedPercentage {
-		t.Errorf("Unexpected percentage of tens task: exp %v, act %v", expectedPercentage, actPercentage)
+	assert.Equal(t, 10, workers["A"])
+	assert.Equal(t, 10, workers["B"])
+	assert.Equal(t, 10, workers["C"])
+}
+
+func TestSelectTasksByUserClasses(t *testing.T) {
+	taskA := &Task{Name: "UserA", Weight: 1}
+	taskB := &Task{Name: "UserB", Weight: 1}
+	taskC := &Task{Name: "UserC", Weight: 1}
+	runner := &runner{rand: newRand(1)}
+	runner.setTasks([]*Task{taskA, taskB, taskC})
+
+	runner.selectTasks(map[string]interface{}{"UserA": uint64(3), "UserB": uint64(1)})
+	workers := map[string]int{}
+	for i := 0; i < 4; i++ {
+		workers[runner.addWorker(nil).task.Name]++
+	}
+	if workers["UserA"] != 3 || workers["UserB"] != 1 || workers["UserC"] != 0 {
+		t.Error("The workers should be distributed by the user classes of the master, got", workers)
 	}
 
-	assert.True(t, hundreds > 100)
-	actPercentage = float64(hundreds) / float64(total)
-	expectedPercentage = 100.0 / 111.0
-	if actPercentage > 2*expectedPercentage || actPercentage < 0.5*expectedPercentage {
-		t.Errorf("Unexpected percentage of hundreds task: exp %v, act %v", expectedPercentage, actPercentage)
+	// the user classes which aren't named after the tasks are ignored
+	runner.selectTasks(map[string]interface{}{"Dummy": uint64(4)})
+	if runner.taskUsers != nil {
+		t.Error("The weights of the tasks should be used, got", runner.taskUsers)
+	}
+}
+
+func TestRescaleByUserClasses(t *testing.T) {
+	createTask := func(name string) *Task {
+		return &Task{
+			Name:     name,
+			Fn:       func() {},
+			WaitTime: Constant(time.Minute),
+		}
+	}
+	runner := newSlaveRunner("localhost", 5557, []*Task{createTask("UserA"), createTask("UserB")}, nil)
+	defer runner.close()
+	runner.client = newClient("localhost", 5557, runner.nodeID)
+	runner.state = stateInit
+
+	go func() {
+		// consumes clearStatsChannel
+		<-runner.stats.clearStatsChan
+	}()
+
+	spawn := func(userClassesCount map[string]interface{}) map[string]int {
+		runner.onMessage(newMessage("spawn", map[string]interface{}{
+			"user_classes_count": userClassesCount,
+			"timestamp":          float64(time.Now().Unix()),
+		}, runner.nodeID))
+		<-runner.client.sendChannel() // spawning
+		<-runner.client.sendChannel() // spawning_complete
+
+		workers := map[string]int{}
+		runner.workersLock.Lock()
+		for w := range runner.workers {
+			workers[w.task.Name]++
+		}
+		runner.workersLock.Unlock()
+		return workers
+	}
+
+	workers := spawn(map[string]interface{}{"UserA": uint64(3), "UserB": uint64(1)})
+	if workers["UserA"] != 3 || workers["UserB"] != 1 {
+		t.Error("The workers should be distributed by the user classes of the master, got", workers)
+	}
+	// the same number of users, moved from UserA to UserB
+	workers = spawn(map[string]interface{}{"UserA": uint64(1), "UserB": uint64(3)})
+	if workers["UserA"] != 1 || workers["UserB"] != 3 {
+		t.Error("The workers should be moved by the user classes of the master, got", workers)
+	}
+	runner.stop()
+}
+
+func TestAddAndRemoveTask(t *testing.T) {
+	var lock sync.Mutex
+	calls := map[string]int{}
+	createTask := func(name string) *Task {
+		return &Task{
+			Name:     name,
+			Weight:   1,
+			Fn:       func() {},
+			WaitTime: Constant(time.Minute),
+			OnStart: func() {
+				lock.Lock()
+				calls[name+" started"]++
+				lock.Unlock()
+			},
+			OnStop: func() {
+				lock.Lock()
+				calls[name+" stopped"]++
+				lock.Unlock()
+			},
+		}
+	}
+	runner := newSlaveRunner("localhost", 5557, []*Task{createTask("UserA")}, nil)
+	defer runner.close()
+	runner.client = newClient("localhost", 5557, runner.nodeID)
+	runner.state = stateInit
+
+	go func() {
+		// consumes clearStatsChannel
+		<-runner.stats.clearStatsChan
+	}()
+
+	runner.onMessage(newMessage("spawn", map[string]interface{}{
+		"user_classes_count": map[string]interface{}{"Dummy": uint64(4)},
+		"timestamp":          float64(time.Now().Unix()),
+	}, runner.nodeID))
+	<-runner.client.sendChannel() // spawning
+	<-runner.client.sendChannel() // spawning_complete
+
+	waitForWorkers := func(expected map[string]int) {
+		deadline := time.Now().Add(time.Second)
+		for {
+			workers := map[string]int{}
+			runner.workersLock.Lock()
+			for w := range runner.workers {
+				workers[w.task.Name]++
+			}
+			runner.workersLock.Unlock()
+			if reflect.DeepEqual(workers, expected) {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("The workers should be rebalanced, expected:", expected, "got:", workers)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	runner.addTask(createTask("UserB"))
+	waitForWorkers(map[string]int{"UserA": 2, "UserB": 2})
+
+	if runner.removeTask("UserC") {
+		t.Error("Removing an unknown task should return false")
+	}
+	if !runner.removeTask("UserA") {
+		t.Error("Removing UserA should return true")
+	}
+	waitForWorkers(map[string]int{"UserB": 4})
+
+	lock.Lock()
+	if calls["UserA started"] != 1 || calls["UserA stopped"] != 1 || calls["UserB started"] != 1 || calls["UserB stopped"] != 0 {
+		t.Error("OnStart and OnStop should be called when the tasks are added and removed, got", calls)
 	}
+	lock.Unlock()
+	runner.stop()
 }
 
 func TestSpawnWorkersWithManyTasksInWeighingTaskSet(t *testing.T) {
@@ -314,7 +530,7 @@ func TestSpawnAndStop(t *testing.T) {
 	}
 	runner.stop()
 
-	runner.onQuiting()
+	runner.publishQuit()
 	msg = <-runner.client.sendChannel()
 	if msg.Type != "quit" {
 		t.Error("Runner should send quit message on quitting, got", msg.Type)
@@ -345,6 +561,147 @@ func TestStop(t *testing.T) {
 	}
 }
 
+func TestStopCancelsContext(t *testing.T) {
+	canceled := make(chan bool, 10)
+	taskA := &Task{
+		FnWithContext: func(ctx context.Context) {
+			select {
+			case <-ctx.Done():
+				canceled <- true
+			case <-time.After(time.Minute):
+			}
+		},
+	}
+	runner := newLocalRunner([]*Task{taskA}, nil, 2, 1000)
+	defer runner.close()
+
+	go func() {
+		// consumes clearStatsChannel
+		<-runner.stats.clearStatsChan
+	}()
+	runner.startSpawning(2, 1000, nil)
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&runner.numClients) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("The workers are not spawned in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	runner.stop()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-canceled:
+		case <-time.After(time.Second):
+			t.Fatal("The context should be canceled when the runner is stopped")
+		}
+	}
+}
+
+func TestStopDrainsWorkers(t *testing.T) {
+	started, finished := int64(0), int64(0)
+	taskA := &Task{
+		Fn: func() {
+			atomic.AddInt64(&started, 1)
+			time.Sleep(200 * time.Millisecond)
+			atomic.AddInt64(&finished, 1)
+		},
+	}
+	runner := newLocalRunner([]*Task{taskA}, nil, 2, 1000)
+	runner.drainTimeout = time.Second
+	defer runner.close()
+
+	go func() {
+		// consumes clearStatsChannel
+		<-runner.stats.clearStatsChan
+	}()
+	runner.startSpawning(2, 1000, nil)
+	time.Sleep(100 * time.Millisecond)
+
+	runner.stop()
+	if atomic.LoadInt32(&runner.runningWorkers) != 0 {
+		t.Error("All the workers should return before stop returns, running:", runner.runningWorkers)
+	}
+	if atomic.LoadInt64(&started) != atomic.LoadInt64(&finished) {
+		t.Error("The running task functions should finish, started:", started, "finished:", finished)
+	}
+}
+
+func TestDrainTimeoutCancelsContext(t *testing.T) {
+	taskA := &Task{
+		FnWithContext: func(ctx context.Context) {
+			<-ctx.Done()
+		},
+	}
+	runner := newLocalRunner([]*Task{taskA}, nil, 2, 1000)
+	runner.drainTimeout = 100 * time.Millisecond
+	defer runner.close()
+
+	go func() {
+		// consumes clearStatsChannel
+		<-runner.stats.clearStatsChan
+	}()
+	runner.startSpawning(2, 1000, nil)
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&runner.runningWorkers) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("The workers should be spawned")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	start := time.Now()
+	runner.stop()
+	elapsed := time.Since(start)
+	if elapsed < 100*time.Millisecond || elapsed > time.Second {
+		t.Error("stop should wait for the drain timeout, then the contexts are canceled, elapsed:", elapsed)
+	}
+	deadline = time.Now().Add(time.Second)
+	for atomic.LoadInt32(&runner.runningWorkers) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("The workers should return once their contexts are canceled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTestLifecycleHooks(t *testing.T) {
+	var lock sync.Mutex
+	var calls []string
+	record := func(call string) func() {
+		return func() {
+			lock.Lock()
+			calls = append(calls, call)
+			lock.Unlock()
+		}
+	}
+	taskA := &Task{
+		Fn: func() {
+			time.Sleep(10 * time.Millisecond)
+		},
+		OnStart: record("task start"),
+		OnStop:  record("task stop"),
+	}
+	runner := newLocalRunner([]*Task{taskA}, nil, 2, 1000)
+	runner.testStartHooks = []func(){record("test start"), func() {
+		panic("the hooks are protected by safeRun")
+	}}
+	runner.testStopHooks = []func(){record("test stop")}
+	defer runner.close()
+
+	go func() {
+		// consumes clearStatsChannel
+		<-runner.stats.clearStatsChan
+	}()
+	runner.startSpawning(2, 1000, nil)
+	runner.rescale(3, 1000, nil)
+	runner.stop()
+
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, []string{"test start", "task start", "task stop", "test stop"}, calls)
+}
+
 func TestOnSpawnMessage(t *testing.T) {
 	taskA := &Task{
 		Fn: func() {
@@ -389,6 +746,52 @@ func TestOnSpawnMessage(t *testing.T) {
 	runner.onMessage(newMessage("stop", nil, runner.nodeID))
 }
 
+func TestOnLocust2SpawnMessage(t *testing.T) {
+	taskA := &Task{
+		Fn: func() {
+			time.Sleep(time.Second)
+		},
+	}
+	runner := newSlaveRunner("localhost", 5557, []*Task{taskA}, nil)
+	defer runner.close()
+	runner.client = newClient("localhost", 5557, runner.nodeID)
+	runner.state = stateInit
+
+	go func() {
+		// consumes clearStatsChannel
+		<-runner.stats.clearStatsChan
+	}()
+
+	userClassesCount := map[interface{}]interface{}{"UserA": uint64(3), "UserB": uint64(2)}
+	runner.onMessage(newMessage("spawn", map[string]interface{}{
+		"user_classes_count": userClassesCount,
+		"timestamp":          float64(time.Now().Unix()),
+	}, runner.nodeID))
+
+	msg := <-runner.client.sendChannel()
+	if msg.Type != "spawning" {
+		t.Error("Runner should send spawning message when it starts spawning, got", msg.Type)
+	}
+	msg = <-runner.client.sendChannel()
+	if msg.Type != "spawning_complete" {
+		t.Fatal("Runner should send spawning_complete message when spawning completed, got", msg.Type)
+	}
+	if msg.Data["user_count"].(int32) != 5 {
+		t.Error("The sum of user classes should be spawned at once, expected: 5, was:", msg.Data["user_count"])
+	}
+	reported := msg.Data["user_classes_count"].(map[string]interface{})
+	if reported["UserA"] != uint64(3) || reported["UserB"] != uint64(2) {
+		t.Error("user_classes_count should be reported as it's received, got", reported)
+	}
+
+	runner.onMessage(newMessage("stop", nil, runner.nodeID))
+	<-runner.client.sendChannel()
+	msg = <-runner.client.sendChannel()
+	if msg.Type != "client_ready" || msg.customData() != -1 {
+		t.Error("Runner should send client_ready message with -1 after stopped, got", msg.Type, msg.customData())
+	}
+}
+
 func TestOnQuitMessage(t *testing.T) {
 	runner := newSlaveRunner("localhost", 5557, nil, nil)
 	defer runner.close()
@@ -573,43 +976,195 @@ func TestOnMessage(t *testing.T) {
 	}
 }
 
-func TestGetReady(t *testing.T) {
-	masterHost := "127.0.0.1"
-	masterPort := 6557
-
-	server := newTestServer(masterHost, masterPort)
-	defer server.close()
-	server.start()
-
-	rateLimiter := NewStableRateLimiter(100, time.Second)
-	r := newSlaveRunner(masterHost, masterPort, nil, rateLimiter)
-	defer r.close()
-	defer Events.Unsubscribe("boomer:quit", r.onQuiting)
-
-	r.run()
-
-	msg := <-server.fromClient
-	if msg.Type != "client_ready" {
-		t.Error("Runner should send client_ready message to server.")
+func TestRescaleWithLongThinkTime(t *testing.T) {
+	task := &Task{
+		Fn: func() {},
+		WaitTime: func() time.Duration {
+			return time.Minute
+		},
 	}
+	runner := newSlaveRunner("localhost", 5557, []*Task{task}, nil)
+	defer runner.close()
+	runner.client = newClient("localhost", 5557, runner.nodeID)
+	runner.state = stateInit
 
-	r.numClients = 10
-	// it's not really running
-	r.state = stateRunning
-	data := make(map[string]interface{})
-	r.stats.messageToRunnerChan <- data
+	go func() {
+		// consumes clearStatsChannel
+		<-runner.stats.clearStatsChan
+	}()
 
-	msg = <-server.fromClient
-	if msg.Type != "stats" {
-		t.Error("Runner should send stats message to server.")
+	numGoroutines := runtime.NumGoroutine()
+	runner.onMessage(newMessage("spawn", map[string]interface{}{
+		"spawn_rate": float64(1000),
+		"num_users":  int64(100),
+	}, runner.nodeID))
+	<-runner.client.sendChannel() // spawning
+	<-runner.client.sendChannel() // spawning_complete
+	if runner.numClients != 100 {
+		t.Fatal("Number of goroutines mismatches, expected: 100, current count:", runner.numClients)
 	}
 
-	userCount := msg.Data["user_count"].(int64)
-	if userCount != int64(10) {
+	// decrease num_users while all the workers are sleeping in think time
+	runner.onMessage(newMessage("spawn", map[string]interface{}{
+		"spawn_rate": float64(10),
+		"num_users":  int64(10),
+	}, runner.nodeID))
+	<-runner.client.sendChannel() // spawning
+	msg := <-runner.client.sendChannel()
+	if msg.Type != "spawning_complete" {
+		t.Error("Runner should send spawning_complete message when rescale completed, got", msg.Type)
+	}
+	if runner.numClients != 10 {
+		t.Error("Number of goroutines mismatches, expected: 10, current count:", runner.numClients)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > numGoroutines+10+5 {
+		if time.Now().After(deadline) {
+			t.Fatal("The stopped workers don't exit in time, running goroutines:", runtime.NumGoroutine()-numGoroutines)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	runner.stop()
+}
+
+func TestStopWorkersPrefersIdle(t *testing.T) {
+	runner := &runner{rand: newRand(1)}
+	busy := runner.addWorker(nil)
+	idle1 := runner.addWorker(nil)
+	idle2 := runner.addWorker(nil)
+	idle1.idle = 1
+	idle2.idle = 1
+
+	runner.workersLock.Lock()
+	runner.stopWorkers(2)
+	runner.workersLock.Unlock()
+
+	for _, w := range []*worker{idle1, idle2} {
+		select {
+		case <-w.quit:
+		default:
+			t.Error("The idle worker should be stopped first")
+		}
+	}
+	select {
+	case <-busy.quit:
+		t.Error("The busy worker should keep running")
+	default:
+	}
+	if runner.numClients != 1 {
+		t.Error("Number of goroutines mismatches, expected: 1, current count:", runner.numClients)
+	}
+
+	// a stopped worker is removed only once
+	runner.removeWorker(idle1)
+	if runner.numClients != 1 {
+		t.Error("Number of goroutines mismatches, expected: 1, current count:", runner.numClients)
+	}
+}
+
+func TestMirrorStats(t *testing.T) {
+	runner := newSlaveRunner("localhost", 5557, nil, nil)
+	defer runner.close()
+	runner.client = newClient("localhost", 5557, runner.nodeID)
+	runner.addMirror("localhost", 5558)
+	mirror := runner.mirrors[0]
+	mirror.connected = 1
+
+	runner.sendMessage(newMessage("heartbeat", nil, runner.nodeID))
+	runner.sendMessage(newMessage("stats", nil, runner.nodeID))
+	if msg := <-runner.client.sendChannel(); msg.Type != "heartbeat" {
+		t.Error("Expected: heartbeat, got:", msg.Type)
+	}
+	if msg := <-runner.client.sendChannel(); msg.Type != "stats" {
+		t.Error("Expected: stats, got:", msg.Type)
+	}
+	if msg := <-mirror.client.sendChannel(); msg.Type != "stats" {
+		t.Error("Only stats messages should be mirrored, got:", msg.Type)
+	}
+
+	// a slow secondary master doesn't block the primary one
+	for i := 0; i < cap(mirror.client.sendChannel()); i++ {
+		mirror.client.sendChannel() <- newMessage("stats", nil, runner.nodeID)
+	}
+	done := make(chan bool)
+	go func() {
+		runner.sendMessage(newMessage("stats", nil, runner.nodeID))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Sending to the primary master is blocked by the secondary one")
+	}
+	if msg := <-runner.client.sendChannel(); msg.Type != "stats" {
+		t.Error("Expected: stats, got:", msg.Type)
+	}
+}
+
+func TestGetReady(t *testing.T) {
+	masterHost := "127.0.0.1"
+	masterPort := 6557
+
+	server := newTestServer(masterHost, masterPort)
+	defer server.close()
+	server.start()
+
+	rateLimiter := NewStableRateLimiter(100, time.Second)
+	r := newSlaveRunner(masterHost, masterPort, nil, rateLimiter)
+	defer r.close()
+
+	r.run()
+
+	msg := <-server.fromClient
+	if msg.Type != "client_ready" {
+		t.Error("Runner should send client_ready message to server.")
+	}
+
+	r.numClients = 10
+	// it's not really running
+	r.state = stateRunning
+	data := make(map[string]interface{})
+	r.stats.messageToRunnerChan <- data
+
+	msg = <-server.fromClient
+	if msg.Type != "stats" {
+		t.Error("Runner should send stats message to server.")
+	}
+
+	userCount := msg.Data["user_count"].(int64)
+	if userCount != int64(10) {
 		t.Error("User count mismatch, expect: 10, got:", userCount)
 	}
 }
 
+func TestMessageInterceptor(t *testing.T) {
+	runner := newSlaveRunner("localhost", 5557, nil, nil)
+	defer runner.close()
+	runner.client = newClient("localhost", 5557, runner.nodeID)
+	runner.messageInterceptor = func(msg *Message) *Message {
+		if msg.Type == "heartbeat" {
+			return nil
+		}
+		if msg.Data == nil {
+			msg.Data = make(map[string]interface{})
+		}
+		msg.Data["tag"] = "shard-1"
+		return msg
+	}
+
+	runner.sendMessage(newMessage("heartbeat", nil, runner.nodeID))
+	runner.sendMessage(newMessage("client_ready", nil, runner.nodeID))
+
+	msg := <-runner.client.sendChannel()
+	if msg.Type != "client_ready" {
+		t.Error("The heartbeat message should be dropped by the interceptor, got", msg.Type)
+	}
+	if msg.Data["tag"] != "shard-1" {
+		t.Error("The message should be mutated by the interceptor")
+	}
+}
+
 func TestEarlyStop(t *testing.T) {
 	task := &Task{
 		Fn: func() {
@@ -696,3 +1251,734 @@ func TestEarlyStop(t *testing.T) {
 		t.Error("Number of goroutines mismatches, expected: 0, current count:", runner.numClients)
 	}
 }
+
+func TestSetRandomSeed(t *testing.T) {
+	tasks := []*Task{
+		{Name: "A", Weight: 1},
+		{Name: "B", Weight: 1},
+		{Name: "C", Weight: 1},
+	}
+	assign := func() []string {
+		runner := newLocalRunner(tasks, nil, 1, 1)
+		defer runner.close()
+		runner.setRandomSeed(42)
+		names := make([]string, 0, 20)
+		for i := 0; i < 20; i++ {
+			names = append(names, runner.addWorker(nil).task.Name)
+		}
+		return names
+	}
+
+	assert.Equal(t, assign(), assign(), "The same seed should assign the same tasks")
+}
+
+func TestOnCustomMessage(t *testing.T) {
+	runner := newSlaveRunner("localhost", 5557, nil, nil)
+	defer runner.close()
+
+	var received interface{}
+	runner.messageHandlers = map[string]func(data interface{}){
+		"credentials": func(data interface{}) {
+			received = data
+		},
+	}
+	runner.state = stateInit
+	runner.onMessage(newCustomMessage("credentials", []byte("secret"), runner.nodeID))
+
+	if data, ok := received.([]byte); !ok || string(data) != "secret" {
+		t.Error("The custom message should be handled, got", received)
+	}
+	if runner.state != stateInit {
+		t.Error("The custom message shouldn't change the state, got", runner.state)
+	}
+}
+
+// reconnectTestClient fails to connect until connectFailures are consumed.
+type reconnectTestClient struct {
+	connectFailures *int32
+	fromMaster      chan *Message
+	toMaster        chan *Message
+	disconnected    chan bool
+	closed          int32
+}
+
+func newReconnectTestClient(connectFailures *int32) *reconnectTestClient {
+	return &reconnectTestClient{
+		connectFailures: connectFailures,
+		fromMaster:      make(chan *Message, 10),
+		toMaster:        make(chan *Message, 10),
+		disconnected:    make(chan bool),
+	}
+}
+
+func (c *reconnectTestClient) connect() error {
+	if atomic.AddInt32(c.connectFailures, -1) >= 0 {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func (c *reconnectTestClient) close()                         { atomic.StoreInt32(&c.closed, 1) }
+func (c *reconnectTestClient) recvChannel() chan *Message     { return c.fromMaster }
+func (c *reconnectTestClient) sendChannel() chan *Message     { return c.toMaster }
+func (c *reconnectTestClient) disconnectedChannel() chan bool { return c.disconnected }
+
+func TestReconnect(t *testing.T) {
+	defaultBackoff := reconnectBackoff
+	reconnectBackoff = 10 * time.Millisecond
+	defer func() {
+		reconnectBackoff = defaultBackoff
+	}()
+
+	connectFailures := int32(2)
+	clients := make(chan *reconnectTestClient, 10)
+	clientBackends["reconnect-test"] = func(masterHost string, masterPort int, identity string, security clientSecurity) client {
+		c := newReconnectTestClient(&connectFailures)
+		clients <- c
+		return c
+	}
+	defer delete(clientBackends, "reconnect-test")
+
+	runner := newSlaveRunner("localhost", 5557, nil, nil)
+	defer runner.close()
+	runner.clientBackend = "reconnect-test"
+	first := newReconnectTestClient(&connectFailures)
+	runner.client = first
+	runner.stopChan = make(chan bool)
+	runner.state = stateRunning
+	runner.startListener()
+
+	first.fromMaster <- newMessage("reconnect", nil, runner.nodeID)
+
+	var current *reconnectTestClient
+	for i := 0; i < 3; i++ {
+		select {
+		case current = <-clients:
+		case <-time.After(time.Second):
+			t.Fatal("The runner should retry to connect")
+		}
+	}
+	select {
+	case msg := <-current.toMaster:
+		assert.Equal(t, "client_ready", msg.Type)
+	case <-time.After(time.Second):
+		t.Fatal("The runner should register to the master again")
+	}
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&first.closed))
+	assert.True(t, runner.getClient() == current, "The client should be replaced")
+	assert.Equal(t, stateInit, runner.state)
+	select {
+	case <-runner.stopChan:
+	default:
+		t.Error("The running goroutines should be stopped")
+	}
+
+	// the new client is listened to
+	current.fromMaster <- newMessage("heartbeat", nil, runner.nodeID)
+	time.Sleep(10 * time.Millisecond)
+	assert.True(t, atomic.LoadInt64(&runner.lastMasterHeartbeat) != 0)
+}
+
+func TestMasterLost(t *testing.T) {
+	defaultTimeout := masterHeartbeatTimeout
+	masterHeartbeatTimeout = 50 * time.Millisecond
+	defer func() {
+		masterHeartbeatTimeout = defaultTimeout
+	}()
+
+	runner := newSlaveRunner("localhost", 5557, nil, nil)
+	defer runner.close()
+	runner.state = stateInit
+
+	assert.False(t, runner.masterLost(), "A master without heartbeats is never lost")
+
+	runner.onMessage(newMessage("heartbeat", nil, runner.nodeID))
+	assert.False(t, runner.masterLost())
+
+	time.Sleep(100 * time.Millisecond)
+	assert.True(t, runner.masterLost())
+}
+
+func TestMasterReportData(t *testing.T) {
+	stats := newRequestStats()
+	stats.logRequest("http", "foo", 10, 100)
+	stats.logError("http", "foo", "500 error")
+	data := stats.collectReportData()
+	data["user_count"] = int32(10)
+	if report := masterReportData(data); len(report["stats"].([]interface{})) != 1 {
+		t.Error("The stats after the warm-up period should be reported to the master")
+	}
+	if _, ok := masterReportData(data)["labeled_stats"]; ok {
+		t.Error("The labeled stats should not be reported to the master")
+	}
+
+	data["warmup"] = true
+	report := masterReportData(data)
+	if len(report["stats"].([]interface{})) != 0 || len(report["errors"].(map[string]map[string]interface{})) != 0 {
+		t.Error("The stats of the warm-up period should not be reported to the master, got", report)
+	}
+	if numRequests := report["stats_total"].(map[string]interface{})["num_requests"].(int64); numRequests != 0 {
+		t.Error("The total of the warm-up period should be empty, got", numRequests)
+	}
+	if report["user_count"] != int32(10) {
+		t.Error("The user count should be kept, got", report["user_count"])
+	}
+	if len(data["stats"].([]interface{})) != 1 {
+		t.Error("The data passed to the outputs should not be modified")
+	}
+}
+
+func TestStatsBatcher(t *testing.T) {
+	report := func(failures int) map[string]interface{} {
+		collector := NewStatsCollector()
+		collector.RecordSuccess("http", "foo", 10, 100)
+		for i := 0; i < failures; i++ {
+			collector.RecordFailure("http", "foo", 20, "500 error")
+		}
+		data := masterReportData(collector.Report())
+		data["user_count"] = int32(failures)
+		return data
+	}
+
+	batch := newStatsBatcher(2)
+	if batch.add(report(1)) != nil {
+		t.Error("The first report should be batched")
+	}
+	merged := batch.add(report(2))
+	if merged == nil {
+		t.Fatal("The batch should be sent once it's full")
+	}
+	stats := merged["stats"].([]interface{})
+	if len(stats) != 1 || stats[0].(map[string]interface{})["num_requests"] != int64(5) {
+		t.Error("The stats should be merged, got", stats)
+	}
+	if total := merged["stats_total"].(map[string]interface{}); total["num_failures"] != int64(3) {
+		t.Error("The total should be merged, got", total["num_failures"])
+	}
+	errors := merged["errors"].(map[string]map[string]interface{})
+	if len(errors) != 1 {
+		t.Error("The errors should be merged, got", errors)
+	}
+	for _, e := range errors {
+		if e["occurrences"] != int64(3) {
+			t.Error("The occurrences should be summed, got", e["occurrences"])
+		}
+	}
+	if merged["user_count"] != int32(2) {
+		t.Error("The other data should be the latest, got", merged["user_count"])
+	}
+
+	batch.add(report(0))
+	merged = batch.flush()
+	if merged == nil || merged["stats_total"].(map[string]interface{})["num_requests"] != int64(1) {
+		t.Error("The pending report should be flushed by itself, got", merged)
+	}
+	if batch.flush() != nil {
+		t.Error("Nothing should be flushed twice")
+	}
+}
+
+func TestOnWorkerCountMessage(t *testing.T) {
+	rateLimiter := NewDistributedRateLimiter(100, time.Second)
+	runner := newSlaveRunner("localhost", 5557, nil, rateLimiter)
+	defer runner.close()
+
+	runner.state = stateInit
+	runner.onMessage(newCustomMessage("worker_count", uint64(4), runner.nodeID))
+	if atomic.LoadInt64(&rateLimiter.workerCount) != 4 {
+		t.Error("The worker count should be passed to the rate limiter, got", rateLimiter.workerCount)
+	}
+	if runner.state != stateInit {
+		t.Error("The worker count message shouldn't change the state, got", runner.state)
+	}
+}
+
+func TestExpectedWorkers(t *testing.T) {
+	taskA := &Task{
+		Fn: func() {
+			time.Sleep(time.Second)
+		},
+	}
+	runner := newSlaveRunner("localhost", 5557, []*Task{taskA}, nil)
+	defer runner.close()
+	runner.client = newClient("localhost", 5557, runner.nodeID)
+	runner.state = stateInit
+	runner.expectedWorkers = 3
+
+	go func() {
+		// consumes clearStatsChannel
+		<-runner.stats.clearStatsChan
+	}()
+
+	runner.onMessage(newCustomMessage("worker_count", uint64(2), runner.nodeID))
+	runner.onMessage(newMessage("spawn", map[string]interface{}{
+		"spawn_rate": float64(10),
+		"num_users":  int64(10),
+	}, runner.nodeID))
+	if runner.getState() != stateInit || runner.pendingSpawn == nil {
+		t.Fatal("The spawn message should be held until 3 workers are connected, got", runner.getState())
+	}
+	select {
+	case msg := <-runner.client.sendChannel():
+		t.Fatal("Nothing should be sent while the spawn message is held, got", msg.Type)
+	default:
+	}
+
+	runner.onMessage(newCustomMessage("worker_count", uint64(3), runner.nodeID))
+	msg := <-runner.client.sendChannel()
+	if msg.Type != "spawning" || runner.pendingSpawn != nil {
+		t.Error("The held spawn message should be handled once 3 workers are connected, got", msg.Type)
+	}
+	msg = <-runner.client.sendChannel()
+	if msg.Type != "spawning_complete" || msg.Data["user_count"].(int32) != 10 {
+		t.Error("The users should be spawned, got", msg.Type, msg.Data)
+	}
+}
+
+func TestExpectedWorkersStop(t *testing.T) {
+	runner := newSlaveRunner("localhost", 5557, nil, nil)
+	defer runner.close()
+	runner.client = newClient("localhost", 5557, runner.nodeID)
+	runner.state = stateInit
+	runner.expectedWorkers = 2
+
+	runner.onMessage(newMessage("spawn", map[string]interface{}{
+		"spawn_rate": float64(10),
+		"num_users":  int64(10),
+	}, runner.nodeID))
+	runner.onMessage(newMessage("stop", nil, runner.nodeID))
+	if runner.pendingSpawn != nil {
+		t.Error("The held spawn message should be dropped when the test is stopped")
+	}
+	runner.onMessage(newCustomMessage("worker_count", uint64(2), runner.nodeID))
+	if runner.getState() != stateInit {
+		t.Error("Nothing should be spawned once the test is stopped, got", runner.getState())
+	}
+}
+
+func TestPauseAndResume(t *testing.T) {
+	iterations := int64(0)
+	taskA := &Task{
+		FnWithUser: func(ctx context.Context, user *User) {
+			user.Storage["iterations"] = atomic.AddInt64(&iterations, 1)
+			time.Sleep(time.Millisecond)
+		},
+	}
+	runner := newSlaveRunner("localhost", 5557, []*Task{taskA}, nil)
+	defer runner.close()
+	runner.client = newClient("localhost", 5557, runner.nodeID)
+	runner.state = stateInit
+
+	go func() {
+		// consumes clearStatsChannel
+		<-runner.stats.clearStatsChan
+	}()
+
+	runner.onMessage(newMessage("spawn", map[string]interface{}{
+		"spawn_rate": float64(0),
+		"num_users":  int64(3),
+	}, runner.nodeID))
+	<-runner.client.sendChannel() // spawning
+	<-runner.client.sendChannel() // spawning_complete
+	runner.setState(stateRunning)
+
+	runner.onMessage(newMessage("pause", nil, runner.nodeID))
+	if !runner.isPaused() || runner.pause() {
+		t.Fatal("The runner should be paused once")
+	}
+	// wait for the running iterations to finish
+	time.Sleep(20 * time.Millisecond)
+	paused := atomic.LoadInt64(&iterations)
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt64(&iterations); n != paused {
+		t.Error("No iterations should be started while paused, got", n-paused)
+	}
+	if n := atomic.LoadInt32(&runner.numClients); n != 3 {
+		t.Error("The users should be kept while paused, got", n)
+	}
+
+	runner.onMessage(newMessage("resume", nil, runner.nodeID))
+	time.Sleep(50 * time.Millisecond)
+	if runner.isPaused() || atomic.LoadInt64(&iterations) == paused {
+		t.Error("The iterations should be continued once resumed")
+	}
+	if runner.resume() {
+		t.Error("The runner shouldn't be resumed twice")
+	}
+
+	runner.pause()
+	runner.onMessage(newMessage("stop", nil, runner.nodeID))
+	if runner.isPaused() {
+		t.Error("Stopping the test should resume it")
+	}
+}
+
+func TestSpawnStartAt(t *testing.T) {
+	taskA := &Task{
+		Fn: func() {
+			time.Sleep(time.Second)
+		},
+	}
+	runner := newSlaveRunner("localhost", 5557, []*Task{taskA}, nil)
+	defer runner.close()
+	runner.client = newClient("localhost", 5557, runner.nodeID)
+	runner.state = stateInit
+
+	go func() {
+		// consumes clearStatsChannel
+		<-runner.stats.clearStatsChan
+	}()
+
+	startAt := time.Now().Add(200 * time.Millisecond)
+	runner.onMessage(newMessage("spawn", map[string]interface{}{
+		"spawn_rate": float64(10),
+		"num_users":  int64(5),
+		"start_at":   startAt.UnixNano() / int64(time.Millisecond),
+	}, runner.nodeID))
+	if msg := <-runner.client.sendChannel(); msg.Type != "spawning" {
+		t.Fatal("Runner should send spawning message at once, got", msg.Type)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt32(&runner.numClients); n != 0 {
+		t.Error("No users should be spawned before start_at, got", n)
+	}
+	msg := <-runner.client.sendChannel()
+	if msg.Type != "spawning_complete" || time.Now().Before(startAt) {
+		t.Error("The users should be spawned after start_at, got", msg.Type)
+	}
+}
+
+func TestSpawnStartAtStopped(t *testing.T) {
+	runner := newSlaveRunner("localhost", 5557, []*Task{{Fn: func() {}}}, nil)
+	defer runner.close()
+	runner.setStartAt(time.Now().Add(time.Hour))
+
+	quit := make(chan bool)
+	done := make(chan bool)
+	go func() {
+		runner.spawn(10, quit, nil, nil)
+		close(done)
+	}()
+	close(quit)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Spawning should be stopped while waiting for the start time")
+	}
+	if n := atomic.LoadInt32(&runner.numClients); n != 0 {
+		t.Error("No users should be spawned, got", n)
+	}
+
+	runner.setStartAt(time.Time{})
+	if runner.startDelay() != 0 {
+		t.Error("The zero time should start at once")
+	}
+}
+
+func TestIterationQuota(t *testing.T) {
+	runner := newSlaveRunner("localhost", 5557, nil, nil)
+	defer runner.close()
+
+	quitted := int32(0)
+	runner.setIterationLimit(10, func() {
+		atomic.AddInt32(&quitted, 1)
+	})
+	if quota := runner.iterationQuota(); quota != 10 {
+		t.Error("The quota should be the limit without the worker count, got", quota)
+	}
+	runner.state = stateRunning
+	runner.onMessage(newCustomMessage("worker_count", uint64(3), runner.nodeID))
+	if quota := runner.iterationQuota(); quota != 4 {
+		t.Error("The limit should be split over 3 workers and rounded up, got", quota)
+	}
+
+	for i := 0; i < 4; i++ {
+		if !runner.startIteration() {
+			t.Fatal("The iteration should be started within the quota")
+		}
+	}
+	if runner.startIteration() {
+		t.Error("The iteration shouldn't be started beyond the quota")
+	}
+	for i := 0; i < 4; i++ {
+		runner.finishIteration()
+	}
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&quitted) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("The runner should quit once the iterations are finished")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestArrivalInterval(t *testing.T) {
+	runner := newSlaveRunner("localhost", 5557, nil, nil)
+	defer runner.close()
+
+	runner.setArrivalRate(0, nil)
+	if runner.arrivalChan != nil {
+		t.Error("The open model shouldn't be enabled without an arrival rate")
+	}
+	runner.setArrivalRate(100, nil)
+	if runner.arrivalInterval() != 10*time.Millisecond {
+		t.Error("Expected an interval of 10ms, got", runner.arrivalInterval())
+	}
+	runner.state = stateRunning
+	runner.onMessage(newCustomMessage("worker_count", uint64(4), runner.nodeID))
+	if runner.arrivalInterval() != 40*time.Millisecond {
+		t.Error("The arrival rate should be split over 4 workers, got", runner.arrivalInterval())
+	}
+	if runner.nextArrivalInterval() != 40*time.Millisecond {
+		t.Error("The intervals should be fixed by default, got", runner.nextArrivalInterval())
+	}
+}
+
+func TestNextArrivalInterval(t *testing.T) {
+	runner := newSlaveRunner("localhost", 5557, nil, nil)
+	defer runner.close()
+
+	means := make([]time.Duration, 0)
+	interval := time.Duration(0)
+	runner.setArrivalRate(100, func(random *rand.Rand, mean time.Duration) time.Duration {
+		means = append(means, mean)
+		return interval
+	})
+	interval = 3 * time.Millisecond
+	if d := runner.nextArrivalInterval(); d != 3*time.Millisecond {
+		t.Error("The interval should be returned by the distribution, got", d)
+	}
+	interval = -time.Millisecond
+	if d := runner.nextArrivalInterval(); d <= 0 {
+		t.Error("The interval should be positive, got", d)
+	}
+	if len(means) != 2 || means[0] != 10*time.Millisecond {
+		t.Error("The distribution should be called with the interval of the arrival rate, got", means)
+	}
+}
+
+func TestTaskRateLimiter(t *testing.T) {
+	reads, writes := int64(0), int64(0)
+	// the bucket isn't refilled during the test
+	writeLimiter := NewStableRateLimiter(3, time.Hour)
+	readTask := &Task{
+		Weight: 1,
+		Fn: func() {
+			atomic.AddInt64(&reads, 1)
+			time.Sleep(time.Millisecond)
+		},
+	}
+	writeTask := &Task{
+		Weight:      1,
+		RateLimiter: writeLimiter,
+		Fn: func() {
+			atomic.AddInt64(&writes, 1)
+		},
+	}
+	runner := newLocalRunner([]*Task{readTask, writeTask}, nil, 2, 1000)
+	defer runner.close()
+
+	go func() {
+		// consumes clearStatsChannel
+		<-runner.stats.clearStatsChan
+	}()
+	runner.startSpawning(2, 1000, nil)
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt64(&reads) < 10 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	runner.stop()
+
+	if atomic.LoadInt64(&writes) != 3 {
+		t.Error("The write task should be limited by its rate limiter, got", writes)
+	}
+	if atomic.LoadInt64(&reads) < 10 {
+		t.Error("The read task should not be limited, got", reads)
+	}
+}
+
+func TestCircuitBreakerPausesTask(t *testing.T) {
+	calls := int64(0)
+	task := &Task{
+		Name: "foo",
+		Fn: func() {
+			atomic.AddInt64(&calls, 1)
+			time.Sleep(time.Millisecond)
+		},
+	}
+	runner := newLocalRunner([]*Task{task}, nil, 2, 1000)
+	defer runner.close()
+	runner.circuitBreakers = newCircuitBreakerOutput(map[string]CircuitBreaker{
+		"foo": {FailRatio: 0.5, CoolDown: 200 * time.Millisecond},
+	}, eventPublisher{hooks: &Hooks{}})
+	runner.circuitBreakers.judge("foo", runner.circuitBreakers.breakers["foo"], 1)
+
+	go func() {
+		// consumes clearStatsChannel
+		<-runner.stats.clearStatsChan
+	}()
+	runner.startSpawning(2, 1000, nil)
+	defer runner.stop()
+
+	time.Sleep(50 * time.Millisecond)
+	if atomic.LoadInt64(&calls) != 0 {
+		t.Error("The task should be paused while the breaker is open, got", atomic.LoadInt64(&calls))
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt64(&calls) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if atomic.LoadInt64(&calls) == 0 {
+		t.Error("The task should be resumed after the cool-down")
+	}
+}
+
+func TestRunTaskRecordsPanic(t *testing.T) {
+	task := &Task{
+		Name: "foo",
+		Fn: func() {
+			panic("nil map")
+		},
+	}
+	runner := newLocalRunner([]*Task{task}, nil, 1, 1)
+	defer runner.close()
+
+	runner.runTask(context.Background(), &worker{task: task})
+	runner.stats.flushRecords()
+
+	if runner.stats.total.numFailures != 1 {
+		t.Fatal("The panic should be recorded as a failure, got", runner.stats.total.numFailures)
+	}
+	for _, e := range runner.stats.errors {
+		if e.method != "panic" || e.name != "foo" || e.error != "nil map" || e.category != ErrorPanic {
+			t.Error("Unexpected error of the panic", e)
+		}
+		if !strings.Contains(e.stack, "TestRunTaskRecordsPanic") || e.toMap()["stack"] != e.stack {
+			t.Error("The stack trace should be attached to the error, got", e.stack)
+		}
+	}
+}
+
+func TestRespawnWorkerAfterPanic(t *testing.T) {
+	calls, panicked := int64(0), int32(0)
+	task := &Task{
+		Fn: func() {
+			atomic.AddInt64(&calls, 1)
+		},
+		WaitTime: func() time.Duration {
+			if atomic.CompareAndSwapInt32(&panicked, 0, 1) {
+				panic("invalid think time")
+			}
+			return time.Millisecond
+		},
+	}
+	runner := newLocalRunner([]*Task{task}, nil, 2, 1000)
+	defer runner.close()
+
+	go func() {
+		// consumes clearStatsChannel
+		<-runner.stats.clearStatsChan
+	}()
+	runner.startSpawning(2, 1000, nil)
+	defer runner.stop()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt64(&calls) < 10 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if atomic.LoadInt64(&calls) < 10 {
+		t.Fatal("The crashed worker should be respawned, got", atomic.LoadInt64(&calls))
+	}
+	if n := atomic.LoadInt32(&runner.numClients); n != 2 {
+		t.Error("The user count shouldn't be changed by the panic, got", n)
+	}
+	if n := atomic.LoadInt32(&runner.runningWorkers); n != 2 {
+		t.Error("The goroutine of the crashed worker should be replaced, got", n)
+	}
+}
+
+func TestTaskTimeout(t *testing.T) {
+	canceled := make(chan error, 1)
+	task := &Task{
+		Name:    "foo",
+		Timeout: 20 * time.Millisecond,
+		FnWithContext: func(ctx context.Context) {
+			<-ctx.Done()
+			canceled <- ctx.Err()
+		},
+	}
+	runner := newLocalRunner([]*Task{task}, nil, 1, 1)
+	defer runner.close()
+
+	runner.runTask(context.Background(), &worker{task: task})
+	runner.stats.flushRecords()
+
+	if err := <-canceled; err != context.DeadlineExceeded {
+		t.Error("The context should be canceled by the timeout, got", err)
+	}
+	if runner.stats.total.numFailures != 1 {
+		t.Fatal("The timeout should be recorded as a failure, got", runner.stats.total.numFailures)
+	}
+	for _, e := range runner.stats.errors {
+		if e.method != "timeout" || e.name != "foo" || e.category != ErrorTimeout {
+			t.Error("Unexpected error of the timeout", e)
+		}
+	}
+}
+
+func TestTaskTimeoutAbandonsHungIteration(t *testing.T) {
+	hung := make(chan bool)
+	defer close(hung)
+	task := &Task{
+		Timeout: 20 * time.Millisecond,
+		Fn: func() {
+			<-hung
+		},
+	}
+	runner := newLocalRunner([]*Task{task}, nil, 1, 1)
+	defer runner.close()
+
+	start := time.Now()
+	runner.runTask(context.Background(), &worker{task: task})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Error("The hung iteration should be abandoned after the timeout, got", elapsed)
+	}
+	runner.stats.flushRecords()
+	if runner.stats.total.numFailures != 1 {
+		t.Error("The timeout should be recorded as a failure, got", runner.stats.total.numFailures)
+	}
+}
+
+func TestTaskWithinTimeout(t *testing.T) {
+	task := &Task{
+		Timeout: time.Second,
+		Fn:      func() {},
+	}
+	runner := newLocalRunner([]*Task{task}, nil, 1, 1)
+	defer runner.close()
+
+	runner.runTask(context.Background(), &worker{task: task})
+	runner.stats.flushRecords()
+	if runner.stats.total.numRequests != 0 {
+		t.Error("Nothing should be recorded if the iteration is within the timeout, got", runner.stats.total.numRequests)
+	}
+}
+
+func TestAddRunMetadata(t *testing.T) {
+	runner := &runner{}
+	data := map[string]interface{}{}
+	runner.addRunMetadata(data)
+	if len(data) != 0 {
+		t.Error("Nothing should be added without the run metadata, got", data)
+	}
+
+	runner.runID = "nightly"
+	runner.runLabels = map[string]string{"env": "staging"}
+	runner.addRunMetadata(data)
+	report := masterReportData(data)
+	if report["run_id"] != "nightly" || ParseIntervalStats(report).RunLabels["env"] != "staging" {
+		t.Error("The run metadata should be reported to the master, got", report)
+	}
+}
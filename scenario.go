@@ -0,0 +1,103 @@
+package boomer
+
+import (
+	"context"
+	"time"
+)
+
+// scenarioRequestType is the request type of the whole journeys of the scenarios.
+const scenarioRequestType = "scenario"
+
+// Step is a step of a Scenario, like login, browse or checkout.
+type Step struct {
+	Name string
+	// Fn runs the step, state is shared by all the steps of the same journey. If Fn returns an error,
+	// the step is recorded as a failure, and the rest of the steps are skipped until the next journey.
+	Fn func(ctx context.Context, state map[string]interface{}) error
+	// WaitTime is optional, it returns how long the user sleeps after the step, before the next one.
+	WaitTime func() time.Duration
+}
+
+// Scenario is a multi-step user journey, the steps are run in order by each goroutine, with a state shared by the
+// steps of a journey, which is created for every journey. Each step is recorded with the name of the scenario as the
+// request type and its own name, including the failures, and the whole journey is recorded as "scenario" with
+// the name of the scenario, so both the steps and the journeys have their own stats.
+// The requests made by the steps are recorded as usual, the steps don't need to record themselves.
+//
+//	checkout := &boomer.Scenario{
+//		Name: "checkout",
+//		Steps: []*boomer.Step{
+//			{Name: "login", Fn: login},
+//			{Name: "browse", Fn: browse, WaitTime: boomer.Between(time.Second, 3*time.Second)},
+//			{Name: "checkout", Fn: pay},
+//		},
+//	}
+//	boomer.Run(checkout.Task())
+type Scenario struct {
+	Name string
+	// Weight is the weight of the task returned by Task.
+	Weight int
+	Steps  []*Step
+	// Recorder is optional, the steps and the journeys are recorded by the defaultBoomer if it's nil.
+	Recorder Recorder
+	// WaitTime is optional, it returns how long the user sleeps after a journey, before the next one.
+	WaitTime func() time.Duration
+}
+
+// Task returns a Task, which runs a journey of the scenario in every iteration, so the runner can drive it like other tasks.
+func (s *Scenario) Task() *Task {
+	return &Task{
+		Name:          s.Name,
+		Weight:        s.Weight,
+		FnWithContext: s.run,
+		WaitTime:      s.WaitTime,
+	}
+}
+
+func (s *Scenario) recorder() Recorder {
+	if s.Recorder != nil {
+		return s.Recorder
+	}
+	return defaultBoomer
+}
+
+// run runs the steps in order, it stops at the first failed step, or once ctx is canceled.
+func (s *Scenario) run(ctx context.Context) {
+	recorder := s.recorder()
+	state := make(map[string]interface{})
+	start := time.Now()
+	for i, step := range s.Steps {
+		stepStart := time.Now()
+		err := step.Fn(ctx, state)
+		if ctx.Err() != nil {
+			// the user is stopped, the journey is incomplete
+			return
+		}
+		if err != nil {
+			recorder.RecordFailure(s.Name, step.Name, elapsedMilliseconds(stepStart), err.Error())
+			recorder.RecordFailure(scenarioRequestType, s.Name, elapsedMilliseconds(start), step.Name+": "+err.Error())
+			return
+		}
+		recorder.RecordSuccess(s.Name, step.Name, elapsedMilliseconds(stepStart), 0)
+		if step.WaitTime != nil && i < len(s.Steps)-1 && !sleepContext(ctx, step.WaitTime()) {
+			return
+		}
+	}
+	recorder.RecordSuccess(scenarioRequestType, s.Name, elapsedMilliseconds(start), 0)
+}
+
+func elapsedMilliseconds(start time.Time) int64 {
+	return int64(time.Since(start) / time.Millisecond)
+}
+
+// sleepContext returns false if ctx is canceled before d elapses.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
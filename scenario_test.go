@@ -0,0 +1,126 @@
+package boomer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestScenario(t *testing.T) {
+	collector := NewStatsCollector()
+	var order []string
+	scenario := &Scenario{
+		Name:     "checkout",
+		Weight:   10,
+		Recorder: collector,
+		Steps: []*Step{
+			{Name: "login", Fn: func(ctx context.Context, state map[string]interface{}) error {
+				order = append(order, "login")
+				state["token"] = "secret"
+				return nil
+			}},
+			{Name: "browse", Fn: func(ctx context.Context, state map[string]interface{}) error {
+				order = append(order, "browse")
+				if state["token"] != "secret" {
+					t.Error("The state should be shared by the steps")
+				}
+				return nil
+			}, WaitTime: Constant(time.Millisecond)},
+			{Name: "pay", Fn: func(ctx context.Context, state map[string]interface{}) error {
+				order = append(order, "pay")
+				return nil
+			}},
+		},
+	}
+
+	task := scenario.Task()
+	if task.Name != "checkout" || task.Weight != 10 {
+		t.Error("The task should have the name and the weight of the scenario")
+	}
+	task.run(context.Background())
+
+	if len(order) != 3 || order[0] != "login" || order[1] != "browse" || order[2] != "pay" {
+		t.Error("The steps should be run in order, got", order)
+	}
+	for _, step := range []string{"login", "browse", "pay"} {
+		if collector.NumRequests("checkout", step) != 1 {
+			t.Error("Each step should be recorded once, but", step, "isn't")
+		}
+	}
+	if collector.NumRequests("scenario", "checkout") != 1 || collector.NumFailures("scenario", "checkout") != 0 {
+		t.Error("The journey should be recorded as a success")
+	}
+}
+
+func TestScenarioStepFailure(t *testing.T) {
+	collector := NewStatsCollector()
+	checkedOut := false
+	scenario := &Scenario{
+		Name:     "checkout",
+		Recorder: collector,
+		Steps: []*Step{
+			{Name: "login", Fn: func(ctx context.Context, state map[string]interface{}) error {
+				if _, ok := state["token"]; ok {
+					t.Error("The state should be created for every journey")
+				}
+				state["token"] = "secret"
+				return errors.New("unauthorized")
+			}},
+			{Name: "pay", Fn: func(ctx context.Context, state map[string]interface{}) error {
+				checkedOut = true
+				return nil
+			}},
+		},
+	}
+
+	task := scenario.Task()
+	task.run(context.Background())
+	task.run(context.Background())
+
+	if checkedOut {
+		t.Error("The steps after a failed step should be skipped")
+	}
+	if collector.NumFailures("checkout", "login") != 2 {
+		t.Error("The failed step should be recorded as a failure")
+	}
+	if collector.NumRequests("checkout", "pay") != 0 {
+		t.Error("The skipped step shouldn't be recorded")
+	}
+	if collector.NumFailures("scenario", "checkout") != 2 {
+		t.Error("The journey should be recorded as a failure")
+	}
+}
+
+func TestScenarioCanceled(t *testing.T) {
+	collector := NewStatsCollector()
+	ctx, cancel := context.WithCancel(context.Background())
+	scenario := &Scenario{
+		Name:     "checkout",
+		Recorder: collector,
+		Steps: []*Step{
+			{Name: "login", Fn: func(ctx context.Context, state map[string]interface{}) error {
+				cancel()
+				return nil
+			}, WaitTime: Constant(time.Hour)},
+			{Name: "pay", Fn: func(ctx context.Context, state map[string]interface{}) error {
+				t.Error("The user is stopped, the next step shouldn't be run")
+				return nil
+			}},
+		},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		scenario.Task().run(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("The wait time should be interrupted once the user is stopped")
+	}
+	if collector.NumRequests("scenario", "checkout") != 0 || collector.NumRequests("checkout", "login") != 0 {
+		t.Error("An incomplete journey shouldn't be recorded")
+	}
+}
@@ -0,0 +1,31 @@
+package boomer
+
+import "sort"
+
+// server is the socket used by MasterRunner to talk to the workers.
+type server interface {
+	bind() (err error)
+	close()
+	// recvChannel receives the messages from all the workers.
+	recvChannel() chan *Message
+	// sendChannel sends a message to the worker of msg.NodeID.
+	sendChannel() chan *Message
+}
+
+// serverBackends are the transports of MasterRunner by name. zmq is the default and talks to locust and boomer
+// workers, tcp only talks to boomer workers with the tcp client backend.
+var serverBackends = map[string]func(bindHost string, bindPort int, identity string) server{
+	"zmq": func(bindHost string, bindPort int, identity string) server {
+		return newServer(bindHost, bindPort, identity)
+	},
+}
+
+// availableServerBackends returns the names of the available backends, in order.
+func availableServerBackends() []string {
+	names := make([]string, 0, len(serverBackends))
+	for name := range serverBackends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
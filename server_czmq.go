@@ -0,0 +1,119 @@
+// +build goczmq
+
+package boomer
+
+import (
+	"fmt"
+
+	"github.com/zeromq/goczmq"
+)
+
+type czmqSocketServer struct {
+	bindHost string
+	bindPort int
+	identity string
+
+	routerSocket *goczmq.Sock
+
+	fromWorkers  chan *Message
+	toWorkers    chan *Message
+	shutdownChan chan bool
+}
+
+func newServer(bindHost string, bindPort int, identity string) (server *czmqSocketServer) {
+	logInfo("Boomer is built with goczmq support.")
+	server = &czmqSocketServer{
+		bindHost:     bindHost,
+		bindPort:     bindPort,
+		identity:     identity,
+		fromWorkers:  make(chan *Message, 100),
+		toWorkers:    make(chan *Message, 100),
+		shutdownChan: make(chan bool),
+	}
+	return server
+}
+
+func (s *czmqSocketServer) bind() (err error) {
+	addr := fmt.Sprintf("tcp://%s:%d", s.bindHost, s.bindPort)
+	router, err := goczmq.NewRouter(addr)
+	if err != nil {
+		return err
+	}
+
+	s.routerSocket = router
+
+	logInfo("Boomer is listening on %s for workers.\n", addr)
+
+	go s.recv()
+	go s.send()
+
+	return nil
+}
+
+func (s *czmqSocketServer) close() {
+	close(s.shutdownChan)
+	if s.routerSocket != nil {
+		s.routerSocket.Destroy()
+	}
+}
+
+func (s *czmqSocketServer) recvChannel() chan *Message {
+	return s.fromWorkers
+}
+
+func (s *czmqSocketServer) recv() {
+	for {
+		select {
+		case <-s.shutdownChan:
+			return
+		default:
+			// the first frame is the identity of the worker
+			frames, err := s.routerSocket.RecvMessage()
+			if err != nil {
+				logError("Error reading: %v\n", err)
+				continue
+			}
+			if len(frames) < 2 {
+				continue
+			}
+			decodedMsg, err := newMessageFromBytes(frames[len(frames)-1])
+			if err != nil {
+				logError("Msgpack decode fail: %v\n", err)
+				continue
+			}
+			s.fromWorkers <- decodedMsg
+		}
+	}
+}
+
+func (s *czmqSocketServer) sendChannel() chan *Message {
+	return s.toWorkers
+}
+
+func (s *czmqSocketServer) send() {
+	for {
+		select {
+		case <-s.shutdownChan:
+			return
+		case msg := <-s.toWorkers:
+			s.sendMessage(msg)
+		}
+	}
+}
+
+// sendMessage routes the message by node id, which is used as the identity by the workers.
+func (s *czmqSocketServer) sendMessage(msg *Message) {
+	logDebug("Send a %s message to worker(%s)", msg.Type, msg.NodeID)
+	serializedMessage, err := msg.serialize()
+	if err != nil {
+		logError("Msgpack encode fail: %v\n", err)
+		return
+	}
+	err = s.routerSocket.SendFrame([]byte(msg.NodeID), goczmq.FlagMore)
+	if err == nil {
+		err = s.routerSocket.SendFrame(serializedMessage, goczmq.FlagNone)
+	}
+	if err != nil {
+		logError("Error sending: %v\n", err)
+	}
+}
@@ -0,0 +1,177 @@
+// +build !goczmq
+
+package boomer
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// gomqSocketServer works like a ZMQ_ROUTER socket. gomq doesn't support routing by identity,
+// so every message is sent to all the workers, which drop the messages of other node ids.
+type gomqSocketServer struct {
+	bindHost string
+	bindPort int
+	identity string
+
+	listener net.Listener
+	lock     sync.Mutex
+	conns    map[*zmtp.Connection]net.Conn
+
+	fromWorkers  chan *Message
+	toWorkers    chan *Message
+	shutdownChan chan bool
+}
+
+func newServer(bindHost string, bindPort int, identity string) (server *gomqSocketServer) {
+	logInfo("Boomer is built with gomq support.")
+	server = &gomqSocketServer{
+		bindHost:     bindHost,
+		bindPort:     bindPort,
+		identity:     identity,
+		conns:        make(map[*zmtp.Connection]net.Conn),
+		fromWorkers:  make(chan *Message, 100),
+		toWorkers:    make(chan *Message, 100),
+		shutdownChan: make(chan bool),
+	}
+	return server
+}
+
+func (s *gomqSocketServer) bind() (err error) {
+	addr := fmt.Sprintf("%s:%d", s.bindHost, s.bindPort)
+	s.listener, err = net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	logInfo("Boomer is listening on tcp://%s for workers.\n", addr)
+	go s.accept()
+	go s.send()
+
+	return nil
+}
+
+func (s *gomqSocketServer) close() {
+	close(s.shutdownChan)
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	s.lock.Lock()
+	for conn, netConn := range s.conns {
+		netConn.Close()
+		delete(s.conns, conn)
+	}
+	s.lock.Unlock()
+}
+
+func (s *gomqSocketServer) accept() {
+	for {
+		netConn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.shutdownChan:
+				return
+			default:
+			}
+			logError("Error accepting: %v\n", err)
+			continue
+		}
+
+		conn := zmtp.NewConnection(netConn)
+		_, err = conn.Prepare(zmtp.NewSecurityNull(), zmtp.RouterSocketType, zmtp.SocketIdentity(s.identity), true, nil)
+		if err != nil {
+			logError("Error handshaking with %s: %v\n", netConn.RemoteAddr(), err)
+			netConn.Close()
+			continue
+		}
+
+		s.lock.Lock()
+		s.conns[conn] = netConn
+		s.lock.Unlock()
+
+		messages := make(chan *zmtp.Message, 100)
+		conn.Recv(messages)
+		go s.recv(conn, messages)
+	}
+}
+
+func (s *gomqSocketServer) removeConn(conn *zmtp.Connection) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if netConn, ok := s.conns[conn]; ok {
+		netConn.Close()
+		delete(s.conns, conn)
+	}
+}
+
+func (s *gomqSocketServer) recvChannel() chan *Message {
+	return s.fromWorkers
+}
+
+func (s *gomqSocketServer) recv(conn *zmtp.Connection, messages chan *zmtp.Message) {
+	for {
+		select {
+		case <-s.shutdownChan:
+			return
+		case msg := <-messages:
+			if msg.Err != nil {
+				logDebug("Error reading, the worker may be disconnected: %v\n", msg.Err)
+				s.removeConn(conn)
+				return
+			}
+			if msg.MessageType == zmtp.CommandMessage {
+				continue
+			}
+			if len(msg.Body) == 0 {
+				continue
+			}
+			decodedMsg, err := newMessageFromBytes(msg.Body[len(msg.Body)-1])
+			if err != nil {
+				logError("Msgpack decode fail: %v\n", err)
+				continue
+			}
+			s.fromWorkers <- decodedMsg
+		}
+	}
+}
+
+func (s *gomqSocketServer) sendChannel() chan *Message {
+	return s.toWorkers
+}
+
+func (s *gomqSocketServer) send() {
+	for {
+		select {
+		case <-s.shutdownChan:
+			return
+		case msg := <-s.toWorkers:
+			s.sendMessage(msg)
+		}
+	}
+}
+
+func (s *gomqSocketServer) sendMessage(msg *Message) {
+	logDebug("Send a %s message to worker(%s)", msg.Type, msg.NodeID)
+	serializedMessage, err := msg.serialize()
+	if err != nil {
+		logError("Msgpack encode fail: %v\n", err)
+		return
+	}
+
+	s.lock.Lock()
+	conns := make([]*zmtp.Connection, 0, len(s.conns))
+	for conn := range s.conns {
+		conns = append(conns, conn)
+	}
+	s.lock.Unlock()
+
+	for _, conn := range conns {
+		if err := conn.SendFrame(serializedMessage); err != nil {
+			logError("Error sending: %v\n", err)
+			s.removeConn(conn)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package boomer
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// tcpServer is the server of the tcp transport, see tcpClient. Unlike gomqSocketServer, it routes the messages
+// by node id, the node id of a connection is learned from the messages it sends.
+type tcpServer struct {
+	bindHost string
+	bindPort int
+	identity string
+	// tlsConfig wraps the connections in TLS if it's set, see MasterRunner.SetTLS.
+	tlsConfig *tls.Config
+
+	listener net.Listener
+	lock     sync.Mutex
+	// the node ids of the connections, empty until a connection sends a message
+	conns map[net.Conn]string
+
+	fromWorkers  chan *Message
+	toWorkers    chan *Message
+	shutdownChan chan bool
+}
+
+func init() {
+	serverBackends["tcp"] = func(bindHost string, bindPort int, identity string) server {
+		return newTCPServer(bindHost, bindPort, identity)
+	}
+}
+
+func newTCPServer(bindHost string, bindPort int, identity string) *tcpServer {
+	return &tcpServer{
+		bindHost:     bindHost,
+		bindPort:     bindPort,
+		identity:     identity,
+		conns:        make(map[net.Conn]string),
+		fromWorkers:  make(chan *Message, 100),
+		toWorkers:    make(chan *Message, 100),
+		shutdownChan: make(chan bool),
+	}
+}
+
+func (s *tcpServer) bind() (err error) {
+	addr := net.JoinHostPort(s.bindHost, strconv.Itoa(s.bindPort))
+	s.listener, err = net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	if s.tlsConfig != nil {
+		s.listener = tls.NewListener(s.listener, s.tlsConfig)
+		logInfo("Boomer is listening on tls://%s for workers, over TCP with TLS.\n", addr)
+	} else {
+		logInfo("Boomer is listening on tcp://%s for workers, over plain TCP.\n", addr)
+	}
+	go s.accept()
+	go s.send()
+
+	return nil
+}
+
+func (s *tcpServer) close() {
+	close(s.shutdownChan)
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	s.lock.Lock()
+	for conn := range s.conns {
+		conn.Close()
+		delete(s.conns, conn)
+	}
+	s.lock.Unlock()
+}
+
+func (s *tcpServer) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.shutdownChan:
+				return
+			default:
+			}
+			logError("Error accepting: %v\n", err)
+			continue
+		}
+
+		s.lock.Lock()
+		s.conns[conn] = ""
+		s.lock.Unlock()
+		go s.recv(conn)
+	}
+}
+
+func (s *tcpServer) removeConn(conn net.Conn) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.conns[conn]; ok {
+		conn.Close()
+		delete(s.conns, conn)
+	}
+}
+
+func (s *tcpServer) recvChannel() chan *Message {
+	return s.fromWorkers
+}
+
+func (s *tcpServer) recv(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	for {
+		body, err := readFrame(reader)
+		if err != nil {
+			logDebug("Error reading, the worker may be disconnected: %v\n", err)
+			s.removeConn(conn)
+			return
+		}
+		decodedMsg, err := newMessageFromBytes(body)
+		if err != nil {
+			logError("Msgpack decode fail: %v\n", err)
+			continue
+		}
+		s.lock.Lock()
+		if _, ok := s.conns[conn]; ok {
+			s.conns[conn] = decodedMsg.NodeID
+		}
+		s.lock.Unlock()
+
+		select {
+		case s.fromWorkers <- decodedMsg:
+		case <-s.shutdownChan:
+			return
+		}
+	}
+}
+
+func (s *tcpServer) sendChannel() chan *Message {
+	return s.toWorkers
+}
+
+func (s *tcpServer) send() {
+	for {
+		select {
+		case <-s.shutdownChan:
+			return
+		case msg := <-s.toWorkers:
+			s.sendMessage(msg)
+		}
+	}
+}
+
+func (s *tcpServer) sendMessage(msg *Message) {
+	logDebug("Send a %s message to worker(%s)", msg.Type, msg.NodeID)
+	serializedMessage, err := msg.serialize()
+	if err != nil {
+		logError("Msgpack encode fail: %v\n", err)
+		return
+	}
+
+	// a worker which reconnects may have a stale connection too, which is removed once it fails
+	s.lock.Lock()
+	conns := make([]net.Conn, 0, 1)
+	for conn, nodeID := range s.conns {
+		if nodeID == msg.NodeID {
+			conns = append(conns, conn)
+		}
+	}
+	s.lock.Unlock()
+
+	if len(conns) == 0 {
+		logDebug("Worker(%s) isn't connected, the %s message is dropped", msg.NodeID, msg.Type)
+	}
+	for _, conn := range conns {
+		if err := writeFrame(conn, serializedMessage); err != nil {
+			logError("Error sending: %v\n", err)
+			s.removeConn(conn)
+		}
+	}
+}
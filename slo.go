@@ -0,0 +1,214 @@
+package boomer
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SLOMetric is the metric of the requests which an SLO limits.
+type SLOMetric string
+
+const (
+	// SLOAvgResponseTime is the average response time, in milliseconds.
+	SLOAvgResponseTime SLOMetric = "avg"
+	// SLOMaxResponseTime is the max response time, in milliseconds.
+	SLOMaxResponseTime SLOMetric = "max"
+	// SLOP50 is the median response time, in milliseconds.
+	SLOP50 SLOMetric = "p50"
+	// SLOP90 is the 90th percentile response time, in milliseconds.
+	SLOP90 SLOMetric = "p90"
+	// SLOP95 is the 95th percentile response time, in milliseconds.
+	SLOP95 SLOMetric = "p95"
+	// SLOP99 is the 99th percentile response time, in milliseconds.
+	SLOP99 SLOMetric = "p99"
+	// SLOFailRatio is the ratio of the failures to the requests, e.g. 0.01 for 1%.
+	SLOFailRatio SLOMetric = "fail_ratio"
+)
+
+// SLO is a service level objective, the Metric of the requests named Name must stay below Threshold.
+// Unlike Checks, which judge the whole test when it's stopped, SLOs are evaluated every report interval,
+// e.g. SLO{Name: "GET /checkout", Metric: SLOP99, Threshold: 300} is p99 < 300ms for "GET /checkout".
+type SLO struct {
+	// Name is the request name, empty for all the requests.
+	Name string
+	// Metric is what the SLO limits.
+	Metric SLOMetric
+	// Threshold is the exclusive upper limit of the metric, in milliseconds for the response times.
+	Threshold float64
+	// MinRequests is the minimum number of requests of an interval to be evaluated, the intervals with fewer
+	// requests are skipped. Defaults to 1.
+	MinRequests int64
+}
+
+func (s SLO) valid() bool {
+	switch s.Metric {
+	case SLOAvgResponseTime, SLOMaxResponseTime, SLOP50, SLOP90, SLOP95, SLOP99, SLOFailRatio:
+	default:
+		return false
+	}
+	return s.Threshold > 0 && s.MinRequests >= 0
+}
+
+// String returns the SLO like `p99 < 300 for name="GET /checkout"`.
+func (s SLO) String() string {
+	target := "all requests"
+	if s.Name != "" {
+		target = "name=" + strconv.Quote(s.Name)
+	}
+	return fmt.Sprintf("%s < %s for %s", s.Metric, strconv.FormatFloat(s.Threshold, 'f', -1, 64), target)
+}
+
+// value returns the metric of entry, which is summarized.
+func (s SLO) value(entry *finalReportEntry) float64 {
+	switch s.Metric {
+	case SLOAvgResponseTime:
+		return entry.AvgResponseTime
+	case SLOMaxResponseTime:
+		return float64(entry.MaxResponseTime)
+	case SLOP50:
+		return float64(entry.P50)
+	case SLOP90:
+		return float64(entry.P90)
+	case SLOP95:
+		return float64(entry.P95)
+	case SLOP99:
+		return float64(entry.P99)
+	default:
+		return float64(entry.NumFailures) / float64(entry.NumRequests)
+	}
+}
+
+// SLOStatus is the pass/fail status of an SLO since the test starts.
+type SLOStatus struct {
+	SLO SLO
+	// Value is the metric of the last evaluated interval.
+	Value float64
+	// Passed is whether the last evaluated interval meets the SLO, it's true before any interval is evaluated.
+	Passed bool
+	// Intervals is the number of the evaluated intervals, and Violations is how many of them violate the SLO.
+	Intervals  int64
+	Violations int64
+}
+
+// sloTracker evaluates the SLOs against the stats of every interval, before the outputs receive them.
+type sloTracker struct {
+	publisher eventPublisher
+
+	lock     sync.Mutex
+	statuses []SLOStatus
+}
+
+func newSLOTracker(slos []SLO, publisher eventPublisher) *sloTracker {
+	t := &sloTracker{
+		publisher: publisher,
+	}
+	for _, slo := range slos {
+		t.statuses = append(t.statuses, SLOStatus{SLO: slo, Passed: true})
+	}
+	return t
+}
+
+// reset starts over the statuses, so every test is tracked by itself.
+func (t *sloTracker) reset() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for i := range t.statuses {
+		t.statuses[i] = SLOStatus{SLO: t.statuses[i].SLO, Passed: true}
+	}
+}
+
+// evaluate evaluates the SLOs against the interval's stats, which are skipped in the warm-up period,
+// publishes the violations, and adds the statuses to data as "slos".
+func (t *sloTracker) evaluate(data map[string]interface{}) {
+	if warmup, _ := data["warmup"].(bool); !warmup {
+		entries := make(map[string]*finalReportEntry)
+		stats, _ := data["stats"].([]interface{})
+		for _, stat := range stats {
+			s, ok := stat.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name := toString(s["name"])
+			entry, ok := entries[name]
+			if !ok {
+				entry = newFinalReportEntry("", name)
+				entries[name] = entry
+			}
+			entry.merge(s)
+		}
+		if total, ok := data["stats_total"].(map[string]interface{}); ok {
+			entry := newFinalReportEntry("", "")
+			entry.merge(total)
+			entries[""] = entry
+		}
+		for _, entry := range entries {
+			entry.summarize(time.Second)
+		}
+		t.judge(entries)
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	slos := make([]interface{}, 0, len(t.statuses))
+	for _, status := range t.statuses {
+		slos = append(slos, map[string]interface{}{
+			"slo":          status.SLO.String(),
+			"name":         status.SLO.Name,
+			"metric":       string(status.SLO.Metric),
+			"threshold":    status.SLO.Threshold,
+			"min_requests": status.SLO.MinRequests,
+			"value":        status.Value,
+			"passed":       status.Passed,
+			"intervals":    status.Intervals,
+			"violations":   status.Violations,
+		})
+	}
+	data["slos"] = slos
+}
+
+func (t *sloTracker) judge(entries map[string]*finalReportEntry) {
+	type violation struct {
+		slo   SLO
+		value float64
+	}
+	var violations []violation
+
+	t.lock.Lock()
+	for i := range t.statuses {
+		status := &t.statuses[i]
+		minRequests := status.SLO.MinRequests
+		if minRequests <= 0 {
+			minRequests = 1
+		}
+		entry, ok := entries[status.SLO.Name]
+		if !ok || entry.NumRequests < minRequests {
+			continue
+		}
+		status.Value = status.SLO.value(entry)
+		status.Passed = status.Value < status.SLO.Threshold
+		status.Intervals++
+		if !status.Passed {
+			status.Violations++
+			violations = append(violations, violation{slo: status.SLO, value: status.Value})
+		}
+	}
+	t.lock.Unlock()
+
+	for _, v := range violations {
+		logError("SLO %s is violated, the value is %s", v.slo, strconv.FormatFloat(v.value, 'f', -1, 64))
+		t.publisher.publishSLOViolation(v.slo, v.value)
+	}
+}
+
+// snapshot returns a copy of the statuses.
+func (t *sloTracker) snapshot() []SLOStatus {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	statuses := make([]SLOStatus, len(t.statuses))
+	copy(statuses, t.statuses)
+	return statuses
+}
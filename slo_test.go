@@ -0,0 +1,87 @@
+package boomer
+
+import (
+	"testing"
+)
+
+func TestSLOString(t *testing.T) {
+	slo := SLO{Name: "GET /checkout", Metric: SLOP99, Threshold: 300}
+	if slo.String() != `p99 < 300 for name="GET /checkout"` {
+		t.Error("Unexpected string of the SLO, got", slo.String())
+	}
+	slo = SLO{Metric: SLOFailRatio, Threshold: 0.01}
+	if slo.String() != "fail_ratio < 0.01 for all requests" {
+		t.Error("Unexpected string of the SLO, got", slo.String())
+	}
+}
+
+func TestSLOValid(t *testing.T) {
+	if !(SLO{Metric: SLOAvgResponseTime, Threshold: 100}).valid() {
+		t.Error("The SLO should be valid")
+	}
+	for _, slo := range []SLO{
+		{Metric: "p42", Threshold: 100},
+		{Metric: SLOP95},
+		{Metric: SLOP95, Threshold: 100, MinRequests: -1},
+	} {
+		if slo.valid() {
+			t.Error("The SLO should be invalid", slo)
+		}
+	}
+}
+
+func TestSLOTracker(t *testing.T) {
+	hooks := &Hooks{}
+	violated := make([]SLO, 0)
+	hooks.OnSLOViolation(func(slo SLO, value float64) {
+		if value != 0.5 {
+			t.Error("Unexpected value of the violation", value)
+		}
+		violated = append(violated, slo)
+	})
+	tracker := newSLOTracker([]SLO{
+		{Name: "foo", Metric: SLOMaxResponseTime, Threshold: 100},
+		{Metric: SLOFailRatio, Threshold: 0.4},
+		{Name: "bar", Metric: SLOP50, Threshold: 100, MinRequests: 10},
+	}, eventPublisher{hooks: hooks})
+
+	collector := NewStatsCollector()
+	collector.RecordSuccess("http", "foo", 50, 10)
+	collector.RecordFailure("http", "foo", 80, "500 error")
+	collector.RecordSuccess("tcp", "foo", 20, 10)
+	collector.RecordFailure("http", "bar", 200, "500 error")
+	data := collector.Report()
+	tracker.evaluate(data)
+
+	statuses := tracker.snapshot()
+	if !statuses[0].Passed || statuses[0].Value != 80 || statuses[0].Intervals != 1 {
+		t.Error("The requests of foo should pass, got", statuses[0])
+	}
+	if statuses[1].Passed || statuses[1].Value != 0.5 || statuses[1].Violations != 1 {
+		t.Error("The fail ratio of all the requests should violate the SLO, got", statuses[1])
+	}
+	if !statuses[2].Passed || statuses[2].Intervals != 0 {
+		t.Error("The interval with too few requests of bar shouldn't be evaluated, got", statuses[2])
+	}
+	if len(violated) != 1 || violated[0].Metric != SLOFailRatio {
+		t.Error("The violation should be published once, got", violated)
+	}
+
+	stats := ParseIntervalStats(data)
+	if len(stats.SLOs) != 3 || stats.SLOs[1].Passed || stats.SLOs[1].SLO.Threshold != 0.4 || stats.SLOs[1].Violations != 1 {
+		t.Error("The statuses of the SLOs should be added to the data, got", stats.SLOs)
+	}
+
+	collector.RecordFailure("http", "foo", 10, "500 error")
+	data = collector.Report()
+	data["warmup"] = true
+	tracker.evaluate(data)
+	if status := tracker.snapshot()[1]; status.Intervals != 1 {
+		t.Error("The intervals in the warm-up period shouldn't be evaluated, got", status)
+	}
+
+	tracker.reset()
+	if status := tracker.snapshot()[1]; !status.Passed || status.Intervals != 0 || status.Violations != 0 {
+		t.Error("The statuses should be reset, got", status)
+	}
+}
@@ -0,0 +1,91 @@
+package boomer
+
+import (
+	"sync"
+	"time"
+)
+
+// Snapshot is the aggregates of the test so far, see Boomer.Stats.
+type Snapshot struct {
+	// StartTime is when the test starts, after the warm-up period, the zero time if it's not started.
+	StartTime time.Time
+	// Time is when the last interval is received, the snapshot is updated every report interval.
+	Time time.Time
+	// UserCount is the number of running goroutines in the last interval.
+	UserCount int64
+	// Stats are sorted by name and method.
+	Stats []*RequestSummary
+	Total *RequestSummary
+	// Errors are sorted by the occurrences, the most frequent first.
+	Errors []*RequestError
+}
+
+// snapshotOutput accumulates the stats of every interval for Boomer.Stats, its zero value is ready to use.
+type snapshotOutput struct {
+	lock      sync.Mutex
+	stats     *lifetimeStats
+	lastTime  time.Time
+	userCount int64
+}
+
+// OnStart starts over the aggregates.
+func (o *snapshotOutput) OnStart() {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.stats = newLifetimeStats()
+	o.lastTime = time.Time{}
+	o.userCount = 0
+}
+
+// OnEvent adds the interval's stats to the aggregates.
+func (o *snapshotOutput) OnEvent(data map[string]interface{}) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.stats == nil {
+		o.stats = newLifetimeStats()
+	}
+	o.stats.add(data)
+	o.lastTime = time.Now()
+	o.userCount = toInt64(data["user_count"])
+}
+
+// OnStop keeps the aggregates, so they can be read after the test is stopped.
+func (o *snapshotOutput) OnStop() {}
+
+// snapshot returns a copy of the aggregates, which isn't changed by the later intervals.
+func (o *snapshotOutput) snapshot() Snapshot {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	snapshot := Snapshot{
+		Stats:  []*RequestSummary{},
+		Errors: []*RequestError{},
+	}
+	if o.stats == nil {
+		snapshot.Total = newRequestSummary(newFinalReportEntry("", "Total"))
+		return snapshot
+	}
+	snapshot.StartTime = o.stats.startTime
+	snapshot.Time = o.lastTime
+	snapshot.UserCount = o.userCount
+
+	endTime := o.lastTime
+	if endTime.IsZero() {
+		endTime = time.Now()
+	}
+	for _, entry := range o.stats.summarize(endTime) {
+		snapshot.Stats = append(snapshot.Stats, newRequestSummary(entry))
+	}
+	snapshot.Total = newRequestSummary(o.stats.total)
+	for _, e := range o.stats.sortedErrors() {
+		snapshot.Errors = append(snapshot.Errors, &RequestError{
+			Method:      e.Method,
+			Name:        e.Name,
+			Error:       e.Error,
+			Occurrences: e.Occurrences,
+			Category:    e.Category,
+			Stack:       e.Stack,
+		})
+	}
+	return snapshot
+}
@@ -0,0 +1,81 @@
+package boomer
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestStatsBeforeRun(t *testing.T) {
+	b := NewStandaloneBoomer(10, 10)
+	snapshot := b.Stats()
+	if !snapshot.StartTime.IsZero() || len(snapshot.Stats) != 0 || snapshot.Total == nil || snapshot.Total.NumRequests != 0 {
+		t.Error("The snapshot should be empty before the test starts, got", snapshot)
+	}
+}
+
+func TestSnapshotOutput(t *testing.T) {
+	o := &snapshotOutput{}
+	o.OnStart()
+
+	collector := NewStatsCollector()
+	collector.RecordSuccess("http", "foo", 10, 100)
+	collector.RecordSuccess("http", "bar", 20, 100)
+	o.OnEvent(collector.Report())
+	collector.RecordFailure("http", "foo", 30, "500 error")
+	collector.RecordFailure("http", "foo", 30, "500 error")
+	o.OnEvent(collector.Report())
+
+	snapshot := o.snapshot()
+	if len(snapshot.Stats) != 2 || snapshot.Stats[0].Name != "bar" || snapshot.Stats[1].Name != "foo" {
+		t.Fatal("The stats should be sorted by name, got", snapshot.Stats)
+	}
+	if foo := snapshot.Stats[1]; foo.NumRequests != 3 || foo.NumFailures != 2 || foo.MaxResponseTime != 30 {
+		t.Error("The intervals should be accumulated, got", *foo)
+	}
+	if snapshot.Total.NumRequests != 4 || snapshot.Total.P50 == 0 {
+		t.Error("The total should be accumulated with the percentiles, got", *snapshot.Total)
+	}
+	if len(snapshot.Errors) != 1 || snapshot.Errors[0].Occurrences != 2 {
+		t.Error("The errors should be accumulated, got", snapshot.Errors)
+	}
+	if snapshot.Time.IsZero() || snapshot.Time.Before(snapshot.StartTime) {
+		t.Error("The time of the last interval should be set, got", snapshot.Time)
+	}
+
+	collector.RecordSuccess("http", "foo", 10, 100)
+	o.OnEvent(collector.Report())
+	if snapshot.Stats[1].NumRequests != 3 {
+		t.Error("The snapshot shouldn't be changed by the later intervals")
+	}
+
+	o.OnStop()
+	if o.snapshot().Total.NumRequests != 5 {
+		t.Error("The snapshot should be kept after the test is stopped")
+	}
+	o.OnStart()
+	if o.snapshot().Total.NumRequests != 0 {
+		t.Error("The snapshot should be started over with the next test")
+	}
+}
+
+func TestSnapshotOutputConcurrently(t *testing.T) {
+	o := &snapshotOutput{}
+	collector := NewStatsCollector()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			o.snapshot()
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		collector.RecordSuccess("http", "foo", 10, 100)
+		o.OnEvent(collector.Report())
+	}
+	wg.Wait()
+	if o.snapshot().Total.NumRequests != 100 {
+		t.Error("All the intervals should be accumulated, got", o.snapshot().Total.NumRequests)
+	}
+}
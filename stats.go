@@ -1,14 +1,34 @@
 package boomer
 
 import (
+	"math/rand"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+const (
+	// recordBufferSize is the max records buffered by a shard between two flushes, a record is dropped if its shard
+	// is full, instead of blocking the task until the stats goroutine catches up.
+	recordBufferSize = 10000
+	// recordShardsPerCPU is the number of the shards per CPU, so the recording goroutines rarely contend for a shard.
+	recordShardsPerCPU = 4
+	// recordFlushInterval is how often the stats goroutine flushes the records of the shards.
+	recordFlushInterval = 10 * time.Millisecond
+)
+
 type requestSuccess struct {
 	requestType    string
 	name           string
 	responseTime   int64
 	responseLength int64
+	// when the request is recorded, in milliseconds
+	timestamp int64
+	labels    map[string]string
 }
 
 type requestFailure struct {
@@ -16,6 +36,106 @@ type requestFailure struct {
 	name         string
 	responseTime int64
 	error        string
+	// category is only classified by RecordError, empty for the other failures
+	category ErrorCategory
+	// stack is the stack trace of a recovered panic, empty for the other failures
+	stack string
+	// when the request is recorded, in milliseconds
+	timestamp int64
+	labels    map[string]string
+}
+
+// recordShard buffers the records of some of the recording goroutines, see recordBuffer.
+type recordShard struct {
+	lock      sync.Mutex
+	successes []requestSuccess
+	failures  []requestFailure
+
+	// the buffers of the last flush, they are reused by the next flush, only accessed by the flushing goroutine.
+	spareSuccesses []requestSuccess
+	spareFailures  []requestFailure
+
+	// pads the shard to its own cache lines, so the shards locked by different CPUs don't false-share.
+	_ [64]byte
+}
+
+// recordBuffer spreads the records of the requests over several shards, instead of funneling all of them through
+// a channel, which caps the records per second of a worker. A recording goroutine only locks a shard to append the
+// record by value, and the stats goroutine swaps the buffers of the shards to flush them.
+type recordBuffer struct {
+	shards []*recordShard
+	// next picks the shard of the next record in turn, it's updated atomically.
+	next uint32
+	// capacity is the max records of a shard between two flushes.
+	capacity int
+}
+
+func newRecordBuffer(shards int, capacity int) *recordBuffer {
+	if shards < 1 {
+		shards = 1
+	}
+	b := &recordBuffer{
+		shards:   make([]*recordShard, shards),
+		capacity: capacity,
+	}
+	for i := range b.shards {
+		b.shards[i] = &recordShard{}
+	}
+	return b
+}
+
+func (b *recordBuffer) shard() *recordShard {
+	return b.shards[atomic.AddUint32(&b.next, 1)%uint32(len(b.shards))]
+}
+
+// addSuccess returns false if the shard is full.
+func (b *recordBuffer) addSuccess(m requestSuccess) bool {
+	shard := b.shard()
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+	if len(shard.successes)+len(shard.failures) >= b.capacity {
+		return false
+	}
+	shard.successes = append(shard.successes, m)
+	return true
+}
+
+// addFailure returns false if the shard is full.
+func (b *recordBuffer) addFailure(n requestFailure) bool {
+	shard := b.shard()
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+	if len(shard.successes)+len(shard.failures) >= b.capacity {
+		return false
+	}
+	shard.failures = append(shard.failures, n)
+	return true
+}
+
+// flush calls onSuccess and onFailure with the buffered records, shard by shard, it must not be called concurrently.
+func (b *recordBuffer) flush(onSuccess func(m *requestSuccess), onFailure func(n *requestFailure)) {
+	for _, shard := range b.shards {
+		shard.lock.Lock()
+		successes, failures := shard.successes, shard.failures
+		shard.successes, shard.failures = shard.spareSuccesses[:0], shard.spareFailures[:0]
+		shard.lock.Unlock()
+
+		for i := range successes {
+			onSuccess(&successes[i])
+			successes[i] = requestSuccess{}
+		}
+		for i := range failures {
+			onFailure(&failures[i])
+			failures[i] = requestFailure{}
+		}
+		shard.spareSuccesses, shard.spareFailures = successes, failures
+	}
+}
+
+type errorKey struct {
+	method string
+	name   string
+	error  string
 }
 
 type requestStats struct {
@@ -24,11 +144,53 @@ type requestStats struct {
 	total     *statsEntry
 	startTime int64
 
-	requestSuccessChan  chan *requestSuccess
-	requestFailureChan  chan *requestFailure
+	// errorKeys caches the keys of errors, so an error isn't hashed every time it occurs.
+	errorKeys map[errorKey]string
+
+	// labeledEntries break the entries down by the labels of the requests, they are only delivered to
+	// the outputs, and dropped every interval to keep the memory bounded.
+	labeledEntries map[string]*statsEntry
+
+	// responseTimeSampleSize is the max number of raw response times kept per request name
+	// in each interval, 0 means no raw response times are kept.
+	responseTimeSampleSize int
+
+	aggregationMode AggregationMode
+
+	// errorExemplars is the max number of raw errors kept for each normalized error in each interval,
+	// 0 means the errors aren't normalized, unless there is an errorNormalizer.
+	errorExemplars int
+	// errorNormalizer replaces normalizeError if it's not nil.
+	errorNormalizer ErrorNormalizer
+
+	// records buffers the successes and failures until the stats goroutine flushes them.
+	records *recordBuffer
+
 	clearStatsChan      chan bool
 	messageToRunnerChan chan map[string]interface{}
 	shutdownChan        chan bool
+	closeOnce           sync.Once
+
+	rawSampleOutputs []RawSampleOutput
+
+	// reportInterval is how often the stats are collected and reported.
+	reportInterval time.Duration
+
+	// recentResults is updated by the goroutines that record the results, not by the stats goroutine.
+	recentResults failureRatioWindow
+
+	// droppedRecords counts the records dropped because the buffer is full, it's updated atomically.
+	// reportedDroppedRecords is only accessed by the stats goroutine.
+	droppedRecords         int64
+	reportedDroppedRecords int64
+
+	// numRetries counts the retried attempts of WithRetry in the current interval, it's updated atomically.
+	numRetries int64
+
+	// warmupChan starts a warm-up period of the duration, the intervals in it are reported with "warmup" true.
+	// warmup is only accessed by the stats goroutine.
+	warmupChan chan time.Duration
+	warmup     bool
 }
 
 func newRequestStats() (stats *requestStats) {
@@ -36,14 +198,17 @@ func newRequestStats() (stats *requestStats) {
 	errors := make(map[string]*statsError)
 
 	stats = &requestStats{
-		entries: entries,
-		errors:  errors,
+		entries:        entries,
+		errors:         errors,
+		errorKeys:      make(map[errorKey]string),
+		labeledEntries: make(map[string]*statsEntry),
 	}
-	stats.requestSuccessChan = make(chan *requestSuccess, 100)
-	stats.requestFailureChan = make(chan *requestFailure, 100)
+	stats.records = newRecordBuffer(runtime.GOMAXPROCS(0)*recordShardsPerCPU, recordBufferSize)
 	stats.clearStatsChan = make(chan bool)
 	stats.messageToRunnerChan = make(chan map[string]interface{}, 10)
 	stats.shutdownChan = make(chan bool)
+	stats.warmupChan = make(chan time.Duration)
+	stats.reportInterval = slaveReportInterval
 
 	stats.total = &statsEntry{
 		name:   "Total",
@@ -55,26 +220,129 @@ func newRequestStats() (stats *requestStats) {
 }
 
 func (s *requestStats) logRequest(method, name string, responseTime int64, contentLength int64) {
+	name = s.aggregatedName(method, name)
 	s.total.log(responseTime, contentLength)
 	s.get(name, method).log(responseTime, contentLength)
 }
 
 func (s *requestStats) logError(method, name, err string) {
+	s.logErrorAt(method, name, err, "", "", Now())
+}
+
+// logErrorAt logs an error of the category, which occurs at timestamp, in milliseconds.
+// stack is the stack trace of a panic, the first one of the interval is kept for each error.
+func (s *requestStats) logErrorAt(method, name, err string, category ErrorCategory, stack string, timestamp int64) {
+	name = s.aggregatedName(method, name)
 	s.total.logError(err)
 	s.get(name, method).logError(err)
 
-	// store error in errors map
-	key := MD5(method, name, err)
+	grouped := err
+	if s.errorNormalizer != nil {
+		grouped = s.errorNormalizer(err)
+	} else if s.errorExemplars > 0 {
+		grouped = normalizeError(err)
+	}
+
+	// store error in errors map, the key is hashed once per interval
+	k := errorKey{method: method, name: name, error: grouped}
+	key, ok := s.errorKeys[k]
+	if !ok {
+		key = MD5(method, name, grouped)
+		s.errorKeys[k] = key
+	}
 	entry, ok := s.errors[key]
 	if !ok {
 		entry = &statsError{
-			name:   name,
-			method: method,
-			error:  err,
+			name:     name,
+			method:   method,
+			error:    grouped,
+			category: category,
 		}
 		s.errors[key] = entry
 	}
 	entry.occured()
+	if entry.stack == "" {
+		entry.stack = stack
+	}
+	if s.errorExemplars > 0 {
+		entry.sample(errorExemplar{error: err, timestamp: timestamp}, s.errorExemplars)
+	}
+}
+
+// setResponseTimeSampleSize must be called before the stats goroutine is started.
+func (s *requestStats) setResponseTimeSampleSize(size int) {
+	s.responseTimeSampleSize = size
+	s.total.sampleSize = size
+	s.total.reset()
+}
+
+// setReportInterval must be called before the stats goroutine is started.
+func (s *requestStats) setReportInterval(d time.Duration) {
+	s.reportInterval = d
+}
+
+// setErrorExemplars must be called before the stats goroutine is started.
+func (s *requestStats) setErrorExemplars(n int) {
+	s.errorExemplars = n
+}
+
+// setErrorNormalizer must be called before the stats goroutine is started.
+func (s *requestStats) setErrorNormalizer(normalizer ErrorNormalizer) {
+	s.errorNormalizer = normalizer
+}
+
+// setAggregationMode must be called before the stats goroutine is started.
+func (s *requestStats) setAggregationMode(mode AggregationMode) {
+	s.aggregationMode = mode
+}
+
+// aggregatedName returns the name of the stats entry, which the request is logged into.
+// In ByType mode, all the requests sharing a type are logged into the entry named after the type.
+func (s *requestStats) aggregatedName(method, name string) string {
+	if s.aggregationMode == ByType {
+		return method
+	}
+	return name
+}
+
+// logLabeled logs the request into the entry of its labels, err is empty for a success.
+func (s *requestStats) logLabeled(method, name string, labels map[string]string, responseTime int64, contentLength int64, err string) {
+	name = s.aggregatedName(method, name)
+	key := name + method + labelsKey(labels)
+	entry, ok := s.labeledEntries[key]
+	if !ok {
+		entry = &statsEntry{
+			name:          name,
+			method:        method,
+			labels:        labels,
+			numReqsPerSec: make(map[int64]int64),
+			responseTimes: make(map[int64]int64),
+			sampleSize:    s.responseTimeSampleSize,
+		}
+		entry.reset()
+		s.labeledEntries[key] = entry
+	}
+	entry.log(responseTime, contentLength)
+	if err != "" {
+		entry.logError(err)
+	}
+}
+
+// labelsKey returns the same key for the same labels, regardless of the order of the map.
+func labelsKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString("\x00")
+		b.WriteString(k)
+		b.WriteString("=")
+		b.WriteString(labels[k])
+	}
+	return b.String()
 }
 
 func (s *requestStats) get(name string, method string) (entry *statsEntry) {
@@ -85,6 +353,7 @@ func (s *requestStats) get(name string, method string) (entry *statsEntry) {
 			method:        method,
 			numReqsPerSec: make(map[int64]int64),
 			responseTimes: make(map[int64]int64),
+			sampleSize:    s.responseTimeSampleSize,
 		}
 		newEntry.reset()
 		s.entries[name+method] = newEntry
@@ -93,15 +362,55 @@ func (s *requestStats) get(name string, method string) (entry *statsEntry) {
 	return entry
 }
 
+// extend merges the report data of a worker, which may be decoded from msgpack.
+func (s *requestStats) extend(data map[string]interface{}) {
+	stats, _ := data["stats"].([]interface{})
+	for _, stat := range stats {
+		m := toStringMap(stat)
+		s.get(toString(m["name"]), toString(m["method"])).extend(m)
+	}
+	if total := toStringMap(data["stats_total"]); total != nil {
+		s.total.extend(total)
+	}
+
+	for key, e := range toStringMap(data["errors"]) {
+		m := toStringMap(e)
+		entry, ok := s.errors[key]
+		if !ok {
+			entry = &statsError{
+				name:     toString(m["name"]),
+				method:   toString(m["method"]),
+				error:    toString(m["error"]),
+				category: ErrorCategory(toString(m["category"])),
+			}
+			s.errors[key] = entry
+		}
+		entry.occurrences += toInt64(m["occurrences"])
+		if entry.stack == "" {
+			entry.stack = toString(m["stack"])
+		}
+		for _, exemplar := range toSlice(m["exemplars"]) {
+			e := toStringMap(exemplar)
+			entry.exemplars = append(entry.exemplars, errorExemplar{
+				error:     toString(e["error"]),
+				timestamp: toInt64(e["timestamp"]),
+			})
+		}
+	}
+}
+
 func (s *requestStats) clearAll() {
 	s.total = &statsEntry{
-		name:   "Total",
-		method: "",
+		name:       "Total",
+		method:     "",
+		sampleSize: s.responseTimeSampleSize,
 	}
 	s.total.reset()
 
 	s.entries = make(map[string]*statsEntry)
 	s.errors = make(map[string]*statsError)
+	s.errorKeys = make(map[errorKey]string)
+	s.labeledEntries = make(map[string]*statsEntry)
 	s.startTime = time.Now().Unix()
 }
 
@@ -115,6 +424,18 @@ func (s *requestStats) serializeStats() []interface{} {
 	return entries
 }
 
+// serializeLabeledStats serializes the labeled entries with their "labels", and drops them.
+func (s *requestStats) serializeLabeledStats() []interface{} {
+	entries := make([]interface{}, 0, len(s.labeledEntries))
+	for _, v := range s.labeledEntries {
+		report := v.serialize()
+		report["labels"] = v.labels
+		entries = append(entries, report)
+	}
+	s.labeledEntries = make(map[string]*statsEntry)
+	return entries
+}
+
 func (s *requestStats) serializeErrors() map[string]map[string]interface{} {
 	errors := make(map[string]map[string]interface{})
 	for k, v := range s.errors {
@@ -127,37 +448,146 @@ func (s *requestStats) collectReportData() map[string]interface{} {
 	data := make(map[string]interface{})
 	data["stats"] = s.serializeStats()
 	data["stats_total"] = s.total.getStrippedReport()
+	data["labeled_stats"] = s.serializeLabeledStats()
 	data["errors"] = s.serializeErrors()
+	data["num_retries"] = atomic.SwapInt64(&s.numRetries, 0)
+	data["num_dropped_records"] = s.collectDroppedRecords()
+	data["warmup"] = s.warmup
 	s.errors = make(map[string]*statsError)
+	s.errorKeys = make(map[errorKey]string)
 	return data
 }
 
+// recordSuccess hands m over to the stats goroutine without blocking, it's dropped and counted if its shard is full.
+func (s *requestStats) recordSuccess(m requestSuccess) {
+	if !s.records.addSuccess(m) {
+		atomic.AddInt64(&s.droppedRecords, 1)
+	}
+}
+
+// recordFailure is like recordSuccess.
+func (s *requestStats) recordFailure(n requestFailure) {
+	if !s.records.addFailure(n) {
+		atomic.AddInt64(&s.droppedRecords, 1)
+	}
+}
+
+// flushRecords logs the records buffered by the shards, it's called by the stats goroutine.
+func (s *requestStats) flushRecords() {
+	s.records.flush(s.onRequestSuccess, s.onRequestFailure)
+}
+
+// collectDroppedRecords returns the records dropped since the last interval, and warns of them.
+func (s *requestStats) collectDroppedRecords() int64 {
+	dropped := atomic.LoadInt64(&s.droppedRecords)
+	count := dropped - s.reportedDroppedRecords
+	if count > 0 {
+		logError("%d records are dropped in the last interval, the stats can't keep up with the requests, they are incomplete", count)
+	}
+	s.reportedDroppedRecords = dropped
+	return count
+}
+
+func (s *requestStats) onRequestSuccess(m *requestSuccess) {
+	s.logRequest(m.requestType, m.name, m.responseTime, m.responseLength)
+	if len(m.labels) > 0 {
+		s.logLabeled(m.requestType, m.name, m.labels, m.responseTime, m.responseLength, "")
+	}
+	if len(s.rawSampleOutputs) == 0 {
+		return
+	}
+	sample := &RawSample{
+		Timestamp:      m.timestamp - m.responseTime,
+		RequestType:    m.requestType,
+		Name:           m.name,
+		ResponseTime:   m.responseTime,
+		ResponseLength: m.responseLength,
+		Success:        true,
+		Labels:         m.labels,
+	}
+	for _, o := range s.rawSampleOutputs {
+		o.OnSample(sample)
+	}
+}
+
+func (s *requestStats) onRequestFailure(n *requestFailure) {
+	s.logRequest(n.requestType, n.name, n.responseTime, 0)
+	s.logErrorAt(n.requestType, n.name, n.error, n.category, n.stack, n.timestamp)
+	if len(n.labels) > 0 {
+		s.logLabeled(n.requestType, n.name, n.labels, n.responseTime, 0, n.error)
+	}
+	if len(s.rawSampleOutputs) == 0 {
+		return
+	}
+	sample := &RawSample{
+		Timestamp:     n.timestamp - n.responseTime,
+		RequestType:   n.requestType,
+		Name:          n.name,
+		ResponseTime:  n.responseTime,
+		Success:       false,
+		Error:         n.error,
+		ErrorCategory: n.category,
+		Labels:        n.labels,
+	}
+	for _, o := range s.rawSampleOutputs {
+		o.OnSample(sample)
+	}
+}
+
 func (s *requestStats) start() {
 	go func() {
-		var ticker = time.NewTicker(slaveReportInterval)
+		var ticker = time.NewTicker(s.reportInterval)
+		var flushTicker = time.NewTicker(recordFlushInterval)
+		defer flushTicker.Stop()
+		var warmupTimer <-chan time.Time
 		for {
 			select {
-			case m := <-s.requestSuccessChan:
-				s.logRequest(m.requestType, m.name, m.responseTime, m.responseLength)
-			case n := <-s.requestFailureChan:
-				s.logRequest(n.requestType, n.name, n.responseTime, 0)
-				s.logError(n.requestType, n.name, n.error)
+			case <-flushTicker.C:
+				s.flushRecords()
 			case <-s.clearStatsChan:
+				// the records of the last test are dropped
+				s.flushRecords()
 				s.clearAll()
+			case d := <-s.warmupChan:
+				s.warmup = true
+				warmupTimer = time.After(d)
+			case <-warmupTimer:
+				// report the rest of the warm-up period at once, so no interval mixes
+				// the warm-up with the measured period.
+				s.flushRecords()
+				data := s.collectReportData()
+				s.warmup = false
+				warmupTimer = nil
+				s.messageToRunnerChan <- data
 			case <-ticker.C:
+				s.flushRecords()
 				data := s.collectReportData()
 				// send data to channel, no network IO in this goroutine
 				s.messageToRunnerChan <- data
 			case <-s.shutdownChan:
+				// deliver the last interval's data, including the records which are
+				// still buffered, then tell the runner that no more data will come.
+				s.drain()
+				s.messageToRunnerChan <- s.collectReportData()
+				close(s.messageToRunnerChan)
 				return
 			}
 		}
 	}()
 }
 
-// close is used by unit tests to avoid leakage of goroutines
+// drain logs all the records buffered by the shards.
+func (s *requestStats) drain() {
+	s.flushRecords()
+}
+
+// close stops the stats goroutine. If it's started, the last interval's data is sent to
+// messageToRunnerChan, which is closed afterwards.
+// It's safe to call close more than once.
 func (s *requestStats) close() {
-	close(s.shutdownChan)
+	s.closeOnce.Do(func() {
+		close(s.shutdownChan)
+	})
 }
 
 type statsEntry struct {
@@ -172,8 +602,14 @@ type statsEntry struct {
 	numFailPerSec        map[int64]int64
 	responseTimes        map[int64]int64
 	totalContentLength   int64
+	minContentLength     int64
+	maxContentLength     int64
 	startTime            int64
 	lastRequestTimestamp int64
+	sampleSize           int
+	responseTimeSamples  *responseTimeReservoir
+	// labels of the labeled entries, nil for the others
+	labels map[string]string
 }
 
 func (s *statsEntry) reset() {
@@ -188,6 +624,13 @@ func (s *statsEntry) reset() {
 	s.numReqsPerSec = make(map[int64]int64)
 	s.numFailPerSec = make(map[int64]int64)
 	s.totalContentLength = 0
+	s.minContentLength = 0
+	s.maxContentLength = 0
+	if s.sampleSize > 0 {
+		s.responseTimeSamples = newResponseTimeReservoir(s.sampleSize)
+	} else {
+		s.responseTimeSamples = nil
+	}
 }
 
 func (s *statsEntry) log(responseTime int64, contentLength int64) {
@@ -196,7 +639,19 @@ func (s *statsEntry) log(responseTime int64, contentLength int64) {
 	s.logTimeOfRequest()
 	s.logResponseTime(responseTime)
 
+	s.logContentLength(contentLength)
+}
+
+func (s *statsEntry) logContentLength(contentLength int64) {
 	s.totalContentLength += contentLength
+
+	if s.numRequests == 1 || contentLength < s.minContentLength {
+		s.minContentLength = contentLength
+	}
+
+	if contentLength > s.maxContentLength {
+		s.maxContentLength = contentLength
+	}
 }
 
 func (s *statsEntry) logTimeOfRequest() {
@@ -248,6 +703,10 @@ func (s *statsEntry) logResponseTime(responseTime int64) {
 	} else {
 		s.responseTimes[roundedResponseTime]++
 	}
+
+	if s.responseTimeSamples != nil {
+		s.responseTimeSamples.add(responseTime)
+	}
 }
 
 func (s *statsEntry) logError(err string) {
@@ -261,6 +720,46 @@ func (s *statsEntry) logError(err string) {
 	}
 }
 
+// extend merges the serialized stats of a worker, which may be decoded from msgpack.
+func (s *statsEntry) extend(m map[string]interface{}) {
+	numRequests := toInt64(m["num_requests"])
+	if numRequests > 0 {
+		minResponseTime := toInt64(m["min_response_time"])
+		if s.numRequests == 0 || minResponseTime < s.minResponseTime {
+			s.minResponseTime = minResponseTime
+		}
+		minContentLength := toInt64(m["min_content_length"])
+		if s.numRequests == 0 || minContentLength < s.minContentLength {
+			s.minContentLength = minContentLength
+		}
+	}
+	if maxResponseTime := toInt64(m["max_response_time"]); maxResponseTime > s.maxResponseTime {
+		s.maxResponseTime = maxResponseTime
+	}
+	if maxContentLength := toInt64(m["max_content_length"]); maxContentLength > s.maxContentLength {
+		s.maxContentLength = maxContentLength
+	}
+	if lastRequestTimestamp := toInt64(m["last_request_timestamp"]); lastRequestTimestamp > s.lastRequestTimestamp {
+		s.lastRequestTimestamp = lastRequestTimestamp
+	}
+	if startTime := toInt64(m["start_time"]); startTime > 0 && startTime < s.startTime {
+		s.startTime = startTime
+	}
+	s.numRequests += numRequests
+	s.numFailures += toInt64(m["num_failures"])
+	s.totalResponseTime += toInt64(m["total_response_time"])
+	s.totalContentLength += toInt64(m["total_content_length"])
+	for k, v := range toInt64Map(m["response_times"]) {
+		s.responseTimes[k] += v
+	}
+	for k, v := range toInt64Map(m["num_reqs_per_sec"]) {
+		s.numReqsPerSec[k] += v
+	}
+	for k, v := range toInt64Map(m["num_fail_per_sec"]) {
+		s.numFailPerSec[k] += v
+	}
+}
+
 func (s *statsEntry) serialize() map[string]interface{} {
 	result := make(map[string]interface{})
 	result["name"] = s.name
@@ -276,9 +775,28 @@ func (s *statsEntry) serialize() map[string]interface{} {
 	result["max_response_time"] = s.maxResponseTime
 	result["min_response_time"] = s.minResponseTime
 	result["total_content_length"] = s.totalContentLength
+	// locust only knows the total content length, the master ignores the others.
+	result["min_content_length"] = s.minContentLength
+	result["max_content_length"] = s.maxContentLength
 	result["response_times"] = s.responseTimes
 	result["num_reqs_per_sec"] = s.numReqsPerSec
 	result["num_fail_per_sec"] = s.numFailPerSec
+	result["response_time_percentiles"] = s.percentiles(reportedPercentiles...)
+	return result
+}
+
+// reportedPercentiles are the percentiles reported as "response_time_percentiles".
+var reportedPercentiles = []float64{0.5, 0.9, 0.95, 0.99}
+
+// percentiles are calculated from the samples if they are kept, or from the rounded response times.
+func (s *statsEntry) percentiles(percents ...float64) map[float64]int64 {
+	if s.responseTimeSamples != nil {
+		return s.responseTimeSamples.percentiles(percents...)
+	}
+	result := make(map[float64]int64, len(percents))
+	for _, p := range percents {
+		result[p] = getPercentileResponseTime(s.numRequests, s.responseTimes, p)
+	}
 	return result
 }
 
@@ -293,17 +811,185 @@ type statsError struct {
 	method      string
 	error       string
 	occurrences int64
+	category    ErrorCategory
+	// exemplars are the raw errors sampled from the occurrences of a normalized error.
+	exemplars []errorExemplar
+	// stack is the stack trace of the first occurrence, if the error is a recovered panic.
+	stack string
+}
+
+// errorExemplar is a raw error, and when it occurs, in milliseconds.
+type errorExemplar struct {
+	error     string
+	timestamp int64
 }
 
 func (err *statsError) occured() {
 	err.occurrences++
 }
 
+// sample keeps a uniform random sample of at most size exemplars, like responseTimeReservoir.
+// It must be called after the occurrence is counted.
+func (err *statsError) sample(exemplar errorExemplar, size int) {
+	if len(err.exemplars) < size {
+		err.exemplars = append(err.exemplars, exemplar)
+		return
+	}
+	if i := rand.Int63n(err.occurrences); i < int64(size) {
+		err.exemplars[i] = exemplar
+	}
+}
+
 func (err *statsError) toMap() map[string]interface{} {
 	m := make(map[string]interface{})
 	m["method"] = err.method
 	m["name"] = err.name
 	m["error"] = err.error
 	m["occurrences"] = err.occurrences
+	if err.category != "" {
+		m["category"] = string(err.category)
+	}
+	if err.stack != "" {
+		m["stack"] = err.stack
+	}
+	if len(err.exemplars) > 0 {
+		exemplars := make([]interface{}, 0, len(err.exemplars))
+		for _, e := range err.exemplars {
+			exemplars = append(exemplars, map[string]interface{}{
+				"error":     e.error,
+				"timestamp": e.timestamp,
+			})
+		}
+		m["exemplars"] = exemplars
+	}
 	return m
 }
+
+// ErrorNormalizer returns the error which err is grouped into, e.g. with the timestamps and the IDs stripped.
+type ErrorNormalizer func(err string) string
+
+// errorPatterns replace the dynamic parts of errors, like IDs, so the errors differing only in them are grouped.
+// The numbers are only replaced after a separator or if they are long, so status codes like "500 error" are kept.
+var errorPatterns = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`), "<uuid>"},
+	{regexp.MustCompile(`\b(0x)?[0-9a-fA-F]{16,}\b`), "<hex>"},
+	{regexp.MustCompile(`([/=#:_-])[0-9]+|[0-9]{4,}`), "${1}<n>"},
+}
+
+// normalizeError replaces the UUIDs, the long hex strings and the numbers in err with placeholders,
+// e.g. "GET /users/123: not found" becomes "GET /users/<n>: not found".
+func normalizeError(err string) string {
+	for _, p := range errorPatterns {
+		err = p.pattern.ReplaceAllString(err, p.replacement)
+	}
+	return err
+}
+
+// responseTimeReservoir keeps a uniform random sample of at most size response times,
+// using the reservoir sampling algorithm(Algorithm R).
+type responseTimeReservoir struct {
+	size    int
+	seen    int64
+	samples []int64
+}
+
+func newResponseTimeReservoir(size int) *responseTimeReservoir {
+	return &responseTimeReservoir{
+		size:    size,
+		samples: make([]int64, 0, size),
+	}
+}
+
+func (r *responseTimeReservoir) add(responseTime int64) {
+	r.seen++
+	if len(r.samples) < r.size {
+		r.samples = append(r.samples, responseTime)
+		return
+	}
+	// replace a random sample with a probability of size/seen
+	if i := rand.Int63n(r.seen); i < int64(r.size) {
+		r.samples[i] = responseTime
+	}
+}
+
+// percentiles returns the response time of each percent, using the nearest-rank method.
+func (r *responseTimeReservoir) percentiles(percents ...float64) map[float64]int64 {
+	result := make(map[float64]int64, len(percents))
+	if len(r.samples) == 0 {
+		for _, p := range percents {
+			result[p] = 0
+		}
+		return result
+	}
+
+	sorted := make([]int64, len(r.samples))
+	copy(sorted, r.samples)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	for _, p := range percents {
+		rank := int(p*float64(len(sorted))+0.5) - 1
+		if rank < 0 {
+			rank = 0
+		}
+		if rank >= len(sorted) {
+			rank = len(sorted) - 1
+		}
+		result[p] = sorted[rank]
+	}
+	return result
+}
+
+// failureRatioWindowSize is how many seconds of results are used to calculate the failure ratio.
+const failureRatioWindowSize = 10
+
+// failureRatioWindow counts successes and failures of the last few seconds, in per-second buckets.
+// It's lock-free to keep recording cheap, a few results may be lost when a bucket is recycled,
+// so the ratio is an approximation.
+type failureRatioWindow struct {
+	buckets [failureRatioWindowSize]failureRatioBucket
+}
+
+type failureRatioBucket struct {
+	second    int64
+	successes int64
+	failures  int64
+}
+
+func (w *failureRatioWindow) add(failed bool) {
+	now := time.Now().Unix()
+	bucket := &w.buckets[now%failureRatioWindowSize]
+	if second := atomic.LoadInt64(&bucket.second); second != now {
+		if atomic.CompareAndSwapInt64(&bucket.second, second, now) {
+			atomic.StoreInt64(&bucket.successes, 0)
+			atomic.StoreInt64(&bucket.failures, 0)
+		}
+	}
+	if failed {
+		atomic.AddInt64(&bucket.failures, 1)
+	} else {
+		atomic.AddInt64(&bucket.successes, 1)
+	}
+}
+
+// ratio returns failures / (successes + failures) of the last failureRatioWindowSize seconds,
+// or 0 if nothing is recorded.
+func (w *failureRatioWindow) ratio() float64 {
+	now := time.Now().Unix()
+	var successes, failures int64
+	for i := range w.buckets {
+		bucket := &w.buckets[i]
+		if now-atomic.LoadInt64(&bucket.second) >= failureRatioWindowSize {
+			continue
+		}
+		successes += atomic.LoadInt64(&bucket.successes)
+		failures += atomic.LoadInt64(&bucket.failures)
+	}
+	if successes+failures == 0 {
+		return 0
+	}
+	return float64(failures) / float64(successes+failures)
+}
@@ -1,10 +1,24 @@
 package boomer
 
 import (
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
+// takeRecords flushes the records buffered by s, which isn't started.
+func takeRecords(s *requestStats) (successes []requestSuccess, failures []requestFailure) {
+	s.records.flush(func(m *requestSuccess) {
+		successes = append(successes, *m)
+	}, func(n *requestFailure) {
+		failures = append(failures, *n)
+	})
+	return successes, failures
+}
+
 func TestLogRequest(t *testing.T) {
 	newStats := newRequestStats()
 	newStats.logRequest("http", "success", 2, 30)
@@ -28,6 +42,12 @@ func TestLogRequest(t *testing.T) {
 	if entry.totalContentLength != 130 {
 		t.Error("totalContentLength is wrong, expected: 130, got:", entry.totalContentLength)
 	}
+	if entry.minContentLength != 20 {
+		t.Error("minContentLength is wrong, expected: 20, got:", entry.minContentLength)
+	}
+	if entry.maxContentLength != 40 {
+		t.Error("maxContentLength is wrong, expected: 40, got:", entry.maxContentLength)
+	}
 
 	// check newStats.total
 	if newStats.total.numRequests != 4 {
@@ -79,6 +99,140 @@ func TestRoundedResponseTime(t *testing.T) {
 	}
 }
 
+func TestResponseTimeSampleSize(t *testing.T) {
+	newStats := newRequestStats()
+	newStats.setResponseTimeSampleSize(1000)
+	// response times are uniformly distributed in [1, 1000]
+	for i := 0; i < 1000000; i++ {
+		newStats.logRequest("http", "sampled", int64(i%1000)+1, 0)
+	}
+	entry := newStats.get("sampled", "http")
+
+	if len(entry.responseTimeSamples.samples) != 1000 {
+		t.Error("Samples should be bounded to 1000, got:", len(entry.responseTimeSamples.samples))
+	}
+	if len(newStats.total.responseTimeSamples.samples) != 1000 {
+		t.Error("Samples of total should be bounded to 1000, got:", len(newStats.total.responseTimeSamples.samples))
+	}
+	if entry.numRequests != 1000000 {
+		t.Error("numRequests is wrong, expected: 1000000, got:", entry.numRequests)
+	}
+
+	percentiles := entry.responseTimeSamples.percentiles(0.5, 0.9)
+	if percentiles[0.5] < 450 || percentiles[0.5] > 550 {
+		t.Error("50% percentile should be close to 500, got:", percentiles[0.5])
+	}
+	if percentiles[0.9] < 850 || percentiles[0.9] > 950 {
+		t.Error("90% percentile should be close to 900, got:", percentiles[0.9])
+	}
+
+	report := entry.serialize()
+	if _, ok := report["response_time_percentiles"]; !ok {
+		t.Error("Key response_time_percentiles not found")
+	}
+}
+
+func TestResponseTimeSamplesDisabled(t *testing.T) {
+	newStats := newRequestStats()
+	newStats.logRequest("http", "success", 2, 30)
+	entry := newStats.get("success", "http")
+
+	if entry.responseTimeSamples != nil {
+		t.Error("Samples should not be kept by default")
+	}
+}
+
+func TestResponseTimePercentiles(t *testing.T) {
+	newStats := newRequestStats()
+	for i := 1; i <= 100; i++ {
+		newStats.logRequest("http", "success", int64(i), 0)
+	}
+	entry := newStats.get("success", "http")
+
+	percentiles, ok := entry.serialize()["response_time_percentiles"].(map[float64]int64)
+	if !ok {
+		t.Fatal("Key response_time_percentiles not found")
+	}
+	expected := map[float64]int64{0.5: 50, 0.9: 90, 0.95: 95, 0.99: 99}
+	for p, v := range expected {
+		if percentiles[p] != v {
+			t.Errorf("%v percentile should be %d, got %d", p, v, percentiles[p])
+		}
+	}
+}
+
+func TestAggregationModeByType(t *testing.T) {
+	newStats := newRequestStats()
+	newStats.setAggregationMode(ByType)
+	newStats.logRequest("GET", "/users/1", 2, 30)
+	newStats.logRequest("GET", "/users/2", 3, 40)
+	newStats.logRequest("POST", "/users", 1, 20)
+	newStats.logError("GET", "/users/3", "timeout")
+	newStats.logError("GET", "/users/4", "timeout")
+
+	if len(newStats.entries) != 2 {
+		t.Error("Requests should be collapsed into 2 entries, got:", len(newStats.entries))
+	}
+	entry := newStats.get("GET", "GET")
+	if entry.numRequests != 2 {
+		t.Error("numRequests is wrong, expected: 2, got:", entry.numRequests)
+	}
+	if entry.numFailures != 2 {
+		t.Error("numFailures is wrong, expected: 2, got:", entry.numFailures)
+	}
+	if len(newStats.errors) != 1 {
+		t.Error("Errors should be collapsed into 1 entry, got:", len(newStats.errors))
+	}
+}
+
+type sampleCollector struct {
+	samples []RawSample
+}
+
+func (o *sampleCollector) OnStart() {}
+
+func (o *sampleCollector) OnSample(sample *RawSample) {
+	o.samples = append(o.samples, *sample)
+}
+
+func (o *sampleCollector) OnStop() {}
+
+func TestRawSampleOutput(t *testing.T) {
+	newStats := newRequestStats()
+	collector := &sampleCollector{}
+	newStats.rawSampleOutputs = []RawSampleOutput{collector}
+
+	newStats.onRequestSuccess(&requestSuccess{
+		requestType:    "http",
+		name:           "success",
+		responseTime:   2,
+		responseLength: 30,
+		timestamp:      1002,
+	})
+	newStats.onRequestFailure(&requestFailure{
+		requestType:  "http",
+		name:         "failure",
+		responseTime: 1,
+		error:        "500 error",
+		timestamp:    1003,
+	})
+
+	if len(collector.samples) != 2 {
+		t.Fatal("Expected 2 samples, got", len(collector.samples))
+	}
+	success := collector.samples[0]
+	if success.Timestamp != 1000 || !success.Success || success.Name != "success" || success.ResponseLength != 30 {
+		t.Error("Unexpected sample of success", success)
+	}
+	failure := collector.samples[1]
+	if failure.Timestamp != 1002 || failure.Success || failure.Error != "500 error" {
+		t.Error("Unexpected sample of failure", failure)
+	}
+	if newStats.total.numRequests != 2 {
+		t.Error("Samples should be aggregated too, expected: 2, got:", newStats.total.numRequests)
+	}
+}
+
 func TestLogError(t *testing.T) {
 	newStats := newRequestStats()
 	newStats.logError("http", "failure", "500 error")
@@ -118,11 +272,70 @@ func BenchmarkLogError(b *testing.B) {
 	newStats := newRequestStats()
 	for i := 0; i < b.N; i++ {
 		// LogError use md5 to calculate hash keys, it may slow down the only goroutine,
-		// which consumes both requestSuccessChannel and requestFailureChannel.
+		// which flushes the records of all the shards.
 		newStats.logError("http", "failure", "500 error")
 	}
 }
 
+func TestNormalizeError(t *testing.T) {
+	for err, expected := range map[string]string{
+		"500 error":                      "500 error",
+		"GET /users/123: not found":      "GET /users/<n>: not found",
+		"order 12345 is locked":          "order <n> is locked",
+		"id=42 timed out":                "id=<n> timed out",
+		"dial tcp 10.0.0.1:8080: failed": "dial tcp 10.0.0.1:<n>: failed",
+		"session 3f2b8c1e-9a4d-4e6f-8b2a-1c3d5e7f9a0b expired": "session <uuid> expired",
+		"trace 5f1e7a9c3b2d4e6f8a0b1c2d3e4f5a6b":               "trace <hex>",
+	} {
+		if normalized := normalizeError(err); normalized != expected {
+			t.Errorf("%q should be normalized to %q, got %q", err, expected, normalized)
+		}
+	}
+}
+
+func TestErrorExemplars(t *testing.T) {
+	newStats := newRequestStats()
+	newStats.setErrorExemplars(3)
+	for i := 0; i < 10; i++ {
+		newStats.logErrorAt("http", "failure", fmt.Sprintf("GET /orders/%d: 404", i), "", "", int64(i))
+	}
+	newStats.logErrorAt("http", "failure", "500 error", "", "", 100)
+
+	if len(newStats.errors) != 2 {
+		t.Fatal("The errors should be grouped by the normalized error, got", len(newStats.errors))
+	}
+	entry := newStats.errors[MD5("http", "failure", "GET /orders/<n>: 404")]
+	if entry == nil || entry.occurrences != 10 {
+		t.Fatal("The occurrences of the normalized error should be 10")
+	}
+	if len(entry.exemplars) != 3 {
+		t.Fatal("At most 3 exemplars should be kept, got", len(entry.exemplars))
+	}
+	for _, e := range entry.exemplars {
+		if e.error != fmt.Sprintf("GET /orders/%d: 404", e.timestamp) {
+			t.Error("The exemplar should be a raw error with its timestamp, got", e)
+		}
+	}
+
+	master := newRequestStats()
+	master.extend(newStats.collectReportData())
+	if exemplars := master.errors[MD5("http", "failure", "GET /orders/<n>: 404")].exemplars; len(exemplars) != 3 {
+		t.Error("The exemplars should be merged by the master, got", exemplars)
+	}
+}
+
+func TestErrorExemplarsDisabled(t *testing.T) {
+	newStats := newRequestStats()
+	newStats.logError("http", "failure", "GET /orders/1: 404")
+	newStats.logError("http", "failure", "GET /orders/2: 404")
+	if len(newStats.errors) != 2 {
+		t.Error("The errors shouldn't be normalized by default, got", len(newStats.errors))
+	}
+	if _, ok := newStats.serializeErrors()[MD5("http", "failure", "GET /orders/1: 404")]["exemplars"]; ok {
+		t.Error("There should be no exemplars by default")
+	}
+}
+
 func TestClearAll(t *testing.T) {
 	newStats := newRequestStats()
 	newStats.logRequest("http", "success", 1, 20)
@@ -170,6 +383,34 @@ func TestSerializeStats(t *testing.T) {
 	}
 }
 
+func TestExtendContentLength(t *testing.T) {
+	worker := newRequestStats()
+	worker.logRequest("http", "foo", 1, 0)
+	worker.logRequest("http", "foo", 1, 300)
+	another := newRequestStats()
+	another.logRequest("http", "foo", 1, 100)
+	another.logRequest("http", "foo", 1, 500)
+
+	master := newRequestStats()
+	master.extend(worker.collectReportData())
+	master.extend(another.collectReportData())
+	entry := master.get("foo", "http")
+	if entry.totalContentLength != 900 {
+		t.Error("totalContentLength is wrong, expected: 900, got:", entry.totalContentLength)
+	}
+	if entry.minContentLength != 0 {
+		t.Error("minContentLength is wrong, expected: 0, got:", entry.minContentLength)
+	}
+	if entry.maxContentLength != 500 {
+		t.Error("maxContentLength is wrong, expected: 500, got:", entry.maxContentLength)
+	}
+
+	serialized := entry.serialize()
+	if serialized["min_content_length"] != int64(0) || serialized["max_content_length"] != int64(500) {
+		t.Error("The min and max content length should be serialized, got:", serialized)
+	}
+}
+
 func TestSerializeErrors(t *testing.T) {
 	newStats := newRequestStats()
 	newStats.logError("http", "failure", "500 error")
@@ -213,24 +454,94 @@ func TestCollectReportData(t *testing.T) {
 	}
 }
 
+func TestRecordDropsWhenBufferIsFull(t *testing.T) {
+	newStats := newRequestStats()
+	newStats.records = newRecordBuffer(2, 5)
+	// the stats goroutine isn't started, so nothing flushes the records
+	for i := 0; i < 6; i++ {
+		newStats.recordSuccess(requestSuccess{requestType: "http", name: "success"})
+	}
+	for i := 0; i < 7; i++ {
+		newStats.recordFailure(requestFailure{requestType: "http", name: "failure"})
+	}
+
+	if dropped := atomic.LoadInt64(&newStats.droppedRecords); dropped != 3 {
+		t.Error("3 records should be dropped, got", dropped)
+	}
+	if dropped := newStats.collectReportData()["num_dropped_records"]; dropped != int64(3) {
+		t.Error("The dropped records should be reported, got", dropped)
+	}
+	if dropped := newStats.collectReportData()["num_dropped_records"]; dropped != int64(0) {
+		t.Error("The dropped records should be reported once, got", dropped)
+	}
+
+	successes, failures := takeRecords(newStats)
+	if len(successes) != 6 || len(failures) != 4 {
+		t.Error("The shards should be full, got", len(successes), len(failures))
+	}
+	newStats.recordFailure(requestFailure{requestType: "http", name: "failure"})
+	if _, failures := takeRecords(newStats); len(failures) != 1 {
+		t.Error("The shards should be emptied by the flush, got", len(failures))
+	}
+}
+
+func TestRecordBufferConcurrently(t *testing.T) {
+	buffer := newRecordBuffer(4, 1000)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				buffer.addSuccess(requestSuccess{name: "success"})
+				buffer.addFailure(requestFailure{name: "failure"})
+			}
+		}()
+	}
+	successes, failures := 0, 0
+	flush := func() {
+		buffer.flush(func(m *requestSuccess) {
+			successes++
+		}, func(n *requestFailure) {
+			failures++
+		})
+	}
+	flush()
+	wg.Wait()
+	flush()
+	if successes != 800 || failures != 800 {
+		t.Error("All the records should be flushed, got", successes, failures)
+	}
+}
+
+func BenchmarkRecordBuffer(b *testing.B) {
+	newStats := newRequestStats()
+	newStats.records.capacity = math.MaxInt32
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			newStats.recordSuccess(requestSuccess{requestType: "http", name: "success", responseTime: 10})
+		}
+	})
+}
+
 func TestStatsStart(t *testing.T) {
 	newStats := newRequestStats()
 	newStats.start()
 	defer newStats.close()
 
-	newStats.requestSuccessChan <- &requestSuccess{
+	newStats.recordSuccess(requestSuccess{
 		requestType:    "http",
 		name:           "success",
 		responseTime:   2,
 		responseLength: 30,
-	}
+	})
 
-	newStats.requestFailureChan <- &requestFailure{
+	newStats.recordFailure(requestFailure{
 		requestType:  "http",
 		name:         "failure",
 		responseTime: 1,
 		error:        "500 error",
-	}
+	})
 
 	var ticker = time.NewTicker(slaveReportInterval + 500*time.Millisecond)
 	for {
@@ -243,3 +554,122 @@ func TestStatsStart(t *testing.T) {
 	}
 end:
 }
+
+func TestFailureRatioWindow(t *testing.T) {
+	w := &failureRatioWindow{}
+	if w.ratio() != 0 {
+		t.Error("Expected: 0, got:", w.ratio())
+	}
+
+	w.add(false)
+	w.add(false)
+	w.add(false)
+	w.add(true)
+	if w.ratio() != 0.25 {
+		t.Error("Expected: 0.25, got:", w.ratio())
+	}
+
+	// results older than the window are ignored
+	now := time.Now().Unix()
+	stale := &w.buckets[(now+1)%failureRatioWindowSize]
+	stale.second = now + 1 - 2*failureRatioWindowSize
+	stale.failures = 100
+	if w.ratio() != 0.25 {
+		t.Error("Expected: 0.25, got:", w.ratio())
+	}
+}
+
+func TestStatsReportInterval(t *testing.T) {
+	newStats := newRequestStats()
+	newStats.setReportInterval(100 * time.Millisecond)
+	newStats.start()
+	defer newStats.close()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-newStats.messageToRunnerChan:
+		case <-time.After(time.Second):
+			t.Fatal("Timeout waiting for stats reports every 100ms")
+		}
+	}
+}
+
+func TestStatsWarmup(t *testing.T) {
+	newStats := newRequestStats()
+	newStats.setReportInterval(time.Hour)
+	newStats.start()
+	defer newStats.close()
+
+	newStats.warmupChan <- 50 * time.Millisecond
+	newStats.recordSuccess(requestSuccess{
+		requestType:    "http",
+		name:           "warmup",
+		responseTime:   1000,
+		responseLength: 10,
+	})
+
+	// the warm-up period is reported as soon as it ends
+	var data map[string]interface{}
+	select {
+	case data = <-newStats.messageToRunnerChan:
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for the stats of the warm-up period")
+	}
+	if warmup, _ := data["warmup"].(bool); !warmup {
+		t.Error("The stats of the warm-up period should be marked as warm-up")
+	}
+	if numRequests := data["stats_total"].(map[string]interface{})["num_requests"].(int64); numRequests != 1 {
+		t.Error("The requests of the warm-up period should be recorded, got", numRequests)
+	}
+
+	newStats.close()
+	data = <-newStats.messageToRunnerChan
+	if warmup, _ := data["warmup"].(bool); warmup {
+		t.Error("The stats after the warm-up period should not be marked as warm-up")
+	}
+}
+
+func TestLabeledStats(t *testing.T) {
+	newStats := newRequestStats()
+	collector := &sampleCollector{}
+	newStats.rawSampleOutputs = []RawSampleOutput{collector}
+
+	newStats.onRequestSuccess(&requestSuccess{requestType: "http", name: "foo", responseTime: 2, labels: map[string]string{"region": "us", "tenant": "a"}})
+	newStats.onRequestSuccess(&requestSuccess{requestType: "http", name: "foo", responseTime: 4, labels: map[string]string{"tenant": "a", "region": "us"}})
+	newStats.onRequestFailure(&requestFailure{requestType: "http", name: "foo", responseTime: 6, error: "500 error", labels: map[string]string{"region": "eu"}})
+	newStats.onRequestSuccess(&requestSuccess{requestType: "http", name: "foo", responseTime: 8})
+
+	if entry := newStats.get("foo", "http"); entry.numRequests != 4 {
+		t.Error("The labeled requests should be logged by name too, expected: 4, got:", entry.numRequests)
+	}
+	if collector.samples[0].Labels["region"] != "us" || collector.samples[3].Labels != nil {
+		t.Error("The raw samples should have the labels")
+	}
+
+	data := newStats.collectReportData()
+	labeled := data["labeled_stats"].([]interface{})
+	if len(labeled) != 2 {
+		t.Fatal("Expected 2 labeled entries, got", len(labeled))
+	}
+	for _, e := range labeled {
+		s := e.(map[string]interface{})
+		switch s["labels"].(map[string]string)["region"] {
+		case "us":
+			if s["num_requests"].(int64) != 2 || s["num_failures"].(int64) != 0 {
+				t.Error("Unexpected labeled entry", s)
+			}
+		case "eu":
+			if s["num_requests"].(int64) != 1 || s["num_failures"].(int64) != 1 {
+				t.Error("Unexpected labeled entry", s)
+			}
+		default:
+			t.Error("Unexpected labels", s["labels"])
+		}
+	}
+
+	// the labeled entries are dropped every interval
+	data = newStats.collectReportData()
+	if len(data["labeled_stats"].([]interface{})) != 0 {
+		t.Error("The labeled entries should be dropped after they are reported")
+	}
+}
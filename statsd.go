@@ -0,0 +1,214 @@
+package boomer
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// statsDMaxPacketSize keeps the packets in the MTU of most networks.
+	statsDMaxPacketSize = 1432
+	statsDFlushInterval = time.Second
+)
+
+// StatsDOutput emits a counter and a timing metric of every request to a StatsD or DogStatsD endpoint over UDP.
+// It's a RawSampleOutput, add it by Boomer.AddRawSampleOutput. The metrics are buffered and sent
+// in packets, at least every second.
+//
+// With StatsD, the metrics are named like "boomer.<method>.<name>.requests", "boomer.<method>.<name>.failures"
+// and "boomer.<method>.<name>.response_time". With DogStatsD, they are "boomer.requests", "boomer.failures" and
+// "boomer.response_time", tagged by method and name, and the extra tags added by AddTag.
+type StatsDOutput struct {
+	addr       string
+	prefix     string
+	dogStatsD  bool
+	tags       []string
+	sampleRate float64
+	rand       *rand.Rand
+
+	lock   sync.Mutex
+	conn   net.Conn
+	buf    bytes.Buffer
+	ticker *time.Ticker
+	done   chan bool
+}
+
+// NewStatsDOutput returns a StatsDOutput, which emits to a StatsD server on addr, like "localhost:8125".
+func NewStatsDOutput(addr string) *StatsDOutput {
+	return &StatsDOutput{
+		addr:       addr,
+		prefix:     "boomer.",
+		sampleRate: 1,
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// NewDogStatsDOutput returns a StatsDOutput, which emits to a DogStatsD agent on addr, like "localhost:8125", with tags.
+func NewDogStatsDOutput(addr string) *StatsDOutput {
+	o := NewStatsDOutput(addr)
+	o.dogStatsD = true
+	return o
+}
+
+// SetPrefix sets the prefix of the metric names, it's "boomer." by default. It must be called before the test is started.
+func (o *StatsDOutput) SetPrefix(prefix string) {
+	o.prefix = prefix
+}
+
+// AddTag adds a tag to all the metrics, like AddTag("env", "staging"), it's only sent to DogStatsD.
+// The tags "method" and "name" are reserved for the requests. It must be called before the test is started.
+func (o *StatsDOutput) AddTag(key, value string) {
+	if !o.dogStatsD {
+		logError("Tags are only supported by DogStatsD, ignored!")
+		return
+	}
+	o.tags = append(o.tags, dogStatsDTag(key, value))
+	sort.Strings(o.tags)
+}
+
+// SetSampleRate emits the metrics of a random part of the requests, in (0, 1], to reduce the traffic at high RPS.
+// The rate is sent with the metrics, so the counters are scaled up by the server. It must be called before the test is started.
+func (o *StatsDOutput) SetSampleRate(rate float64) {
+	if rate <= 0 || rate > 1 {
+		logError("Invalid sample rate, ignored!")
+		return
+	}
+	o.sampleRate = rate
+}
+
+// Init resolves the address, so boomer can fail fast if it's invalid. UDP doesn't tell if the server is listening.
+func (o *StatsDOutput) Init() error {
+	conn, err := net.Dial("udp", o.addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to StatsD %s, %v", o.addr, err)
+	}
+	o.conn = conn
+	return nil
+}
+
+// OnStart connects to the server if it's not done by Init, and starts flushing the buffer every second.
+func (o *StatsDOutput) OnStart() {
+	if o.conn == nil {
+		if err := o.Init(); err != nil {
+			logError("%v", err)
+			return
+		}
+	}
+	o.ticker = time.NewTicker(statsDFlushInterval)
+	o.done = make(chan bool)
+	go func(ticker *time.Ticker, done chan bool) {
+		for {
+			select {
+			case <-ticker.C:
+				o.lock.Lock()
+				o.flush()
+				o.lock.Unlock()
+			case <-done:
+				return
+			}
+		}
+	}(o.ticker, o.done)
+}
+
+// OnSample buffers the metrics of a sample.
+func (o *StatsDOutput) OnSample(sample *RawSample) {
+	if o.conn == nil {
+		return
+	}
+	if o.sampleRate < 1 && o.rand.Float64() >= o.sampleRate {
+		return
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.add(sample.RequestType, sample.Name, "requests", "1|c")
+	if !sample.Success {
+		o.add(sample.RequestType, sample.Name, "failures", "1|c")
+	}
+	o.add(sample.RequestType, sample.Name, "response_time", strconv.FormatInt(sample.ResponseTime, 10)+"|ms")
+}
+
+// OnStop flushes the buffer and closes the connection.
+func (o *StatsDOutput) OnStop() {
+	if o.conn == nil {
+		return
+	}
+	if o.ticker != nil {
+		o.ticker.Stop()
+		close(o.done)
+		o.ticker = nil
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.flush()
+	o.conn.Close()
+	o.conn = nil
+}
+
+// add buffers a metric, value is like "1|c", the buffer is flushed first if the metric doesn't fit in the packet.
+// Must be called with lock held.
+func (o *StatsDOutput) add(method, name, metric, value string) {
+	line := o.line(method, name, metric, value)
+	if o.buf.Len() > 0 && o.buf.Len()+1+len(line) > statsDMaxPacketSize {
+		o.flush()
+	}
+	if o.buf.Len() > 0 {
+		o.buf.WriteByte('\n')
+	}
+	o.buf.WriteString(line)
+}
+
+func (o *StatsDOutput) line(method, name, metric, value string) string {
+	var line strings.Builder
+	line.WriteString(o.prefix)
+	if !o.dogStatsD {
+		line.WriteString(statsDName(method) + "." + statsDName(name) + ".")
+	}
+	line.WriteString(metric + ":" + value)
+	if o.sampleRate < 1 {
+		line.WriteString("|@" + strconv.FormatFloat(o.sampleRate, 'f', -1, 64))
+	}
+	if o.dogStatsD {
+		line.WriteString("|#" + dogStatsDTag("method", method) + "," + dogStatsDTag("name", name))
+		for _, tag := range o.tags {
+			line.WriteString("," + tag)
+		}
+	}
+	return line.String()
+}
+
+// flush sends the buffer as a packet. Must be called with lock held.
+func (o *StatsDOutput) flush() {
+	if o.buf.Len() == 0 || o.conn == nil {
+		return
+	}
+	if _, err := o.conn.Write(o.buf.Bytes()); err != nil {
+		logDebug("Failed to send metrics to StatsD, %v", err)
+	}
+	o.buf.Reset()
+}
+
+var statsDNameReplacer = regexp.MustCompile(`[^a-zA-Z0-9_\-]+`)
+
+// statsDName replaces the characters, which aren't safe in the metric names, like "/" and ":", with "_".
+func statsDName(s string) string {
+	name := strings.Trim(statsDNameReplacer.ReplaceAllString(s, "_"), "_")
+	if name == "" {
+		return "_"
+	}
+	return name
+}
+
+var dogStatsDTagEscaper = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+
+func dogStatsDTag(key, value string) string {
+	return dogStatsDTagEscaper.Replace(key) + ":" + dogStatsDTagEscaper.Replace(value)
+}
@@ -0,0 +1,126 @@
+package boomer
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func listenStatsD(t *testing.T) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func readStatsDPacket(t *testing.T, conn net.PacketConn) []string {
+	buf := make([]byte, 65536)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(string(buf[:n]), "\n")
+}
+
+func TestStatsDOutput(t *testing.T) {
+	server := listenStatsD(t)
+	defer server.Close()
+
+	o := NewStatsDOutput(server.LocalAddr().String())
+	o.SetPrefix("loadtest.")
+	if err := o.Init(); err != nil {
+		t.Fatal(err)
+	}
+	o.OnStart()
+	o.OnSample(&RawSample{RequestType: "http", Name: "/users/:id", ResponseTime: 10, Success: true})
+	o.OnSample(&RawSample{RequestType: "http", Name: "/users/:id", ResponseTime: 30, Error: "500 error"})
+	o.OnStop()
+
+	lines := readStatsDPacket(t, server)
+	expected := []string{
+		"loadtest.http.users_id.requests:1|c",
+		"loadtest.http.users_id.response_time:10|ms",
+		"loadtest.http.users_id.requests:1|c",
+		"loadtest.http.users_id.failures:1|c",
+		"loadtest.http.users_id.response_time:30|ms",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Error("Unexpected metrics:", lines)
+	}
+}
+
+func TestDogStatsDOutput(t *testing.T) {
+	server := listenStatsD(t)
+	defer server.Close()
+
+	o := NewDogStatsDOutput(server.LocalAddr().String())
+	o.AddTag("env", "staging")
+	o.AddTag("host", "node,1")
+	if err := o.Init(); err != nil {
+		t.Fatal(err)
+	}
+	o.OnStart()
+	o.OnSample(&RawSample{RequestType: "http", Name: "foo", ResponseTime: 10, Success: true})
+	o.OnStop()
+
+	lines := readStatsDPacket(t, server)
+	if len(lines) != 2 {
+		t.Fatal("Expected the counter and the timing, got", lines)
+	}
+	if lines[0] != "boomer.requests:1|c|#method:http,name:foo,env:staging,host:node_1" {
+		t.Error("Unexpected counter:", lines[0])
+	}
+	if lines[1] != "boomer.response_time:10|ms|#method:http,name:foo,env:staging,host:node_1" {
+		t.Error("Unexpected timing:", lines[1])
+	}
+}
+
+func TestStatsDOutputSampleRate(t *testing.T) {
+	server := listenStatsD(t)
+	defer server.Close()
+
+	o := NewStatsDOutput(server.LocalAddr().String())
+	o.SetSampleRate(0)
+	o.SetSampleRate(0.5)
+	if o.sampleRate != 0.5 {
+		t.Fatal("The sample rate should be 0.5, got", o.sampleRate)
+	}
+	o.AddTag("env", "staging")
+	if len(o.tags) != 0 {
+		t.Error("Tags should be ignored by StatsD")
+	}
+	if err := o.Init(); err != nil {
+		t.Fatal(err)
+	}
+	o.OnStart()
+	for i := 0; i < 1000; i++ {
+		o.OnSample(&RawSample{RequestType: "http", Name: "foo", ResponseTime: 10, Success: true})
+	}
+	o.OnStop()
+
+	count := 0
+	for {
+		buf := make([]byte, 65536)
+		server.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		n, _, err := server.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			if len(line) > statsDMaxPacketSize {
+				t.Fatal("A packet is too large")
+			}
+			if line == "boomer.http.foo.requests:1|c|@0.5" {
+				count++
+			} else if line != "boomer.http.foo.response_time:10|ms|@0.5" {
+				t.Fatal("Unexpected metric:", line)
+			}
+		}
+	}
+	if count < 350 || count > 650 {
+		t.Error("About half of the requests should be emitted, got", count)
+	}
+}
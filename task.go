@@ -1,13 +1,142 @@
 package boomer
 
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
 // Task is like the "Locust object" in locust, the python version.
 // When boomer receives a start message from master, it will spawn several goroutines to run Task.Fn.
-// But users can keep some information in the python version, they can't do the same things in boomer.
-// Because Task.Fn is a pure function.
+// Users can keep some information in the python version, Task.FnWithUser does the same things in boomer,
+// with a User per goroutine.
 type Task struct {
-	// The weight is used to distribute goroutines over multiple tasks.
+	// The weight is used to distribute goroutines over multiple tasks, each goroutine runs a single task,
+	// and the number of goroutines running a task is in proportion to its weight.
 	Weight int
 	// Fn is called by the goroutines allocated to this task, in a loop.
-	Fn   func()
-	Name string
+	Fn func()
+	// FnWithContext is optional, it's called instead of Fn if it's set. The context is canceled once the goroutine
+	// is stopped, by a stop or quit message from the master, Boomer.Quit or a scale-down, so a long-running task body
+	// can abort instead of keeping hammering the target. See Boomer.SetDrainTimeout to cancel it after a grace period.
+	FnWithContext func(ctx context.Context)
+	// FnWithUser is optional, it's called instead of Fn and FnWithContext if it's set, with the User of the goroutine,
+	// which is kept across the calls until the goroutine is stopped. The context is the same as FnWithContext's,
+	// UserFromContext returns the same User.
+	FnWithUser func(ctx context.Context, user *User)
+	Name       string
+	// Timeout is optional, it limits how long an iteration runs. Once it's exceeded, the context passed to
+	// FnWithContext and FnWithUser is canceled, a failure of the "timeout" type, named after the task, is recorded,
+	// and the goroutine goes on with the next iteration, so a hung iteration doesn't tie up the goroutine.
+	// The abandoned iteration keeps running in the background until it returns.
+	Timeout time.Duration
+	// Tags is optional, the tasks can be selected by their tags with Boomer.SetTags and Boomer.SetExcludeTags,
+	// like @tag of locust, so the workers of a heterogeneous fleet can run different tasks.
+	Tags []string
+	// WaitTime is optional, it returns how long the goroutine sleeps after each call of Fn, aka think time.
+	// The sleep is interrupted when the goroutine is stopped, so a long think time doesn't delay a scale-down.
+	// Between and Constant return the common ones, like wait_time of locust.
+	WaitTime func() time.Duration
+	// RateLimiter is optional, it limits the calls of this task only, in addition to the rate limiter of Boomer,
+	// so different requests can be throttled independently, e.g. 1000 RPS reads and 50 RPS writes.
+	// It's started when the test starts and stopped when the test is stopped, so it shouldn't be the rate limiter
+	// of Boomer, but several tasks can share it to be limited together.
+	RateLimiter RateLimiter
+	// OnStart is optional, it's called once when the test starts, before any goroutine is spawned,
+	// like warming up a connection pool. A spawn message which rescales a running test doesn't call it again.
+	OnStart func()
+	// OnStop is optional, it's called once when the test is stopped, after the goroutines are stopped,
+	// like closing the connections.
+	OnStop func()
+}
+
+// run calls FnWithUser or FnWithContext if it's set, or Fn.
+func (t *Task) run(ctx context.Context) {
+	if t.FnWithUser != nil {
+		t.FnWithUser(ctx, UserFromContext(ctx))
+		return
+	}
+	if t.FnWithContext != nil {
+		t.FnWithContext(ctx)
+		return
+	}
+	t.Fn()
+}
+
+// hasAnyTag returns whether the task has any of tags.
+func (t *Task) hasAnyTag(tags []string) bool {
+	for _, tag := range tags {
+		for _, own := range t.Tags {
+			if own == tag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// filterTasks returns the tasks which have any of tags, or all the tasks if tags is empty, and none of excludeTags,
+// like --tags and --exclude-tags of locust.
+func filterTasks(tasks []*Task, tags, excludeTags []string) []*Task {
+	filtered := make([]*Task, 0, len(tasks))
+	for _, task := range tasks {
+		if (len(tags) == 0 || task.hasAnyTag(tags)) && !task.hasAnyTag(excludeTags) {
+			filtered = append(filtered, task)
+		}
+	}
+	return filtered
+}
+
+// Between returns a WaitTime, which is a random duration between min and max, like between of locust.
+func Between(min, max time.Duration) func() time.Duration {
+	if max < min {
+		min, max = max, min
+	}
+	return func() time.Duration {
+		return min + time.Duration(rand.Int63n(int64(max-min)+1))
+	}
+}
+
+// Constant returns a WaitTime, which is always d, like constant of locust.
+func Constant(d time.Duration) func() time.Duration {
+	return func() time.Duration {
+		return d
+	}
+}
+
+// Exponential returns a WaitTime, which is exponentially distributed with the mean, so the requests of a user
+// are a Poisson process, which is burstier than a constant wait time, like real traffic.
+func Exponential(mean time.Duration) func() time.Duration {
+	return func() time.Duration {
+		return time.Duration(rand.ExpFloat64() * float64(mean))
+	}
+}
+
+// InterArrival returns the time until the next arrival of the open model, see Boomer.SetArrivalRate,
+// mean is the interval of the arrival rate. The random number generator is seeded by Boomer.SetRandomSeed.
+type InterArrival func(random *rand.Rand, mean time.Duration) time.Duration
+
+// FixedInterArrival starts the iterations at fixed intervals, it's the default.
+func FixedInterArrival(random *rand.Rand, mean time.Duration) time.Duration {
+	return mean
+}
+
+// ExponentialInterArrival starts the iterations at exponentially distributed intervals, so the arrivals are
+// a Poisson process at the arrival rate.
+func ExponentialInterArrival(random *rand.Rand, mean time.Duration) time.Duration {
+	return time.Duration(random.ExpFloat64() * float64(mean))
+}
+
+// ParseInterArrival returns the inter-arrival distribution of name, fixed or poisson.
+func ParseInterArrival(name string) (InterArrival, error) {
+	switch strings.ToLower(name) {
+	case "fixed":
+		return FixedInterArrival, nil
+	case "poisson":
+		return ExponentialInterArrival, nil
+	default:
+		return nil, fmt.Errorf("invalid arrival distribution %q, expected fixed or poisson", name)
+	}
 }
@@ -0,0 +1,102 @@
+package boomer
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestBetween(t *testing.T) {
+	waitTime := Between(10*time.Millisecond, 20*time.Millisecond)
+	for i := 0; i < 100; i++ {
+		if d := waitTime(); d < 10*time.Millisecond || d > 20*time.Millisecond {
+			t.Fatal("The wait time should be between 10ms and 20ms, got", d)
+		}
+	}
+
+	if d := Between(time.Second, time.Second)(); d != time.Second {
+		t.Error("The wait time should be 1s, got", d)
+	}
+	if d := Between(20*time.Millisecond, 10*time.Millisecond)(); d < 10*time.Millisecond || d > 20*time.Millisecond {
+		t.Error("The swapped bounds should work too, got", d)
+	}
+}
+
+func TestConstant(t *testing.T) {
+	if d := Constant(time.Second)(); d != time.Second {
+		t.Error("The wait time should be 1s, got", d)
+	}
+}
+
+func TestExponential(t *testing.T) {
+	waitTime := Exponential(10 * time.Millisecond)
+	total := time.Duration(0)
+	for i := 0; i < 10000; i++ {
+		d := waitTime()
+		if d < 0 {
+			t.Fatal("The wait time should be positive, got", d)
+		}
+		total += d
+	}
+	if mean := total / 10000; mean < 9*time.Millisecond || mean > 11*time.Millisecond {
+		t.Error("The mean of the wait time should be about 10ms, got", mean)
+	}
+}
+
+func TestInterArrival(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	if d := FixedInterArrival(random, time.Second); d != time.Second {
+		t.Error("The interval should be 1s, got", d)
+	}
+
+	total := time.Duration(0)
+	distinct := make(map[time.Duration]bool)
+	for i := 0; i < 10000; i++ {
+		d := ExponentialInterArrival(random, 10*time.Millisecond)
+		total += d
+		distinct[d] = true
+	}
+	if mean := total / 10000; mean < 9*time.Millisecond || mean > 11*time.Millisecond {
+		t.Error("The mean of the intervals should be about 10ms, got", mean)
+	}
+	if len(distinct) < 1000 {
+		t.Error("The intervals should be random, got", len(distinct), "distinct values")
+	}
+}
+
+func TestParseInterArrival(t *testing.T) {
+	for _, name := range []string{"fixed", "poisson", "Poisson"} {
+		if interArrival, err := ParseInterArrival(name); err != nil || interArrival == nil {
+			t.Error("Failed to parse", name, err)
+		}
+	}
+	if _, err := ParseInterArrival("uniform"); err == nil {
+		t.Error("An unknown distribution should be refused")
+	}
+}
+
+func TestFilterTasks(t *testing.T) {
+	api := &Task{Name: "api", Tags: []string{"api"}}
+	slow := &Task{Name: "slow", Tags: []string{"api", "slow"}}
+	untagged := &Task{Name: "untagged"}
+	tasks := []*Task{api, slow, untagged}
+
+	names := func(tasks []*Task) (names []string) {
+		for _, task := range tasks {
+			names = append(names, task.Name)
+		}
+		return names
+	}
+	if got := names(filterTasks(tasks, nil, nil)); len(got) != 3 {
+		t.Error("All the tasks should be run without tags, got", got)
+	}
+	if got := names(filterTasks(tasks, []string{"api"}, nil)); len(got) != 2 || got[0] != "api" || got[1] != "slow" {
+		t.Error("Only the tasks with the tags should be run, got", got)
+	}
+	if got := names(filterTasks(tasks, nil, []string{"slow"})); len(got) != 2 || got[0] != "api" || got[1] != "untagged" {
+		t.Error("The tasks with the excluded tags shouldn't be run, got", got)
+	}
+	if got := names(filterTasks(tasks, []string{"api"}, []string{"slow"})); len(got) != 1 || got[0] != "api" {
+		t.Error("The excluded tags should override the tags, got", got)
+	}
+}
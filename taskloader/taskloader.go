@@ -0,0 +1,414 @@
+// Package taskloader loads boomer tasks at runtime, from Go plugins or from child processes, so a generic agent
+// binary can run the scenarios delivered at deploy time, instead of being recompiled for every scenario.
+//
+// A Go plugin is built by `go build -buildmode=plugin`, with the same versions of Go and boomer as the agent,
+// and exports a Tasks function which returns the tasks.
+//
+//	func Tasks() []*boomer.Task
+//
+// A child process can be written in any language, it speaks JSON lines over its stdin and stdout. It writes
+// its tasks first, then boomer writes a call whenever a user runs a task, and the process answers the call with
+// the same id and the requests it has made, which are recorded by boomer. The calls are concurrent, the answers
+// can be written in any order. An answer may have an "error" instead, if the task fails without a request.
+//
+//	< {"tasks": [{"name": "search", "weight": 10}, {"name": "checkout", "weight": 1}]}
+//	> {"id": 1, "task": "search"}
+//	> {"id": 2, "task": "checkout"}
+//	< {"id": 2, "requests": [{"type": "POST", "name": "/checkout", "response_time": 80, "error": "HTTP 503"}]}
+//	< {"id": 1, "requests": [{"type": "GET", "name": "/search", "response_time": 12, "response_length": 512}]}
+//
+// A Loader loads both by the file names, the plugins end with ".so", and closes the child processes at last.
+//
+//	loader := &taskloader.Loader{}
+//	defer loader.Close()
+//	tasks, err := loader.LoadDir("/etc/boomer/scenarios")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	globalBoomer.Run(tasks...)
+package taskloader
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"plugin"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/myzhan/boomer"
+)
+
+// pluginSymbol is the function exported by the plugins, which returns the tasks.
+const pluginSymbol = "Tasks"
+
+// closeTimeout is how long Close waits for a child process to exit, it's a variable for testing.
+var closeTimeout = 10 * time.Second
+
+// ErrProcessExited is returned when a call is made after the child process exits.
+var ErrProcessExited = errors.New("taskloader: the process has exited")
+
+// Recorder records the requests made by the child processes, *boomer.Boomer implements it.
+type Recorder interface {
+	RecordSuccess(requestType, name string, responseTime int64, responseLength int64)
+	RecordFailure(requestType, name string, responseTime int64, exception string)
+}
+
+// defaultRecorder records to the defaultBoomer of boomer.
+type defaultRecorder struct{}
+
+func (defaultRecorder) RecordSuccess(requestType, name string, responseTime int64, responseLength int64) {
+	boomer.RecordSuccess(requestType, name, responseTime, responseLength)
+}
+
+func (defaultRecorder) RecordFailure(requestType, name string, responseTime int64, exception string) {
+	boomer.RecordFailure(requestType, name, responseTime, exception)
+}
+
+// LoadPlugin returns the tasks of the Go plugin of path.
+func LoadPlugin(path string) ([]*boomer.Task, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("taskloader: %s: %v", path, err)
+	}
+	symbol, err := p.Lookup(pluginSymbol)
+	if err != nil {
+		return nil, fmt.Errorf("taskloader: %s: %v", path, err)
+	}
+	tasks, ok := symbol.(func() []*boomer.Task)
+	if !ok {
+		return nil, fmt.Errorf("taskloader: %s: %s is %T, expected func() []*boomer.Task", path, pluginSymbol, symbol)
+	}
+	return tasks(), nil
+}
+
+// Config is used to start a Process, the zero value is ready to use.
+type Config struct {
+	// Recorder records the requests, the package-level boomer.RecordSuccess and boomer.RecordFailure are used if it's nil.
+	Recorder Recorder
+
+	// HandshakeTimeout limits the time to wait for the tasks of the process, it's 10 seconds if it's zero.
+	HandshakeTimeout time.Duration
+}
+
+// processTask is a task declared by a child process.
+type processTask struct {
+	Name   string `json:"name"`
+	Weight int    `json:"weight"`
+}
+
+// call is written to a child process when a user runs a task.
+type call struct {
+	ID   int64  `json:"id"`
+	Task string `json:"task"`
+}
+
+// answer is written by a child process when a call is done.
+type answer struct {
+	ID       int64     `json:"id"`
+	Requests []request `json:"requests"`
+	Error    string    `json:"error"`
+}
+
+// request is a request made by a child process.
+type request struct {
+	Type           string `json:"type"`
+	Name           string `json:"name"`
+	ResponseTime   int64  `json:"response_time"`
+	ResponseLength int64  `json:"response_length"`
+	Error          string `json:"error"`
+}
+
+// Process is a child process which runs the tasks, it's safe for concurrent use by all the users.
+type Process struct {
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	recorder Recorder
+	tasks    []*boomer.Task
+
+	nextID    int64
+	writeLock sync.Mutex
+
+	lock    sync.Mutex
+	pending map[int64]chan answer
+	done    chan struct{}
+	err     error
+}
+
+// StartProcess starts cmd, and waits for its tasks. The stdin and stdout of cmd are used by the protocol,
+// its stderr is the stderr of boomer if it's not set.
+func StartProcess(cmd *exec.Cmd, config Config) (*Process, error) {
+	handshakeTimeout := config.HandshakeTimeout
+	if handshakeTimeout <= 0 {
+		handshakeTimeout = 10 * time.Second
+	}
+	recorder := config.Recorder
+	if recorder == nil {
+		recorder = defaultRecorder{}
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("taskloader: %s: %v", cmd.Path, err)
+	}
+
+	p := &Process{
+		cmd:      cmd,
+		stdin:    stdin,
+		recorder: recorder,
+		pending:  make(map[int64]chan answer),
+		done:     make(chan struct{}),
+	}
+	reader := bufio.NewReader(stdout)
+	handshake := make(chan error, 1)
+	go func() {
+		handshake <- p.readTasks(reader)
+	}()
+	select {
+	case err = <-handshake:
+	case <-time.After(handshakeTimeout):
+		err = errors.New("timeout waiting for the tasks")
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, fmt.Errorf("taskloader: %s: %v", cmd.Path, err)
+	}
+
+	go p.readAnswers(reader)
+	return p, nil
+}
+
+// readTasks reads the first line of the process, which declares the tasks.
+func (p *Process) readTasks(reader *bufio.Reader) error {
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return err
+	}
+	var declared struct {
+		Tasks []processTask `json:"tasks"`
+	}
+	if err = json.Unmarshal(line, &declared); err != nil {
+		return fmt.Errorf("invalid tasks, %v", err)
+	}
+	for _, t := range declared.Tasks {
+		name := t.Name
+		p.tasks = append(p.tasks, &boomer.Task{
+			Name:   name,
+			Weight: t.Weight,
+			FnWithContext: func(ctx context.Context) {
+				p.run(ctx, name)
+			},
+		})
+	}
+	return nil
+}
+
+// readAnswers hands the answers over to the calls, until the process exits.
+func (p *Process) readAnswers(reader *bufio.Reader) {
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var a answer
+			if jsonErr := json.Unmarshal(line, &a); jsonErr != nil {
+				log.Printf("taskloader: %s: invalid answer, %v\n", p.cmd.Path, jsonErr)
+			} else {
+				p.lock.Lock()
+				ch, ok := p.pending[a.ID]
+				delete(p.pending, a.ID)
+				p.lock.Unlock()
+				if ok {
+					ch <- a
+				}
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	err := p.cmd.Wait()
+	if err == nil {
+		err = ErrProcessExited
+	}
+	log.Printf("taskloader: %s has exited, %v\n", p.cmd.Path, err)
+	p.lock.Lock()
+	p.err = err
+	p.pending = nil
+	p.lock.Unlock()
+	close(p.done)
+}
+
+// Tasks returns the tasks of the process.
+func (p *Process) Tasks() []*boomer.Task {
+	return p.tasks
+}
+
+// Call asks the process to run the task named name, and records the requests it has made.
+func (p *Process) Call(ctx context.Context, name string) error {
+	id := atomic.AddInt64(&p.nextID, 1)
+	ch := make(chan answer, 1)
+	p.lock.Lock()
+	if p.pending == nil {
+		p.lock.Unlock()
+		return ErrProcessExited
+	}
+	p.pending[id] = ch
+	p.lock.Unlock()
+
+	line, _ := json.Marshal(call{ID: id, Task: name})
+	p.writeLock.Lock()
+	_, err := p.stdin.Write(append(line, '\n'))
+	p.writeLock.Unlock()
+	if err != nil {
+		p.forget(id)
+		// the process may have closed its stdin on exiting, which is reported once it's waited for
+		select {
+		case <-p.done:
+			return ErrProcessExited
+		case <-time.After(closeTimeout):
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	select {
+	case a := <-ch:
+		for _, r := range a.Requests {
+			if r.Error != "" {
+				p.recorder.RecordFailure(r.Type, r.Name, r.ResponseTime, r.Error)
+			} else {
+				p.recorder.RecordSuccess(r.Type, r.Name, r.ResponseTime, r.ResponseLength)
+			}
+		}
+		if a.Error != "" {
+			return errors.New(a.Error)
+		}
+		return nil
+	case <-p.done:
+		return ErrProcessExited
+	case <-ctx.Done():
+		p.forget(id)
+		return ctx.Err()
+	}
+}
+
+func (p *Process) forget(id int64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	delete(p.pending, id)
+}
+
+// run calls the task, once the process exits, the users of its tasks idle until they are stopped,
+// instead of spinning on the calls which fail at once.
+func (p *Process) run(ctx context.Context, name string) {
+	err := p.Call(ctx, name)
+	switch {
+	case err == nil, errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+	case errors.Is(err, ErrProcessExited):
+		<-ctx.Done()
+	default:
+		log.Printf("taskloader: %s: task %s failed, %v\n", p.cmd.Path, name, err)
+	}
+}
+
+// Close closes the stdin of the process, which should exit then, and waits for it to exit.
+// The process is killed if it doesn't exit in closeTimeout.
+func (p *Process) Close() error {
+	p.stdin.Close()
+	select {
+	case <-p.done:
+	case <-time.After(closeTimeout):
+		p.cmd.Process.Kill()
+		<-p.done
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.err == ErrProcessExited {
+		return nil
+	}
+	return p.err
+}
+
+// Loader loads the tasks from the plugins and the child processes, the zero value is ready to use.
+type Loader struct {
+	// Config is used to start the child processes.
+	Config Config
+
+	lock      sync.Mutex
+	processes []*Process
+}
+
+// Load returns the tasks of the plugin of path if it ends with ".so", or starts the executable of path
+// as a child process and returns its tasks.
+func (l *Loader) Load(path string) ([]*boomer.Task, error) {
+	if strings.HasSuffix(path, ".so") {
+		return LoadPlugin(path)
+	}
+	p, err := StartProcess(exec.Command(path), l.Config)
+	if err != nil {
+		return nil, err
+	}
+	l.lock.Lock()
+	l.processes = append(l.processes, p)
+	l.lock.Unlock()
+	return p.Tasks(), nil
+}
+
+// LoadDir loads the plugins and the executables in dir, sorted by name, the other files are skipped.
+func (l *Loader) LoadDir(dir string) ([]*boomer.Task, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks []*boomer.Task
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".so") && file.Mode()&0111 == 0 {
+			continue
+		}
+		loaded, err := l.Load(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, loaded...)
+	}
+	return tasks, nil
+}
+
+// Close closes the child processes started by the loader.
+func (l *Loader) Close() error {
+	l.lock.Lock()
+	processes := l.processes
+	l.processes = nil
+	l.lock.Unlock()
+
+	var firstErr error
+	for _, p := range processes {
+		if err := p.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
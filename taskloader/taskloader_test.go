@@ -0,0 +1,178 @@
+package taskloader
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type record struct {
+	requestType, name string
+	responseTime      int64
+	responseLength    int64
+	exception         string
+}
+
+type fakeRecorder struct {
+	lock    sync.Mutex
+	records []record
+}
+
+func (r *fakeRecorder) RecordSuccess(requestType, name string, responseTime int64, responseLength int64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.records = append(r.records, record{requestType, name, responseTime, responseLength, ""})
+}
+
+func (r *fakeRecorder) RecordFailure(requestType, name string, responseTime int64, exception string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.records = append(r.records, record{requestType, name, responseTime, 0, exception})
+}
+
+// helperCommand runs TestHelperProcess as the child process, in mode.
+func helperCommand(mode string) *exec.Cmd {
+	cmd := exec.Command(os.Args[0], "-test.run=TestHelperProcess")
+	cmd.Env = append(os.Environ(), "TASKLOADER_HELPER_PROCESS="+mode)
+	return cmd
+}
+
+// TestHelperProcess isn't a real test, it's the child process of the other tests.
+func TestHelperProcess(t *testing.T) {
+	mode := os.Getenv("TASKLOADER_HELPER_PROCESS")
+	if mode == "" {
+		return
+	}
+	defer os.Exit(0)
+
+	fmt.Println(`{"tasks": [{"name": "search", "weight": 10}, {"name": "checkout", "weight": 1}, {"name": "broken"}]}`)
+	if mode == "exit" {
+		return
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var c call
+		json.Unmarshal(scanner.Bytes(), &c)
+		switch c.Task {
+		case "search":
+			fmt.Printf(`{"id": %d, "requests": [{"type": "GET", "name": "/search", "response_time": 12, "response_length": 512}]}`+"\n", c.ID)
+		case "checkout":
+			fmt.Printf(`{"id": %d, "requests": [{"type": "POST", "name": "/checkout", "response_time": 80, "error": "HTTP 503"}]}`+"\n", c.ID)
+		default:
+			fmt.Printf(`{"id": %d, "error": "unknown task"}`+"\n", c.ID)
+		}
+	}
+}
+
+func TestProcess(t *testing.T) {
+	recorder := &fakeRecorder{}
+	p, err := StartProcess(helperCommand("serve"), Config{Recorder: recorder})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := p.Tasks()
+	if len(tasks) != 3 || tasks[0].Name != "search" || tasks[0].Weight != 10 || tasks[1].Name != "checkout" || tasks[1].Weight != 1 {
+		t.Fatal("The tasks of the process should be returned, got", tasks)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tasks[0].FnWithContext(context.Background())
+		}()
+	}
+	wg.Wait()
+	if err = p.Call(context.Background(), "checkout"); err != nil {
+		t.Error(err)
+	}
+	if err = p.Call(context.Background(), "broken"); err == nil || err.Error() != "unknown task" {
+		t.Error("The error of the answer should be returned, got", err)
+	}
+
+	recorder.lock.Lock()
+	if len(recorder.records) != 11 {
+		t.Fatal("The requests of the process should be recorded, got", recorder.records)
+	}
+	if r := recorder.records[0]; r != (record{"GET", "/search", 12, 512, ""}) {
+		t.Error("The success should be recorded, got", r)
+	}
+	if r := recorder.records[10]; r != (record{"POST", "/checkout", 80, 0, "HTTP 503"}) {
+		t.Error("The failure should be recorded, got", r)
+	}
+	recorder.lock.Unlock()
+
+	if err = p.Close(); err != nil {
+		t.Error("The process should exit cleanly, got", err)
+	}
+	if err = p.Call(context.Background(), "search"); err != ErrProcessExited {
+		t.Error("The calls should fail once the process exits, got", err)
+	}
+}
+
+func TestProcessExited(t *testing.T) {
+	p, err := StartProcess(helperCommand("exit"), Config{Recorder: &fakeRecorder{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	// the users idle instead of spinning once the process exits
+	p.Tasks()[0].FnWithContext(ctx)
+	if time.Since(start) < 100*time.Millisecond {
+		t.Error("The task should wait for the user to be stopped once the process exits")
+	}
+}
+
+func TestStartProcessWithoutTasks(t *testing.T) {
+	if _, err := StartProcess(exec.Command("true"), Config{}); err == nil {
+		t.Error("A process which doesn't write its tasks should be refused")
+	}
+	if _, err := StartProcess(exec.Command("sleep", "10"), Config{HandshakeTimeout: 100 * time.Millisecond}); err == nil {
+		t.Error("A process which doesn't write its tasks in time should be refused")
+	}
+}
+
+func TestLoadPlugin(t *testing.T) {
+	if _, err := LoadPlugin("missing.so"); err == nil {
+		t.Error("A missing plugin should be refused")
+	}
+}
+
+func TestLoaderLoadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "taskloader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	script := "#!/bin/sh\necho '{\"tasks\": [{\"name\": \"%s\"}]}'\ncat > /dev/null\n"
+	ioutil.WriteFile(filepath.Join(dir, "b.sh"), []byte(fmt.Sprintf(script, "b")), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "a.sh"), []byte(fmt.Sprintf(script, "a")), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "README"), []byte("not a scenario"), 0644)
+
+	loader := &Loader{Config: Config{Recorder: &fakeRecorder{}}}
+	tasks, err := loader.LoadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 2 || tasks[0].Name != "a" || tasks[1].Name != "b" {
+		t.Error("The tasks of the executables should be loaded by name, got", tasks)
+	}
+	if err = loader.Close(); err != nil {
+		t.Error(err)
+	}
+}
@@ -1,6 +1,7 @@
 package boomer
 
 import (
+	"context"
 	"math/rand"
 	"sync"
 	"time"
@@ -28,6 +29,7 @@ type WeighingTaskSet struct {
 	tasks  []*Task
 	index  []int
 	lock   sync.RWMutex
+	rand   *rand.Rand
 }
 
 // NewWeighingTaskSet returns a new WeighingTaskSet.
@@ -37,9 +39,16 @@ func NewWeighingTaskSet() *WeighingTaskSet {
 		offset: 0,
 		tasks:  make([]*Task, 0),
 		index:  make([]int, 0),
+		rand:   newRand(time.Now().UnixNano()),
 	}
 }
 
+// SetRandomSeed makes the tasks picked by Run reproducible, by default the seed is time-based.
+// Like Boomer.SetRandomSeed, it only affects which task is picked, not the task code itself.
+func (ts *WeighingTaskSet) SetRandomSeed(seed int64) {
+	ts.rand = newRand(seed)
+}
+
 // AddTask add a Task to the Weighing TaskSet.
 // If the task's weight is <=0, it will be ignored.
 func (ts *WeighingTaskSet) AddTask(task *Task) {
@@ -100,8 +109,105 @@ func (ts *WeighingTaskSet) GetWeight() (weight int) {
 // Run will pick up a task in the task set randomly and run.
 // It can is used as a Task.Fn.
 func (ts *WeighingTaskSet) Run() {
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	roll := r.Intn(ts.offset)
+	ts.RunWithContext(context.Background())
+}
+
+// RunWithContext is like Run, but passes ctx to the task if it has a FnWithContext.
+// It can is used as a Task.FnWithContext.
+func (ts *WeighingTaskSet) RunWithContext(ctx context.Context) {
+	roll := ts.rand.Intn(ts.offset)
 	task := ts.GetTask(roll)
-	task.Fn()
+	task.run(ctx)
+}
+
+// SequentialTaskSet is a implementation of the TaskSet interface.
+// It runs all of its tasks in the order they are added, like a user journey of
+// login -> search -> add-to-cart -> checkout. Each call of Run executes the whole sequence once,
+// so the sequence is repeated by the goroutine running it as a Task.Fn.
+//
+// Each step should report its own result by calling RecordSuccess or RecordFailure with its own name,
+// so every step has its own entry in the stats, just like independent tasks.
+// If abortOnFailure is enabled, a step added by AddStep which returns an error will stop the
+// remaining steps in this iteration. The skipped steps are not recorded at all.
+type SequentialTaskSet struct {
+	weight         int
+	abortOnFailure bool
+	steps          []sequentialStep
+	lock           sync.RWMutex
+}
+
+type sequentialStep struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// NewSequentialTaskSet returns a new SequentialTaskSet.
+func NewSequentialTaskSet() *SequentialTaskSet {
+	return &SequentialTaskSet{
+		weight: 0,
+		steps:  make([]sequentialStep, 0),
+	}
+}
+
+// AddTask appends a Task to the sequence. It never aborts the sequence.
+func (ts *SequentialTaskSet) AddTask(task *Task) {
+	ts.addStep(task.Name, func(ctx context.Context) error {
+		task.run(ctx)
+		return nil
+	})
+}
+
+// AddStep appends a step to the sequence, fn returns an error if the step fails.
+func (ts *SequentialTaskSet) AddStep(name string, fn func() error) {
+	ts.addStep(name, func(ctx context.Context) error {
+		return fn()
+	})
+}
+
+func (ts *SequentialTaskSet) addStep(name string, fn func(ctx context.Context) error) {
+	ts.lock.Lock()
+	ts.steps = append(ts.steps, sequentialStep{
+		name: name,
+		fn:   fn,
+	})
+	ts.lock.Unlock()
+}
+
+// SetAbortOnFailure determines whether to skip the remaining steps when a step fails.
+func (ts *SequentialTaskSet) SetAbortOnFailure(abort bool) {
+	ts.abortOnFailure = abort
+}
+
+// SetWeight sets the weight of the task set.
+func (ts *SequentialTaskSet) SetWeight(weight int) {
+	ts.weight = weight
+}
+
+// GetWeight returns the weight of the task set.
+func (ts *SequentialTaskSet) GetWeight() (weight int) {
+	return ts.weight
+}
+
+// Run executes all the steps in order.
+// It can is used as a Task.Fn.
+func (ts *SequentialTaskSet) Run() {
+	ts.RunWithContext(context.Background())
+}
+
+// RunWithContext is like Run, but passes ctx to the tasks which have a FnWithContext,
+// and skips the remaining steps once ctx is canceled.
+// It can is used as a Task.FnWithContext.
+func (ts *SequentialTaskSet) RunWithContext(ctx context.Context) {
+	ts.lock.RLock()
+	steps := ts.steps
+	ts.lock.RUnlock()
+
+	for _, step := range steps {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := step.fn(ctx); err != nil && ts.abortOnFailure {
+			return
+		}
+	}
 }
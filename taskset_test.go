@@ -1,6 +1,10 @@
 package boomer
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"testing"
+)
 
 func TestWeighingTaskSetWithSingleTask(t *testing.T) {
 	ts := NewWeighingTaskSet()
@@ -90,3 +94,90 @@ func TestWeighingTaskSetGetTaskWithThreeTasks(t *testing.T) {
 		t.Error("Expecting C, but got ", ts.GetTask(5).Name)
 	}
 }
+
+func TestSequentialTaskSet(t *testing.T) {
+	ts := NewSequentialTaskSet()
+	ts.SetWeight(10)
+	if ts.GetWeight() != 10 {
+		t.Error("Expecting weight 10, but got ", ts.GetWeight())
+	}
+
+	order := make([]string, 0)
+	ts.AddTask(&Task{
+		Name: "login",
+		Fn: func() {
+			order = append(order, "login")
+		},
+	})
+	ts.AddStep("search", func() error {
+		order = append(order, "search")
+		return nil
+	})
+	ts.AddTask(&Task{
+		Name: "checkout",
+		Fn: func() {
+			order = append(order, "checkout")
+		},
+	})
+
+	ts.Run()
+	ts.Run()
+
+	expected := []string{"login", "search", "checkout", "login", "search", "checkout"}
+	if len(order) != len(expected) {
+		t.Fatal("Expecting", expected, "but got", order)
+	}
+	for i := range expected {
+		if order[i] != expected[i] {
+			t.Fatal("Expecting", expected, "but got", order)
+		}
+	}
+}
+
+func TestSequentialTaskSetAbortOnFailure(t *testing.T) {
+	ts := NewSequentialTaskSet()
+
+	checkoutIsRun := false
+	ts.AddStep("login", func() error {
+		return errors.New("login failed")
+	})
+	ts.AddStep("checkout", func() error {
+		checkoutIsRun = true
+		return nil
+	})
+
+	ts.Run()
+	if !checkoutIsRun {
+		t.Error("The remaining steps should be run if abortOnFailure is disabled")
+	}
+
+	checkoutIsRun = false
+	ts.SetAbortOnFailure(true)
+	ts.Run()
+	if checkoutIsRun {
+		t.Error("The remaining steps should be skipped if a step fails")
+	}
+}
+
+func TestSequentialTaskSetRunWithContext(t *testing.T) {
+	ts := NewSequentialTaskSet()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	checkoutIsRun := false
+	ts.AddTask(&Task{
+		Name: "login",
+		FnWithContext: func(ctx context.Context) {
+			cancel()
+		},
+	})
+	ts.AddStep("checkout", func() error {
+		checkoutIsRun = true
+		return nil
+	})
+
+	ts.RunWithContext(ctx)
+
+	if checkoutIsRun {
+		t.Error("The remaining steps should be skipped once the context is canceled")
+	}
+}
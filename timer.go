@@ -0,0 +1,60 @@
+package boomer
+
+import (
+	"time"
+)
+
+// Timer measures the response time of a request, and records it in milliseconds, like RecordSuccess and RecordFailure
+// expect. It uses the monotonic clock, so the response time isn't affected by changes of the wall clock, and it's never
+// negative. Don't compute the response time with time.Since and convert it by hand, mixing nanoseconds and milliseconds
+// is the most common mistake.
+//
+//	timer := boomer.StartTimer()
+//	resp, err := http.Get(url)
+//	if err != nil {
+//		timer.RecordFailure("http", "foo", err.Error())
+//		return
+//	}
+//	timer.RecordSuccess("http", "foo", resp.ContentLength)
+type Timer struct {
+	boomer *Boomer
+	start  time.Time
+}
+
+// StartTimer returns a Timer, which starts timing now and records to b.
+func (b *Boomer) StartTimer() Timer {
+	return Timer{
+		boomer: b,
+		start:  time.Now(),
+	}
+}
+
+// StartTimer returns a Timer, which starts timing now.
+// It's a convenience function to use the defaultBoomer.
+func StartTimer() Timer {
+	return defaultBoomer.StartTimer()
+}
+
+// Elapsed returns the time since the timer is started.
+func (t Timer) Elapsed() time.Duration {
+	elapsed := time.Since(t.start)
+	if elapsed < 0 {
+		return 0
+	}
+	return elapsed
+}
+
+// ElapsedMilliseconds returns the time since the timer is started, in milliseconds.
+func (t Timer) ElapsedMilliseconds() int64 {
+	return int64(t.Elapsed() / time.Millisecond)
+}
+
+// RecordSuccess records a success, whose response time is the time since the timer is started.
+func (t Timer) RecordSuccess(requestType, name string, responseLength int64) {
+	t.boomer.RecordSuccess(requestType, name, t.ElapsedMilliseconds(), responseLength)
+}
+
+// RecordFailure records a failure, whose response time is the time since the timer is started.
+func (t Timer) RecordFailure(requestType, name string, exception string) {
+	t.boomer.RecordFailure(requestType, name, t.ElapsedMilliseconds(), exception)
+}
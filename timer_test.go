@@ -0,0 +1,41 @@
+package boomer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimer(t *testing.T) {
+	masterHost := "127.0.0.1"
+	masterPort := 5557
+	defaultBoomer = NewBoomer(masterHost, masterPort)
+	defaultBoomer.slaveRunner = newSlaveRunner(masterHost, masterPort, nil, nil)
+
+	timer := StartTimer()
+	time.Sleep(20 * time.Millisecond)
+	timer.RecordSuccess("http", "foo", 10)
+	timer.RecordFailure("http", "bar", "timeout")
+
+	successes, failures := takeRecords(defaultBoomer.slaveRunner.stats)
+	if len(successes) != 1 || len(failures) != 1 {
+		t.Fatal("Expected 1 success and 1 failure, got:", len(successes), len(failures))
+	}
+	requestSuccessMsg := successes[0]
+	if requestSuccessMsg.responseTime < 20 || requestSuccessMsg.responseTime > 1000 {
+		t.Error("The response time should be in milliseconds, got:", requestSuccessMsg.responseTime)
+	}
+	if requestSuccessMsg.name != "foo" || requestSuccessMsg.responseLength != 10 {
+		t.Error("Unexpected success", requestSuccessMsg)
+	}
+	requestFailureMsg := failures[0]
+	if requestFailureMsg.responseTime < requestSuccessMsg.responseTime || requestFailureMsg.error != "timeout" {
+		t.Error("Unexpected failure", requestFailureMsg)
+	}
+}
+
+func TestTimerIsNeverNegative(t *testing.T) {
+	timer := Timer{start: time.Now().Add(time.Hour)}
+	if timer.Elapsed() != 0 || timer.ElapsedMilliseconds() != 0 {
+		t.Error("The elapsed time should not be negative, got:", timer.Elapsed())
+	}
+}
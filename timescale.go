@@ -0,0 +1,228 @@
+package boomer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"os/user"
+	"sort"
+	"strings"
+	"time"
+)
+
+// timescaleMaxRowsPerInsert keeps the parameters of an INSERT under the limit of PostgreSQL, which is 65535.
+const timescaleMaxRowsPerInsert = 1000
+
+// timescaleDB is the part of *sql.DB used by TimescaleOutput.
+type timescaleDB interface {
+	PingContext(ctx context.Context) error
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// TimescaleOutput writes the stats of every interval to PostgreSQL or TimescaleDB, in the tables of locust-plugins,
+// so the Grafana dashboards of locust-timescale can be reused with boomer. It's an OutputV2, add it by
+// AddOutput(AdaptOutput(output)). The tables must be created by the schema of locust-plugins, the driver
+// of db, like github.com/lib/pq or github.com/jackc/pgx/v4/stdlib, is imported by the caller.
+//
+// A row is written to "testrun" when the test starts, and updated with the summary when it's stopped.
+// The user count of every interval is written to "user_count". The dashboards query the requests one by one,
+// while boomer aggregates them, so a row per request is generated in "request" from the response times of
+// the interval, spread over the interval. The response times are rounded like the stats, and the failures are
+// assigned the slowest response times of their request name in the interval.
+type TimescaleOutput struct {
+	db          timescaleDB
+	testplan    string
+	env         string
+	description string
+	loadgen     string
+
+	runID     time.Time
+	lastTime  time.Time
+	userCount int64
+}
+
+// NewTimescaleOutput returns a TimescaleOutput, which writes to db with testplan, like the --testplan of locust-plugins.
+func NewTimescaleOutput(db *sql.DB, testplan string) *TimescaleOutput {
+	hostname, _ := os.Hostname()
+	return &TimescaleOutput{
+		db:       db,
+		testplan: testplan,
+		env:      "local",
+		loadgen:  hostname,
+	}
+}
+
+// SetEnv sets the env column of the test run, like "staging", it's "local" by default.
+func (o *TimescaleOutput) SetEnv(env string) {
+	o.env = env
+}
+
+// SetDescription sets the description column of the test run.
+func (o *TimescaleOutput) SetDescription(description string) {
+	o.description = description
+}
+
+// Init pings the database, so boomer can fail fast if it's unreachable.
+func (o *TimescaleOutput) Init() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := o.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to connect to TimescaleDB, %v", err)
+	}
+	return nil
+}
+
+// OnStart writes the test run, its id is the start time.
+func (o *TimescaleOutput) OnStart() {
+	o.runID = time.Now()
+	o.lastTime = o.runID
+	o.userCount = 0
+	username := ""
+	if u, err := user.Current(); err == nil {
+		username = u.Username
+	}
+	o.exec("INSERT INTO testrun (id, testplan, num_clients, description, env, username, arguments) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		o.runID, o.testplan, 0, o.description, o.env, username, strings.Join(os.Args[1:], " "))
+}
+
+// OnInterval writes the user count and the requests of the interval.
+func (o *TimescaleOutput) OnInterval(stats *IntervalStats) {
+	start := o.lastTime
+	o.lastTime = stats.Time
+	if stats.UserCount > o.userCount {
+		o.userCount = stats.UserCount
+	}
+	o.exec("INSERT INTO user_count (testplan, user_count, time, run_id) VALUES ($1, $2, $3, $4)",
+		o.testplan, stats.UserCount, stats.Time, o.runID)
+
+	rows := timescaleRequestRows(stats)
+	for len(rows) > 0 {
+		n := len(rows)
+		if n > timescaleMaxRowsPerInsert {
+			n = timescaleMaxRowsPerInsert
+		}
+		o.insertRequests(start, stats.Time, rows[:n])
+		rows = rows[n:]
+	}
+}
+
+// OnFinal updates the test run with the summary.
+func (o *TimescaleOutput) OnFinal(stats *FinalStats) {
+	total := stats.Total
+	failRatio := 0.0
+	if total.NumRequests > 0 {
+		failRatio = float64(total.NumFailures) / float64(total.NumRequests)
+	}
+	o.exec("UPDATE testrun SET end_time = $1, num_clients = $2, rps_avg = $3, resp_time_avg = $4, fail_ratio = $5, requests = $6 WHERE id = $7",
+		stats.EndTime, o.userCount, total.RPS, total.AvgResponseTime, failRatio, total.NumRequests, o.runID)
+}
+
+// OnStop of TimescaleOutput has nothing to do.
+func (o *TimescaleOutput) OnStop() {
+
+}
+
+// timescaleRequestRow is count requests which have the same columns.
+type timescaleRequestRow struct {
+	requestType    string
+	name           string
+	responseTime   int64
+	responseLength int64
+	success        bool
+	exception      string
+	count          int64
+}
+
+// timescaleRequestRows groups the requests of an interval by their columns.
+func timescaleRequestRows(stats *IntervalStats) []*timescaleRequestRow {
+	errors := make(map[string][]*RequestError)
+	for _, e := range stats.Errors {
+		key := e.Method + "\x00" + e.Name
+		errors[key] = append(errors[key], e)
+	}
+
+	var rows []*timescaleRequestRow
+	for _, s := range stats.Stats {
+		if s.NumRequests == 0 {
+			continue
+		}
+		responseLength := getAvgContentLength(s.NumRequests, s.TotalContentLength)
+		responseTimes := make([]int64, 0, len(s.ResponseTimes))
+		for responseTime := range s.ResponseTimes {
+			responseTimes = append(responseTimes, responseTime)
+		}
+		// the slowest first, they are assigned to the failures
+		sort.Slice(responseTimes, func(i, j int) bool { return responseTimes[i] > responseTimes[j] })
+
+		i := 0
+		left := int64(0)
+		if len(responseTimes) > 0 {
+			left = s.ResponseTimes[responseTimes[0]]
+		}
+		// take appends the rows of n requests, taking the slowest response times left.
+		take := func(n int64, success bool, exception string) {
+			for n > 0 && i < len(responseTimes) {
+				count := n
+				if count > left {
+					count = left
+				}
+				rows = append(rows, &timescaleRequestRow{
+					requestType:    s.Method,
+					name:           s.Name,
+					responseTime:   responseTimes[i],
+					responseLength: responseLength,
+					success:        success,
+					exception:      exception,
+					count:          count,
+				})
+				n -= count
+				left -= count
+				if left == 0 {
+					i++
+					if i < len(responseTimes) {
+						left = s.ResponseTimes[responseTimes[i]]
+					}
+				}
+			}
+		}
+		for _, e := range errors[s.Method+"\x00"+s.Name] {
+			take(e.Occurrences, false, e.Error)
+		}
+		take(s.NumRequests, true, "")
+	}
+	return rows
+}
+
+// insertRequests writes the requests of rows, spread over start to end by random, as one statement.
+func (o *TimescaleOutput) insertRequests(start, end time.Time, rows []*timescaleRequestRow) {
+	var values []string
+	args := []interface{}{end, end.Sub(start).Seconds(), o.runID, o.testplan, o.loadgen}
+	for _, row := range rows {
+		n := len(args)
+		values = append(values, fmt.Sprintf("($%d::text, $%d::text, $%d::float8, $%d::integer, $%d::smallint, $%d::text, $%d::integer)",
+			n+1, n+2, n+3, n+4, n+5, n+6, n+7))
+		success := 0
+		if row.success {
+			success = 1
+		}
+		var exception interface{}
+		if row.exception != "" {
+			exception = row.exception
+		}
+		args = append(args, row.requestType, row.name, row.responseTime, row.responseLength, success, exception, row.count)
+	}
+	o.exec("INSERT INTO request (time, run_id, testplan, loadgen, greenlet_id, request_type, name, response_time, response_length, success, exception) "+
+		"SELECT $1::timestamptz - random() * $2::float8 * interval '1 second', $3, $4, $5, 0, "+
+		"v.request_type, v.name, v.response_time, v.response_length, v.success, v.exception "+
+		"FROM (VALUES "+strings.Join(values, ", ")+") AS v(request_type, name, response_time, response_length, success, exception, count), "+
+		"generate_series(1, v.count)", args...)
+}
+
+func (o *TimescaleOutput) exec(query string, args ...interface{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := o.db.ExecContext(ctx, query, args...); err != nil {
+		logError("Failed to write stats to TimescaleDB, %v", err)
+	}
+}
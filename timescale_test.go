@@ -0,0 +1,118 @@
+package boomer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type timescaleQuery struct {
+	query string
+	args  []interface{}
+}
+
+type fakeTimescaleDB struct {
+	pingErr error
+	queries []*timescaleQuery
+}
+
+func (db *fakeTimescaleDB) PingContext(ctx context.Context) error {
+	return db.pingErr
+}
+
+func (db *fakeTimescaleDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	db.queries = append(db.queries, &timescaleQuery{query: query, args: args})
+	return nil, nil
+}
+
+func TestTimescaleRequestRows(t *testing.T) {
+	stats := &IntervalStats{
+		Stats: []*RequestStats{{
+			Method:             "http",
+			Name:               "foo",
+			NumRequests:        5,
+			NumFailures:        3,
+			TotalContentLength: 500,
+			ResponseTimes:      map[int64]int64{10: 3, 20: 1, 30: 1},
+		}},
+		Errors: []*RequestError{
+			{Method: "http", Name: "foo", Error: "timeout", Occurrences: 2},
+			{Method: "http", Name: "foo", Error: "500 error", Occurrences: 1},
+		},
+	}
+
+	rows := timescaleRequestRows(stats)
+	expected := []timescaleRequestRow{
+		{"http", "foo", 30, 100, false, "timeout", 1},
+		{"http", "foo", 20, 100, false, "timeout", 1},
+		{"http", "foo", 10, 100, false, "500 error", 1},
+		{"http", "foo", 10, 100, true, "", 2},
+	}
+	if len(rows) != len(expected) {
+		t.Fatal("Expected 4 rows, got", len(rows))
+	}
+	for i, row := range rows {
+		if *row != expected[i] {
+			t.Error("Unexpected row", i, *row)
+		}
+	}
+}
+
+func TestTimescaleOutput(t *testing.T) {
+	db := &fakeTimescaleDB{}
+	o := NewTimescaleOutput(nil, "myplan")
+	o.db = db
+	o.SetEnv("staging")
+	if err := o.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	o.OnStart()
+	o.OnInterval(&IntervalStats{
+		Time:      o.runID.Add(3 * time.Second),
+		UserCount: 10,
+		Stats: []*RequestStats{{
+			Method:        "http",
+			Name:          "foo",
+			NumRequests:   2,
+			ResponseTimes: map[int64]int64{10: 2},
+		}},
+	})
+	o.OnFinal(&FinalStats{
+		EndTime: time.Now(),
+		Total:   &RequestSummary{NumRequests: 4, NumFailures: 1, RPS: 2, AvgResponseTime: 10},
+	})
+	o.OnStop()
+
+	if len(db.queries) != 4 {
+		t.Fatal("Expected 4 queries, got", len(db.queries))
+	}
+	if !strings.HasPrefix(db.queries[0].query, "INSERT INTO testrun") || db.queries[0].args[1] != "myplan" || db.queries[0].args[4] != "staging" {
+		t.Error("The test run should be inserted, got", db.queries[0].args)
+	}
+	if !strings.HasPrefix(db.queries[1].query, "INSERT INTO user_count") || db.queries[1].args[1] != int64(10) {
+		t.Error("The user count should be inserted, got", db.queries[1].args)
+	}
+	request := db.queries[2]
+	if !strings.HasPrefix(request.query, "INSERT INTO request") || strings.Count(request.query, "::smallint") != 1 {
+		t.Error("The requests should be inserted as a row, got", request.query)
+	}
+	if request.args[1] != 3.0 || request.args[6] != "foo" || request.args[11] != int64(2) {
+		t.Error("The requests should be spread over the interval, got", request.args)
+	}
+	update := db.queries[3]
+	if !strings.HasPrefix(update.query, "UPDATE testrun") || update.args[1] != int64(10) || update.args[4] != 0.25 || update.args[6] != o.runID {
+		t.Error("The test run should be updated with the summary, got", update.args)
+	}
+}
+
+func TestTimescaleOutputInitFailed(t *testing.T) {
+	o := NewTimescaleOutput(nil, "myplan")
+	o.db = &fakeTimescaleDB{pingErr: errors.New("connection refused")}
+	if err := o.Init(); err == nil {
+		t.Error("Init should fail if the database is unreachable")
+	}
+}
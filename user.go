@@ -0,0 +1,47 @@
+package boomer
+
+import (
+	"context"
+	"math/rand"
+)
+
+// User is the state of a virtual user, i.e. a goroutine spawned to run a task. It's created when the goroutine
+// is spawned, and kept across the iterations until the goroutine is stopped, so the task can keep something
+// per user, like an auth session, instead of sharing it by all the goroutines.
+// A User belongs to a single goroutine, it's not safe for concurrent use.
+type User struct {
+	// Index is the index of the user, starting from 0. It's unique among the running users of this process,
+	// the index of a stopped user is reused by the next spawned user.
+	Index int
+	// Seed is the seed of Rand, it's picked by the random number generator of the runner,
+	// so the seeds are reproducible with Boomer.SetRandomSeed.
+	Seed int64
+	// Rand is the random number generator of the user.
+	Rand *rand.Rand
+	// Storage is kept across the iterations of the user.
+	Storage map[string]interface{}
+}
+
+func newUser(index int, seed int64) *User {
+	return &User{
+		Index:   index,
+		Seed:    seed,
+		Rand:    rand.New(rand.NewSource(seed)),
+		Storage: make(map[string]interface{}),
+	}
+}
+
+type userContextKey struct{}
+
+// ContextWithUser returns a copy of ctx which carries user, like the context passed to the tasks by boomer.
+// It's meant for the unit tests of the code which calls UserFromContext.
+func ContextWithUser(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, userContextKey{}, user)
+}
+
+// UserFromContext returns the User of the goroutine, which runs the task with ctx,
+// or nil if ctx isn't passed by boomer, e.g. in a unit test.
+func UserFromContext(ctx context.Context) *User {
+	user, _ := ctx.Value(userContextKey{}).(*User)
+	return user
+}
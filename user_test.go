@@ -0,0 +1,98 @@
+package boomer
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUser(t *testing.T) {
+	var lock sync.Mutex
+	users := make(map[*User]bool)
+	task := &Task{
+		FnWithUser: func(ctx context.Context, user *User) {
+			if UserFromContext(ctx) != user {
+				t.Error("UserFromContext should return the user passed to FnWithUser")
+			}
+			lock.Lock()
+			count, _ := user.Storage["count"].(int)
+			user.Storage["count"] = count + 1
+			users[user] = true
+			lock.Unlock()
+			time.Sleep(time.Millisecond)
+		},
+	}
+
+	runner := newSlaveRunner("localhost", 5557, []*Task{task}, nil)
+	defer runner.close()
+	runner.client = newClient("localhost", 5557, runner.nodeID)
+	runner.setRandomSeed(10)
+
+	quit := make(chan bool)
+	go runner.spawnWorkers(5, quit, nil)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		lock.Lock()
+		iterated := 0
+		for user := range users {
+			if user.Storage["count"].(int) > 1 {
+				iterated++
+			}
+		}
+		lock.Unlock()
+		if iterated == 5 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Every user should be kept across the iterations")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(quit)
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(users) != 5 {
+		t.Fatal("Every goroutine should have its own user, got", len(users))
+	}
+	indexes := make(map[int]bool)
+	seeds := make(map[int64]bool)
+	for user := range users {
+		indexes[user.Index] = true
+		seeds[user.Seed] = true
+	}
+	for i := 0; i < 5; i++ {
+		if !indexes[i] {
+			t.Error("The indexes of the users should be 0 to 4, missing", i)
+		}
+	}
+	if len(seeds) != 5 {
+		t.Error("The users should have different seeds")
+	}
+}
+
+func TestFreeUserIndex(t *testing.T) {
+	runner := &runner{
+		workers: map[*worker]bool{
+			{user: newUser(0, 0)}: true,
+			{user: newUser(2, 0)}: true,
+		},
+	}
+	if index := runner.freeUserIndex(); index != 1 {
+		t.Error("The index of a stopped user should be reused, got", index)
+	}
+}
+
+func TestUserFromContext(t *testing.T) {
+	if UserFromContext(context.Background()) != nil {
+		t.Error("There should be no user in a context which isn't passed by boomer")
+	}
+	user := newUser(1, 10)
+	if UserFromContext(ContextWithUser(context.Background(), user)) != user {
+		t.Error("UserFromContext should return the user")
+	}
+	if newUser(1, 10).Rand.Int63() != user.Rand.Int63() {
+		t.Error("The users with the same seed should have the same randomness")
+	}
+}
@@ -4,12 +4,16 @@ import (
 	"crypto/md5"
 	"fmt"
 	"io"
-	"log"
 	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	httppprof "net/http/pprof"
 	"os"
 	"runtime"
 	"runtime/pprof"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -59,14 +63,14 @@ func StartMemoryProfile(file string, duration time.Duration) (err error) {
 		return err
 	}
 
-	log.Println("Start memory profiling for", duration)
+	logInfo("Start memory profiling for %v", duration)
 	time.AfterFunc(duration, func() {
 		err = pprof.WriteHeapProfile(f)
 		if err != nil {
-			log.Println(err)
+			logError("%v", err)
 		}
 		f.Close()
-		log.Println("Stop memory profiling after", duration)
+		logInfo("Stop memory profiling after %v", duration)
 	})
 	return nil
 }
@@ -78,7 +82,7 @@ func StartCPUProfile(file string, duration time.Duration) (err error) {
 		return err
 	}
 
-	log.Println("Start cpu profiling for", duration)
+	logInfo("Start cpu profiling for %v", duration)
 	err = pprof.StartCPUProfile(f)
 	if err != nil {
 		f.Close()
@@ -88,23 +92,107 @@ func StartCPUProfile(file string, duration time.Duration) (err error) {
 	time.AfterFunc(duration, func() {
 		pprof.StopCPUProfile()
 		f.Close()
-		log.Println("Stop CPU profiling after", duration)
+		logInfo("Stop CPU profiling after %v", duration)
 	})
 	return nil
 }
 
+// StartPprofServer serves the live profiles of net/http/pprof on addr, like ":6060", until the process exits,
+// so a profile can be grabbed at any time during a test, e.g. "go tool pprof http://localhost:6060/debug/pprof/heap".
+// It returns the address which is listened on, in case the port of addr is 0.
+func StartPprofServer(addr string) (net.Addr, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", httppprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", httppprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", httppprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", httppprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", httppprof.Trace)
+	logInfo("The pprof server is serving on http://%s/debug/pprof/", ln.Addr().String())
+	go http.Serve(ln, mux)
+	return ln.Addr(), nil
+}
+
 // GetCurrentCPUUsage get current CPU usage
 func GetCurrentCPUUsage() float64 {
 	currentPid := os.Getpid()
 	p, err := process.NewProcess(int32(currentPid))
 	if err != nil {
-		log.Printf("Fail to get CPU percent, %v\n", err)
+		logError("Fail to get CPU percent, %v\n", err)
 		return 0.0
 	}
 	percent, err := p.CPUPercent()
 	if err != nil {
-		log.Printf("Fail to get CPU percent, %v\n", err)
+		logError("Fail to get CPU percent, %v\n", err)
 		return 0.0
 	}
 	return percent / float64(runtime.NumCPU())
 }
+
+// processUsage samples the CPU and memory usage of the current process.
+type processUsage struct {
+	proc *process.Process
+}
+
+func newProcessUsage() *processUsage {
+	p, err := process.NewProcess(int32(os.Getpid()))
+	if err != nil {
+		logError("Fail to get the current process, %v\n", err)
+	}
+	return &processUsage{
+		proc: p,
+	}
+}
+
+// cpuPercent returns the CPU usage since the last call, in percent of all the CPUs, it's 0 for the first call.
+func (u *processUsage) cpuPercent() float64 {
+	if u.proc == nil {
+		return 0.0
+	}
+	percent, err := u.proc.Percent(0)
+	if err != nil {
+		logError("Fail to get CPU percent, %v\n", err)
+		return 0.0
+	}
+	return percent / float64(runtime.NumCPU())
+}
+
+// memoryUsage returns the resident set size in bytes.
+func (u *processUsage) memoryUsage() uint64 {
+	if u.proc == nil {
+		return 0
+	}
+	info, err := u.proc.MemoryInfo()
+	if err != nil {
+		logError("Fail to get memory usage, %v\n", err)
+		return 0
+	}
+	return info.RSS
+}
+
+// lockedSource is a rand.Source which is safe for concurrent use, like the source of the global math/rand.
+type lockedSource struct {
+	lock sync.Mutex
+	src  rand.Source
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.src.Seed(seed)
+}
+
+// newRand returns a *rand.Rand which is safe for concurrent use.
+func newRand(seed int64) *rand.Rand {
+	return rand.New(&lockedSource{src: rand.NewSource(seed)})
+}
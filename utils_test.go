@@ -1,6 +1,8 @@
 package boomer
 
 import (
+	"io/ioutil"
+	"net/http"
 	"os"
 	"regexp"
 	"testing"
@@ -90,3 +92,33 @@ func TestStartCPUProfile(t *testing.T) {
 		os.Remove("cpu.pprof")
 	}
 }
+
+func TestStartPprofServer(t *testing.T) {
+	addr, err := StartPprofServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get("http://" + addr.String() + "/debug/pprof/goroutine?debug=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !regexp.MustCompile(`goroutine profile: total \d+`).Match(body) {
+		t.Error("The goroutine profile should be served, got", resp.StatusCode, string(body))
+	}
+
+	if _, err := StartPprofServer(addr.String()); err == nil {
+		t.Error("The address in use should be refused")
+	}
+}
+
+func TestProcessUsage(t *testing.T) {
+	usage := newProcessUsage()
+	if usage.memoryUsage() == 0 {
+		t.Error("memory usage should be greater than 0")
+	}
+	if cpu := usage.cpuPercent(); cpu < 0 {
+		t.Error("CPU usage should not be negative, got", cpu)
+	}
+}
@@ -0,0 +1,308 @@
+package boomer
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var webStatusTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>boomer</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: right; }
+th:first-child, td:first-child, th:nth-child(2), td:nth-child(2) { text-align: left; }
+form { display: inline-block; margin-right: 1em; }
+input { width: 6em; }
+</style>
+<script>
+// reload the page every report interval, but not while the controls are being edited
+setTimeout(function reload() {
+	if (document.activeElement && document.activeElement.tagName == "INPUT") {
+		setTimeout(reload, 1000);
+	} else {
+		location.reload();
+	}
+}, {{.Refresh}} * 1000);
+</script>
+</head>
+<body>
+<h1>boomer</h1>
+<p>Updated at {{.UpdatedAt}}</p>
+{{if .Controllable}}<p>State: {{.State}}</p>
+<p>
+<form method="post" action="/start">
+Users <input type="number" name="users" min="1" value="{{.SpawnCount}}">
+Spawn rate <input type="number" name="spawn_rate" min="0.01" step="any" value="{{.SpawnRate}}">
+<button type="submit">{{if .Running}}Update{{else}}Start{{end}}</button>
+</form>
+{{if .Running}}<form method="post" action="/stop"><button type="submit">Stop</button></form>{{end}}
+</p>
+{{end}}<p>Users: {{.Users}} &nbsp; RPS: {{.RPS}} &nbsp; Failure rate: {{.FailureRate}}</p>
+<table>
+<tr><th>Type</th><th>Name</th><th># requests</th><th># fails</th><th>RPS</th><th>Average</th><th>Min</th><th>Max</th><th>50%</th><th>90%</th><th>95%</th><th>99%</th></tr>
+{{range .Rows}}<tr><td>{{.Method}}</td><td>{{.Name}}</td><td>{{.NumRequests}}</td><td>{{.NumFailures}}</td><td>{{.RPS}}</td><td>{{.Average}}</td><td>{{.Min}}</td><td>{{.Max}}</td><td>{{.P50}}</td><td>{{.P90}}</td><td>{{.P95}}</td><td>{{.P99}}</td></tr>
+{{end}}</table>
+{{range .Charts}}<div>{{.}}</div>
+{{end}}</body>
+</html>
+`))
+
+type webStatusRow struct {
+	Method      string
+	Name        string
+	NumRequests int64
+	NumFailures int64
+	RPS         int64
+	Average     string
+	Min         int64
+	Max         int64
+	P50         int64
+	P90         int64
+	P95         int64
+	P99         int64
+}
+
+type webStatusPage struct {
+	Refresh     int
+	UpdatedAt   string
+	Users       int64
+	RPS         int64
+	FailureRate string
+	Rows        []webStatusRow
+	Charts      []template.HTML
+
+	// the controls, they are filled when the page is rendered
+	Controllable bool
+	State        string
+	Running      bool
+	SpawnCount   int
+	SpawnRate    float64
+}
+
+// testController starts and stops the test from the web UI or the control API, it's implemented by localRunner.
+type testController interface {
+	getState() string
+	startTest(spawnCount int, spawnRate float64)
+	stopTest()
+}
+
+// webStatusOutput serves a status page of the last interval's stats and the charts since the test starts,
+// it's used in standalone mode. If it has a controller, the page has the controls to start and stop the test,
+// and to change the number of users.
+type webStatusOutput struct {
+	addr     string
+	server   *http.Server
+	listener net.Listener
+
+	// refresh is the interval to reload the page, in seconds.
+	refresh int
+
+	lock      sync.RWMutex
+	page      *webStatusPage
+	stats     *lifetimeStats
+	listening chan bool
+
+	// controller must be set before OnStart, the controls are hidden if it's nil.
+	controller testController
+	// spawnCount and spawnRate are the values of the last start, they are the defaults of the controls.
+	spawnCount int
+	spawnRate  float64
+}
+
+// newWebStatusOutput returns a webStatusOutput, whose page is reloaded every reportInterval, at least a second.
+func newWebStatusOutput(addr string, reportInterval time.Duration) *webStatusOutput {
+	refresh := int(reportInterval / time.Second)
+	if refresh < 1 {
+		refresh = 1
+	}
+	o := &webStatusOutput{
+		addr:      addr,
+		refresh:   refresh,
+		page:      &webStatusPage{Refresh: refresh},
+		stats:     newLifetimeStats(),
+		listening: make(chan bool),
+		spawnRate: 1,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", o.handleStatus)
+	mux.HandleFunc("/start", o.handleStart)
+	mux.HandleFunc("/stop", o.handleStop)
+	o.server = &http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+	return o
+}
+
+// Init binds the address, so boomer can fail fast if the address is in use.
+func (o *webStatusOutput) Init() error {
+	ln, err := net.Listen("tcp", o.addr)
+	if err != nil {
+		return fmt.Errorf("failed to start the web status page on %s, %v", o.addr, err)
+	}
+	o.listener = ln
+	return nil
+}
+
+// OnStart starts the http server.
+func (o *webStatusOutput) OnStart() {
+	defer close(o.listening)
+	if o.listener == nil {
+		if err := o.Init(); err != nil {
+			logError("%v", err)
+			return
+		}
+	}
+	logInfo("The web status page is serving on http://%s", o.listener.Addr().String())
+	go o.server.Serve(o.listener)
+}
+
+// OnEvent keeps the last interval's stats and adds them to the charts.
+func (o *webStatusOutput) OnEvent(data map[string]interface{}) {
+	page := newWebStatusPage(data, o.refresh)
+	// only the timeline is kept, the warm-up period is charted too
+	if total, ok := data["stats_total"].(map[string]interface{}); ok {
+		o.stats.addTimelinePoint(time.Now(), data, total)
+	}
+	page.Charts = timelineCharts(o.stats.timeline)
+	o.lock.Lock()
+	o.page = page
+	o.lock.Unlock()
+}
+
+// OnStop shuts down the http server.
+func (o *webStatusOutput) OnStop() {
+	<-o.listening
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	o.server.Shutdown(ctx)
+}
+
+func (o *webStatusOutput) handleStatus(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/" {
+		http.NotFound(w, req)
+		return
+	}
+	o.lock.RLock()
+	page := *o.page
+	page.SpawnCount = o.spawnCount
+	page.SpawnRate = o.spawnRate
+	o.lock.RUnlock()
+	if o.controller != nil {
+		page.Controllable = true
+		page.State = o.controller.getState()
+		page.Running = page.State == stateSpawning || page.State == stateRunning
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := webStatusTemplate.Execute(w, &page); err != nil {
+		logError("Failed to render the web status page, %v", err)
+	}
+}
+
+// handleStart starts the test with the users and the spawn rate of the form, or rescales the running test.
+func (o *webStatusOutput) handleStart(w http.ResponseWriter, req *http.Request) {
+	if !o.checkControl(w, req) {
+		return
+	}
+	spawnCount, err := strconv.Atoi(req.FormValue("users"))
+	if err != nil || spawnCount <= 0 {
+		http.Error(w, "Invalid users, expected a positive integer.", http.StatusBadRequest)
+		return
+	}
+	spawnRate, err := strconv.ParseFloat(req.FormValue("spawn_rate"), 64)
+	if err != nil || spawnRate <= 0 {
+		http.Error(w, "Invalid spawn rate, expected a positive number.", http.StatusBadRequest)
+		return
+	}
+	o.lock.Lock()
+	o.spawnCount = spawnCount
+	o.spawnRate = spawnRate
+	o.lock.Unlock()
+	logInfo("The test is started by the web UI with %d users at %.2f users/s", spawnCount, spawnRate)
+	o.controller.startTest(spawnCount, spawnRate)
+	http.Redirect(w, req, "/", http.StatusSeeOther)
+}
+
+// handleStop stops the users, boomer keeps running, so the test can be started again.
+func (o *webStatusOutput) handleStop(w http.ResponseWriter, req *http.Request) {
+	if !o.checkControl(w, req) {
+		return
+	}
+	logInfo("The test is stopped by the web UI")
+	o.controller.stopTest()
+	http.Redirect(w, req, "/", http.StatusSeeOther)
+}
+
+// checkControl responds an error if the request can't control the test.
+func (o *webStatusOutput) checkControl(w http.ResponseWriter, req *http.Request) bool {
+	if o.controller == nil {
+		http.NotFound(w, req)
+		return false
+	}
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed.", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+func newWebStatusPage(data map[string]interface{}, refresh int) *webStatusPage {
+	page := &webStatusPage{
+		Refresh:     refresh,
+		UpdatedAt:   time.Now().Format("2006/01/02 15:04:05"),
+		FailureRate: "0.00%",
+	}
+	if userCount, ok := data["user_count"].(int32); ok {
+		page.Users = int64(userCount)
+	}
+
+	if total, ok := data["stats_total"].(map[string]interface{}); ok {
+		numRequests := total["num_requests"].(int64)
+		numFailures := total["num_failures"].(int64)
+		page.RPS = getCurrentRps(numRequests, total["num_reqs_per_sec"].(map[int64]int64))
+		if numRequests != 0 {
+			page.FailureRate = strconv.FormatFloat(float64(numFailures)*100/float64(numRequests), 'f', 2, 64) + "%"
+		}
+	}
+
+	stats, _ := data["stats"].([]interface{})
+	for _, stat := range stats {
+		s := stat.(map[string]interface{})
+		numRequests := s["num_requests"].(int64)
+		responseTimes := s["response_times"].(map[int64]int64)
+		page.Rows = append(page.Rows, webStatusRow{
+			Method:      s["method"].(string),
+			Name:        s["name"].(string),
+			NumRequests: numRequests,
+			NumFailures: s["num_failures"].(int64),
+			RPS:         getCurrentRps(numRequests, s["num_reqs_per_sec"].(map[int64]int64)),
+			Average:     strconv.FormatFloat(getAvgResponseTime(numRequests, s["total_response_time"].(int64)), 'f', 2, 64),
+			Min:         s["min_response_time"].(int64),
+			Max:         s["max_response_time"].(int64),
+			P50:         getPercentileResponseTime(numRequests, responseTimes, 0.5),
+			P90:         getPercentileResponseTime(numRequests, responseTimes, 0.9),
+			P95:         getPercentileResponseTime(numRequests, responseTimes, 0.95),
+			P99:         getPercentileResponseTime(numRequests, responseTimes, 0.99),
+		})
+	}
+	sort.Slice(page.Rows, func(i, j int) bool {
+		if page.Rows[i].Name == page.Rows[j].Name {
+			return page.Rows[i].Method < page.Rows[j].Method
+		}
+		return page.Rows[i].Name < page.Rows[j].Name
+	})
+	return page
+}
@@ -0,0 +1,164 @@
+package boomer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebStatusOutput(t *testing.T) {
+	o := newWebStatusOutput("127.0.0.1:0", slaveReportInterval)
+	o.OnStart()
+
+	data := map[string]interface{}{}
+	stat := map[string]interface{}{}
+	data["stats"] = []interface{}{stat}
+	data["user_count"] = int32(10)
+	data["stats_total"] = map[string]interface{}{
+		"num_requests": int64(100),
+		"num_failures": int64(10),
+		"num_reqs_per_sec": map[int64]int64{
+			1: 50,
+			2: 50,
+		},
+	}
+
+	stat["name"] = "foo"
+	stat["method"] = "http"
+	stat["num_requests"] = int64(100)
+	stat["num_failures"] = int64(10)
+	stat["response_times"] = map[int64]int64{
+		10:  1,
+		100: 99,
+	}
+	stat["total_response_time"] = int64(9910)
+	stat["min_response_time"] = int64(10)
+	stat["max_response_time"] = int64(100)
+	stat["num_reqs_per_sec"] = map[int64]int64{
+		1: 50,
+		2: 50,
+	}
+	o.OnEvent(data)
+
+	recorder := httptest.NewRecorder()
+	o.handleStatus(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	body := recorder.Body.String()
+
+	if recorder.Code != http.StatusOK {
+		t.Error("Expected status code 200, got", recorder.Code)
+	}
+	if !strings.Contains(body, "Users: 10") {
+		t.Error("User count is not found in the status page")
+	}
+	if !strings.Contains(body, "RPS: 50") {
+		t.Error("RPS is not found in the status page")
+	}
+	if !strings.Contains(body, "Failure rate: 10.00%") {
+		t.Error("Failure rate is not found in the status page")
+	}
+	if !strings.Contains(body, "<td>foo</td>") {
+		t.Error("Request name is not found in the status page")
+	}
+
+	o.OnStop()
+}
+
+type fakeTestController struct {
+	state      string
+	spawnCount int
+	spawnRate  float64
+	stopped    bool
+}
+
+func (c *fakeTestController) getState() string {
+	return c.state
+}
+
+func (c *fakeTestController) startTest(spawnCount int, spawnRate float64) {
+	c.state = stateSpawning
+	c.spawnCount = spawnCount
+	c.spawnRate = spawnRate
+}
+
+func (c *fakeTestController) stopTest() {
+	c.state = stateStopped
+	c.stopped = true
+}
+
+func TestWebStatusOutputControls(t *testing.T) {
+	o := newWebStatusOutput("127.0.0.1:0", slaveReportInterval)
+	render := func() string {
+		recorder := httptest.NewRecorder()
+		o.server.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+		return recorder.Body.String()
+	}
+	post := func(path, form string) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		recorder := httptest.NewRecorder()
+		o.server.Handler.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	if strings.Contains(render(), "action=\"/start\"") {
+		t.Error("The controls should be hidden without a controller")
+	}
+	if code := post("/start", "users=10&spawn_rate=1"); code != http.StatusNotFound {
+		t.Error("Expected status code 404 without a controller, got", code)
+	}
+
+	controller := &fakeTestController{state: stateInit}
+	o.controller = controller
+	body := render()
+	if !strings.Contains(body, "State: ready") || !strings.Contains(body, ">Start</button>") || strings.Contains(body, ">Stop</button>") {
+		t.Error("The test should be startable, got", body)
+	}
+
+	if code := post("/start", "users=0&spawn_rate=1"); code != http.StatusBadRequest {
+		t.Error("Expected status code 400 for invalid users, got", code)
+	}
+	if code := post("/start", "users=10&spawn_rate=abc"); code != http.StatusBadRequest {
+		t.Error("Expected status code 400 for invalid spawn rate, got", code)
+	}
+	recorder := httptest.NewRecorder()
+	o.server.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/start", nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Error("Expected status code 405 for GET, got", recorder.Code)
+	}
+	if controller.state != stateInit {
+		t.Fatal("The test shouldn't be started by invalid requests")
+	}
+
+	if code := post("/start", "users=10&spawn_rate=2.5"); code != http.StatusSeeOther {
+		t.Error("Expected status code 303, got", code)
+	}
+	if controller.spawnCount != 10 || controller.spawnRate != 2.5 {
+		t.Error("The test should be started with 10 users at 2.5 users/s, got", controller.spawnCount, controller.spawnRate)
+	}
+	body = render()
+	if !strings.Contains(body, ">Update</button>") || !strings.Contains(body, ">Stop</button>") || !strings.Contains(body, `value="10"`) {
+		t.Error("The running test should be updatable and stoppable, got", body)
+	}
+
+	if code := post("/stop", ""); code != http.StatusSeeOther || !controller.stopped {
+		t.Error("The test should be stopped, got", code)
+	}
+}
+
+func TestWebStatusOutputCharts(t *testing.T) {
+	o := newWebStatusOutput("127.0.0.1:0", slaveReportInterval)
+	collector := NewStatsCollector()
+	for i := 0; i < 2; i++ {
+		collector.RecordSuccess("http", "foo", 10, 100)
+		data := collector.Report()
+		data["user_count"] = int32(10)
+		o.OnEvent(data)
+	}
+
+	recorder := httptest.NewRecorder()
+	o.handleStatus(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	if strings.Count(recorder.Body.String(), "<svg") != 3 {
+		t.Error("The charts should be shown")
+	}
+}
@@ -0,0 +1,270 @@
+// Package wsclient manages WebSocket connections for boomer, the connections and the messages are
+// recorded with RecordSuccess or RecordFailure.
+//
+// A connection can be pinned to a user, which is kept open across the iterations of the task, until
+// it's broken or the user is stopped.
+//
+//	client := wsclient.New("ws://localhost:8080/echo", wsclient.Config{ReadTimeout: 5 * time.Second})
+//	task := &boomer.Task{
+//		Name: "echo",
+//		FnWithContext: func(ctx context.Context) {
+//			conn, err := client.Conn(ctx)
+//			if err != nil {
+//				return
+//			}
+//			conn.RoundTrip("echo", websocket.TextMessage, []byte("hello"))
+//		},
+//	}
+package wsclient
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/myzhan/boomer"
+)
+
+const (
+	requestType = "ws"
+	// connectName is the name of the connections in the stats.
+	connectName = "connect"
+)
+
+// Recorder records the connections and the messages, *boomer.Boomer implements it.
+type Recorder interface {
+	RecordSuccess(requestType, name string, responseTime int64, responseLength int64)
+	RecordFailure(requestType, name string, responseTime int64, exception string)
+}
+
+// defaultRecorder records to the defaultBoomer of boomer.
+type defaultRecorder struct{}
+
+func (defaultRecorder) RecordSuccess(requestType, name string, responseTime int64, responseLength int64) {
+	boomer.RecordSuccess(requestType, name, responseTime, responseLength)
+}
+
+func (defaultRecorder) RecordFailure(requestType, name string, responseTime int64, exception string) {
+	boomer.RecordFailure(requestType, name, responseTime, exception)
+}
+
+// Config is used to create a Client, the zero value is ready to use.
+type Config struct {
+	// Recorder records the requests, the package-level boomer.RecordSuccess and boomer.RecordFailure are used if it's nil.
+	Recorder Recorder
+
+	// Header is sent with the handshake request, e.g. for authentication.
+	Header http.Header
+
+	// HandshakeTimeout limits the time of the handshake, it's 10 seconds if it's zero.
+	HandshakeTimeout time.Duration
+
+	// ReadTimeout limits the time to wait for a message in RoundTrip and Receive, zero means no timeout.
+	ReadTimeout time.Duration
+
+	// InsecureSkipVerify skips verifying the certificates of the servers.
+	InsecureSkipVerify bool
+}
+
+// ErrClosed is returned when a connection is used after it's closed or broken.
+var ErrClosed = errors.New("websocket connection is closed")
+
+// wsConn is the part of websocket.Conn used by Conn.
+type wsConn interface {
+	WriteMessage(messageType int, data []byte) error
+	ReadMessage() (messageType int, p []byte, err error)
+	SetReadDeadline(t time.Time) error
+	Close() error
+}
+
+// Client dials the WebSocket connections to a URL, it's safe for concurrent use by all the users.
+type Client struct {
+	readTimeout time.Duration
+	recorder    Recorder
+	dial        func(ctx context.Context) (wsConn, error)
+
+	lock sync.Mutex
+	// the pinned connections, keyed by the Done channel of the users' contexts
+	pinned map[<-chan struct{}]*Conn
+}
+
+// New returns a new Client, which dials the connections to url.
+func New(url string, config Config) *Client {
+	handshakeTimeout := config.HandshakeTimeout
+	if handshakeTimeout <= 0 {
+		handshakeTimeout = 10 * time.Second
+	}
+	dialer := &websocket.Dialer{
+		HandshakeTimeout: handshakeTimeout,
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: config.InsecureSkipVerify,
+		},
+	}
+
+	recorder := config.Recorder
+	if recorder == nil {
+		recorder = defaultRecorder{}
+	}
+	return &Client{
+		readTimeout: config.ReadTimeout,
+		recorder:    recorder,
+		dial: func(ctx context.Context) (wsConn, error) {
+			conn, _, err := dialer.DialContext(ctx, url, config.Header)
+			if err != nil {
+				return nil, err
+			}
+			return conn, nil
+		},
+		pinned: make(map[<-chan struct{}]*Conn),
+	}
+}
+
+// Dial opens a new connection, which is recorded as "connect". The caller should close it.
+func (c *Client) Dial(ctx context.Context) (*Conn, error) {
+	start := time.Now()
+	ws, err := c.dial(ctx)
+	if err != nil {
+		if ctx.Err() != context.Canceled {
+			c.recorder.RecordFailure(requestType, connectName, elapsedMillis(start), err.Error())
+		}
+		return nil, err
+	}
+	c.recorder.RecordSuccess(requestType, connectName, elapsedMillis(start), 0)
+	return &Conn{ws: ws, client: c}, nil
+}
+
+// Conn returns the connection pinned to the user of ctx, which must be the context passed to
+// Task.FnWithContext, or derived from it by context.WithValue. A new connection is dialed if the user
+// has no connection yet or the previous one is broken, it's closed when the user is stopped.
+func (c *Client) Conn(ctx context.Context) (*Conn, error) {
+	done := ctx.Done()
+	if done == nil {
+		return nil, errors.New("the context can't be canceled, use the context passed to Task.FnWithContext")
+	}
+
+	c.lock.Lock()
+	conn, ok := c.pinned[done]
+	c.lock.Unlock()
+	if ok && !conn.isClosed() {
+		return conn, nil
+	}
+
+	conn, err := c.Dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	c.pinned[done] = conn
+	c.lock.Unlock()
+
+	go func() {
+		<-done
+		c.lock.Lock()
+		if c.pinned[done] == conn {
+			delete(c.pinned, done)
+		}
+		c.lock.Unlock()
+		conn.Close()
+	}()
+	return conn, nil
+}
+
+// Conn is a WebSocket connection, it must be used by one goroutine at a time, like a user.
+// The connection is closed once an error occurs, the pinned connection is dialed again by Client.Conn.
+type Conn struct {
+	ws     wsConn
+	client *Client
+
+	lock   sync.Mutex
+	closed bool
+}
+
+// Send sends a message without waiting for any response, a failure is recorded under name.
+func (c *Conn) Send(name string, messageType int, data []byte) error {
+	if c.isClosed() {
+		return ErrClosed
+	}
+	start := time.Now()
+	if err := c.ws.WriteMessage(messageType, data); err != nil {
+		c.fail(name, start, err)
+		return err
+	}
+	return nil
+}
+
+// Receive waits for the next message, it's recorded under name, including the time to wait.
+func (c *Conn) Receive(name string) (messageType int, data []byte, err error) {
+	if c.isClosed() {
+		return 0, nil, ErrClosed
+	}
+	start := time.Now()
+	messageType, data, err = c.read()
+	if err != nil {
+		c.fail(name, start, err)
+		return 0, nil, err
+	}
+	c.client.recorder.RecordSuccess(requestType, name, elapsedMillis(start), int64(len(data)))
+	return messageType, data, nil
+}
+
+// RoundTrip sends a message and waits for the next message as the response, the round-trip latency is
+// recorded under name. It's suitable for request/response protocols, where the responses are in order.
+func (c *Conn) RoundTrip(name string, messageType int, data []byte) ([]byte, error) {
+	if c.isClosed() {
+		return nil, ErrClosed
+	}
+	start := time.Now()
+	if err := c.ws.WriteMessage(messageType, data); err != nil {
+		c.fail(name, start, err)
+		return nil, err
+	}
+	_, response, err := c.read()
+	if err != nil {
+		c.fail(name, start, err)
+		return nil, err
+	}
+	c.client.recorder.RecordSuccess(requestType, name, elapsedMillis(start), int64(len(response)))
+	return response, nil
+}
+
+func (c *Conn) read() (messageType int, data []byte, err error) {
+	if c.client.readTimeout > 0 {
+		c.ws.SetReadDeadline(time.Now().Add(c.client.readTimeout))
+	}
+	return c.ws.ReadMessage()
+}
+
+// fail records a failure and closes the broken connection. Nothing is recorded if the connection is
+// closed during the operation, e.g. the user is stopped.
+func (c *Conn) fail(name string, start time.Time, err error) {
+	if c.isClosed() {
+		return
+	}
+	c.client.recorder.RecordFailure(requestType, name, elapsedMillis(start), err.Error())
+	c.Close()
+}
+
+// Close closes the connection, it's safe to close a connection more than once.
+func (c *Conn) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.ws.Close()
+}
+
+func (c *Conn) isClosed() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.closed
+}
+
+func elapsedMillis(start time.Time) int64 {
+	return time.Since(start).Nanoseconds() / int64(time.Millisecond)
+}
@@ -0,0 +1,180 @@
+package wsclient
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordedRequest struct {
+	success   bool
+	name      string
+	length    int64
+	exception string
+}
+
+type fakeRecorder struct {
+	lock    sync.Mutex
+	records []recordedRequest
+}
+
+func (r *fakeRecorder) RecordSuccess(requestType, name string, responseTime int64, responseLength int64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.records = append(r.records, recordedRequest{true, name, responseLength, ""})
+}
+
+func (r *fakeRecorder) RecordFailure(requestType, name string, responseTime int64, exception string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.records = append(r.records, recordedRequest{false, name, 0, exception})
+}
+
+func (r *fakeRecorder) get() []recordedRequest {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]recordedRequest{}, r.records...)
+}
+
+// echoConn echoes the messages, or fails with err.
+type echoConn struct {
+	lock     sync.Mutex
+	messages [][]byte
+	err      error
+	closed   bool
+}
+
+func (c *echoConn) WriteMessage(messageType int, data []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	c.messages = append(c.messages, data)
+	return nil
+}
+
+func (c *echoConn) ReadMessage() (int, []byte, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.err != nil {
+		return 0, nil, c.err
+	}
+	data := c.messages[0]
+	c.messages = c.messages[1:]
+	return websocket.TextMessage, data, nil
+}
+
+func (c *echoConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *echoConn) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *echoConn) isClosed() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.closed
+}
+
+func newTestClient(recorder Recorder) (*Client, *[]*echoConn) {
+	client := New("ws://localhost:8080/echo", Config{Recorder: recorder})
+	conns := make([]*echoConn, 0)
+	client.dial = func(ctx context.Context) (wsConn, error) {
+		conn := &echoConn{}
+		conns = append(conns, conn)
+		return conn, nil
+	}
+	return client, &conns
+}
+
+func TestRoundTrip(t *testing.T) {
+	recorder := &fakeRecorder{}
+	client, _ := newTestClient(recorder)
+
+	conn, err := client.Dial(context.Background())
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	response, err := conn.RoundTrip("echo", websocket.TextMessage, []byte("hello"))
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(response))
+
+	assert.Nil(t, conn.Send("send", websocket.TextMessage, []byte("foo")))
+	_, data, err := conn.Receive("receive")
+	assert.Nil(t, err)
+	assert.Equal(t, "foo", string(data))
+
+	assert.Equal(t, []recordedRequest{
+		{true, "connect", 0, ""},
+		{true, "echo", 5, ""},
+		{true, "receive", 3, ""},
+	}, recorder.get())
+}
+
+func TestDialFailure(t *testing.T) {
+	recorder := &fakeRecorder{}
+	client, _ := newTestClient(recorder)
+	client.dial = func(ctx context.Context) (wsConn, error) {
+		return nil, errors.New("bad handshake")
+	}
+
+	_, err := client.Dial(context.Background())
+	assert.NotNil(t, err)
+	assert.Equal(t, []recordedRequest{{false, "connect", 0, "bad handshake"}}, recorder.get())
+}
+
+func TestPinnedConn(t *testing.T) {
+	recorder := &fakeRecorder{}
+	client, conns := newTestClient(recorder)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first, err := client.Conn(ctx)
+	assert.Nil(t, err)
+	second, err := client.Conn(context.WithValue(ctx, struct{}{}, "iteration"))
+	assert.Nil(t, err)
+	assert.True(t, first == second, "the connection should be pinned to the user")
+
+	// the broken connection is closed and dialed again
+	(*conns)[0].err = errors.New("connection reset by peer")
+	_, err = first.RoundTrip("echo", websocket.TextMessage, []byte("hello"))
+	assert.NotNil(t, err)
+	assert.True(t, (*conns)[0].isClosed())
+	_, err = first.RoundTrip("echo", websocket.TextMessage, []byte("hello"))
+	assert.Equal(t, ErrClosed, err)
+
+	third, err := client.Conn(ctx)
+	assert.Nil(t, err)
+	assert.True(t, third != first, "a broken connection should be dialed again")
+	assert.Len(t, *conns, 2)
+
+	// the connection is closed when the user is stopped
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+	assert.True(t, (*conns)[1].isClosed())
+	client.lock.Lock()
+	assert.Len(t, client.pinned, 0)
+	client.lock.Unlock()
+
+	assert.Equal(t, []recordedRequest{
+		{true, "connect", 0, ""},
+		{false, "echo", 0, "connection reset by peer"},
+		{true, "connect", 0, ""},
+	}, recorder.get())
+}
+
+func TestConnRequiresCancelableContext(t *testing.T) {
+	client, _ := newTestClient(&fakeRecorder{})
+	_, err := client.Conn(context.Background())
+	assert.NotNil(t, err)
+}